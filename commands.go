@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/configs"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/modules/backup"
+	"github.com/IlnurShafikov/wallet/modules/consistency"
+	wallet2 "github.com/IlnurShafikov/wallet/modules/wallet"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
+	"github.com/IlnurShafikov/wallet/services/security"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/transaction"
+	"github.com/rs/zerolog"
+	"io"
+	"os"
+)
+
+func runCommand(cfg *configs.Config, logger *zerolog.Logger, name string, args []string) error {
+	switch name {
+	case "serve":
+		return serve(cfg, logger)
+	case "migrate-keys":
+		return migrateKeys(cfg, logger, args)
+	case "pepper-report":
+		return pepperReport(cfg, logger)
+	case "backup":
+		return backupCommand(cfg, logger, args)
+	case "restore":
+		return restoreCommand(cfg, logger, args)
+	case "check":
+		return checkCommand(cfg, logger, args)
+	default:
+		return fmt.Errorf("unknown command: %s", name)
+	}
+}
+
+// migrateKeys - переносит ключи redis без префикса типа в схему <тип>:<оператор>:<id>
+func migrateKeys(cfg *configs.Config, logger *zerolog.Logger, args []string) error {
+	flags := flag.NewFlagSet("migrate-keys", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only report keys that would be renamed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	tenants, err := tenant.Load(cfg.TenantsFile)
+	if err != nil {
+		return fmt.Errorf("failed load tenants: %w", err)
+	}
+
+	clientRedis, err := newRedisClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer clientRedis.Close()
+
+	result, err := keyschema.Migrate(context.Background(), clientRedis, redisKeySchema(cfg), tenants.IDs(), *dryRun)
+	if err != nil {
+		return fmt.Errorf("migrate keys: %w", err)
+	}
+
+	for _, key := range result.Conflicts {
+		logger.Warn().Str("key", key).Msg("target key already exists, key left unchanged")
+	}
+
+	logger.Info().
+		Bool("dryRun", *dryRun).
+		Int("wallets", result.Wallets).
+		Int("users", result.Users).
+		Int("rounds", result.Rounds).
+		Int("skipped", result.Skipped).
+		Int("conflicts", len(result.Conflicts)).
+		Msg("migrate keys finished")
+
+	return nil
+}
+
+// pepperReport - сколько пользователей еще используют устаревшие версии перца
+func pepperReport(cfg *configs.Config, logger *zerolog.Logger) error {
+	tenants, err := tenant.Load(cfg.TenantsFile)
+	if err != nil {
+		return fmt.Errorf("failed load tenants: %w", err)
+	}
+
+	comp, err := makeComponents(cfg)
+	if err != nil {
+		return fmt.Errorf("failed create components: %w", err)
+	}
+	defer comp.close()
+
+	for _, tenantID := range tenants.IDs() {
+		ctx := tenant.WithTenant(context.Background(), tenantID)
+		versions := make(map[int]int)
+		outdated := 0
+
+		err = comp.userRepository.Iterate(ctx, func(user models.User) error {
+			version, _, err := security.PepperVersion(user.Password)
+			if err != nil {
+				version = -1
+			}
+
+			versions[version]++
+			if version != cfg.PepperVersion {
+				outdated++
+			}
+
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("iterate users: %w", err)
+		}
+
+		for version, count := range versions {
+			logger.Info().
+				Str("tenant", string(tenantID)).
+				Int("pepperVersion", version).
+				Int("users", count).
+				Msg("pepper version usage")
+		}
+
+		logger.Info().
+			Str("tenant", string(tenantID)).
+			Int("currentVersion", cfg.PepperVersion).
+			Int("outdated", outdated).
+			Msg("pepper report")
+	}
+
+	return nil
+}
+
+// backupSource - хранилища из конфигурации, умеющие перечислять свои записи
+func backupSource(comp *components) (backup.Source, error) {
+	wallets, ok := comp.walletRepository.(wallet2.Iterator)
+	if !ok {
+		return backup.Source{}, errors.New("wallet storage does not support iteration")
+	}
+
+	rounds, ok := comp.transactionRepository.(transaction.Iterator)
+	if !ok {
+		return backup.Source{}, errors.New("round storage does not support iteration")
+	}
+
+	return backup.Source{Users: comp.userRepository, Wallets: wallets, Rounds: rounds}, nil
+}
+
+// backupCommand - выгружает пользователей, кошельки и раунды всех операторов в NDJSON.
+// С архивом в дамп попадают и перенесенные в него раунды
+func backupCommand(cfg *configs.Config, logger *zerolog.Logger, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := flags.String("out", "-", "dump file, - for stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	tenants, err := tenant.Load(cfg.TenantsFile)
+	if err != nil {
+		return fmt.Errorf("failed load tenants: %w", err)
+	}
+
+	comp, err := makeComponents(cfg)
+	if err != nil {
+		return fmt.Errorf("failed create components: %w", err)
+	}
+	defer comp.close()
+
+	if cfg.Archive.Dir != "" {
+		if _, _, err = withArchive(cfg, comp); err != nil {
+			return err
+		}
+	}
+
+	source, err := backupSource(comp)
+	if err != nil {
+		return err
+	}
+
+	if cfg.StorageType == "in_memory" && cfg.WAL.Dir == "" {
+		logger.Warn().Msg("in_memory storage keeps users only until restart, dump contains what survived")
+	}
+
+	var (
+		w    io.Writer = os.Stdout
+		file *os.File
+	)
+
+	if *out != "-" {
+		file, err = os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+		if err != nil {
+			return fmt.Errorf("create dump: %w", err)
+		}
+		defer file.Close()
+
+		w = file
+	}
+
+	footer, err := backup.Dump(context.Background(), w, source, cfg.StorageType, tenants.IDs())
+	if err == nil && file != nil {
+		err = file.Sync()
+	}
+
+	if err != nil {
+		if file != nil {
+			_ = os.Remove(*out)
+		}
+
+		return fmt.Errorf("backup: %w", err)
+	}
+
+	for tenantID, counts := range footer.Counts {
+		logger.Info().
+			Str("tenant", string(tenantID)).
+			Int("users", counts.Users).
+			Int("wallets", counts.Wallets).
+			Int("rounds", counts.Rounds).
+			Msg("tenant dumped")
+	}
+
+	logger.Info().Str("sha256", footer.SHA256).Msg("backup finished")
+
+	return nil
+}
+
+// restoreCommand - проверяет дамп целиком и только потом пишет его в хранилище
+// из конфигурации. Восстановление идет только в пустое хранилище: прерванное
+// восстановление не продолжается, хранилище нужно очистить и запустить заново
+func restoreCommand(cfg *configs.Config, logger *zerolog.Logger, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	in := flags.String("in", "", "dump file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *in == "" {
+		return errors.New("dump file is required: -in")
+	}
+
+	if cfg.StorageType == "in_memory" && cfg.WAL.Dir == "" {
+		return errors.New("in_memory storage without wal does not keep data after exit, set WAL_DIR " +
+			"or restore into redis, sqlite or postgres")
+	}
+
+	tenants, err := tenant.Load(cfg.TenantsFile)
+	if err != nil {
+		return fmt.Errorf("failed load tenants: %w", err)
+	}
+
+	file, err := os.Open(*in)
+	if err != nil {
+		return fmt.Errorf("open dump: %w", err)
+	}
+	defer file.Close()
+
+	header, footer, err := backup.Verify(file)
+	if err != nil {
+		return fmt.Errorf("verify dump: %w", err)
+	}
+
+	for tenantID := range footer.Counts {
+		if _, ok := tenants.Get(tenantID); !ok {
+			logger.Warn().Str("tenant", string(tenantID)).Msg("tenant from dump is not configured, its data is unreachable")
+		}
+	}
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek dump: %w", err)
+	}
+
+	comp, err := makeComponents(cfg)
+	if err != nil {
+		return fmt.Errorf("failed create components: %w", err)
+	}
+	defer comp.close()
+
+	// архивные раунды тоже занимают идентификаторы
+	if cfg.Archive.Dir != "" {
+		if _, _, err = withArchive(cfg, comp); err != nil {
+			return err
+		}
+	}
+
+	source, err := backupSource(comp)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	for tenantID := range footer.Counts {
+		stored, err := backup.Count(tenant.WithTenant(ctx, tenantID), source)
+		if err != nil {
+			return err
+		}
+
+		if stored != (backup.Counts{}) {
+			return fmt.Errorf("tenant %s: storage is not empty (%+v), restore only into empty storage", tenantID, stored)
+		}
+	}
+
+	restored, err := backup.Restore(ctx, file, backup.Target{
+		Users:   comp.userRepository,
+		Wallets: comp.walletRepository,
+		Rounds:  comp.transactionRepository,
+	})
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+
+	// хранилище было пустым, поэтому в нем ровно то, что в дампе
+	for tenantID, expected := range footer.Counts {
+		stored, err := backup.Count(tenant.WithTenant(ctx, tenantID), source)
+		if err != nil {
+			return err
+		}
+
+		logger.Info().
+			Str("tenant", string(tenantID)).
+			Int("users", restored[tenantID].Users).
+			Int("wallets", restored[tenantID].Wallets).
+			Int("rounds", restored[tenantID].Rounds).
+			Msg("tenant restored")
+
+		if stored != expected {
+			return fmt.Errorf("tenant %s: storage has %+v after restore, dump has %+v", tenantID, stored, expected)
+		}
+	}
+
+	logger.Info().
+		Str("source", header.Source).
+		Time("created", header.Created).
+		Str("sha256", footer.SHA256).
+		Msg("restore finished")
+
+	return nil
+}
+
+// checkCommand - сверяет кошельки с раундами всех операторов, с -fix исправляет
+// безопасные нарушения. Ошибка, если остались неисправленные нарушения
+func checkCommand(cfg *configs.Config, logger *zerolog.Logger, args []string) error {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	fix := flags.Bool("fix", false, "finish rounds that already have a win")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	tenants, err := tenant.Load(cfg.TenantsFile)
+	if err != nil {
+		return fmt.Errorf("failed load tenants: %w", err)
+	}
+
+	comp, err := makeComponents(cfg)
+	if err != nil {
+		return fmt.Errorf("failed create components: %w", err)
+	}
+	defer comp.close()
+
+	if cfg.Archive.Dir != "" {
+		if _, _, err = withArchive(cfg, comp); err != nil {
+			return err
+		}
+	}
+
+	checker, err := newChecker(cfg, comp, tenants)
+	if err != nil {
+		return err
+	}
+
+	unfixed := 0
+	for _, tenantID := range tenants.IDs() {
+		report, err := checker.Check(tenant.WithTenant(context.Background(), tenantID), *fix)
+		if err != nil {
+			return fmt.Errorf("check tenant %s: %w", tenantID, err)
+		}
+
+		for _, issue := range report.Issues {
+			event := logger.Warn().
+				Str("tenant", string(tenantID)).
+				Str("kind", string(issue.Kind)).
+				Int("userID", int(issue.UserID)).
+				Bool("fixed", issue.Fixed)
+
+			if issue.RoundID != nil {
+				event = event.Str("roundID", issue.RoundID.String())
+			}
+
+			if issue.Kind == consistency.IssueBalanceMismatch {
+				event = event.Int("balance", int(issue.Balance)).Int("expected", int(issue.Expected))
+			}
+
+			event.Msg("consistency issue")
+		}
+
+		if !report.BalancesChecked {
+			logger.Warn().
+				Str("tenant", string(tenantID)).
+				Msg("finished rounds expire without archive, balances are not checked against history")
+		}
+
+		logger.Info().
+			Str("tenant", string(tenantID)).
+			Int("wallets", report.Wallets).
+			Int("rounds", report.Rounds).
+			Bool("balancesChecked", report.BalancesChecked).
+			Int("issues", len(report.Issues)).
+			Int("unfixed", report.Unfixed()).
+			Msg("tenant checked")
+
+		unfixed += report.Unfixed()
+	}
+
+	if unfixed > 0 {
+		return fmt.Errorf("consistency check found %d unfixed issues", unfixed)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package configs
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParse_FinishedRoundTTL(t *testing.T) {
+	cfg, err := Parse()
+	require.NoError(t, err)
+	assert.Zero(t, cfg.TTL.FinishedRound)
+
+	t.Setenv("ARCHIVE_DIR", t.TempDir())
+
+	cfg, err = Parse()
+	require.NoError(t, err)
+	assert.Equal(t, archivedRoundTTL, cfg.TTL.FinishedRound)
+
+	t.Setenv("TTL_FINISHED_ROUND", "0")
+
+	cfg, err = Parse()
+	require.NoError(t, err)
+	assert.Zero(t, cfg.TTL.FinishedRound)
+
+	t.Setenv("TTL_FINISHED_ROUND", "48h")
+
+	cfg, err = Parse()
+	require.NoError(t, err)
+	assert.Equal(t, 48*time.Hour, cfg.TTL.FinishedRound)
+}
+
+// старый общий срок не игнорируется молча
+func TestParse_LifeTime(t *testing.T) {
+	t.Setenv("LIFE_TIME", "24h")
+
+	_, err := Parse()
+	assert.ErrorContains(t, err, "LIFE_TIME")
+}
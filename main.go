@@ -2,19 +2,44 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/IlnurShafikov/wallet/configs"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/modules/consistency"
+	"github.com/IlnurShafikov/wallet/modules/privacy"
 	"github.com/IlnurShafikov/wallet/modules/users"
 	"github.com/IlnurShafikov/wallet/modules/users/repositories"
 	wallet2 "github.com/IlnurShafikov/wallet/modules/wallet"
+	"github.com/IlnurShafikov/wallet/services/admin"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/archive"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
+	"github.com/IlnurShafikov/wallet/services/loginhistory"
+	"github.com/IlnurShafikov/wallet/services/notify"
+	"github.com/IlnurShafikov/wallet/services/onetime"
+	"github.com/IlnurShafikov/wallet/services/passwordpolicy"
+	"github.com/IlnurShafikov/wallet/services/postgres"
 	"github.com/IlnurShafikov/wallet/services/security"
+	"github.com/IlnurShafikov/wallet/services/session"
+	"github.com/IlnurShafikov/wallet/services/signature"
+	"github.com/IlnurShafikov/wallet/services/sqlite"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/throttle"
 	"github.com/IlnurShafikov/wallet/services/transaction"
+	"github.com/IlnurShafikov/wallet/services/wal"
 	"github.com/go-redis/redis/v8"
 	"github.com/gofiber/fiber/v2"
 	"github.com/rs/zerolog"
+	"io"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 )
 
@@ -22,6 +47,34 @@ type components struct {
 	userRepository        users.Repository
 	walletRepository      wallet2.Repository
 	transactionRepository transaction.Repository
+	roundLister           transaction.Lister
+	nonceRepository       signature.Repository
+	throttleRepository    throttle.Repository
+	sessionRepository     session.Repository
+	resetRepository       onetime.Repository
+	challengeRepository   onetime.Repository
+	loginRepository       loginhistory.Repository
+	// closers - закрываются после остановки сервера
+	closers []io.Closer
+}
+
+// closerFunc - функция остановки как io.Closer
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// close - закрывает хранилища в обратном порядке открытия
+func (c *components) close() error {
+	var errs []error
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		if err := c.closers[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
 const (
@@ -29,11 +82,35 @@ const (
 )
 
 func errorHandler(fCtx *fiber.Ctx, err error) error {
-	return fCtx.Status(http.StatusBadRequest).
+	status := http.StatusBadRequest
+	code := ""
+
+	retryAfter := 0
+	var fields []apierror.FieldError
+
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		status = apiErr.Status
+		code = apiErr.Code
+		retryAfter = int(math.Ceil(apiErr.RetryAfter.Seconds()))
+		fields = apiErr.Fields
+	}
+
+	if retryAfter > 0 {
+		fCtx.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	}
+
+	return fCtx.Status(status).
 		JSON(struct {
-			Message string `json:"message"`
+			Message    string                `json:"message"`
+			Code       string                `json:"code,omitempty"`
+			RetryAfter int                   `json:"retry_after,omitempty"`
+			Fields     []apierror.FieldError `json:"fields,omitempty"`
 		}{
-			Message: err.Error(),
+			Message:    err.Error(),
+			Code:       code,
+			RetryAfter: retryAfter,
+			Fields:     fields,
 		})
 }
 
@@ -67,13 +144,44 @@ func run() error {
 		Logger().
 		Level(loggerLevel)
 
+	if len(os.Args) > 1 {
+		return runCommand(cfg, &logger, os.Args[1], os.Args[2:])
+	}
+
+	return serve(cfg, &logger)
+}
+
+func serve(cfg *configs.Config, logger *zerolog.Logger) error {
 	comp, err := makeComponents(cfg)
 	if err != nil {
 		return fmt.Errorf("failed create components: %w", err)
 	}
+	defer func() {
+		if err := comp.close(); err != nil {
+			logger.Error().Err(err).Msg("failed close storage")
+		}
+	}()
+
+	if expiring := cfg.TTL.ExpiringMoney(); cfg.StorageType == "redis" && len(expiring) > 0 {
+		logger.Warn().Strs("entities", expiring).Msg("entities holding money expire in redis and will be lost after ttl")
+	}
+
+	tenants, err := tenant.Load(cfg.TenantsFile)
+	if err != nil {
+		return fmt.Errorf("failed load tenants: %w", err)
+	}
 
-	hasherPassword := security.NewBcryptHashing(cfg.Secret)
-	walletTR := wallet2.NewWallet(comp.walletRepository, comp.transactionRepository, &logger)
+	if cfg.Archive.Dir != "" {
+		if err = startArchive(cfg, comp, tenants, logger); err != nil {
+			return fmt.Errorf("failed start archive: %w", err)
+		}
+	}
+
+	hasherPassword, err := newPasswordManager(cfg)
+	if err != nil {
+		return err
+	}
+	walletTR := wallet2.NewWallet(comp.walletRepository, comp.transactionRepository, tenants, logger)
 
 	fApp := fiber.New(fiber.Config{
 		ReadTimeout:  5 * time.Second,
@@ -82,12 +190,94 @@ func run() error {
 		ErrorHandler: errorHandler,
 		AppName:      appName,
 	})
+	fApp.Use(tenant.Middleware(tenants))
+
+	var providerAuth []fiber.Handler
+	if cfg.Signature.Enabled {
+		verifier := signature.NewVerifier(cfg.Signature.Secrets, tenants, comp.nonceRepository, cfg.Signature.MaxSkew)
+		providerAuth = append(providerAuth, verifier.Middleware())
+	}
+
+	limiter := throttle.NewLimiter(comp.throttleRepository, throttle.Policy{
+		MaxFailures:   cfg.Throttle.MaxFailures,
+		MaxIPFailures: cfg.Throttle.MaxIPFailures,
+		BaseDelay:     cfg.Throttle.BaseDelay,
+		MaxDelay:      cfg.Throttle.MaxDelay,
+		LockDuration:  cfg.Throttle.LockDuration,
+	})
+
+	userService := users.NewUserService(comp.userRepository, hasherPassword, limiter, logger)
+	policy := passwordPolicy(cfg)
+	sessions := session.NewManager(comp.sessionRepository, cfg.SessionTTL)
+
+	wallet2.RegisterWalletHandler(fApp, walletTR, userService, logger, providerAuth...)
+	passwords := users.NewPasswords(
+		comp.userRepository,
+		hasherPassword,
+		limiter,
+		limiter.Scoped("reset"),
+		sessions,
+		comp.resetRepository,
+		newNotifier(cfg, logger),
+		cfg.PasswordResetTTL,
+		policy,
+	)
+
+	twoFactor := users.NewTwoFactor(comp.userRepository, comp.challengeRepository, cfg.TwoFactor.Issuer, cfg.TwoFactor.ChallengeTTL)
+
+	loginHistory := users.NewLoginHistory(comp.userRepository, comp.loginRepository)
+
+	users.RegisterAuthorizationHandler(fApp, userService, twoFactor, sessions, loginHistory, logger)
+	users.RegisterTwoFactorHandler(fApp, twoFactor, sessions, logger)
+	users.RegisterKYCHandler(fApp, userService, sessions, logger)
+	users.RegisterSessionHandler(fApp, loginHistory, sessions, logger)
 
-	userService := users.NewUserService(comp.userRepository, hasherPassword)
-	wallet2.RegisterWalletHandler(fApp, walletTR, &logger)
-	users.RegisterAuthorizationHandler(fApp, userService, &logger)
-	users.RegisterRegistrationHandler(fApp, comp.userRepository, hasherPassword, &logger)
-	transaction.RegisterTransactionHandler(fApp, comp.transactionRepository, &logger)
+	depositLimits := wallet2.DepositLimits{
+		Period:  cfg.DepositLimitPeriod,
+		Amounts: make(map[models.KYCStatus]models.Amount, len(cfg.KYCDepositLimits)),
+	}
+	for status, limit := range cfg.KYCDepositLimits {
+		depositLimits.Amounts[models.KYCStatus(status)] = models.Amount(limit)
+	}
+
+	if len(providerAuth) == 0 {
+		logger.Warn().Msg("request signature is disabled, deposits are not available")
+	}
+
+	payments := wallet2.NewPayments(comp.walletRepository, comp.transactionRepository, comp.roundLister, userService, depositLimits)
+	wallet2.RegisterPaymentHandler(fApp, payments, logger,
+		[]fiber.Handler{session.Middleware(sessions), session.Owner("userID")}, providerAuth)
+	users.RegisterPasswordHandler(fApp, passwords, sessions, logger)
+	users.RegisterProfileHandler(fApp, userService, sessions, logger)
+	users.RegisterAdminHandler(fApp, userService, sessions, loginHistory, logger, admin.Middleware(cfg.AdminToken))
+
+	privacyService := privacy.NewService(
+		comp.userRepository,
+		comp.walletRepository,
+		comp.roundLister,
+		comp.loginRepository,
+		sessions,
+	)
+	privacy.RegisterPrivacyHandler(fApp, privacyService, sessions, logger, admin.Middleware(cfg.AdminToken))
+
+	provisioner := wallet2.NewProvisioner(comp.walletRepository, comp.transactionRepository, tenants, walletPolicy(cfg))
+	users.RegisterRegistrationHandler(fApp, comp.userRepository, provisioner, hasherPassword, policy, logger)
+	transaction.RegisterTransactionHandler(fApp, comp.transactionRepository, logger)
+
+	checker, err := newChecker(cfg, comp, tenants)
+	if err != nil {
+		return err
+	}
+	consistency.RegisterConsistencyHandler(fApp, checker, logger, admin.Middleware(cfg.AdminToken))
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	go func() {
+		<-stop
+		_ = fApp.Shutdown()
+	}()
 
 	err = fApp.Listen(cfg.GetServerPort())
 	if err != nil {
@@ -97,47 +287,417 @@ func run() error {
 	return nil
 }
 
+// startArchive - раунды читаются с откатом к архиву, рассчитанные раунды
+// переносятся в архив в фоне, пока не закрыты comp
+func startArchive(cfg *configs.Config, comp *components, tenants *tenant.Registry, logger *zerolog.Logger) error {
+	hot, store, err := withArchive(cfg, comp)
+	if err != nil {
+		return err
+	}
+
+	archiver := archive.NewArchiver(hot, store, tenants.IDs(), cfg.Archive.MinAge, cfg.Archive.BatchSize, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		archiver.Run(ctx, cfg.Archive.Interval)
+	}()
+
+	// архиватор останавливается раньше, чем закрывается архив
+	comp.closers = append(comp.closers, closerFunc(func() error {
+		cancel()
+		<-done
+
+		return nil
+	}))
+
+	return nil
+}
+
+// withArchive - подменяет хранилище раундов на чтение с откатом к архиву,
+// возвращает исходное хранилище для переноса раундов. Архив закрывается вместе с comp
+func withArchive(cfg *configs.Config, comp *components) (transaction.Archivable, *archive.Archive, error) {
+	hot, ok := comp.transactionRepository.(transaction.Archivable)
+	if !ok {
+		return nil, nil, fmt.Errorf("storage %s does not support archive", cfg.StorageType)
+	}
+
+	store, err := archive.Open(cfg.Archive.Dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	comp.closers = append(comp.closers, store)
+
+	repo := archive.NewRepository(comp.transactionRepository, comp.roundLister, store)
+	comp.transactionRepository = repo
+	comp.roundLister = repo
+
+	return hot, store, nil
+}
+
+// newChecker - сверка кошельков с раундами, с архивом раунды читаются и из него.
+// Без архива рассчитанные раунды в redis истекают, и баланс с историей не сверяется
+func newChecker(cfg *configs.Config, comp *components, tenants *tenant.Registry) (*consistency.Checker, error) {
+	wallets, ok := comp.walletRepository.(wallet2.Iterator)
+	if !ok {
+		return nil, errors.New("wallet storage does not support iteration")
+	}
+
+	rounds, ok := comp.transactionRepository.(interface {
+		transaction.Repository
+		transaction.Iterator
+	})
+	if !ok {
+		return nil, errors.New("round storage does not support iteration")
+	}
+
+	fullHistory := cfg.Archive.Dir != "" || cfg.StorageType != "redis" || cfg.TTL.FinishedRound == 0
+
+	return consistency.NewChecker(wallets, rounds, tenants, walletPolicy(cfg), fullHistory), nil
+}
+
+// walletPolicy - политика кошелька для операторов без своей
+func walletPolicy(cfg *configs.Config) tenant.WalletPolicy {
+	return tenant.WalletPolicy{
+		InitialBalance: models.Balance(cfg.Wallet.InitialBalance),
+		WelcomeBonus:   models.Balance(cfg.Wallet.WelcomeBonus),
+	}
+}
+
+// newPasswordManager - новые пароли хешируются выбранным алгоритмом и текущим перцем,
+// хеши другого алгоритма или перца пересчитываются при входе
+func newPasswordManager(cfg *configs.Config) (*security.Peppered, error) {
+	peppers, err := cfg.PepperSecrets()
+	if err != nil {
+		return nil, err
+	}
+
+	managers := make(map[int]security.PasswordManager, len(peppers))
+	for version, secret := range peppers {
+		managers[version] = newPasswordChain(cfg.PasswordHasher, secret)
+	}
+
+	return security.NewPeppered(cfg.PepperVersion, managers)
+}
+
+func newPasswordChain(hasher, secret string) *security.Chain {
+	bcryptHashing := security.NewBcryptHashing(secret)
+	argon2idHashing := security.NewArgon2idHashing(secret, security.DefaultArgon2Params())
+
+	if hasher == "bcrypt" {
+		return security.NewChain(bcryptHashing, argon2idHashing)
+	}
+
+	return security.NewChain(argon2idHashing, bcryptHashing)
+}
+
+func passwordPolicy(cfg *configs.Config) passwordpolicy.Policy {
+	return passwordpolicy.Policy{
+		MinLength:      cfg.PasswordPolicy.MinLength,
+		MaxLength:      cfg.PasswordPolicy.MaxLength,
+		RequireLower:   cfg.PasswordPolicy.RequireLower,
+		RequireUpper:   cfg.PasswordPolicy.RequireUpper,
+		RequireDigit:   cfg.PasswordPolicy.RequireDigit,
+		RequireSymbol:  cfg.PasswordPolicy.RequireSymbol,
+		RejectCommon:   cfg.PasswordPolicy.RejectCommon,
+		LoginMinLength: cfg.PasswordPolicy.LoginMinLength,
+		LoginMaxLength: cfg.PasswordPolicy.LoginMaxLength,
+	}
+}
+
+func newNotifier(cfg *configs.Config, logger *zerolog.Logger) notify.Notifier {
+	if cfg.Notify.Type == "file" {
+		return notify.NewFileNotifier(cfg.Notify.File)
+	}
+
+	return notify.NewLogNotifier(logger)
+}
+
 func makeComponents(cfg *configs.Config) (*components, error) {
 	switch cfg.StorageType {
 	case "in_memory":
-		return inMemoryComponent()
+		if cfg.WAL.Dir != "" {
+			return durableComponent(cfg)
+		}
+
+		return inMemoryComponent(cfg)
 	case "redis":
 		return redisComponent(cfg)
+	case "sqlite":
+		return sqliteComponent(cfg)
+	case "postgres":
+		return postgresComponent(cfg)
 	default:
 		return nil, fmt.Errorf("unknow storage type: %s", cfg.StorageType)
 	}
 }
 
-func redisComponent(cfg *configs.Config) (*components, error) {
-	clientRedis := redis.NewClient(&redis.Options{
-		Addr:         cfg.Redis.Address,
-		DialTimeout:  2 * time.Second,
-		ReadTimeout:  2 * time.Second,
-		WriteTimeout: 2 * time.Second,
-	})
+func newRedisClient(cfg *configs.Config) (redis.UniversalClient, error) {
+	opts := cfg.Redis
+
+	var tlsConfig *tls.Config
+	if opts.TLS {
+		tlsConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ServerName: opts.TLSServerName,
+		}
+	}
+
+	var clientRedis redis.UniversalClient
+	switch opts.Mode {
+	case "sentinel":
+		clientRedis = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       opts.MasterName,
+			SentinelAddrs:    opts.Addresses,
+			SentinelPassword: opts.SentinelPassword,
+			Username:         opts.Username,
+			Password:         opts.Password,
+			DB:               opts.DB,
+			TLSConfig:        tlsConfig,
+			PoolSize:         opts.PoolSize,
+			MinIdleConns:     opts.MinIdleConns,
+			DialTimeout:      opts.DialTimeout,
+			ReadTimeout:      opts.ReadTimeout,
+			WriteTimeout:     opts.WriteTimeout,
+		})
+	case "cluster":
+		clientRedis = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        opts.Addresses,
+			Username:     opts.Username,
+			Password:     opts.Password,
+			TLSConfig:    tlsConfig,
+			PoolSize:     opts.PoolSize,
+			MinIdleConns: opts.MinIdleConns,
+			DialTimeout:  opts.DialTimeout,
+			ReadTimeout:  opts.ReadTimeout,
+			WriteTimeout: opts.WriteTimeout,
+		})
+	default:
+		clientRedis = redis.NewClient(&redis.Options{
+			Addr:         opts.Address,
+			Username:     opts.Username,
+			Password:     opts.Password,
+			DB:           opts.DB,
+			TLSConfig:    tlsConfig,
+			PoolSize:     opts.PoolSize,
+			MinIdleConns: opts.MinIdleConns,
+			DialTimeout:  opts.DialTimeout,
+			ReadTimeout:  opts.ReadTimeout,
+			WriteTimeout: opts.WriteTimeout,
+		})
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	err := clientRedis.Ping(ctx).Err()
 	if err != nil {
+		_ = clientRedis.Close()
 		return nil, fmt.Errorf("redis.Ping:%w", err)
 	}
 
+	return clientRedis, nil
+}
+
+func redisKeySchema(cfg *configs.Config) keyschema.Schema {
+	return keyschema.Schema{
+		HashTags:       cfg.Redis.Mode == "cluster",
+		Wallet:         cfg.Redis.Keys.Wallet,
+		User:           cfg.Redis.Keys.User,
+		Round:          cfg.Redis.Keys.Round,
+		UserIndex:      cfg.Redis.Keys.UserIndex,
+		Sequence:       cfg.Redis.Keys.Sequence,
+		Session:        cfg.Redis.Keys.Session,
+		UserSessions:   cfg.Redis.Keys.UserSessions,
+		Throttle:       cfg.Redis.Keys.Throttle,
+		Nonce:          cfg.Redis.Keys.Nonce,
+		PasswordReset:  cfg.Redis.Keys.PasswordReset,
+		LoginChallenge: cfg.Redis.Keys.LoginChallenge,
+	}
+}
+
+func redisComponent(cfg *configs.Config) (*components, error) {
+	clientRedis, err := newRedisClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := redisKeySchema(cfg)
+
+	transactions := transaction.NewRedisRepository(clientRedis, keys, transaction.TTL{
+		Open:     cfg.TTL.OpenRound,
+		Finished: cfg.TTL.FinishedRound,
+	})
+
 	resp := &components{
-		userRepository:        repositories.NewRedisRepository(clientRedis, cfg.ExpiredAt),
-		walletRepository:      wallet2.NewRedisRepository(clientRedis, cfg.ExpiredAt),
-		transactionRepository: transaction.NewRedisRepository(clientRedis, cfg.ExpiredAt),
+		userRepository:        repositories.NewRedisRepository(clientRedis, keys, cfg.TTL.User),
+		walletRepository:      wallet2.NewRedisRepository(clientRedis, keys, cfg.TTL.Wallet),
+		transactionRepository: transactions,
+		roundLister:           transactions,
+		nonceRepository:       signature.NewRedisRepository(clientRedis, keys),
+		throttleRepository:    throttle.NewRedisRepository(clientRedis, keys),
+		sessionRepository:     session.NewRedisRepository(clientRedis, keys),
+		resetRepository:       onetime.NewRedisRepository(clientRedis, keys.PasswordReset),
+		challengeRepository:   onetime.NewRedisRepository(clientRedis, keys.LoginChallenge),
+		loginRepository:       loginhistory.NewRedisRepository(clientRedis, cfg.LoginHistorySize),
+	}
+
+	return resp, nil
+}
+
+// sqliteComponent - пользователи, кошельки и раунды в sqlite,
+// короткоживущие данные (сессии, счетчики, одноразовые токены) в памяти
+func sqliteComponent(cfg *configs.Config) (*components, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	db, err := sqlite.Open(ctx, cfg.SQLite.Path, cfg.SQLite.BusyTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := inMemoryComponent(cfg)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// база закрывается вместе с comp, при закрытии sqlite переносит WAL в файл базы
+	resp.closers = append(resp.closers, db)
+
+	transactions := transaction.NewSQLiteRepository(db)
+
+	resp.userRepository = repositories.NewSQLiteRepository(db)
+	resp.walletRepository = wallet2.NewSQLiteRepository(db)
+	resp.transactionRepository = transactions
+	resp.roundLister = transactions
+
+	return resp, nil
+}
+
+// postgresComponent - пользователи, кошельки и раунды в postgres,
+// короткоживущие данные (сессии, счетчики, одноразовые токены) в памяти
+func postgresComponent(cfg *configs.Config) (*components, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	db, err := postgres.Open(ctx, cfg.Postgres.DSN, postgres.Pool{
+		MaxConns:        cfg.Postgres.MaxConns,
+		MinConns:        cfg.Postgres.MinConns,
+		MaxConnLifetime: cfg.Postgres.MaxConnLifetime,
+		MaxConnIdleTime: cfg.Postgres.MaxConnIdleTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := inMemoryComponent(cfg)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	resp.closers = append(resp.closers, closerFunc(func() error {
+		db.Close()
+		return nil
+	}))
+
+	transactions := transaction.NewPostgresRepository(db)
+
+	resp.userRepository = repositories.NewPostgresRepository(db)
+	resp.walletRepository = wallet2.NewPostgresRepository(db)
+	resp.transactionRepository = transactions
+	resp.roundLister = transactions
+
+	return resp, nil
+}
+
+// durableComponent - пользователи, кошельки и раунды в памяти с журналом на диске,
+// остальные данные теряются при перезапуске как в in_memory
+func durableComponent(cfg *configs.Config) (resp *components, err error) {
+	opts := wal.Options{
+		Sync:          wal.Sync(cfg.WAL.Sync),
+		Interval:      cfg.WAL.SyncInterval,
+		SnapshotEvery: cfg.WAL.SnapshotEvery,
+	}
+
+	resp, err = inMemoryComponent(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = resp.close()
+		}
+	}()
+
+	openLog := func(name string) (*wal.Log, error) {
+		journal, err := wal.Open(cfg.WAL.Dir, name, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		resp.closers = append(resp.closers, journal)
+
+		return journal, nil
+	}
+
+	userLog, err := openLog("users")
+	if err != nil {
+		return nil, err
+	}
+
+	userRepo, err := repositories.NewDurableInMemoryRepository(userLog)
+	if err != nil {
+		return nil, fmt.Errorf("restore users: %w", err)
+	}
+
+	walletLog, err := openLog("wallets")
+	if err != nil {
+		return nil, err
 	}
 
+	wallets, err := wallet2.NewDurableInMemoryRepository(walletLog)
+	if err != nil {
+		return nil, fmt.Errorf("restore wallets: %w", err)
+	}
+
+	roundLog, err := openLog("rounds")
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := transaction.NewDurableInMemoryRepository(roundLog)
+	if err != nil {
+		return nil, fmt.Errorf("restore rounds: %w", err)
+	}
+
+	resp.userRepository = userRepo
+	resp.walletRepository = wallets
+	resp.transactionRepository = transactions
+	resp.roundLister = transactions
+
 	return resp, nil
 }
 
-func inMemoryComponent() (*components, error) {
+func inMemoryComponent(cfg *configs.Config) (*components, error) {
+	transactions := transaction.NewInMemoryRepository()
+
 	resp := &components{
 		userRepository:        repositories.NewInMemoryRepository(),
 		walletRepository:      wallet2.NewInMemoryRepository(),
-		transactionRepository: transaction.NewInMemoryRepository(),
+		transactionRepository: transactions,
+		roundLister:           transactions,
+		nonceRepository:       signature.NewInMemoryRepository(),
+		throttleRepository:    throttle.NewInMemoryRepository(),
+		sessionRepository:     session.NewInMemoryRepository(),
+		resetRepository:       onetime.NewInMemoryRepository(),
+		challengeRepository:   onetime.NewInMemoryRepository(),
+		loginRepository:       loginhistory.NewInMemoryRepository(cfg.LoginHistorySize),
 	}
 
 	return resp, nil
@@ -10,6 +10,11 @@ type RoundID = uuid.UUID
 
 type TransactionID = uuid.UUID
 
+// TenantID - идентификатор оператора (бренда), данные которого изолированы
+type TenantID string
+
+const DefaultTenant TenantID = "default"
+
 type UserID int
 
 func (u UserID) String() string {
@@ -21,9 +26,114 @@ type Balance int
 type Amount int
 
 type User struct {
-	ID       UserID
-	Login    string
-	Password []byte
+	ID        UserID
+	Login     string
+	Password  []byte
+	Profile   Profile   `json:"profile"`
+	CreatedAt time.Time `json:"created_at"`
+	// TwoFactor - второй фактор, nil если не подключен
+	TwoFactor *TwoFactor `json:"two_factor,omitempty"`
+	// KYC - проверка личности, nil если данные не отправлялись
+	KYC *KYC `json:"kyc,omitempty"`
+	// Account - блокировки аккаунта, nil если статус не менялся
+	Account *Account `json:"account,omitempty"`
+	// ErasedAt - время удаления персональных данных по запросу пользователя
+	ErasedAt *time.Time `json:"erased_at,omitempty"`
+}
+
+// StatusAt - действующий статус, истекшая приостановка считается активным статусом
+func (u User) StatusAt(now time.Time) UserStatus {
+	if u.Account == nil {
+		return UserActive
+	}
+
+	if u.Account.Status == UserSuspended && u.Account.SuspendedUntil != nil && !now.Before(*u.Account.SuspendedUntil) {
+		return UserActive
+	}
+
+	return u.Account.Status
+}
+
+type UserStatus string
+
+const (
+	UserActive    UserStatus = "active"
+	UserSuspended UserStatus = "suspended"
+	UserBanned    UserStatus = "banned"
+)
+
+type Account struct {
+	Status         UserStatus `json:"status"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	// History - журнал смены статуса администраторами
+	History []StatusChange `json:"history,omitempty"`
+}
+
+type StatusChange struct {
+	Status         UserStatus `json:"status"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	Reason         string     `json:"reason"`
+	At             time.Time  `json:"at"`
+}
+
+func (u User) KYCStatus() KYCStatus {
+	if u.KYC == nil {
+		return KYCNone
+	}
+
+	return u.KYC.Status
+}
+
+type KYCStatus string
+
+const (
+	KYCNone     KYCStatus = "none"
+	KYCPending  KYCStatus = "pending"
+	KYCVerified KYCStatus = "verified"
+	KYCRejected KYCStatus = "rejected"
+)
+
+type KYC struct {
+	Status     KYCStatus      `json:"status"`
+	Submission *KYCSubmission `json:"submission,omitempty"`
+	// History - все смены статуса по порядку
+	History []KYCChange `json:"history,omitempty"`
+}
+
+// KYCSubmission - данные документа, отправленные игроком
+type KYCSubmission struct {
+	FullName       string    `json:"full_name"`
+	DocumentType   string    `json:"document_type"`
+	DocumentNumber string    `json:"document_number"`
+	SubmittedAt    time.Time `json:"submitted_at"`
+}
+
+// KYCChange - смена статуса, Actor - user или admin
+type KYCChange struct {
+	Status KYCStatus `json:"status"`
+	Actor  string    `json:"actor"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// TwoFactor - TOTP секрет и хеши одноразовых кодов восстановления.
+// До подтверждения первым кодом Enabled = false и вход не требует кода.
+type TwoFactor struct {
+	Secret        string   `json:"secret"`
+	Enabled       bool     `json:"enabled"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	// LastStep - шаг последнего принятого кода, защита от повтора
+	LastStep int64 `json:"last_step,omitempty"`
+}
+
+// Profile - анкета игрока
+type Profile struct {
+	Email       string `json:"email,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	// Country - код страны ISO 3166-1 alpha-2
+	Country string `json:"country,omitempty"`
+	// DateOfBirth - дата рождения в формате 2006-01-02
+	DateOfBirth string `json:"date_of_birth,omitempty"`
 }
 
 type Wallet struct {
@@ -40,10 +150,25 @@ type Transaction struct {
 	Created time.Time `json:"created"`
 }
 
+// RoundKind - игровой раунд или платеж. Платеж хранится как завершенный раунд
+// с суммой в Bet, чтобы баланс восстанавливался по истории раундов.
+type RoundKind string
+
+const (
+	RoundKindGame        RoundKind = ""
+	RoundKindDeposit     RoundKind = "deposit"
+	RoundKindWithdrawal  RoundKind = "withdrawal"
+	RoundKindTransferIn  RoundKind = "transfer_in"
+	RoundKindTransferOut RoundKind = "transfer_out"
+	// RoundKindOpening - начальный баланс кошелька по политике оператора на момент создания
+	RoundKindOpening RoundKind = "opening"
+)
+
 type Round struct {
 	UserID   UserID       `json:"user_id"`
 	Bet      Transaction  `json:"bet"`
 	Win      *Transaction `json:"win,omitempty"`
 	Finished bool         `json:"finished"`
 	Refunded bool         `json:"refunded"`
+	Kind     RoundKind    `json:"kind,omitempty"`
 }
@@ -0,0 +1,316 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/modules/users"
+	"github.com/IlnurShafikov/wallet/modules/wallet"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/transaction"
+	"io"
+	"time"
+)
+
+// Version - версия формата дампа
+const Version = 1
+
+// maxLineSize - пользователь с историей статусов и KYC занимает несколько КБ
+const maxLineSize = 16 << 20
+
+const (
+	typeHeader = "header"
+	typeUser   = "user"
+	typeWallet = "wallet"
+	typeRound  = "round"
+	typeFooter = "footer"
+)
+
+var (
+	ErrInvalidDump = errors.New("invalid dump")
+	ErrChecksum    = errors.New("dump checksum mismatch")
+)
+
+// Source - хранилище, из которого снимается дамп
+type Source struct {
+	Users   users.Iterator
+	Wallets wallet.Iterator
+	Rounds  transaction.Iterator
+}
+
+// Target - хранилище, в которое восстанавливается дамп. Записи создаются
+// как новые, существующий пользователь, кошелек или раунд - ошибка
+type Target struct {
+	Users   users.Restorer
+	Wallets interface {
+		Create(context.Context, models.UserID, models.Balance) error
+	}
+	Rounds interface {
+		CreateBet(context.Context, models.RoundID, models.Round) error
+	}
+}
+
+// Counts - число записей по типам
+type Counts struct {
+	Users   int `json:"users"`
+	Wallets int `json:"wallets"`
+	Rounds  int `json:"rounds"`
+}
+
+// Header - первая строка дампа
+type Header struct {
+	Version int               `json:"version"`
+	Created time.Time         `json:"created"`
+	Source  string            `json:"source"`
+	Tenants []models.TenantID `json:"tenants"`
+}
+
+// Footer - последняя строка дампа. SHA256 считается по всем строкам до нее,
+// дамп без подвала считается оборванным
+type Footer struct {
+	Counts map[models.TenantID]Counts `json:"counts"`
+	SHA256 string                     `json:"sha256"`
+}
+
+// Wallet - баланс кошелька пользователя
+type Wallet struct {
+	UserID  models.UserID  `json:"user_id"`
+	Balance models.Balance `json:"balance"`
+}
+
+// line - строка дампа NDJSON, заполнено поле по Type
+type line struct {
+	Type     string                 `json:"type"`
+	TenantID models.TenantID        `json:"tenant_id,omitempty"`
+	Header   *Header                `json:"header,omitempty"`
+	User     *models.User           `json:"user,omitempty"`
+	Wallet   *Wallet                `json:"wallet,omitempty"`
+	Round    *transaction.UserRound `json:"round,omitempty"`
+	Footer   *Footer                `json:"footer,omitempty"`
+}
+
+// Dump - пишет пользователей, кошельки и раунды операторов построчно,
+// данные не накапливаются в памяти. Возвращает подвал записанного дампа
+func Dump(ctx context.Context, w io.Writer, source Source, name string, tenants []models.TenantID) (*Footer, error) {
+	buf := bufio.NewWriter(w)
+	sum := sha256.New()
+	out := json.NewEncoder(io.MultiWriter(buf, sum))
+
+	err := out.Encode(line{Type: typeHeader, Header: &Header{
+		Version: Version,
+		Created: time.Now().UTC(),
+		Source:  name,
+		Tenants: tenants,
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("write header: %w", err)
+	}
+
+	footer := &Footer{Counts: make(map[models.TenantID]Counts, len(tenants))}
+
+	for _, tenantID := range tenants {
+		tctx := tenant.WithTenant(ctx, tenantID)
+		counts := Counts{}
+
+		err = source.Users.Iterate(tctx, func(user models.User) error {
+			counts.Users++
+			return out.Encode(line{Type: typeUser, TenantID: tenantID, User: &user})
+		})
+		if err != nil {
+			return nil, fmt.Errorf("dump users of %s: %w", tenantID, err)
+		}
+
+		err = source.Wallets.Iterate(tctx, func(userID models.UserID, balance models.Balance) error {
+			counts.Wallets++
+			return out.Encode(line{Type: typeWallet, TenantID: tenantID, Wallet: &Wallet{UserID: userID, Balance: balance}})
+		})
+		if err != nil {
+			return nil, fmt.Errorf("dump wallets of %s: %w", tenantID, err)
+		}
+
+		err = source.Rounds.Iterate(tctx, func(round transaction.UserRound) error {
+			counts.Rounds++
+			return out.Encode(line{Type: typeRound, TenantID: tenantID, Round: &round})
+		})
+		if err != nil {
+			return nil, fmt.Errorf("dump rounds of %s: %w", tenantID, err)
+		}
+
+		footer.Counts[tenantID] = counts
+	}
+
+	footer.SHA256 = hex.EncodeToString(sum.Sum(nil))
+
+	if err = json.NewEncoder(buf).Encode(line{Type: typeFooter, Footer: footer}); err != nil {
+		return nil, fmt.Errorf("write footer: %w", err)
+	}
+
+	if err = buf.Flush(); err != nil {
+		return nil, fmt.Errorf("flush: %w", err)
+	}
+
+	return footer, nil
+}
+
+// Verify - проверяет версию, число записей и контрольную сумму без записи в хранилище.
+// Restore проверяет дамп только по ходу чтения, поэтому перед ним дамп нужно проверить
+func Verify(r io.Reader) (*Header, *Footer, error) {
+	return read(r, func(line) error { return nil })
+}
+
+// Restore - записывает дамп в хранилище и возвращает число записанных записей
+func Restore(ctx context.Context, r io.Reader, target Target) (map[models.TenantID]Counts, error) {
+	restored := make(map[models.TenantID]Counts)
+
+	_, _, err := read(r, func(l line) error {
+		tctx := tenant.WithTenant(ctx, l.TenantID)
+		counts := restored[l.TenantID]
+
+		var err error
+		switch l.Type {
+		case typeUser:
+			err = target.Users.Restore(tctx, *l.User)
+			counts.Users++
+		case typeWallet:
+			err = target.Wallets.Create(tctx, l.Wallet.UserID, l.Wallet.Balance)
+			counts.Wallets++
+		case typeRound:
+			err = target.Rounds.CreateBet(tctx, l.Round.RoundID, l.Round.Round)
+			counts.Rounds++
+		}
+
+		if err != nil {
+			return fmt.Errorf("restore %s of %s: %w", l.Type, l.TenantID, err)
+		}
+
+		restored[l.TenantID] = counts
+
+		return nil
+	})
+
+	return restored, err
+}
+
+// read - разбирает дамп и вызывает apply для каждой записи между заголовком и подвалом
+func read(r io.Reader, apply func(line) error) (*Header, *Footer, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+
+	var (
+		header *Header
+		footer *Footer
+		sum    = sha256.New()
+		counts = make(map[models.TenantID]Counts)
+	)
+
+	for n := 1; scanner.Scan(); n++ {
+		if footer != nil {
+			return nil, nil, fmt.Errorf("line %d after footer: %w", n, ErrInvalidDump)
+		}
+
+		l := line{}
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w: %s", n, ErrInvalidDump, err)
+		}
+
+		if header == nil && l.Type != typeHeader {
+			return nil, nil, fmt.Errorf("line %d: header expected: %w", n, ErrInvalidDump)
+		}
+
+		if l.Type != typeFooter {
+			sum.Write(scanner.Bytes())
+			sum.Write([]byte{'\n'})
+		}
+
+		tenantCounts := counts[l.TenantID]
+
+		switch {
+		case l.Type == typeHeader && header == nil && l.Header != nil:
+			if l.Header.Version != Version {
+				return nil, nil, fmt.Errorf("unsupported dump version %d: %w", l.Header.Version, ErrInvalidDump)
+			}
+
+			header = l.Header
+			continue
+		case l.Type == typeFooter && l.Footer != nil:
+			footer = l.Footer
+			continue
+		case l.Type == typeUser && l.User != nil:
+			tenantCounts.Users++
+		case l.Type == typeWallet && l.Wallet != nil:
+			tenantCounts.Wallets++
+		case l.Type == typeRound && l.Round != nil:
+			tenantCounts.Rounds++
+		default:
+			return nil, nil, fmt.Errorf("line %d: unexpected %q record: %w", n, l.Type, ErrInvalidDump)
+		}
+
+		counts[l.TenantID] = tenantCounts
+
+		if err := apply(l); err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("read dump: %w", err)
+	}
+
+	if footer == nil {
+		return nil, nil, fmt.Errorf("footer not found, dump is truncated: %w", ErrInvalidDump)
+	}
+
+	if hex.EncodeToString(sum.Sum(nil)) != footer.SHA256 {
+		return nil, nil, ErrChecksum
+	}
+
+	for tenantID, expected := range footer.Counts {
+		if counts[tenantID] != expected {
+			return nil, nil, fmt.Errorf("tenant %s: counts %+v, footer %+v: %w", tenantID, counts[tenantID], expected, ErrInvalidDump)
+		}
+	}
+
+	for tenantID := range counts {
+		if _, ok := footer.Counts[tenantID]; !ok {
+			return nil, nil, fmt.Errorf("tenant %s is missing in footer: %w", tenantID, ErrInvalidDump)
+		}
+	}
+
+	return header, footer, nil
+}
+
+// Count - число записей оператора в хранилище, для сверки после восстановления
+func Count(ctx context.Context, source Source) (Counts, error) {
+	counts := Counts{}
+
+	err := source.Users.Iterate(ctx, func(models.User) error {
+		counts.Users++
+		return nil
+	})
+	if err != nil {
+		return counts, fmt.Errorf("count users: %w", err)
+	}
+
+	err = source.Wallets.Iterate(ctx, func(models.UserID, models.Balance) error {
+		counts.Wallets++
+		return nil
+	})
+	if err != nil {
+		return counts, fmt.Errorf("count wallets: %w", err)
+	}
+
+	err = source.Rounds.Iterate(ctx, func(transaction.UserRound) error {
+		counts.Rounds++
+		return nil
+	})
+	if err != nil {
+		return counts, fmt.Errorf("count rounds: %w", err)
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,231 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/modules/users/repositories"
+	"github.com/IlnurShafikov/wallet/modules/wallet"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
+	"github.com/IlnurShafikov/wallet/services/sqlite"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/transaction"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var tenants = []models.TenantID{models.DefaultTenant, "other"}
+
+type storage struct {
+	users   usersRepository
+	wallets interface {
+		wallet.Repository
+		wallet.Iterator
+	}
+	rounds interface {
+		transaction.Repository
+		transaction.Iterator
+	}
+}
+
+type usersRepository interface {
+	Create(ctx context.Context, login string, password []byte) (*models.User, error)
+	GetByID(ctx context.Context, userID models.UserID) (*models.User, error)
+	Iterate(ctx context.Context, fn func(user models.User) error) error
+	Restore(ctx context.Context, user models.User) error
+}
+
+func (s storage) source() Source {
+	return Source{Users: s.users, Wallets: s.wallets, Rounds: s.rounds}
+}
+
+func (s storage) target() Target {
+	return Target{Users: s.users, Wallets: s.wallets, Rounds: s.rounds}
+}
+
+func inMemoryStorage() storage {
+	return storage{
+		users:   repositories.NewInMemoryRepository(),
+		wallets: wallet.NewInMemoryRepository(),
+		rounds:  transaction.NewInMemoryRepository(),
+	}
+}
+
+func sqliteStorage(t *testing.T) storage {
+	db, err := sqlite.Open(context.Background(), filepath.Join(t.TempDir(), "wallet.db"), time.Second)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	return storage{
+		users:   repositories.NewSQLiteRepository(db),
+		wallets: wallet.NewSQLiteRepository(db),
+		rounds:  transaction.NewSQLiteRepository(db),
+	}
+}
+
+func redisStorage(t *testing.T) storage {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(s.Close)
+
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	keys := keyschema.Default()
+
+	return storage{
+		users:   repositories.NewRedisRepository(client, keys, 0),
+		wallets: wallet.NewRedisRepository(client, keys, 0),
+		rounds:  transaction.NewRedisRepository(client, keys, transaction.TTL{}),
+	}
+}
+
+// fill - по два пользователя с кошельком и раундами у каждого оператора
+func fill(t *testing.T, s storage) {
+	created := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tenantID := range tenants {
+		ctx := tenant.WithTenant(context.Background(), tenantID)
+
+		for _, login := range []string{"alice", "bob"} {
+			user, err := s.users.Create(ctx, login, []byte("hash-"+login))
+			require.NoError(t, err)
+			require.NoError(t, s.wallets.Create(ctx, user.ID, 100))
+
+			require.NoError(t, s.rounds.CreateBet(ctx, models.RoundID(uuid.New()), models.Round{
+				UserID:   user.ID,
+				Bet:      models.Transaction{Amount: -10, TransactionID: models.TransactionID(uuid.New()), Created: created},
+				Win:      &models.Transaction{Amount: 20, TransactionID: models.TransactionID(uuid.New()), Created: created},
+				Finished: true,
+			}))
+			require.NoError(t, s.rounds.CreateBet(ctx, models.RoundID(uuid.New()), models.Round{
+				UserID: user.ID,
+				Bet:    models.Transaction{Amount: -5, TransactionID: models.TransactionID(uuid.New()), Created: created},
+			}))
+		}
+	}
+}
+
+func dump(t *testing.T, s storage) (*bytes.Buffer, *Footer) {
+	var buf bytes.Buffer
+
+	footer, err := Dump(context.Background(), &buf, s.source(), "test", tenants)
+	require.NoError(t, err)
+
+	return &buf, footer
+}
+
+func TestDumpRestore(t *testing.T) {
+	source := inMemoryStorage()
+	fill(t, source)
+
+	data, footer := dump(t, source)
+	for _, tenantID := range tenants {
+		assert.Equal(t, Counts{Users: 2, Wallets: 2, Rounds: 4}, footer.Counts[tenantID])
+	}
+
+	header, verified, err := Verify(bytes.NewReader(data.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, "test", header.Source)
+	assert.Equal(t, footer, verified)
+
+	targets := map[string]func(t *testing.T) storage{
+		"sqlite": sqliteStorage,
+		"redis":  redisStorage,
+	}
+
+	for name, newTarget := range targets {
+		t.Run(name, func(t *testing.T) {
+			target := newTarget(t)
+
+			restored, err := Restore(context.Background(), bytes.NewReader(data.Bytes()), target.target())
+			require.NoError(t, err)
+			assert.Equal(t, footer.Counts, restored)
+
+			for _, tenantID := range tenants {
+				ctx := tenant.WithTenant(context.Background(), tenantID)
+
+				counts, err := Count(ctx, target.source())
+				require.NoError(t, err)
+				assert.Equal(t, footer.Counts[tenantID], counts)
+
+				expected := map[models.TransactionID]transaction.UserRound{}
+				require.NoError(t, source.rounds.Iterate(ctx, func(round transaction.UserRound) error {
+					expected[round.Bet.TransactionID] = round
+					return nil
+				}))
+
+				require.NoError(t, target.rounds.Iterate(ctx, func(round transaction.UserRound) error {
+					assert.Equal(t, expected[round.Bet.TransactionID].RoundID, round.RoundID)
+					assert.Equal(t, expected[round.Bet.TransactionID].Finished, round.Finished)
+					return nil
+				}))
+
+				require.NoError(t, source.users.Iterate(ctx, func(user models.User) error {
+					restoredUser, err := target.users.GetByID(ctx, user.ID)
+					require.NoError(t, err)
+					assert.Equal(t, user.Login, restoredUser.Login)
+					assert.Equal(t, user.Password, restoredUser.Password)
+
+					balance, err := target.wallets.Get(ctx, user.ID)
+					require.NoError(t, err)
+					assert.Equal(t, models.Balance(100), balance)
+
+					return nil
+				}))
+
+				// счетчик UserID поднят до восстановленных пользователей
+				user, err := target.users.Create(ctx, "carol", nil)
+				require.NoError(t, err)
+				_, err = source.users.GetByID(ctx, user.ID)
+				assert.Error(t, err)
+			}
+
+			// повторное восстановление не перезаписывает существующие записи
+			_, err = Restore(context.Background(), bytes.NewReader(data.Bytes()), target.target())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestVerify_Corrupted(t *testing.T) {
+	source := inMemoryStorage()
+	fill(t, source)
+
+	data, _ := dump(t, source)
+	lines := strings.SplitAfter(data.String(), "\n")
+
+	tests := map[string]struct {
+		dump   string
+		expErr error
+	}{
+		"changed balance": {
+			dump:   strings.Replace(data.String(), `"balance":100`, `"balance":900`, 1),
+			expErr: ErrChecksum,
+		},
+		"truncated": {
+			dump:   strings.Join(lines[:len(lines)-3], ""),
+			expErr: ErrInvalidDump,
+		},
+		"without header": {
+			dump:   strings.Join(lines[1:], ""),
+			expErr: ErrInvalidDump,
+		},
+		"dropped record": {
+			dump:   lines[0] + strings.Join(lines[2:], ""),
+			expErr: ErrChecksum,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := Verify(strings.NewReader(tt.dump))
+			assert.ErrorIs(t, err, tt.expErr)
+		})
+	}
+}
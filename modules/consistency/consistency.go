@@ -0,0 +1,277 @@
+package consistency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/modules/wallet"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/transaction"
+	"sort"
+	"time"
+)
+
+// IssueKind - вид нарушения
+type IssueKind string
+
+const (
+	// IssueOrphanRound - раунд пользователя, у которого нет кошелька
+	IssueOrphanRound IssueKind = "orphan_round"
+	// IssueUnfinishedWin - выигрыш записан, а раунд не завершен
+	IssueUnfinishedWin IssueKind = "unfinished_win"
+	// IssueRefundedWithWin - возврат ставки в раунде с выигрышем
+	IssueRefundedWithWin IssueKind = "refunded_with_win"
+	// IssueBalanceMismatch - баланс не совпадает с историей раундов
+	IssueBalanceMismatch IssueKind = "balance_mismatch"
+)
+
+// Issue - нарушение. Для раундов заполнен RoundID, для кошельков - Balance и Expected
+type Issue struct {
+	Kind    IssueKind       `json:"kind"`
+	UserID  models.UserID   `json:"user_id"`
+	RoundID *models.RoundID `json:"round_id,omitempty"`
+	Balance models.Balance  `json:"balance"`
+	// Expected - история раундов с начальным балансом. Для кошельков без
+	// раунда начального баланса он берется из текущей политики оператора
+	Expected models.Balance `json:"expected"`
+	// Fixed - нарушение исправлено в режиме fix
+	Fixed bool `json:"fixed"`
+}
+
+// Report - результат проверки оператора
+type Report struct {
+	TenantID  models.TenantID `json:"tenant_id"`
+	CheckedAt time.Time       `json:"checked_at"`
+	Wallets   int             `json:"wallets"`
+	Rounds    int             `json:"rounds"`
+	// BalancesChecked - false, если рассчитанные раунды истекают без архива:
+	// история неполная и расхождения баланса не проверялись
+	BalancesChecked bool    `json:"balances_checked"`
+	Issues          []Issue `json:"issues"`
+}
+
+// Unfixed - число нарушений, оставшихся после проверки
+func (r Report) Unfixed() int {
+	count := 0
+	for _, issue := range r.Issues {
+		if !issue.Fixed {
+			count++
+		}
+	}
+
+	return count
+}
+
+type roundStore interface {
+	transaction.Iterator
+	GetRound(ctx context.Context, roundID models.RoundID) (*models.Round, error)
+	UpdateRound(ctx context.Context, roundID models.RoundID, round models.Round) error
+}
+
+type tenantConfigs interface {
+	Get(id models.TenantID) (tenant.Config, bool)
+}
+
+// Checker - сверяет кошельки с раундами. Изменение баланса и запись раунда
+// не атомарны, поэтому при сбое между ними данные расходятся.
+// Проверка читает живые данные, операции во время проверки могут дать
+// ложное расхождение баланса, его стоит перепроверить
+type Checker struct {
+	wallets       wallet.Iterator
+	rounds        roundStore
+	tenants       tenantConfigs
+	defaultPolicy tenant.WalletPolicy
+	fullHistory   bool
+	now           func() time.Time
+}
+
+// NewChecker - fullHistory false, если рассчитанные раунды удаляются без
+// переноса в архив, тогда балансы с историей не сверяются
+func NewChecker(
+	wallets wallet.Iterator,
+	rounds roundStore,
+	tenants tenantConfigs,
+	defaultPolicy tenant.WalletPolicy,
+	fullHistory bool,
+) *Checker {
+	return &Checker{
+		wallets:       wallets,
+		rounds:        rounds,
+		tenants:       tenants,
+		defaultPolicy: defaultPolicy,
+		fullHistory:   fullHistory,
+		now:           time.Now,
+	}
+}
+
+// Check - проверяет кошельки и раунды оператора из контекста. С fix завершает
+// раунды с выигрышем: выигрыш уже зачислен, а незавершенный раунд только
+// мешает расчету. Остальные нарушения требуют решения человека и только
+// попадают в отчет
+func (c *Checker) Check(ctx context.Context, fix bool) (*Report, error) {
+	tenantID := tenant.FromContext(ctx)
+	report := &Report{TenantID: tenantID, CheckedAt: c.now().UTC(), BalancesChecked: c.fullHistory, Issues: []Issue{}}
+
+	balances := make(map[models.UserID]models.Balance)
+
+	err := c.wallets.Iterate(ctx, func(userID models.UserID, balance models.Balance) error {
+		balances[userID] = balance
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("iterate wallets: %w", err)
+	}
+
+	report.Wallets = len(balances)
+
+	replayed := make(map[models.UserID]models.Balance)
+	opened := make(map[models.UserID]bool)
+	var unfinished []transaction.UserRound
+
+	err = c.rounds.Iterate(ctx, func(round transaction.UserRound) error {
+		report.Rounds++
+		replayed[round.UserID] += replay(round.Round)
+
+		if round.Kind == models.RoundKindOpening {
+			opened[round.UserID] = true
+		}
+
+		roundID := round.RoundID
+
+		if _, ok := balances[round.UserID]; !ok {
+			report.Issues = append(report.Issues, Issue{Kind: IssueOrphanRound, UserID: round.UserID, RoundID: &roundID})
+		}
+
+		if round.Win != nil && !round.Finished {
+			unfinished = append(unfinished, round)
+		}
+
+		if round.Win != nil && round.Refunded {
+			report.Issues = append(report.Issues, Issue{Kind: IssueRefundedWithWin, UserID: round.UserID, RoundID: &roundID})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("iterate rounds: %w", err)
+	}
+
+	// исправления применяются после обхода, чтобы не писать в хранилище во время чтения
+	for _, round := range unfinished {
+		roundID := round.RoundID
+		issue := Issue{Kind: IssueUnfinishedWin, UserID: round.UserID, RoundID: &roundID}
+
+		if fix {
+			fixed, err := c.finish(ctx, roundID)
+			if err != nil {
+				return nil, fmt.Errorf("finish round %s: %w", roundID, err)
+			}
+
+			// раунд изменили после обхода, нарушения уже нет
+			if !fixed {
+				continue
+			}
+
+			issue.Fixed = true
+		}
+
+		report.Issues = append(report.Issues, issue)
+	}
+
+	if c.fullHistory {
+		report.Issues = append(report.Issues, c.mismatches(tenantID, balances, replayed, opened)...)
+	}
+
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		return report.Issues[i].UserID < report.Issues[j].UserID
+	})
+
+	return report, nil
+}
+
+// finish - завершает раунд, если он все еще с выигрышем и не завершен.
+// Раунд перечитывается: за время обхода его могли завершить или вернуть
+func (c *Checker) finish(ctx context.Context, roundID models.RoundID) (bool, error) {
+	round, err := c.rounds.GetRound(ctx, roundID)
+	if errors.Is(err, transaction.ErrRoundNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if round.Win == nil || round.Finished {
+		return false, nil
+	}
+
+	round.Finished = true
+
+	return true, c.rounds.UpdateRound(ctx, roundID, *round)
+}
+
+// mismatches - кошельки, баланс которых расходится с историей. Начальный баланс
+// записан раундом RoundKindOpening, для кошельков, созданных до появления таких
+// раундов, он восстанавливается по текущей политике оператора
+func (c *Checker) mismatches(
+	tenantID models.TenantID,
+	balances map[models.UserID]models.Balance,
+	replayed map[models.UserID]models.Balance,
+	opened map[models.UserID]bool,
+) []Issue {
+	policy := c.policy(tenantID)
+
+	var issues []Issue
+	for userID, balance := range balances {
+		history := replayed[userID]
+		if opened[userID] {
+			if balance != history {
+				issues = append(issues, Issue{Kind: IssueBalanceMismatch, UserID: userID, Balance: balance, Expected: history})
+			}
+
+			continue
+		}
+
+		if balance == policy.InitialBalance+policy.WelcomeBonus+history {
+			continue
+		}
+
+		// акция с окончанием: кошельки после нее созданы без бонуса
+		if policy.WelcomeBonusUntil != nil && balance == policy.InitialBalance+history {
+			continue
+		}
+
+		issues = append(issues, Issue{
+			Kind:     IssueBalanceMismatch,
+			UserID:   userID,
+			Balance:  balance,
+			Expected: policy.InitialBalance + policy.WelcomeBonus + history,
+		})
+	}
+
+	return issues
+}
+
+func (c *Checker) policy(tenantID models.TenantID) tenant.WalletPolicy {
+	cfg, ok := c.tenants.Get(tenantID)
+	if ok && cfg.Wallet != nil {
+		return *cfg.Wallet
+	}
+
+	return c.defaultPolicy
+}
+
+// replay - изменение баланса раундом: ставка или платеж, если не было возврата, и выигрыш
+func replay(round models.Round) models.Balance {
+	var change models.Balance
+	if !round.Refunded {
+		change += models.Balance(round.Bet.Amount)
+	}
+
+	if round.Win != nil {
+		change += models.Balance(round.Win.Amount)
+	}
+
+	return change
+}
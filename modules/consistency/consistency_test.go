@@ -0,0 +1,244 @@
+package consistency
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/modules/wallet"
+	"github.com/IlnurShafikov/wallet/services/admin"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/transaction"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var created = time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+func bet(amount models.Amount) models.Transaction {
+	return models.Transaction{Amount: amount, TransactionID: models.TransactionID(uuid.New()), Created: created}
+}
+
+func win(amount models.Amount) *models.Transaction {
+	transaction := bet(amount)
+	return &transaction
+}
+
+// setup - кошельки с начальным балансом 100: у первого пользователя история сходится,
+// у второго раунд с выигрышем не завершен, у третьего баланс расходится с историей
+func setup(t *testing.T) (*Checker, *transaction.InMemoryRepository, map[string]models.RoundID) {
+	ctx := context.Background()
+
+	wallets := wallet.NewInMemoryRepository()
+	rounds := transaction.NewInMemoryRepository()
+
+	require.NoError(t, wallets.Create(ctx, 1, 100-10+30+50))
+	require.NoError(t, wallets.Create(ctx, 2, 100-10+20))
+	require.NoError(t, wallets.Create(ctx, 3, 75))
+
+	ids := map[string]models.RoundID{}
+	add := func(name string, round models.Round) {
+		ids[name] = models.RoundID(uuid.New())
+		require.NoError(t, rounds.CreateBet(ctx, ids[name], round))
+	}
+
+	add("won", models.Round{UserID: 1, Bet: bet(-10), Win: win(30), Finished: true})
+	add("refunded", models.Round{UserID: 1, Bet: bet(-5), Refunded: true})
+	add("deposit", models.Round{UserID: 1, Bet: bet(50), Finished: true, Kind: models.RoundKindDeposit})
+	add("unfinished", models.Round{UserID: 2, Bet: bet(-10), Win: win(20)})
+	add("refunded with win", models.Round{UserID: 3, Bet: bet(-10), Win: win(20), Finished: true, Refunded: true})
+	add("orphan", models.Round{UserID: 4, Bet: bet(-10), Finished: true})
+
+	registry, err := tenant.NewRegistry([]tenant.Config{{ID: models.DefaultTenant}})
+	require.NoError(t, err)
+
+	checker := NewChecker(wallets, rounds, registry, tenant.WalletPolicy{InitialBalance: 90, WelcomeBonus: 10}, true)
+	checker.now = func() time.Time { return created }
+
+	return checker, rounds, ids
+}
+
+func TestChecker_Check(t *testing.T) {
+	ctx := context.Background()
+	checker, rounds, ids := setup(t)
+
+	unfinished := ids["unfinished"]
+	refundedWithWin := ids["refunded with win"]
+	orphan := ids["orphan"]
+
+	report, err := checker.Check(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Wallets)
+	assert.Equal(t, 6, report.Rounds)
+	assert.Equal(t, []Issue{
+		{Kind: IssueUnfinishedWin, UserID: 2, RoundID: &unfinished},
+		{Kind: IssueRefundedWithWin, UserID: 3, RoundID: &refundedWithWin},
+		{Kind: IssueBalanceMismatch, UserID: 3, Balance: 75, Expected: 120},
+		{Kind: IssueOrphanRound, UserID: 4, RoundID: &orphan},
+	}, report.Issues)
+	assert.Equal(t, 4, report.Unfixed())
+
+	round, err := rounds.GetRound(ctx, unfinished)
+	require.NoError(t, err)
+	assert.False(t, round.Finished)
+
+	report, err = checker.Check(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, Issue{Kind: IssueUnfinishedWin, UserID: 2, RoundID: &unfinished, Fixed: true}, report.Issues[0])
+	assert.Equal(t, 3, report.Unfixed())
+
+	round, err = rounds.GetRound(ctx, unfinished)
+	require.NoError(t, err)
+	assert.True(t, round.Finished)
+
+	report, err = checker.Check(ctx, false)
+	require.NoError(t, err)
+	assert.Len(t, report.Issues, 3)
+}
+
+// кошельки, созданные после окончания акции, получают начальный баланс без бонуса
+func TestChecker_WelcomeBonusUntil(t *testing.T) {
+	ctx := context.Background()
+
+	wallets := wallet.NewInMemoryRepository()
+	require.NoError(t, wallets.Create(ctx, 1, 100))
+	require.NoError(t, wallets.Create(ctx, 2, 90))
+	require.NoError(t, wallets.Create(ctx, 3, 95))
+
+	until := created
+	registry, err := tenant.NewRegistry([]tenant.Config{{
+		ID:     models.DefaultTenant,
+		Wallet: &tenant.WalletPolicy{InitialBalance: 90, WelcomeBonus: 10, WelcomeBonusUntil: &until},
+	}})
+	require.NoError(t, err)
+
+	checker := NewChecker(wallets, transaction.NewInMemoryRepository(), registry, tenant.WalletPolicy{}, true)
+
+	report, err := checker.Check(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, []Issue{{Kind: IssueBalanceMismatch, UserID: 3, Balance: 95, Expected: 100}}, report.Issues)
+}
+
+// кошелек с раундом начального баланса сверяется с ним, а не с текущей политикой
+func TestChecker_OpeningRound(t *testing.T) {
+	ctx := context.Background()
+	checker, rounds, _ := setup(t)
+
+	wallets := wallet.NewInMemoryRepository()
+	require.NoError(t, wallets.Create(ctx, 5, 500-10))
+	require.NoError(t, wallets.Create(ctx, 6, 300))
+	checker.wallets = wallets
+
+	opening := func(userID models.UserID, amount models.Amount) {
+		round := models.Round{UserID: userID, Bet: bet(amount), Finished: true, Kind: models.RoundKindOpening}
+		require.NoError(t, rounds.CreateBet(ctx, wallet.OpeningRoundID(userID), round))
+	}
+
+	opening(5, 500)
+	opening(6, 200)
+	require.NoError(t, rounds.CreateBet(ctx, models.RoundID(uuid.New()), models.Round{UserID: 5, Bet: bet(-10), Finished: true}))
+
+	report, err := checker.Check(ctx, false)
+	require.NoError(t, err)
+	assert.True(t, report.BalancesChecked)
+	assert.Contains(t, report.Issues, Issue{Kind: IssueBalanceMismatch, UserID: 6, Balance: 300, Expected: 200})
+
+	for _, issue := range report.Issues {
+		assert.NotEqual(t, models.UserID(5), issue.UserID)
+	}
+}
+
+// без полной истории раундов балансы не сверяются
+func TestChecker_PartialHistory(t *testing.T) {
+	ctx := context.Background()
+	checker, _, _ := setup(t)
+	checker.fullHistory = false
+
+	report, err := checker.Check(ctx, false)
+	require.NoError(t, err)
+	assert.False(t, report.BalancesChecked)
+
+	for _, issue := range report.Issues {
+		assert.NotEqual(t, IssueBalanceMismatch, issue.Kind)
+	}
+}
+
+// changingStore - завершает раунд changed после обхода, как параллельный запрос
+type changingStore struct {
+	*transaction.InMemoryRepository
+	changed models.RoundID
+}
+
+func (s changingStore) Iterate(ctx context.Context, fn func(round transaction.UserRound) error) error {
+	if err := s.InMemoryRepository.Iterate(ctx, fn); err != nil {
+		return err
+	}
+
+	round, err := s.GetRound(ctx, s.changed)
+	if err != nil {
+		return err
+	}
+
+	round.Finished = true
+	round.Win.Amount = 25
+
+	return s.UpdateRound(ctx, s.changed, *round)
+}
+
+// fix перечитывает раунд и не перезаписывает изменения, сделанные после обхода
+func TestChecker_FixChangedRound(t *testing.T) {
+	ctx := context.Background()
+	checker, rounds, ids := setup(t)
+	unfinished := ids["unfinished"]
+	checker.rounds = changingStore{InMemoryRepository: rounds, changed: unfinished}
+
+	report, err := checker.Check(ctx, true)
+	require.NoError(t, err)
+
+	for _, issue := range report.Issues {
+		assert.NotEqual(t, IssueUnfinishedWin, issue.Kind)
+	}
+
+	round, err := rounds.GetRound(ctx, unfinished)
+	require.NoError(t, err)
+	assert.True(t, round.Finished)
+	assert.Equal(t, models.Amount(25), round.Win.Amount)
+}
+
+func TestHandler(t *testing.T) {
+	checker, _, _ := setup(t)
+	logger := zerolog.Nop()
+
+	app := fiber.New()
+	RegisterConsistencyHandler(app, checker, &logger, admin.Middleware("secret"))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/admin/consistency", nil))
+	require.NoError(t, err)
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/consistency", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer secret")
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	report := Report{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Equal(t, models.DefaultTenant, report.TenantID)
+	assert.Equal(t, 4, report.Unfixed())
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/consistency/fix", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer secret")
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Equal(t, 3, report.Unfixed())
+}
@@ -0,0 +1,62 @@
+package consistency
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type Handler struct {
+	checker *Checker
+	log     *zerolog.Logger
+}
+
+// RegisterConsistencyHandler - проверка данных оператора запроса, доступна только
+// администратору, adminAuth проверяет доступ
+func RegisterConsistencyHandler(
+	router fiber.Router,
+	checker *Checker,
+	logger *zerolog.Logger,
+	adminAuth ...fiber.Handler,
+) {
+	h := &Handler{
+		checker: checker,
+		log:     logger,
+	}
+
+	router.Get("/admin/consistency", withMiddlewares(adminAuth, h.check)...)
+	router.Post("/admin/consistency/fix", withMiddlewares(adminAuth, h.fix)...)
+}
+
+func withMiddlewares(middlewares []fiber.Handler, handlers ...fiber.Handler) []fiber.Handler {
+	res := make([]fiber.Handler, 0, len(middlewares)+len(handlers))
+	res = append(res, middlewares...)
+
+	return append(res, handlers...)
+}
+
+func (h *Handler) check(fCtx *fiber.Ctx) error {
+	return h.run(fCtx, false)
+}
+
+func (h *Handler) fix(fCtx *fiber.Ctx) error {
+	return h.run(fCtx, true)
+}
+
+func (h *Handler) run(fCtx *fiber.Ctx, fix bool) error {
+	report, err := h.checker.Check(fCtx.UserContext(), fix)
+	if err != nil {
+		h.log.Err(err).
+			Bool("fix", fix).
+			Msg("consistency check failed")
+		return err
+	}
+
+	h.log.Info().
+		Str("tenant", string(report.TenantID)).
+		Bool("fix", fix).
+		Int("issues", len(report.Issues)).
+		Int("unfixed", report.Unfixed()).
+		Msg("consistency checked")
+
+	return fCtx.Status(fiber.StatusOK).JSON(report)
+}
@@ -0,0 +1,96 @@
+package privacy
+
+import (
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/session"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"strconv"
+)
+
+type Handler struct {
+	service *Service
+	log     *zerolog.Logger
+}
+
+// RegisterPrivacyHandler - выгрузку запрашивает сам пользователь или администратор,
+// удаление данных выполняет только администратор, adminAuth проверяет доступ
+func RegisterPrivacyHandler(
+	router fiber.Router,
+	service *Service,
+	sessions *session.Manager,
+	logger *zerolog.Logger,
+	adminAuth ...fiber.Handler,
+) {
+	h := &Handler{
+		service: service,
+		log:     logger,
+	}
+
+	router.Get("/users/:userID/export", session.Middleware(sessions), session.Owner("userID"), h.export)
+
+	router.Get("/admin/users/:userID/export", withMiddlewares(adminAuth, h.export)...)
+	router.Post("/admin/users/:userID/erase", withMiddlewares(adminAuth, h.erase)...)
+}
+
+func withMiddlewares(middlewares []fiber.Handler, handlers ...fiber.Handler) []fiber.Handler {
+	res := make([]fiber.Handler, 0, len(middlewares)+len(handlers))
+	res = append(res, middlewares...)
+
+	return append(res, handlers...)
+}
+
+// export - отдает архив файлом для скачивания
+func (h *Handler) export(fCtx *fiber.Ctx) error {
+	userID, err := h.getUserID(fCtx)
+	if err != nil {
+		return err
+	}
+
+	export, err := h.service.Export(fCtx.UserContext(), userID)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("export failed")
+		return err
+	}
+
+	h.log.Info().
+		Int("userID", int(userID)).
+		Msg("user data exported")
+
+	fCtx.Attachment("user-" + strconv.Itoa(int(userID)) + "-export.json")
+
+	return fCtx.Status(fiber.StatusOK).JSON(export)
+}
+
+func (h *Handler) erase(fCtx *fiber.Ctx) error {
+	userID, err := h.getUserID(fCtx)
+	if err != nil {
+		return err
+	}
+
+	err = h.service.Erase(fCtx.UserContext(), userID)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("erase failed")
+		return err
+	}
+
+	h.log.Info().
+		Int("userID", int(userID)).
+		Msg("user data erased")
+
+	return fCtx.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) getUserID(fCtx *fiber.Ctx) (models.UserID, error) {
+	id, err := fCtx.ParamsInt("userID")
+	if err != nil {
+		h.log.Err(err).Msg("invalid variable type")
+		return 0, err
+	}
+
+	return models.UserID(id), nil
+}
@@ -0,0 +1,184 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/modules/users"
+	"github.com/IlnurShafikov/wallet/modules/wallet"
+	"github.com/IlnurShafikov/wallet/services/loginhistory"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/transaction"
+	"time"
+)
+
+// loginsPageSize - размер страницы при выгрузке истории входов
+const loginsPageSize = 100
+
+type userStore interface {
+	users.IDGetter
+	users.Renamer
+}
+
+type walletGetter interface {
+	Get(ctx context.Context, userID models.UserID) (models.Balance, error)
+}
+
+type sessionRevoker interface {
+	RevokeUser(ctx context.Context, userID models.UserID) error
+}
+
+// Export - все данные пользователя для ответа на запрос субъекта данных
+type Export struct {
+	ExportedAt time.Time               `json:"exported_at"`
+	TenantID   models.TenantID         `json:"tenant_id"`
+	Profile    ExportProfile           `json:"profile"`
+	Wallets    []models.Wallet         `json:"wallets"`
+	Rounds     []transaction.UserRound `json:"rounds"`
+	Logins     []loginhistory.Entry    `json:"logins"`
+}
+
+// ExportProfile - данные пользователя без хеша пароля и секретов второго фактора
+type ExportProfile struct {
+	UserID           models.UserID   `json:"user_id"`
+	Login            string          `json:"login"`
+	CreatedAt        time.Time       `json:"created_at"`
+	Profile          models.Profile  `json:"profile"`
+	TwoFactorEnabled bool            `json:"two_factor_enabled"`
+	KYC              *models.KYC     `json:"kyc,omitempty"`
+	Account          *models.Account `json:"account,omitempty"`
+	ErasedAt         *time.Time      `json:"erased_at,omitempty"`
+}
+
+// Service - выгрузка и удаление персональных данных. Раунды и балансы
+// не содержат персональных данных и хранятся после удаления
+type Service struct {
+	users    userStore
+	wallets  walletGetter
+	rounds   transaction.Lister
+	logins   loginhistory.Repository
+	sessions sessionRevoker
+	now      func() time.Time
+}
+
+func NewService(
+	users userStore,
+	wallets walletGetter,
+	rounds transaction.Lister,
+	logins loginhistory.Repository,
+	sessions sessionRevoker,
+) *Service {
+	return &Service{
+		users:    users,
+		wallets:  wallets,
+		rounds:   rounds,
+		logins:   logins,
+		sessions: sessions,
+		now:      time.Now,
+	}
+}
+
+func (s *Service) Export(ctx context.Context, userID models.UserID) (*Export, error) {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	wallets := []models.Wallet{}
+
+	balance, err := s.wallets.Get(ctx, userID)
+	switch {
+	case err == nil:
+		wallets = append(wallets, models.Wallet{UserID: userID, Balance: balance})
+	case !errors.Is(err, wallet.ErrWalletNotFound):
+		return nil, err
+	}
+
+	rounds, err := s.rounds.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if rounds == nil {
+		rounds = []transaction.UserRound{}
+	}
+
+	logins, err := s.allLogins(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Export{
+		ExportedAt: s.now().UTC(),
+		TenantID:   tenant.FromContext(ctx),
+		Profile: ExportProfile{
+			UserID:           user.ID,
+			Login:            user.Login,
+			CreatedAt:        user.CreatedAt,
+			Profile:          user.Profile,
+			TwoFactorEnabled: user.TwoFactor != nil && user.TwoFactor.Enabled,
+			KYC:              user.KYC,
+			Account:          user.Account,
+			ErasedAt:         user.ErasedAt,
+		},
+		Wallets: wallets,
+		Rounds:  rounds,
+		Logins:  logins,
+	}, nil
+}
+
+// Erase - заменяет логин псевдонимом и удаляет анкету, пароль, второй фактор,
+// данные документа KYC, историю входов и сессии. Повторный вызов ничего не меняет
+func (s *Service) Erase(ctx context.Context, userID models.UserID) error {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.ErasedAt != nil {
+		return nil
+	}
+
+	err = s.sessions.RevokeUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	login := user.Login
+	erasedAt := s.now().UTC()
+
+	// двоеточие недопустимо в логине, поэтому псевдоним не занят
+	user.Login = "erased:" + userID.String()
+	user.Password = nil
+	user.Profile = models.Profile{}
+	user.TwoFactor = nil
+	user.ErasedAt = &erasedAt
+
+	if user.KYC != nil {
+		user.KYC.Submission = nil
+	}
+
+	err = s.users.Rename(ctx, login, *user)
+	if err != nil {
+		return err
+	}
+
+	return s.logins.DeleteByUser(ctx, userID)
+}
+
+func (s *Service) allLogins(ctx context.Context, userID models.UserID) ([]loginhistory.Entry, error) {
+	logins := []loginhistory.Entry{}
+
+	for {
+		entries, total, err := s.logins.List(ctx, userID, len(logins), loginsPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		logins = append(logins, entries...)
+
+		if len(entries) == 0 || len(logins) >= total {
+			return logins, nil
+		}
+	}
+}
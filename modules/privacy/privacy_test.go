@@ -0,0 +1,158 @@
+package privacy
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/modules/users"
+	"github.com/IlnurShafikov/wallet/modules/users/repositories"
+	"github.com/IlnurShafikov/wallet/modules/wallet"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
+	"github.com/IlnurShafikov/wallet/services/loginhistory"
+	"github.com/IlnurShafikov/wallet/services/session"
+	"github.com/IlnurShafikov/wallet/services/sqlite"
+	"github.com/IlnurShafikov/wallet/services/transaction"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type backend struct {
+	users   users.Repository
+	wallets wallet.Repository
+	rounds  interface {
+		transaction.Repository
+		transaction.Lister
+	}
+	logins   loginhistory.Repository
+	sessions session.Repository
+}
+
+func TestService(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	client := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	keys := keyschema.Default()
+
+	db, err := sqlite.Open(context.Background(), filepath.Join(t.TempDir(), "wallet.db"), time.Second)
+	require.NoError(t, err)
+	defer db.Close()
+
+	backends := map[string]backend{
+		"in memory": {
+			users:    repositories.NewInMemoryRepository(),
+			wallets:  wallet.NewInMemoryRepository(),
+			rounds:   transaction.NewInMemoryRepository(),
+			logins:   loginhistory.NewInMemoryRepository(loginhistory.DefaultSize),
+			sessions: session.NewInMemoryRepository(),
+		},
+		"redis": {
+			users:    repositories.NewRedisRepository(client, keys, 0),
+			wallets:  wallet.NewRedisRepository(client, keys, 0),
+			rounds:   transaction.NewRedisRepository(client, keys, transaction.TTL{}),
+			logins:   loginhistory.NewRedisRepository(client, loginhistory.DefaultSize),
+			sessions: session.NewRedisRepository(client, keyschema.Default()),
+		},
+		"sqlite": {
+			users:    repositories.NewSQLiteRepository(db),
+			wallets:  wallet.NewSQLiteRepository(db),
+			rounds:   transaction.NewSQLiteRepository(db),
+			logins:   loginhistory.NewInMemoryRepository(loginhistory.DefaultSize),
+			sessions: session.NewInMemoryRepository(),
+		},
+	}
+
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	for name, b := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			user, err := b.users.Create(ctx, "user01", []byte("hash"))
+			require.NoError(t, err)
+
+			user.Profile = models.Profile{Email: "user01@example.com", DisplayName: "User"}
+			user.TwoFactor = &models.TwoFactor{Secret: "SECRET", Enabled: true}
+			user.KYC = &models.KYC{
+				Status:     models.KYCPending,
+				Submission: &models.KYCSubmission{FullName: "John Doe", DocumentNumber: "123"},
+			}
+			require.NoError(t, b.users.Update(ctx, *user))
+
+			require.NoError(t, b.wallets.Create(ctx, user.ID, 100))
+
+			roundID := uuid.Must(uuid.NewV4())
+			require.NoError(t, b.rounds.CreateBet(ctx, roundID, models.Round{
+				UserID: user.ID,
+				Bet:    models.Transaction{Amount: -10, Created: now},
+			}))
+
+			require.NoError(t, b.logins.Add(ctx, loginhistory.Entry{
+				UserID:  user.ID,
+				Success: true,
+				IP:      "10.0.0.1",
+				At:      now,
+			}))
+
+			sessions := session.NewManager(b.sessions, time.Hour)
+			token, _, err := sessions.Start(ctx, user.ID, session.Client{IP: "10.0.0.1"})
+			require.NoError(t, err)
+
+			service := NewService(b.users, b.wallets, b.rounds, b.logins, sessions)
+			service.now = func() time.Time { return now }
+
+			export, err := service.Export(ctx, user.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "user01", export.Profile.Login)
+			assert.Equal(t, "user01@example.com", export.Profile.Profile.Email)
+			assert.True(t, export.Profile.TwoFactorEnabled)
+			assert.Equal(t, []models.Wallet{{UserID: user.ID, Balance: 100}}, export.Wallets)
+			require.Len(t, export.Rounds, 1)
+			assert.Equal(t, roundID, export.Rounds[0].RoundID)
+			require.Len(t, export.Logins, 1)
+
+			data, err := json.Marshal(export)
+			require.NoError(t, err)
+			assert.NotContains(t, string(data), "SECRET")
+			assert.NotContains(t, string(data), "hash")
+
+			require.NoError(t, service.Erase(ctx, user.ID))
+
+			_, err = b.users.Get(ctx, "user01")
+			assert.ErrorIs(t, err, repositories.ErrUserNotFound)
+
+			erased, err := b.users.GetByID(ctx, user.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "erased:"+user.ID.String(), erased.Login)
+			assert.Empty(t, erased.Password)
+			assert.Equal(t, models.Profile{}, erased.Profile)
+			assert.Nil(t, erased.TwoFactor)
+			assert.Nil(t, erased.KYC.Submission)
+			assert.Equal(t, models.KYCPending, erased.KYC.Status)
+			require.NotNil(t, erased.ErasedAt)
+
+			_, err = sessions.Authenticate(ctx, token)
+			assert.ErrorIs(t, err, session.ErrUnauthorized)
+
+			// финансовые записи сохраняются
+			export, err = service.Export(ctx, user.ID)
+			require.NoError(t, err)
+			assert.Equal(t, []models.Wallet{{UserID: user.ID, Balance: 100}}, export.Wallets)
+			assert.Len(t, export.Rounds, 1)
+			assert.Empty(t, export.Logins)
+			assert.Empty(t, export.Profile.Profile.Email)
+
+			assert.NoError(t, service.Erase(ctx, user.ID))
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/session"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type AdminService interface {
+	Unlock(ctx context.Context, userID models.UserID) error
+	ResetTwoFactor(ctx context.Context, userID models.UserID) error
+	DecideKYC(ctx context.Context, userID models.UserID, req DecideKYCRequest) (*models.KYC, error)
+	GetAccount(ctx context.Context, userID models.UserID) (*models.Account, error)
+	SetStatus(ctx context.Context, userID models.UserID, req SetStatusRequest) (*models.Account, error)
+}
+
+// adminSessions - просмотр и завершение сессий пользователя
+type adminSessions interface {
+	sessionRevoker
+	List(ctx context.Context, userID models.UserID) ([]session.Session, error)
+	Revoke(ctx context.Context, userID models.UserID, sessionID string) error
+}
+
+type loginLister interface {
+	List(ctx context.Context, userID models.UserID, page Page) (*LoginsResponse, error)
+}
+
+type AdminHandler struct {
+	service  AdminService
+	sessions adminSessions
+	history  loginLister
+	log      *zerolog.Logger
+}
+
+// RegisterAdminHandler - административные методы, adminAuth проверяет доступ
+func RegisterAdminHandler(
+	router fiber.Router,
+	service AdminService,
+	sessions adminSessions,
+	history loginLister,
+	logger *zerolog.Logger,
+	adminAuth ...fiber.Handler,
+) {
+	h := &AdminHandler{
+		service:  service,
+		sessions: sessions,
+		history:  history,
+		log:      logger,
+	}
+
+	adminGroup := router.Group("/admin/users", adminAuth...)
+	adminGroup.Post("/:userID/unlock", h.unlock)
+	adminGroup.Delete("/:userID/2fa", h.resetTwoFactor)
+	adminGroup.Post("/:userID/kyc", h.decideKYC)
+	adminGroup.Get("/:userID/status", h.getStatus)
+	adminGroup.Put("/:userID/status", h.setStatus)
+	adminGroup.Get("/:userID/logins", h.logins)
+	adminGroup.Get("/:userID/sessions", h.listSessions)
+	adminGroup.Delete("/:userID/sessions/:sessionID", h.revokeSession)
+}
+
+func (h *AdminHandler) unlock(fCtx *fiber.Ctx) error {
+	userID, err := h.getUserID(fCtx)
+	if err != nil {
+		return err
+	}
+
+	err = h.service.Unlock(fCtx.UserContext(), userID)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("unlock failed")
+		return err
+	}
+
+	h.log.Info().
+		Int("userID", int(userID)).
+		Msg("user unlocked")
+
+	return fCtx.SendStatus(fiber.StatusNoContent)
+}
+
+// resetTwoFactor - для пользователя, потерявшего устройство и коды восстановления
+func (h *AdminHandler) resetTwoFactor(fCtx *fiber.Ctx) error {
+	userID, err := h.getUserID(fCtx)
+	if err != nil {
+		return err
+	}
+
+	err = h.service.ResetTwoFactor(fCtx.UserContext(), userID)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("reset two-factor failed")
+		return err
+	}
+
+	h.log.Info().
+		Int("userID", int(userID)).
+		Msg("two-factor reset")
+
+	return fCtx.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *AdminHandler) decideKYC(fCtx *fiber.Ctx) error {
+	userID, err := h.getUserID(fCtx)
+	if err != nil {
+		return err
+	}
+
+	req := DecideKYCRequest{}
+	if err := json.Unmarshal(fCtx.Body(), &req); err != nil {
+		h.log.Err(err).Msg("unmarshal failed")
+		return err
+	}
+
+	kyc, err := h.service.DecideKYC(fCtx.UserContext(), userID, req)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("kyc decision failed")
+		return err
+	}
+
+	h.log.Info().
+		Int("userID", int(userID)).
+		Str("status", string(kyc.Status)).
+		Msg("kyc decided")
+
+	return fCtx.Status(fiber.StatusOK).JSON(newKYCResponse(kyc))
+}
+
+func (h *AdminHandler) getStatus(fCtx *fiber.Ctx) error {
+	userID, err := h.getUserID(fCtx)
+	if err != nil {
+		return err
+	}
+
+	account, err := h.service.GetAccount(fCtx.UserContext(), userID)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("get status failed")
+		return err
+	}
+
+	return fCtx.Status(fiber.StatusOK).JSON(account)
+}
+
+// setStatus - при блокировке все сессии пользователя завершаются
+func (h *AdminHandler) setStatus(fCtx *fiber.Ctx) error {
+	userID, err := h.getUserID(fCtx)
+	if err != nil {
+		return err
+	}
+
+	req := SetStatusRequest{}
+	if err := json.Unmarshal(fCtx.Body(), &req); err != nil {
+		h.log.Err(err).Msg("unmarshal failed")
+		return err
+	}
+
+	ctx := fCtx.UserContext()
+
+	account, err := h.service.SetStatus(ctx, userID, req)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("set status failed")
+		return err
+	}
+
+	if account.Status != models.UserActive {
+		err = h.sessions.RevokeUser(ctx, userID)
+		if err != nil {
+			h.log.Err(err).
+				Int("userID", int(userID)).
+				Msg("revoke sessions failed")
+			return err
+		}
+	}
+
+	h.log.Info().
+		Int("userID", int(userID)).
+		Str("status", string(account.Status)).
+		Str("reason", req.Reason).
+		Msg("user status changed")
+
+	return fCtx.Status(fiber.StatusOK).JSON(account)
+}
+
+func (h *AdminHandler) logins(fCtx *fiber.Ctx) error {
+	userID, err := h.getUserID(fCtx)
+	if err != nil {
+		return err
+	}
+
+	page, err := parsePage(fCtx)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.history.List(fCtx.UserContext(), userID, page)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("get login history failed")
+		return err
+	}
+
+	return fCtx.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (h *AdminHandler) listSessions(fCtx *fiber.Ctx) error {
+	userID, err := h.getUserID(fCtx)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := h.sessions.List(fCtx.UserContext(), userID)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("list sessions failed")
+		return err
+	}
+
+	return fCtx.Status(fiber.StatusOK).JSON(newSessionsResponse(sessions, ""))
+}
+
+func (h *AdminHandler) revokeSession(fCtx *fiber.Ctx) error {
+	userID, err := h.getUserID(fCtx)
+	if err != nil {
+		return err
+	}
+
+	sessionID := fCtx.Params("sessionID")
+
+	err = h.sessions.Revoke(fCtx.UserContext(), userID, sessionID)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Str("sessionID", sessionID).
+			Msg("revoke session failed")
+		return err
+	}
+
+	h.log.Info().
+		Int("userID", int(userID)).
+		Str("sessionID", sessionID).
+		Msg("session revoked")
+
+	return fCtx.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *AdminHandler) getUserID(fCtx *fiber.Ctx) (models.UserID, error) {
+	id, err := fCtx.ParamsInt("userID")
+	if err != nil {
+		h.log.Err(err).Msg("invalid variable type")
+		return 0, err
+	}
+
+	return models.UserID(id), nil
+}
@@ -5,15 +5,31 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/session"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/throttle"
 	"github.com/gofiber/fiber/v2"
 	"github.com/rs/zerolog"
+	"time"
 )
 
 var ErrAuthorizationFailed = errors.New("authorization failed")
 
+type sessionStarter interface {
+	Start(ctx context.Context, userID models.UserID, client session.Client) (string, *session.Session, error)
+}
+
+// loginRecorder - журнал попыток входа, userID равен 0, если вход не удался
+type loginRecorder interface {
+	Record(ctx context.Context, login string, userID models.UserID, client session.Client, authErr error) error
+}
+
 type AuthorizationHandler struct {
-	service Service
-	log     *zerolog.Logger
+	service    Service
+	challenger LoginChallenger
+	sessions   sessionStarter
+	history    loginRecorder
+	log        *zerolog.Logger
 }
 
 type loginRequest struct {
@@ -21,21 +37,42 @@ type loginRequest struct {
 	Password string `json:"password"`
 }
 
+type twoFactorLoginRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
 type loginResponse struct {
-	UserID models.UserID `json:"user_id"`
+	UserID    models.UserID   `json:"user_id"`
+	TenantID  models.TenantID `json:"tenant_id"`
+	Token     string          `json:"token"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// challengeResponse - пароль верный, сессия будет выдана после кода второго фактора
+type challengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	Challenge         string `json:"challenge"`
 }
 
 func RegisterAuthorizationHandler(
 	router fiber.Router,
 	service Service,
+	challenger LoginChallenger,
+	sessions sessionStarter,
+	history loginRecorder,
 	logger *zerolog.Logger,
 ) {
 	auth := &AuthorizationHandler{
-		service: service,
-		log:     logger,
+		service:    service,
+		challenger: challenger,
+		sessions:   sessions,
+		history:    history,
+		log:        logger,
 	}
 
 	router.Post("/login", auth.authorization)
+	router.Post("/login/2fa", auth.twoFactor)
 }
 
 func (h *AuthorizationHandler) authorization(fCtx *fiber.Ctx) error {
@@ -45,19 +82,105 @@ func (h *AuthorizationHandler) authorization(fCtx *fiber.Ctx) error {
 		return err
 	}
 
-	userID, err := h.service.Authorization(context.Background(), req.Login, req.Password)
+	client := clientInfo(fCtx)
+	ctx := throttle.WithClientIP(fCtx.UserContext(), client.IP)
+
+	userID, err := h.service.Authorization(ctx, req.Login, req.Password)
 	if err != nil {
 		h.log.Err(err).Msg("authorization failed")
+		h.record(ctx, req.Login, 0, client, err)
+		return err
+	}
+
+	challenge, err := h.challenger.Challenge(ctx, userID)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("two-factor challenge failed")
+		return err
+	}
+
+	if challenge != "" {
+		h.log.Debug().
+			Int("userID", int(userID)).
+			Msg("two-factor required")
+
+		return fCtx.Status(fiber.StatusOK).JSON(challengeResponse{
+			TwoFactorRequired: true,
+			Challenge:         challenge,
+		})
+	}
+
+	return h.startSession(fCtx, ctx, req.Login, userID, client)
+}
+
+func (h *AuthorizationHandler) twoFactor(fCtx *fiber.Ctx) error {
+	req := twoFactorLoginRequest{}
+	if err := json.Unmarshal(fCtx.Body(), &req); err != nil {
+		h.log.Err(err).Msg("unmarshal failed")
 		return err
 	}
 
+	ctx := fCtx.UserContext()
+
+	userID, err := h.challenger.CompleteChallenge(ctx, req.Challenge, req.Code)
+	if err != nil {
+		h.log.Err(err).Msg("two-factor authorization failed")
+		return err
+	}
+
+	return h.startSession(fCtx, ctx, "", userID, clientInfo(fCtx))
+}
+
+// startSession - вход считается успешным, когда выдана сессия
+func (h *AuthorizationHandler) startSession(
+	fCtx *fiber.Ctx,
+	ctx context.Context,
+	login string,
+	userID models.UserID,
+	client session.Client,
+) error {
+	token, userSession, err := h.sessions.Start(ctx, userID, client)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("start session failed")
+		return err
+	}
+
+	h.record(ctx, login, userID, client, nil)
+
 	h.log.Debug().
 		Int("userID", int(userID)).
 		Msg("authorization successful")
 
-	err = fCtx.Status(fiber.StatusOK).JSON(loginResponse{
-		UserID: userID,
+	return fCtx.Status(fiber.StatusOK).JSON(loginResponse{
+		UserID:    userID,
+		TenantID:  tenant.FromContext(ctx),
+		Token:     token,
+		ExpiresAt: userSession.ExpiresAt,
 	})
+}
+
+// record - ошибка журнала не влияет на результат входа
+func (h *AuthorizationHandler) record(
+	ctx context.Context,
+	login string,
+	userID models.UserID,
+	client session.Client,
+	authErr error,
+) {
+	err := h.history.Record(ctx, login, userID, client, authErr)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("record login failed")
+	}
+}
 
-	return err
+func clientInfo(fCtx *fiber.Ctx) session.Client {
+	return session.Client{
+		IP:        fCtx.IP(),
+		UserAgent: fCtx.Get(fiber.HeaderUserAgent),
+	}
 }
@@ -0,0 +1,288 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/session"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	kycActorUser  = "user"
+	kycActorAdmin = "admin"
+
+	maxFullNameLength       = 128
+	maxDocumentNumberLength = 64
+)
+
+var (
+	ErrKYCAlreadySubmitted = apierror.New(http.StatusConflict, "kyc_already_submitted", "verification is already pending or completed")
+	ErrKYCNotPending       = apierror.New(http.StatusConflict, "kyc_not_pending", "verification is not pending")
+)
+
+var documentTypes = map[string]bool{
+	"passport":        true,
+	"id_card":         true,
+	"driving_license": true,
+}
+
+type KYCService interface {
+	SubmitKYC(ctx context.Context, userID models.UserID, req SubmitKYCRequest) (*models.KYC, error)
+	GetKYC(ctx context.Context, userID models.UserID) (*models.KYC, error)
+}
+
+type SubmitKYCRequest struct {
+	FullName       string `json:"full_name"`
+	DocumentType   string `json:"document_type"`
+	DocumentNumber string `json:"document_number"`
+}
+
+// DecideKYCRequest - решение администратора, при отказе причина обязательна
+type DecideKYCRequest struct {
+	Status models.KYCStatus `json:"status"`
+	Reason string           `json:"reason"`
+}
+
+type KYCResponse struct {
+	Status  models.KYCStatus   `json:"status"`
+	History []models.KYCChange `json:"history"`
+}
+
+func (r SubmitKYCRequest) Validate() error {
+	var fields []apierror.FieldError
+
+	name := strings.TrimSpace(r.FullName)
+	if name == "" || utf8.RuneCountInString(name) > maxFullNameLength {
+		fields = append(fields, apierror.FieldError{
+			Field:   "full_name",
+			Code:    "invalid",
+			Message: "must be between 1 and 128 characters",
+		})
+	}
+
+	if !documentTypes[r.DocumentType] {
+		fields = append(fields, apierror.FieldError{
+			Field:   "document_type",
+			Code:    "invalid",
+			Message: "must be passport, id_card or driving_license",
+		})
+	}
+
+	number := strings.TrimSpace(r.DocumentNumber)
+	if number == "" || len(number) > maxDocumentNumberLength {
+		fields = append(fields, apierror.FieldError{
+			Field:   "document_number",
+			Code:    "invalid",
+			Message: "must be between 1 and 64 characters",
+		})
+	}
+
+	if len(fields) > 0 {
+		return apierror.Validation(fields)
+	}
+
+	return nil
+}
+
+func (r DecideKYCRequest) Validate() error {
+	var fields []apierror.FieldError
+
+	if r.Status != models.KYCVerified && r.Status != models.KYCRejected {
+		fields = append(fields, apierror.FieldError{
+			Field:   "status",
+			Code:    "invalid",
+			Message: "must be verified or rejected",
+		})
+	}
+
+	if r.Status == models.KYCRejected && strings.TrimSpace(r.Reason) == "" {
+		fields = append(fields, apierror.FieldError{
+			Field:   "reason",
+			Code:    "required",
+			Message: "is required when verification is rejected",
+		})
+	}
+
+	if len(fields) > 0 {
+		return apierror.Validation(fields)
+	}
+
+	return nil
+}
+
+// SubmitKYC - повторная отправка возможна только после отказа
+func (u *UserService) SubmitKYC(
+	ctx context.Context,
+	userID models.UserID,
+	req SubmitKYCRequest,
+) (*models.KYC, error) {
+	err := req.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := u.repository.Modify(ctx, userID, func(user *models.User) error {
+		status := user.KYCStatus()
+		if status != models.KYCNone && status != models.KYCRejected {
+			return ErrKYCAlreadySubmitted
+		}
+
+		if user.KYC == nil {
+			user.KYC = &models.KYC{}
+		}
+
+		user.KYC.Submission = &models.KYCSubmission{
+			FullName:       strings.TrimSpace(req.FullName),
+			DocumentType:   req.DocumentType,
+			DocumentNumber: strings.TrimSpace(req.DocumentNumber),
+			SubmittedAt:    u.now().UTC(),
+		}
+		u.changeKYCStatus(user.KYC, models.KYCPending, kycActorUser, "")
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user.KYC, nil
+}
+
+func (u *UserService) GetKYC(ctx context.Context, userID models.UserID) (*models.KYC, error) {
+	user, err := u.repository.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.KYC == nil {
+		return &models.KYC{Status: models.KYCNone}, nil
+	}
+
+	return user.KYC, nil
+}
+
+// DecideKYC - решение принимается только по ожидающей проверке
+func (u *UserService) DecideKYC(
+	ctx context.Context,
+	userID models.UserID,
+	req DecideKYCRequest,
+) (*models.KYC, error) {
+	err := req.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := u.repository.Modify(ctx, userID, func(user *models.User) error {
+		if user.KYCStatus() != models.KYCPending {
+			return ErrKYCNotPending
+		}
+
+		u.changeKYCStatus(user.KYC, req.Status, kycActorAdmin, strings.TrimSpace(req.Reason))
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user.KYC, nil
+}
+
+// KYCStatus - статус проверки для ограничения платежей
+func (u *UserService) KYCStatus(ctx context.Context, userID models.UserID) (models.KYCStatus, error) {
+	user, err := u.repository.GetByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	return user.KYCStatus(), nil
+}
+
+func (u *UserService) changeKYCStatus(kyc *models.KYC, status models.KYCStatus, actor, reason string) {
+	kyc.Status = status
+	kyc.History = append(kyc.History, models.KYCChange{
+		Status: status,
+		Actor:  actor,
+		Reason: reason,
+		At:     u.now().UTC(),
+	})
+}
+
+type KYCHandler struct {
+	service KYCService
+	log     *zerolog.Logger
+}
+
+// RegisterKYCHandler - данные проверки доступны только владельцу сессии
+func RegisterKYCHandler(
+	router fiber.Router,
+	service KYCService,
+	sessions *session.Manager,
+	logger *zerolog.Logger,
+) {
+	h := &KYCHandler{
+		service: service,
+		log:     logger,
+	}
+
+	auth := []fiber.Handler{session.Middleware(sessions), session.Owner("userID")}
+
+	router.Get("/users/:userID/kyc", append(auth, h.getKYC)...)
+	router.Post("/users/:userID/kyc", append(auth, h.submitKYC)...)
+}
+
+func (h *KYCHandler) getKYC(fCtx *fiber.Ctx) error {
+	userID := session.FromContext(fCtx.UserContext()).UserID
+
+	kyc, err := h.service.GetKYC(fCtx.UserContext(), userID)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("get kyc failed")
+		return err
+	}
+
+	return fCtx.Status(fiber.StatusOK).JSON(newKYCResponse(kyc))
+}
+
+func (h *KYCHandler) submitKYC(fCtx *fiber.Ctx) error {
+	userID := session.FromContext(fCtx.UserContext()).UserID
+
+	req := SubmitKYCRequest{}
+	if err := json.Unmarshal(fCtx.Body(), &req); err != nil {
+		h.log.Err(err).Msg("unmarshal failed")
+		return err
+	}
+
+	kyc, err := h.service.SubmitKYC(fCtx.UserContext(), userID, req)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("submit kyc failed")
+		return err
+	}
+
+	h.log.Info().
+		Int("userID", int(userID)).
+		Msg("kyc submitted")
+
+	return fCtx.Status(fiber.StatusOK).JSON(newKYCResponse(kyc))
+}
+
+func newKYCResponse(kyc *models.KYC) KYCResponse {
+	history := kyc.History
+	if history == nil {
+		history = []models.KYCChange{}
+	}
+
+	return KYCResponse{
+		Status:  kyc.Status,
+		History: history,
+	}
+}
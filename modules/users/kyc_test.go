@@ -0,0 +1,70 @@
+package users
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/modules/users/repositories"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/security"
+	"github.com/IlnurShafikov/wallet/services/throttle"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestUserService_KYC(t *testing.T) {
+	log := zerolog.Nop()
+	ctx := context.Background()
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	repo := repositories.NewInMemoryRepository()
+	user, err := repo.Create(ctx, "user01", []byte("hash"))
+	require.NoError(t, err)
+
+	service := NewUserService(repo, security.NewChain(security.NewBcryptHashing("secret")),
+		throttle.NewLimiter(throttle.NewInMemoryRepository(), throttle.DefaultPolicy()), &log)
+	service.now = func() time.Time { return now }
+
+	status, err := service.KYCStatus(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.KYCNone, status)
+
+	submission := SubmitKYCRequest{FullName: "Ilnur Shafikov", DocumentType: "passport", DocumentNumber: "1234 567890"}
+
+	_, err = service.SubmitKYC(ctx, user.ID, SubmitKYCRequest{DocumentType: "selfie"})
+	assert.ErrorIs(t, err, apierror.ErrValidation)
+
+	_, err = service.DecideKYC(ctx, user.ID, DecideKYCRequest{Status: models.KYCVerified})
+	assert.ErrorIs(t, err, ErrKYCNotPending)
+
+	kyc, err := service.SubmitKYC(ctx, user.ID, submission)
+	require.NoError(t, err)
+	assert.Equal(t, models.KYCPending, kyc.Status)
+
+	_, err = service.SubmitKYC(ctx, user.ID, submission)
+	assert.ErrorIs(t, err, ErrKYCAlreadySubmitted)
+
+	_, err = service.DecideKYC(ctx, user.ID, DecideKYCRequest{Status: models.KYCRejected})
+	assert.ErrorIs(t, err, apierror.ErrValidation)
+
+	_, err = service.DecideKYC(ctx, user.ID, DecideKYCRequest{Status: models.KYCRejected, Reason: "document expired"})
+	require.NoError(t, err)
+
+	_, err = service.SubmitKYC(ctx, user.ID, submission)
+	require.NoError(t, err)
+
+	kyc, err = service.DecideKYC(ctx, user.ID, DecideKYCRequest{Status: models.KYCVerified})
+	require.NoError(t, err)
+	assert.Equal(t, models.KYCVerified, kyc.Status)
+
+	kyc, err = service.GetKYC(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []models.KYCChange{
+		{Status: models.KYCPending, Actor: kycActorUser, At: now},
+		{Status: models.KYCRejected, Actor: kycActorAdmin, Reason: "document expired", At: now},
+		{Status: models.KYCPending, Actor: kycActorUser, At: now},
+		{Status: models.KYCVerified, Actor: kycActorAdmin, At: now},
+	}, kyc.History)
+}
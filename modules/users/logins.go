@@ -0,0 +1,244 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/modules/users/repositories"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/loginhistory"
+	"github.com/IlnurShafikov/wallet/services/session"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// Page - страница списка, offset считается от самой новой записи
+type Page struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+type LoginsResponse struct {
+	Page
+	Total int                  `json:"total"`
+	Items []loginhistory.Entry `json:"items"`
+}
+
+type SessionResponse struct {
+	session.Session
+	Current bool `json:"current"`
+}
+
+// LoginHistory - журнал успешных и неудачных входов
+type LoginHistory struct {
+	users      Getter
+	repository loginhistory.Repository
+	now        func() time.Time
+}
+
+func NewLoginHistory(users Getter, repository loginhistory.Repository) *LoginHistory {
+	return &LoginHistory{
+		users:      users,
+		repository: repository,
+		now:        time.Now,
+	}
+}
+
+// Record - записывает попытку входа. Для неудачной попытки userID неизвестен
+// и ищется по логину, попытки с несуществующим логином не записываются
+func (l *LoginHistory) Record(
+	ctx context.Context,
+	login string,
+	userID models.UserID,
+	client session.Client,
+	authErr error,
+) error {
+	if userID == 0 {
+		user, err := l.users.Get(ctx, login)
+		if err != nil {
+			if errors.Is(err, repositories.ErrUserNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		userID = user.ID
+	}
+
+	return l.repository.Add(ctx, loginhistory.Entry{
+		UserID:    userID,
+		Success:   authErr == nil,
+		Reason:    loginFailureReason(authErr),
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		At:        l.now().UTC(),
+	})
+}
+
+func (l *LoginHistory) List(ctx context.Context, userID models.UserID, page Page) (*LoginsResponse, error) {
+	entries, total, err := l.repository.List(ctx, userID, page.Offset, page.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginsResponse{
+		Page:  page,
+		Total: total,
+		Items: entries,
+	}, nil
+}
+
+func loginFailureReason(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	if errors.Is(err, ErrAuthorizationFailed) {
+		return "invalid_credentials"
+	}
+
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+
+	return "error"
+}
+
+// parsePage - читает offset и limit из query, limit по умолчанию 20, не больше 100
+func parsePage(fCtx *fiber.Ctx) (Page, error) {
+	page := Page{Limit: defaultPageLimit}
+
+	var fields []apierror.FieldError
+
+	if value := fCtx.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			fields = append(fields, apierror.FieldError{
+				Field:   "offset",
+				Code:    "invalid",
+				Message: "must be a non-negative integer",
+			})
+		}
+		page.Offset = offset
+	}
+
+	if value := fCtx.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			fields = append(fields, apierror.FieldError{
+				Field:   "limit",
+				Code:    "invalid",
+				Message: "must be between 1 and " + strconv.Itoa(maxPageLimit),
+			})
+		}
+		page.Limit = limit
+	}
+
+	if len(fields) > 0 {
+		return Page{}, apierror.Validation(fields)
+	}
+
+	return page, nil
+}
+
+type SessionHandler struct {
+	history  *LoginHistory
+	sessions *session.Manager
+	log      *zerolog.Logger
+}
+
+// RegisterSessionHandler - история входов и действующие сессии пользователя
+func RegisterSessionHandler(
+	router fiber.Router,
+	history *LoginHistory,
+	sessions *session.Manager,
+	logger *zerolog.Logger,
+) {
+	h := &SessionHandler{
+		history:  history,
+		sessions: sessions,
+		log:      logger,
+	}
+
+	auth := []fiber.Handler{session.Middleware(sessions), session.Owner("userID")}
+
+	router.Get("/users/:userID/logins", append(auth, h.logins)...)
+	router.Get("/users/:userID/sessions", append(auth, h.list)...)
+	router.Delete("/users/:userID/sessions/:sessionID", append(auth, h.revoke)...)
+}
+
+func (h *SessionHandler) logins(fCtx *fiber.Ctx) error {
+	userID := session.FromContext(fCtx.UserContext()).UserID
+
+	page, err := parsePage(fCtx)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.history.List(fCtx.UserContext(), userID, page)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("get login history failed")
+		return err
+	}
+
+	return fCtx.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (h *SessionHandler) list(fCtx *fiber.Ctx) error {
+	current := session.FromContext(fCtx.UserContext())
+
+	sessions, err := h.sessions.List(fCtx.UserContext(), current.UserID)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(current.UserID)).
+			Msg("list sessions failed")
+		return err
+	}
+
+	return fCtx.Status(fiber.StatusOK).JSON(newSessionsResponse(sessions, current.ID))
+}
+
+// revoke - завершает сессию, в том числе текущую
+func (h *SessionHandler) revoke(fCtx *fiber.Ctx) error {
+	userID := session.FromContext(fCtx.UserContext()).UserID
+	sessionID := fCtx.Params("sessionID")
+
+	err := h.sessions.Revoke(fCtx.UserContext(), userID, sessionID)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Str("sessionID", sessionID).
+			Msg("revoke session failed")
+		return err
+	}
+
+	h.log.Info().
+		Int("userID", int(userID)).
+		Str("sessionID", sessionID).
+		Msg("session revoked")
+
+	return fCtx.SendStatus(fiber.StatusNoContent)
+}
+
+// newSessionsResponse - currentID пустой для запросов администратора
+func newSessionsResponse(sessions []session.Session, currentID string) []SessionResponse {
+	resp := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, SessionResponse{
+			Session: s,
+			Current: currentID != "" && s.ID == currentID,
+		})
+	}
+
+	return resp
+}
@@ -0,0 +1,135 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/IlnurShafikov/wallet/modules/users/repositories"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/loginhistory"
+	"github.com/IlnurShafikov/wallet/services/onetime"
+	"github.com/IlnurShafikov/wallet/services/security"
+	"github.com/IlnurShafikov/wallet/services/session"
+	"github.com/IlnurShafikov/wallet/services/throttle"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginHistory(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+
+	hashing := security.NewChain(security.NewBcryptHashing("secret"))
+	password, err := hashing.HashPassword("password")
+	require.NoError(t, err)
+
+	repo := repositories.NewInMemoryRepository()
+	user, err := repo.Create(ctx, "user01", password)
+	require.NoError(t, err)
+
+	service := NewUserService(repo, hashing, throttle.NewLimiter(throttle.NewInMemoryRepository(), throttle.Policy{
+		MaxFailures:   10,
+		MaxIPFailures: 10,
+		LockDuration:  time.Minute,
+	}), &log)
+	sessions := session.NewManager(session.NewInMemoryRepository(), time.Hour)
+	history := NewLoginHistory(repo, loginhistory.NewInMemoryRepository(loginhistory.DefaultSize))
+	twoFactor := NewTwoFactor(repo, onetime.NewInMemoryRepository(), "Wallet", time.Minute)
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(fCtx *fiber.Ctx, err error) error {
+			var apiErr *apierror.Error
+			if errors.As(err, &apiErr) {
+				return fCtx.SendStatus(apiErr.Status)
+			}
+			return fCtx.SendStatus(http.StatusBadRequest)
+		},
+	})
+	RegisterAuthorizationHandler(app, service, twoFactor, sessions, history, &log)
+	RegisterSessionHandler(app, history, sessions, &log)
+
+	login := func(login, password string) (int, loginResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/login",
+			strings.NewReader(`{"login":"`+login+`","password":"`+password+`"}`))
+		req.Header.Set(fiber.HeaderUserAgent, "test-agent")
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+
+		body := loginResponse{}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+
+		return resp.StatusCode, body
+	}
+
+	get := func(path, token string, out interface{}) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+
+		if out != nil {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+		}
+
+		return resp.StatusCode
+	}
+
+	status, _ := login("unknown", "password")
+	assert.NotEqual(t, http.StatusOK, status)
+
+	status, _ = login("user01", "wrong")
+	assert.NotEqual(t, http.StatusOK, status)
+
+	status, first := login("user01", "password")
+	require.Equal(t, http.StatusOK, status)
+
+	status, second := login("user01", "password")
+	require.Equal(t, http.StatusOK, status)
+
+	logins := LoginsResponse{}
+	status = get("/users/1/logins?limit=2", first.Token, &logins)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 3, logins.Total)
+	require.Len(t, logins.Items, 2)
+	assert.True(t, logins.Items[0].Success)
+	assert.Equal(t, "test-agent", logins.Items[0].UserAgent)
+
+	status = get("/users/1/logins?offset=2", first.Token, &logins)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, logins.Items, 1)
+	assert.False(t, logins.Items[0].Success)
+	assert.Equal(t, "invalid_credentials", logins.Items[0].Reason)
+	assert.Equal(t, user.ID, logins.Items[0].UserID)
+
+	assert.Equal(t, http.StatusBadRequest, get("/users/1/logins?limit=1000", first.Token, nil))
+
+	var listed []SessionResponse
+	status = get("/users/1/sessions", first.Token, &listed)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, listed, 2)
+
+	secondSession, err := sessions.Authenticate(ctx, second.Token)
+	require.NoError(t, err)
+
+	for _, s := range listed {
+		assert.Equal(t, s.ID != secondSession.ID, s.Current)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/1/sessions/"+secondSession.ID, nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+first.Token)
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	assert.Equal(t, http.StatusUnauthorized, get("/users/1/sessions", second.Token, nil))
+}
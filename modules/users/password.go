@@ -0,0 +1,315 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/modules/users/repositories"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/notify"
+	"github.com/IlnurShafikov/wallet/services/onetime"
+	"github.com/IlnurShafikov/wallet/services/passwordpolicy"
+	"github.com/IlnurShafikov/wallet/services/security"
+	"github.com/IlnurShafikov/wallet/services/session"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/throttle"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"net/http"
+	"time"
+)
+
+var ErrInvalidResetToken = apierror.New(http.StatusBadRequest, "invalid_reset_token", "reset token is invalid or expired")
+
+type PasswordService interface {
+	ChangePassword(ctx context.Context, userID models.UserID, currentPassword, newPassword string) error
+	RequestReset(ctx context.Context, login string) error
+	ConfirmReset(ctx context.Context, token, newPassword string) error
+}
+
+type sessionRevoker interface {
+	RevokeUser(ctx context.Context, userID models.UserID) error
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type resetRequest struct {
+	Login string `json:"login"`
+}
+
+type confirmResetRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// Passwords - смена и сброс пароля, после них все сессии пользователя завершаются.
+// resetLimiter ограничивает запросы сброса по логину и IP
+type Passwords struct {
+	repository   Repository
+	passwords    security.PasswordManager
+	limiter      LoginLimiter
+	resetLimiter LoginLimiter
+	sessions     sessionRevoker
+	resets       onetime.Repository
+	notifier     notify.Notifier
+	resetTTL     time.Duration
+	policy       passwordpolicy.Policy
+}
+
+func NewPasswords(
+	repository Repository,
+	passwords security.PasswordManager,
+	limiter LoginLimiter,
+	resetLimiter LoginLimiter,
+	sessions sessionRevoker,
+	resets onetime.Repository,
+	notifier notify.Notifier,
+	resetTTL time.Duration,
+	policy passwordpolicy.Policy,
+) *Passwords {
+	return &Passwords{
+		repository:   repository,
+		passwords:    passwords,
+		limiter:      limiter,
+		resetLimiter: resetLimiter,
+		sessions:     sessions,
+		resets:       resets,
+		notifier:     notifier,
+		resetTTL:     resetTTL,
+		policy:       policy,
+	}
+}
+
+// ChangePassword - неверный текущий пароль учитывается как неудачный вход
+func (p *Passwords) ChangePassword(
+	ctx context.Context,
+	userID models.UserID,
+	currentPassword, newPassword string,
+) error {
+	user, err := p.repository.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = p.validate(user.Login, newPassword)
+	if err != nil {
+		return err
+	}
+
+	err = p.limiter.Acquire(ctx, user.Login)
+	if err != nil {
+		return err
+	}
+
+	err = p.passwords.Verify(currentPassword, user.Password)
+	if err != nil {
+		return ErrAuthorizationFailed
+	}
+
+	_ = p.limiter.Succeed(ctx, user.Login)
+
+	return p.setPassword(ctx, user.ID, newPassword)
+}
+
+// RequestReset - для неизвестного логина и пользователя без email ничего
+// не отправляется, но ответ тот же, чтобы нельзя было перебирать логины.
+// Каждый запрос учитывается ограничением по логину и IP
+func (p *Passwords) RequestReset(ctx context.Context, login string) error {
+	err := p.resetLimiter.Acquire(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	user, err := p.repository.Get(ctx, login)
+	if err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if user.Profile.Email == "" {
+		return nil
+	}
+
+	token, err := session.NewToken()
+	if err != nil {
+		return err
+	}
+
+	err = p.resets.Save(ctx, session.HashToken(token), user.ID, p.resetTTL)
+	if err != nil {
+		return err
+	}
+
+	return p.notifier.Send(ctx, notify.Message{
+		UserID:   user.ID,
+		TenantID: tenant.FromContext(ctx),
+		To:       user.Profile.Email,
+		Subject:  "Password reset",
+		Text:     fmt.Sprintf("Password reset token: %s, valid for %s", token, p.resetTTL),
+	})
+}
+
+// ConfirmReset - токен расходуется только после проверки нового пароля.
+// Пароль не может содержать логин, поэтому пользователь токена
+// сначала читается без удаления токена
+func (p *Passwords) ConfirmReset(ctx context.Context, token, newPassword string) error {
+	tokenHash := session.HashToken(token)
+
+	userID, err := p.resets.Peek(ctx, tokenHash)
+	if err != nil {
+		return resetTokenError(err)
+	}
+
+	user, err := p.repository.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = p.validate(user.Login, newPassword)
+	if err != nil {
+		return err
+	}
+
+	// токен мог быть использован параллельным запросом
+	userID, err = p.resets.Take(ctx, tokenHash)
+	if err != nil {
+		return resetTokenError(err)
+	}
+
+	if userID != user.ID {
+		return ErrInvalidResetToken
+	}
+
+	err = p.setPassword(ctx, user.ID, newPassword)
+	if err != nil {
+		return err
+	}
+
+	// пользователь подтвердил владение аккаунтом, блокировка входа снимается
+	return p.limiter.Reset(ctx, user.Login)
+}
+
+func resetTokenError(err error) error {
+	if errors.Is(err, onetime.ErrTokenNotFound) {
+		return ErrInvalidResetToken
+	}
+
+	return err
+}
+
+func (p *Passwords) validate(login, password string) error {
+	fields := p.policy.ValidatePassword("new_password", login, password)
+	if len(fields) > 0 {
+		return apierror.Validation(fields)
+	}
+
+	return nil
+}
+
+func (p *Passwords) setPassword(ctx context.Context, userID models.UserID, password string) error {
+	hashPassword, err := p.passwords.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.repository.Modify(ctx, userID, func(user *models.User) error {
+		user.Password = hashPassword
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return p.sessions.RevokeUser(ctx, userID)
+}
+
+type PasswordHandler struct {
+	service PasswordService
+	log     *zerolog.Logger
+}
+
+// RegisterPasswordHandler - пароль меняет только сам пользователь
+func RegisterPasswordHandler(
+	router fiber.Router,
+	service PasswordService,
+	sessions *session.Manager,
+	logger *zerolog.Logger,
+) {
+	h := &PasswordHandler{
+		service: service,
+		log:     logger,
+	}
+
+	router.Post("/users/:userID/password", session.Middleware(sessions), session.Owner("userID"), h.changePassword)
+	router.Post("/password/reset", h.requestReset)
+	router.Post("/password/reset/confirm", h.confirmReset)
+}
+
+func (h *PasswordHandler) changePassword(fCtx *fiber.Ctx) error {
+	userID := session.FromContext(fCtx.UserContext()).UserID
+
+	req := changePasswordRequest{}
+	if err := json.Unmarshal(fCtx.Body(), &req); err != nil {
+		h.log.Err(err).Msg("unmarshal failed")
+		return err
+	}
+
+	ctx := throttle.WithClientIP(fCtx.UserContext(), clientInfo(fCtx).IP)
+
+	err := h.service.ChangePassword(ctx, userID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("change password failed")
+		return err
+	}
+
+	h.log.Info().
+		Int("userID", int(userID)).
+		Msg("password changed")
+
+	return fCtx.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *PasswordHandler) requestReset(fCtx *fiber.Ctx) error {
+	req := resetRequest{}
+	if err := json.Unmarshal(fCtx.Body(), &req); err != nil {
+		h.log.Err(err).Msg("unmarshal failed")
+		return err
+	}
+
+	ctx := throttle.WithClientIP(fCtx.UserContext(), clientInfo(fCtx).IP)
+
+	err := h.service.RequestReset(ctx, req.Login)
+	if err != nil {
+		h.log.Err(err).Msg("request password reset failed")
+		return err
+	}
+
+	return fCtx.SendStatus(fiber.StatusAccepted)
+}
+
+func (h *PasswordHandler) confirmReset(fCtx *fiber.Ctx) error {
+	req := confirmResetRequest{}
+	if err := json.Unmarshal(fCtx.Body(), &req); err != nil {
+		h.log.Err(err).Msg("unmarshal failed")
+		return err
+	}
+
+	err := h.service.ConfirmReset(fCtx.UserContext(), req.Token, req.NewPassword)
+	if err != nil {
+		h.log.Err(err).Msg("confirm password reset failed")
+		return err
+	}
+
+	h.log.Info().Msg("password reset")
+
+	return fCtx.SendStatus(fiber.StatusNoContent)
+}
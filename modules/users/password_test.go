@@ -0,0 +1,207 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/modules/users/repositories"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/notify"
+	"github.com/IlnurShafikov/wallet/services/onetime"
+	"github.com/IlnurShafikov/wallet/services/passwordpolicy"
+	"github.com/IlnurShafikov/wallet/services/security"
+	"github.com/IlnurShafikov/wallet/services/session"
+	"github.com/IlnurShafikov/wallet/services/throttle"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testNotifier struct {
+	messages []notify.Message
+}
+
+func (n *testNotifier) Send(_ context.Context, msg notify.Message) error {
+	n.messages = append(n.messages, msg)
+	return nil
+}
+
+// testPolicy - требования по умолчанию из конфигурации
+var testPolicy = passwordpolicy.Policy{
+	MinLength:      8,
+	MaxLength:      128,
+	RequireLower:   true,
+	RequireUpper:   true,
+	RequireDigit:   true,
+	RejectCommon:   true,
+	LoginMinLength: 3,
+	LoginMaxLength: 32,
+}
+
+func TestPasswords(t *testing.T) {
+	log := zerolog.Nop()
+	ctx := context.Background()
+
+	hashing := security.NewChain(security.NewBcryptHashing("secret"))
+	password, err := hashing.HashPassword("password")
+	require.NoError(t, err)
+
+	repo := repositories.NewInMemoryRepository()
+	user, err := repo.Create(ctx, "user01", password)
+	require.NoError(t, err)
+	_, err = repo.Modify(ctx, user.ID, func(user *models.User) error {
+		user.Profile.Email = "user01@example.com"
+		return nil
+	})
+	require.NoError(t, err)
+	_, err = repo.Create(ctx, "user02", password)
+	require.NoError(t, err)
+
+	limiter := throttle.NewLimiter(throttle.NewInMemoryRepository(), throttle.Policy{
+		MaxFailures:   5,
+		MaxIPFailures: 5,
+		BaseDelay:     time.Nanosecond,
+		MaxDelay:      time.Nanosecond,
+		LockDuration:  time.Minute,
+	})
+	sessions := session.NewManager(session.NewInMemoryRepository(), time.Hour)
+	notifier := &testNotifier{}
+
+	passwords := NewPasswords(repo, hashing, limiter, limiter.Scoped("reset"), sessions, onetime.NewInMemoryRepository(), notifier, time.Hour, testPolicy)
+	service := NewUserService(repo, hashing, limiter, &log)
+
+	token, _, err := sessions.Start(ctx, user.ID, session.Client{})
+	require.NoError(t, err)
+
+	err = passwords.ChangePassword(ctx, user.ID, "password", "qwerty")
+	assert.ErrorIs(t, err, apierror.ErrValidation)
+
+	err = passwords.ChangePassword(ctx, user.ID, "wrong", "Changed123")
+	assert.ErrorIs(t, err, ErrAuthorizationFailed)
+
+	err = passwords.ChangePassword(ctx, user.ID, "password", "Changed123")
+	require.NoError(t, err)
+
+	_, err = sessions.Authenticate(ctx, token)
+	assert.ErrorIs(t, err, session.ErrUnauthorized)
+
+	_, err = service.Authorization(ctx, "user01", "Changed123")
+	require.NoError(t, err)
+
+	// неизвестный логин не раскрывается
+	require.NoError(t, passwords.RequestReset(ctx, "unknown"))
+	assert.Empty(t, notifier.messages)
+
+	// без email токен не отправляется на логин
+	require.NoError(t, passwords.RequestReset(ctx, "user02"))
+	assert.Empty(t, notifier.messages)
+
+	require.NoError(t, passwords.RequestReset(ctx, "user01"))
+	require.Len(t, notifier.messages, 1)
+	assert.Equal(t, "user01@example.com", notifier.messages[0].To)
+
+	resetToken := strings.TrimPrefix(strings.Split(notifier.messages[0].Text, ",")[0], "Password reset token: ")
+
+	err = passwords.ConfirmReset(ctx, "wrong", "Reset12345")
+	assert.ErrorIs(t, err, ErrInvalidResetToken)
+
+	// пароль с логином отклоняется, токен остается действительным
+	err = passwords.ConfirmReset(ctx, resetToken, "User01Reset")
+	assert.ErrorIs(t, err, apierror.ErrValidation)
+
+	require.NoError(t, passwords.ConfirmReset(ctx, resetToken, "Reset12345"))
+
+	err = passwords.ConfirmReset(ctx, resetToken, "Again12345")
+	assert.ErrorIs(t, err, ErrInvalidResetToken)
+
+	_, err = service.Authorization(ctx, "user01", "Reset12345")
+	require.NoError(t, err)
+}
+
+// запросы сброса ограничены по логину и по IP
+func TestPasswords_RequestResetLimit(t *testing.T) {
+	ctx := throttle.WithClientIP(context.Background(), "10.0.0.1")
+
+	repo := repositories.NewInMemoryRepository()
+	limiter := throttle.NewLimiter(throttle.NewInMemoryRepository(), throttle.Policy{
+		MaxFailures:   5,
+		MaxIPFailures: 3,
+		BaseDelay:     time.Minute,
+		MaxDelay:      time.Minute,
+		LockDuration:  time.Hour,
+	})
+	sessions := session.NewManager(session.NewInMemoryRepository(), time.Hour)
+	passwords := NewPasswords(repo, security.NewChain(security.NewBcryptHashing("secret")), limiter, limiter.Scoped("reset"),
+		sessions, onetime.NewInMemoryRepository(), &testNotifier{}, time.Hour, testPolicy)
+
+	require.NoError(t, passwords.RequestReset(ctx, "user01"))
+	assert.ErrorIs(t, passwords.RequestReset(ctx, "user01"), throttle.ErrTooManyAttempts)
+
+	require.NoError(t, passwords.RequestReset(ctx, "user02"))
+	require.NoError(t, passwords.RequestReset(ctx, "user03"))
+	assert.ErrorIs(t, passwords.RequestReset(ctx, "user04"), throttle.ErrTooManyAttempts)
+
+	// счетчики входа не затрагиваются
+	assert.NoError(t, limiter.Acquire(ctx, "user01"))
+}
+
+// пароль меняет только владелец сессии
+func TestPasswordHandler_ChangePassword(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+
+	hashing := security.NewChain(security.NewBcryptHashing("secret"))
+	password, err := hashing.HashPassword("password")
+	require.NoError(t, err)
+
+	repo := repositories.NewInMemoryRepository()
+	owner, err := repo.Create(ctx, "user01", password)
+	require.NoError(t, err)
+	other, err := repo.Create(ctx, "user02", password)
+	require.NoError(t, err)
+
+	limiter := throttle.NewLimiter(throttle.NewInMemoryRepository(), throttle.DefaultPolicy())
+	sessions := session.NewManager(session.NewInMemoryRepository(), time.Hour)
+	passwords := NewPasswords(repo, hashing, limiter, limiter.Scoped("reset"), sessions,
+		onetime.NewInMemoryRepository(), &testNotifier{}, time.Hour, testPolicy)
+
+	token, _, err := sessions.Start(ctx, owner.ID, session.Client{})
+	require.NoError(t, err)
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(fCtx *fiber.Ctx, err error) error {
+			var apiErr *apierror.Error
+			if errors.As(err, &apiErr) {
+				return fCtx.SendStatus(apiErr.Status)
+			}
+			return fCtx.SendStatus(http.StatusBadRequest)
+		},
+	})
+	RegisterPasswordHandler(app, passwords, sessions, &log)
+
+	request := func(path, token string) int {
+		body := `{"current_password":"password","new_password":"Changed123"}`
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		}
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, request("/users/"+owner.ID.String()+"/password", ""))
+	assert.Equal(t, http.StatusForbidden, request("/users/"+other.ID.String()+"/password", token))
+	assert.Equal(t, http.StatusNoContent, request("/users/"+owner.ID.String()+"/password", token))
+
+	_, err = NewUserService(repo, hashing, limiter, &log).Authorization(ctx, "user02", "password")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,183 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/session"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	dateLayout         = "2006-01-02"
+	maxEmailLength     = 254
+	maxDisplayNameSize = 64
+	minAge             = 18
+)
+
+var (
+	ErrInvalidEmail       = errors.New("invalid email")
+	ErrInvalidDisplayName = errors.New("invalid display name")
+	ErrInvalidCountry     = errors.New("country must be an ISO 3166-1 alpha-2 code")
+	ErrInvalidDateOfBirth = errors.New("date of birth must be in format YYYY-MM-DD")
+	ErrUnderage           = errors.New("user must be at least 18 years old")
+)
+
+var countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+type ProfileService interface {
+	GetProfile(ctx context.Context, userID models.UserID) (*models.User, error)
+	UpdateProfile(ctx context.Context, userID models.UserID, req UpdateProfileRequest) (*models.User, error)
+}
+
+// UpdateProfileRequest - не переданные поля не меняются,
+// пустая строка очищает поле
+type UpdateProfileRequest struct {
+	Email       *string `json:"email"`
+	DisplayName *string `json:"display_name"`
+	Country     *string `json:"country"`
+	DateOfBirth *string `json:"date_of_birth"`
+}
+
+type ProfileResponse struct {
+	UserID      models.UserID `json:"user_id"`
+	Login       string        `json:"login"`
+	Email       string        `json:"email,omitempty"`
+	DisplayName string        `json:"display_name,omitempty"`
+	Country     string        `json:"country,omitempty"`
+	DateOfBirth string        `json:"date_of_birth,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+func (r UpdateProfileRequest) Validate(now time.Time) error {
+	if r.Email != nil && *r.Email != "" {
+		addr, err := mail.ParseAddress(*r.Email)
+		if err != nil || addr.Address != *r.Email || len(*r.Email) > maxEmailLength {
+			return ErrInvalidEmail
+		}
+	}
+
+	if r.DisplayName != nil && *r.DisplayName != "" {
+		name := *r.DisplayName
+		if strings.TrimSpace(name) != name || utf8.RuneCountInString(name) > maxDisplayNameSize ||
+			strings.IndexFunc(name, unicode.IsControl) >= 0 {
+			return ErrInvalidDisplayName
+		}
+	}
+
+	if r.Country != nil && *r.Country != "" && !countryCode.MatchString(*r.Country) {
+		return ErrInvalidCountry
+	}
+
+	if r.DateOfBirth != nil && *r.DateOfBirth != "" {
+		birth, err := time.Parse(dateLayout, *r.DateOfBirth)
+		if err != nil || birth.After(now) {
+			return ErrInvalidDateOfBirth
+		}
+
+		if birth.AddDate(minAge, 0, 0).After(now) {
+			return ErrUnderage
+		}
+	}
+
+	return nil
+}
+
+func (r UpdateProfileRequest) apply(profile *models.Profile) {
+	if r.Email != nil {
+		profile.Email = *r.Email
+	}
+
+	if r.DisplayName != nil {
+		profile.DisplayName = *r.DisplayName
+	}
+
+	if r.Country != nil {
+		profile.Country = *r.Country
+	}
+
+	if r.DateOfBirth != nil {
+		profile.DateOfBirth = *r.DateOfBirth
+	}
+}
+
+type ProfileHandler struct {
+	service ProfileService
+	log     *zerolog.Logger
+}
+
+// RegisterProfileHandler - анкету читает и меняет только сам пользователь
+func RegisterProfileHandler(
+	router fiber.Router,
+	service ProfileService,
+	sessions *session.Manager,
+	logger *zerolog.Logger,
+) {
+	h := &ProfileHandler{
+		service: service,
+		log:     logger,
+	}
+
+	auth := []fiber.Handler{session.Middleware(sessions), session.Owner("userID")}
+
+	router.Get("/users/:userID", append(auth, h.getProfile)...)
+	router.Patch("/users/:userID", append(auth, h.updateProfile)...)
+}
+
+func (h *ProfileHandler) getProfile(fCtx *fiber.Ctx) error {
+	userID := session.FromContext(fCtx.UserContext()).UserID
+
+	user, err := h.service.GetProfile(fCtx.UserContext(), userID)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("get profile failed")
+		return err
+	}
+
+	return fCtx.Status(fiber.StatusOK).JSON(newProfileResponse(user))
+}
+
+func (h *ProfileHandler) updateProfile(fCtx *fiber.Ctx) error {
+	userID := session.FromContext(fCtx.UserContext()).UserID
+
+	req := UpdateProfileRequest{}
+	if err := json.Unmarshal(fCtx.Body(), &req); err != nil {
+		h.log.Err(err).Msg("unmarshal failed")
+		return err
+	}
+
+	user, err := h.service.UpdateProfile(fCtx.UserContext(), userID, req)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("update profile failed")
+		return err
+	}
+
+	h.log.Debug().
+		Int("userID", int(userID)).
+		Msg("profile updated")
+
+	return fCtx.Status(fiber.StatusOK).JSON(newProfileResponse(user))
+}
+
+func newProfileResponse(user *models.User) ProfileResponse {
+	return ProfileResponse{
+		UserID:      user.ID,
+		Login:       user.Login,
+		Email:       user.Profile.Email,
+		DisplayName: user.Profile.DisplayName,
+		Country:     user.Profile.Country,
+		DateOfBirth: user.Profile.DateOfBirth,
+		CreatedAt:   user.CreatedAt,
+	}
+}
@@ -0,0 +1,78 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"github.com/IlnurShafikov/wallet/modules/users/repositories"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/security"
+	"github.com/IlnurShafikov/wallet/services/session"
+	"github.com/IlnurShafikov/wallet/services/throttle"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// анкету читает и меняет только владелец сессии
+func TestProfileHandler(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+
+	repo := repositories.NewInMemoryRepository()
+	owner, err := repo.Create(ctx, "user01", []byte("hash"))
+	require.NoError(t, err)
+	other, err := repo.Create(ctx, "user02", []byte("hash"))
+	require.NoError(t, err)
+
+	service := NewUserService(repo, security.NewChain(security.NewBcryptHashing("secret")),
+		throttle.NewLimiter(throttle.NewInMemoryRepository(), throttle.DefaultPolicy()), &log)
+	sessions := session.NewManager(session.NewInMemoryRepository(), time.Hour)
+
+	token, _, err := sessions.Start(ctx, owner.ID, session.Client{})
+	require.NoError(t, err)
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(fCtx *fiber.Ctx, err error) error {
+			var apiErr *apierror.Error
+			if errors.As(err, &apiErr) {
+				return fCtx.SendStatus(apiErr.Status)
+			}
+			return fCtx.SendStatus(http.StatusBadRequest)
+		},
+	})
+	RegisterProfileHandler(app, service, sessions, &log)
+
+	request := func(method, path, token, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		}
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+
+		return resp.StatusCode
+	}
+
+	ownerPath := "/users/" + owner.ID.String()
+	otherPath := "/users/" + other.ID.String()
+	email := `{"email":"attacker@example.com"}`
+
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, ownerPath, "", ""))
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPatch, ownerPath, "", email))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodGet, otherPath, token, ""))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPatch, otherPath, token, email))
+
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, ownerPath, token, ""))
+	assert.Equal(t, http.StatusOK, request(http.MethodPatch, ownerPath, token, `{"email":"owner@example.com"}`))
+
+	profile, err := repo.GetByID(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Empty(t, profile.Profile.Email)
+}
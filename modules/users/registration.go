@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/passwordpolicy"
 	"github.com/gofiber/fiber/v2"
 	"github.com/rs/zerolog"
 )
@@ -20,29 +22,65 @@ type CreateUserRequest struct {
 }
 
 type CreateUserResponse struct {
-	Login  string        `json:"login"`
-	UserID models.UserID `json:"user_id"`
+	Login   string         `json:"login"`
+	UserID  models.UserID  `json:"user_id"`
+	Balance models.Balance `json:"balance"`
+}
+
+// Validate - все нарушения правил возвращаются одной ошибкой со списком полей
+func (r CreateUserRequest) Validate(policy passwordpolicy.Policy) error {
+	fields := policy.ValidateLogin(r.Login)
+	fields = append(fields, policy.ValidatePassword("password", r.Login, r.Password)...)
+
+	if r.Password != r.RePassword {
+		fields = append(fields, apierror.FieldError{
+			Field:   "re_password",
+			Code:    "mismatch",
+			Message: ErrWrongRePassword.Error(),
+		})
+	}
+
+	if len(fields) > 0 {
+		return apierror.Validation(fields)
+	}
+
+	return nil
 }
 
 type passwordHasher interface {
 	HashPassword(password string) ([]byte, error)
 }
 
+type usersCreater interface {
+	Creater
+	Deleter
+}
+
+type walletProvisioner interface {
+	Provision(ctx context.Context, userID models.UserID) (models.Balance, error)
+}
+
 type RegistrationHandler struct {
-	usersCreater Creater
+	usersCreater usersCreater
+	wallets      walletProvisioner
 	hasher       passwordHasher
+	policy       passwordpolicy.Policy
 	log          *zerolog.Logger
 }
 
 func RegisterRegistrationHandler(
 	router fiber.Router,
-	usersCreater Creater,
+	usersCreater usersCreater,
+	wallets walletProvisioner,
 	hashed passwordHasher,
+	policy passwordpolicy.Policy,
 	logger *zerolog.Logger,
 ) {
 	handler := &RegistrationHandler{
 		usersCreater: usersCreater,
+		wallets:      wallets,
 		hasher:       hashed,
+		policy:       policy,
 		log:          logger,
 	}
 
@@ -56,9 +94,9 @@ func (c *RegistrationHandler) registration(fCtx *fiber.Ctx) error {
 		return err
 	}
 
-	if req.Password != req.RePassword {
-		c.log.Warn().Msg("password not equal")
-		return ErrWrongRePassword
+	if err := req.Validate(c.policy); err != nil {
+		c.log.Warn().Err(err).Msg("invalid registration request")
+		return err
 	}
 
 	hashPassword, err := c.hasher.HashPassword(req.Password)
@@ -66,7 +104,7 @@ func (c *RegistrationHandler) registration(fCtx *fiber.Ctx) error {
 		c.log.Err(err).Msg("hashing password failed")
 		return err
 	}
-	ctx := context.Background()
+	ctx := fCtx.UserContext()
 
 	user, err := c.usersCreater.Create(ctx, req.Login, hashPassword)
 	if err != nil {
@@ -74,13 +112,30 @@ func (c *RegistrationHandler) registration(fCtx *fiber.Ctx) error {
 		return err
 	}
 
+	balance, err := c.wallets.Provision(ctx, user.ID)
+	if err != nil {
+		c.log.Err(err).
+			Int("userID", int(user.ID)).
+			Msg("wallet provisioning failed")
+
+		// без кошелька пользователь не может играть, регистрация откатывается
+		if delErr := c.usersCreater.Delete(ctx, user.Login); delErr != nil {
+			c.log.Err(delErr).
+				Int("userID", int(user.ID)).
+				Msg("rollback registration failed")
+		}
+
+		return err
+	}
+
 	c.log.Debug().
 		Int("userID", int(user.ID)).
 		Msg("registration successful")
 
 	err = fCtx.Status(fiber.StatusCreated).JSON(CreateUserResponse{
-		Login:  req.Login,
-		UserID: user.ID,
+		Login:   req.Login,
+		UserID:  user.ID,
+		Balance: balance,
 	})
 
 	return err
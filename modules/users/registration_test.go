@@ -0,0 +1,77 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/modules/users/repositories"
+	"github.com/IlnurShafikov/wallet/services/security"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type provisionerStub struct {
+	balance models.Balance
+	err     error
+}
+
+func (p provisionerStub) Provision(context.Context, models.UserID) (models.Balance, error) {
+	return p.balance, p.err
+}
+
+func TestRegistrationHandler(t *testing.T) {
+	log := zerolog.Nop()
+	body := `{"login":"user01","password":"Tr0ub4dor","re_password":"Tr0ub4dor"}`
+
+	tests := []struct {
+		name        string
+		provisioner provisionerStub
+		expStatus   int
+		expCreated  bool
+	}{
+		{
+			name:        "wallet provisioned",
+			provisioner: provisionerStub{balance: 110},
+			expStatus:   http.StatusCreated,
+			expCreated:  true,
+		},
+		{
+			name:        "provisioning failed, user rolled back",
+			provisioner: provisionerStub{err: errors.New("wallet storage unavailable")},
+			expStatus:   http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := repositories.NewInMemoryRepository()
+
+			app := fiber.New()
+			RegisterRegistrationHandler(app, repo, tc.provisioner,
+				security.NewChain(security.NewBcryptHashing("secret")), testPolicy, &log)
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/registration", strings.NewReader(body)))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expStatus, resp.StatusCode)
+
+			_, err = repo.Get(context.Background(), "user01")
+			if !tc.expCreated {
+				assert.ErrorIs(t, err, repositories.ErrUserNotFound)
+				return
+			}
+
+			require.NoError(t, err)
+
+			created := CreateUserResponse{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+			assert.Equal(t, models.Balance(110), created.Balance)
+		})
+	}
+}
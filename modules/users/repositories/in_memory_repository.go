@@ -2,64 +2,358 @@ package repositories
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/wal"
 	"sync"
+	"time"
 )
 
 var (
 	ErrUserNotFound      = errors.New("user not found")
 	ErrUserAlreadyExists = errors.New("user already exists")
+	// ErrUserConflict - пользователя постоянно меняют параллельно, изменение не записано
+	ErrUserConflict = errors.New("user was modified concurrently")
+
+	errLoginChanged = errors.New("login can only be changed by Rename")
 )
 
 type InMemoryRepository struct {
-	users  map[string]models.User
-	lastID models.UserID
-	mu     sync.Mutex
+	users   map[models.TenantID]map[string]models.User
+	logins  map[models.TenantID]map[models.UserID]string
+	lastID  models.UserID
+	mu      sync.Mutex
+	now     func() time.Time
+	journal *wal.Log
+}
+
+// userRecord - запись журнала: пользователь, который ранее лежал под логином Login,
+// теперь лежит под User.Login. Пустой Login - новый пользователь, пустой User - удаление
+type userRecord struct {
+	TenantID models.TenantID `json:"tenant_id"`
+	Login    string          `json:"login,omitempty"`
+	User     *models.User    `json:"user,omitempty"`
+}
+
+// userState - снимок журнала, индекс по UserID восстанавливается из пользователей
+type userState struct {
+	Users  map[models.TenantID]map[string]models.User `json:"users"`
+	LastID models.UserID                              `json:"last_id"`
 }
 
 func NewInMemoryRepository() *InMemoryRepository {
 	return &InMemoryRepository{
-		users:  make(map[string]models.User),
+		users:  make(map[models.TenantID]map[string]models.User),
+		logins: make(map[models.TenantID]map[models.UserID]string),
 		lastID: 0,
+		now:    time.Now,
+	}
+}
+
+// NewDurableInMemoryRepository - пользователи в оп, восстановленные из журнала.
+// Каждое изменение пишется в журнал до применения
+func NewDurableInMemoryRepository(journal *wal.Log) (*InMemoryRepository, error) {
+	repo := NewInMemoryRepository()
+	repo.journal = journal
+
+	err := journal.Load(
+		func(data []byte) error {
+			var state userState
+			if err := json.Unmarshal(data, &state); err != nil {
+				return err
+			}
+
+			for tenantID, users := range state.Users {
+				for login, user := range users {
+					repo.tenantUsers(tenantID)[login] = user
+					repo.tenantLogins(tenantID)[user.ID] = login
+				}
+			}
+			repo.lastID = state.LastID
+
+			return nil
+		},
+		func(data []byte) error {
+			var record userRecord
+			if err := json.Unmarshal(data, &record); err != nil {
+				return err
+			}
+
+			repo.apply(record)
+
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// set - записывает изменение в журнал и в память
+func (i *InMemoryRepository) set(tenantID models.TenantID, login string, user *models.User) error {
+	record := userRecord{TenantID: tenantID, Login: login}
+	if user != nil {
+		stored := cloneUser(*user)
+		record.User = &stored
+	}
+
+	if i.journal != nil {
+		if err := i.journal.Append(record); err != nil {
+			return err
+		}
+	}
+
+	i.apply(record)
+
+	if i.journal != nil && i.journal.NeedSnapshot() {
+		// изменение уже в журнале, неудачный снимок повторится при следующей записи
+		_ = i.journal.Snapshot(userState{Users: i.users, LastID: i.lastID})
 	}
+
+	return nil
 }
 
-func (i *InMemoryRepository) getUser(login string) (models.User, bool) {
-	us, ok := i.users[login]
-	return us, ok
+// apply - применяет запись журнала, повторное применение ничего не меняет
+func (i *InMemoryRepository) apply(record userRecord) {
+	users := i.tenantUsers(record.TenantID)
+	logins := i.tenantLogins(record.TenantID)
+
+	if previous, ok := users[record.Login]; ok && record.Login != "" {
+		delete(users, record.Login)
+		delete(logins, previous.ID)
+	}
+
+	if record.User == nil {
+		return
+	}
+
+	users[record.User.Login] = *record.User
+	logins[record.User.ID] = record.User.Login
+
+	if record.User.ID > i.lastID {
+		i.lastID = record.User.ID
+	}
 }
 
-func (i *InMemoryRepository) Create(_ context.Context, login string, password []byte) (*models.User, error) {
+// tenantUsers - пользователи оператора
+func (i *InMemoryRepository) tenantUsers(tenantID models.TenantID) map[string]models.User {
+	users, ok := i.users[tenantID]
+	if !ok {
+		users = make(map[string]models.User)
+		i.users[tenantID] = users
+	}
+
+	return users
+}
+
+// tenantLogins - индекс UserID -> логин оператора
+func (i *InMemoryRepository) tenantLogins(tenantID models.TenantID) map[models.UserID]string {
+	logins, ok := i.logins[tenantID]
+	if !ok {
+		logins = make(map[models.UserID]string)
+		i.logins[tenantID] = logins
+	}
+
+	return logins
+}
+
+func (i *InMemoryRepository) getUser(ctx context.Context, login string) (models.User, bool) {
+	us, ok := i.tenantUsers(tenant.FromContext(ctx))[login]
+	return cloneUser(us), ok
+}
+
+// cloneUser - копия без общих с хранилищем указателей
+func cloneUser(user models.User) models.User {
+	if user.TwoFactor != nil {
+		twoFactor := *user.TwoFactor
+		twoFactor.RecoveryCodes = append([]string(nil), user.TwoFactor.RecoveryCodes...)
+		user.TwoFactor = &twoFactor
+	}
+
+	if user.KYC != nil {
+		kyc := *user.KYC
+		if kyc.Submission != nil {
+			submission := *kyc.Submission
+			kyc.Submission = &submission
+		}
+		kyc.History = append([]models.KYCChange(nil), user.KYC.History...)
+		user.KYC = &kyc
+	}
+
+	if user.Account != nil {
+		account := *user.Account
+		account.History = append([]models.StatusChange(nil), user.Account.History...)
+		user.Account = &account
+	}
+
+	if user.ErasedAt != nil {
+		erasedAt := *user.ErasedAt
+		user.ErasedAt = &erasedAt
+	}
+
+	return user
+}
+
+func (i *InMemoryRepository) Create(ctx context.Context, login string, password []byte) (*models.User, error) {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	if _, exist := i.getUser(login); exist {
+	if _, exist := i.getUser(ctx, login); exist {
 		return nil, fmt.Errorf("this user %s exists", login)
 	}
 
-	i.lastID++
-
 	user := models.User{
-		ID:       i.lastID,
-		Login:    login,
-		Password: password,
+		ID:        i.lastID + 1,
+		Login:     login,
+		Password:  password,
+		CreatedAt: i.now().UTC(),
+	}
+
+	if err := i.set(tenant.FromContext(ctx), "", &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (i *InMemoryRepository) Get(ctx context.Context, login string) (*models.User, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user, exist := i.getUser(ctx, login)
+	if !exist {
+		return nil, ErrUserNotFound
 	}
 
-	i.users[login] = user
+	return &user, nil
+}
+
+func (i *InMemoryRepository) GetByID(ctx context.Context, userID models.UserID) (*models.User, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	login, exist := i.tenantLogins(tenant.FromContext(ctx))[userID]
+	if !exist {
+		return nil, ErrUserNotFound
+	}
+
+	user, exist := i.getUser(ctx, login)
+	if !exist {
+		return nil, ErrUserNotFound
+	}
 
 	return &user, nil
 }
 
-func (i *InMemoryRepository) Get(_ context.Context, login string) (*models.User, error) {
+// Update - заменяет данные существующего пользователя, логин не меняется
+func (i *InMemoryRepository) Update(ctx context.Context, user models.User) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	current, exist := i.getUser(ctx, user.Login)
+	if !exist || current.ID != user.ID {
+		return ErrUserNotFound
+	}
+
+	return i.set(tenant.FromContext(ctx), user.Login, &user)
+}
+
+func (i *InMemoryRepository) Modify(
+	ctx context.Context,
+	userID models.UserID,
+	fn func(user *models.User) error,
+) (*models.User, error) {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	user, exist := i.getUser(login)
+	login, exist := i.tenantLogins(tenant.FromContext(ctx))[userID]
+	if !exist {
+		return nil, ErrUserNotFound
+	}
+
+	user, exist := i.getUser(ctx, login)
 	if !exist {
 		return nil, ErrUserNotFound
 	}
 
+	if err := fn(&user); err != nil {
+		return nil, err
+	}
+
+	if user.ID != userID || user.Login != login {
+		return nil, errLoginChanged
+	}
+
+	if err := i.set(tenant.FromContext(ctx), login, &user); err != nil {
+		return nil, err
+	}
+
 	return &user, nil
 }
+
+// Rename - переносит пользователя с логина login на user.Login
+func (i *InMemoryRepository) Rename(ctx context.Context, login string, user models.User) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	current, exist := i.getUser(ctx, login)
+	if !exist || current.ID != user.ID {
+		return ErrUserNotFound
+	}
+
+	if _, exist = i.getUser(ctx, user.Login); exist && user.Login != login {
+		return ErrUserAlreadyExists
+	}
+
+	return i.set(tenant.FromContext(ctx), login, &user)
+}
+
+func (i *InMemoryRepository) Delete(ctx context.Context, login string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, exist := i.getUser(ctx, login); !exist {
+		return ErrUserNotFound
+	}
+
+	return i.set(tenant.FromContext(ctx), login, nil)
+}
+
+func (i *InMemoryRepository) Restore(ctx context.Context, user models.User) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	tenantID := tenant.FromContext(ctx)
+
+	if _, exist := i.tenantUsers(tenantID)[user.Login]; exist {
+		return ErrUserAlreadyExists
+	}
+
+	if _, exist := i.tenantLogins(tenantID)[user.ID]; exist {
+		return ErrUserAlreadyExists
+	}
+
+	return i.set(tenantID, "", &user)
+}
+
+func (i *InMemoryRepository) Iterate(ctx context.Context, fn func(user models.User) error) error {
+	i.mu.Lock()
+	users := make([]models.User, 0, len(i.tenantUsers(tenant.FromContext(ctx))))
+	for _, user := range i.tenantUsers(tenant.FromContext(ctx)) {
+		users = append(users, cloneUser(user))
+	}
+	i.mu.Unlock()
+
+	for _, user := range users {
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -4,13 +4,18 @@ import (
 	"context"
 	"fmt"
 	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/wal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 func TestCreate(t *testing.T) {
 	const loginUser = "ilnur"
 	ctx := context.Background()
+	created := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
 
 	tests := []struct {
 		name      string
@@ -25,13 +30,13 @@ func TestCreate(t *testing.T) {
 			login:    loginUser,
 			password: []byte("123"),
 			before:   func(nw *InMemoryRepository) {},
-			expect:   &models.User{1, loginUser, []byte("123")},
+			expect:   &models.User{ID: 1, Login: loginUser, Password: []byte("123"), CreatedAt: created},
 		}, {
 			name:     "creat an existing user",
 			login:    loginUser,
 			password: []byte("123"),
 			before: func(nw *InMemoryRepository) {
-				nw.users[loginUser] = models.User{1, loginUser, []byte("123")}
+				nw.tenantUsers(models.DefaultTenant)[loginUser] = models.User{ID: 1, Login: loginUser, Password: []byte("123")}
 			},
 
 			expectErr: fmt.Errorf("this user %s exists", loginUser),
@@ -41,6 +46,7 @@ func TestCreate(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			nw := NewInMemoryRepository()
+			nw.now = func() time.Time { return created }
 			tc.before(nw)
 			got, err := nw.Create(ctx, tc.login, tc.password)
 			assert.Equal(t, tc.expect, got)
@@ -54,6 +60,7 @@ func TestGet(t *testing.T) {
 	loginUser := "user01"
 	loginWrongUser := "user23"
 	ctx := context.Background()
+	created := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
 
 	tests := []struct {
 		name      string
@@ -64,7 +71,7 @@ func TestGet(t *testing.T) {
 		{
 			name:   "get real user",
 			login:  loginUser,
-			expect: &models.User{1, loginUser, password},
+			expect: &models.User{ID: 1, Login: loginUser, Password: password, CreatedAt: created},
 		},
 		{
 			name:      "get wrong user",
@@ -76,6 +83,7 @@ func TestGet(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			nw := NewInMemoryRepository()
+			nw.now = func() time.Time { return created }
 			_, _ = nw.Create(ctx, loginUser, password)
 			got, err := nw.Get(ctx, tc.login)
 			assert.Equal(t, tc.expect, got)
@@ -83,3 +91,126 @@ func TestGet(t *testing.T) {
 		})
 	}
 }
+
+func TestGetByID(t *testing.T) {
+	ctx := context.Background()
+	brandCtx := tenant.WithTenant(ctx, "brand")
+
+	nw := NewInMemoryRepository()
+	user, err := nw.Create(ctx, "user01", []byte("123"))
+	require.NoError(t, err)
+
+	got, err := nw.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user, got)
+
+	_, err = nw.GetByID(brandCtx, user.ID)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	_, err = nw.GetByID(ctx, user.ID+1)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+
+	nw := NewInMemoryRepository()
+	user, err := nw.Create(ctx, "user01", []byte("123"))
+	require.NoError(t, err)
+
+	user.Profile.Email = "user01@example.com"
+	require.NoError(t, nw.Update(ctx, *user))
+
+	got, err := nw.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "user01@example.com", got.Profile.Email)
+
+	err = nw.Update(ctx, models.User{ID: user.ID, Login: "user02"})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestRename(t *testing.T) {
+	ctx := context.Background()
+
+	nw := NewInMemoryRepository()
+	user, err := nw.Create(ctx, "user01", []byte("123"))
+	require.NoError(t, err)
+
+	_, err = nw.Create(ctx, "user02", []byte("123"))
+	require.NoError(t, err)
+
+	renamed := *user
+	renamed.Login = "user02"
+	assert.ErrorIs(t, nw.Rename(ctx, "user01", renamed), ErrUserAlreadyExists)
+
+	renamed.Login = "user03"
+	require.NoError(t, nw.Rename(ctx, "user01", renamed))
+
+	_, err = nw.Get(ctx, "user01")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	got, err := nw.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "user03", got.Login)
+}
+
+func TestDurableInMemoryRepository(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	open := func() (*InMemoryRepository, *wal.Log) {
+		journal, err := wal.Open(dir, "users", wal.Options{Sync: wal.SyncAlways, SnapshotEvery: 4})
+		require.NoError(t, err)
+
+		repo, err := NewDurableInMemoryRepository(journal)
+		require.NoError(t, err)
+
+		return repo, journal
+	}
+
+	repo, journal := open()
+
+	first, err := repo.Create(ctx, "user1", []byte("1"))
+	require.NoError(t, err)
+
+	second, err := repo.Create(ctx, "user2", []byte("2"))
+	require.NoError(t, err)
+
+	_, err = repo.Create(tenant.WithTenant(ctx, "brand"), "user3", []byte("3"))
+	require.NoError(t, err)
+
+	modified, err := repo.Modify(ctx, first.ID, func(user *models.User) error {
+		user.Profile.Country = "DE"
+		return nil
+	})
+	require.NoError(t, err)
+
+	// изменения после снимка остаются в журнале
+	renamed := *modified
+	renamed.Login = "user4"
+	require.NoError(t, repo.Rename(ctx, "user1", renamed))
+	require.NoError(t, repo.Delete(ctx, "user2"))
+	require.NoError(t, journal.Close())
+
+	repo, journal = open()
+	defer journal.Close()
+
+	got, err := repo.GetByID(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "user4", got.Login)
+	assert.Equal(t, "DE", got.Profile.Country)
+
+	_, err = repo.Get(ctx, "user1")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	_, err = repo.GetByID(ctx, second.ID)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	_, err = repo.Get(tenant.WithTenant(ctx, "brand"), "user3")
+	assert.NoError(t, err)
+
+	// UserID не выдается повторно после восстановления
+	user, err := repo.Create(ctx, "user5", []byte("5"))
+	require.NoError(t, err)
+	assert.Equal(t, models.UserID(4), user.ID)
+}
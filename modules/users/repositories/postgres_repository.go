@@ -0,0 +1,286 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/postgres"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+type PostgresRepository struct {
+	db  *pgxpool.Pool
+	now func() time.Time
+}
+
+func NewPostgresRepository(db *pgxpool.Pool) *PostgresRepository {
+	return &PostgresRepository{
+		db:  db,
+		now: time.Now,
+	}
+}
+
+// Create - UserID выдается счетчиком оператора в той же транзакции,
+// при ошибке вставки счетчик не меняется
+func (r *PostgresRepository) Create(ctx context.Context, login string, password []byte) (*models.User, error) {
+	tenantID := tenant.FromContext(ctx)
+
+	var user models.User
+
+	err := postgres.InTx(ctx, r.db, func(tx pgx.Tx) error {
+		var id int64
+		err := tx.QueryRow(ctx, `
+			INSERT INTO sequences (tenant_id, name, value) VALUES ($1, $2, 1)
+			ON CONFLICT (tenant_id, name) DO UPDATE SET value = sequences.value + 1
+			RETURNING value`,
+			tenantID, userSequence,
+		).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("next user id: %w", err)
+		}
+
+		user = models.User{
+			ID:        models.UserID(id),
+			Login:     login,
+			Password:  password,
+			CreatedAt: r.now().UTC(),
+		}
+
+		data, err := json.Marshal(user)
+		if err != nil {
+			return fmt.Errorf("marshal: %w", err)
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO users (tenant_id, id, login, data) VALUES ($1, $2, $3, $4)`,
+			tenantID, user.ID, login, data,
+		)
+		if err != nil {
+			if postgres.IsUniqueViolation(err) {
+				return ErrUserAlreadyExists
+			}
+			return fmt.Errorf("insert user: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (r *PostgresRepository) Get(ctx context.Context, login string) (*models.User, error) {
+	row := r.db.QueryRow(ctx,
+		`SELECT data FROM users WHERE tenant_id = $1 AND login = $2`,
+		tenant.FromContext(ctx), login,
+	)
+
+	return scanPostgresUser(row)
+}
+
+func (r *PostgresRepository) GetByID(ctx context.Context, userID models.UserID) (*models.User, error) {
+	row := r.db.QueryRow(ctx,
+		`SELECT data FROM users WHERE tenant_id = $1 AND id = $2`,
+		tenant.FromContext(ctx), userID,
+	)
+
+	return scanPostgresUser(row)
+}
+
+// Update - заменяет данные существующего пользователя, логин не меняется
+func (r *PostgresRepository) Update(ctx context.Context, user models.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	tag, err := r.db.Exec(ctx,
+		`UPDATE users SET data = $1 WHERE tenant_id = $2 AND id = $3 AND login = $4`,
+		data, tenant.FromContext(ctx), user.ID, user.Login,
+	)
+	if err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+
+	return requireUpdated(tag)
+}
+
+// Modify - строка пользователя блокируется до конца транзакции
+func (r *PostgresRepository) Modify(
+	ctx context.Context,
+	userID models.UserID,
+	fn func(user *models.User) error,
+) (*models.User, error) {
+	tenantID := tenant.FromContext(ctx)
+
+	var user *models.User
+
+	err := postgres.InTx(ctx, r.db, func(tx pgx.Tx) error {
+		current, err := scanPostgresUser(tx.QueryRow(ctx,
+			`SELECT data FROM users WHERE tenant_id = $1 AND id = $2 FOR UPDATE`,
+			tenantID, userID,
+		))
+		if err != nil {
+			return err
+		}
+
+		login := current.Login
+		if err = fn(current); err != nil {
+			return err
+		}
+
+		if current.ID != userID || current.Login != login {
+			return errLoginChanged
+		}
+
+		data, err := json.Marshal(current)
+		if err != nil {
+			return fmt.Errorf("marshal: %w", err)
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE users SET data = $1 WHERE tenant_id = $2 AND id = $3`,
+			data, tenantID, userID,
+		)
+		if err != nil {
+			return fmt.Errorf("update user: %w", err)
+		}
+
+		user = current
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Rename - переносит пользователя с логина login на user.Login
+func (r *PostgresRepository) Rename(ctx context.Context, login string, user models.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	tag, err := r.db.Exec(ctx,
+		`UPDATE users SET login = $1, data = $2 WHERE tenant_id = $3 AND id = $4 AND login = $5`,
+		user.Login, data, tenant.FromContext(ctx), user.ID, login,
+	)
+	if err != nil {
+		if postgres.IsUniqueViolation(err) {
+			return ErrUserAlreadyExists
+		}
+		return fmt.Errorf("rename user: %w", err)
+	}
+
+	return requireUpdated(tag)
+}
+
+func (r *PostgresRepository) Delete(ctx context.Context, login string) error {
+	tag, err := r.db.Exec(ctx,
+		`DELETE FROM users WHERE tenant_id = $1 AND login = $2`,
+		tenant.FromContext(ctx), login,
+	)
+	if err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+
+	return requireUpdated(tag)
+}
+
+// Restore - пользователь и счетчик UserID меняются в одной транзакции
+func (r *PostgresRepository) Restore(ctx context.Context, user models.User) error {
+	tenantID := tenant.FromContext(ctx)
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	return postgres.InTx(ctx, r.db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO users (tenant_id, id, login, data) VALUES ($1, $2, $3, $4)`,
+			tenantID, user.ID, user.Login, data,
+		)
+		if err != nil {
+			if postgres.IsUniqueViolation(err) {
+				return ErrUserAlreadyExists
+			}
+			return fmt.Errorf("insert user: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO sequences (tenant_id, name, value) VALUES ($1, $2, $3)
+			ON CONFLICT (tenant_id, name) DO UPDATE SET value = GREATEST(sequences.value, EXCLUDED.value)`,
+			tenantID, userSequence, user.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("raise user id: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (r *PostgresRepository) Iterate(ctx context.Context, fn func(user models.User) error) error {
+	rows, err := r.db.Query(ctx,
+		`SELECT data FROM users WHERE tenant_id = $1 ORDER BY id`,
+		tenant.FromContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("select users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanPostgresUser(rows)
+		if err != nil {
+			return err
+		}
+
+		if err = fn(*user); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("select users: %w", err)
+	}
+
+	return nil
+}
+
+func scanPostgresUser(row pgx.Row) (*models.User, error) {
+	var data []byte
+	if err := row.Scan(&data); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("scan user: %w", err)
+	}
+
+	user := new(models.User)
+	if err := json.Unmarshal(data, user); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+
+	return user, nil
+}
+
+func requireUpdated(tag pgconn.CommandTag) error {
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
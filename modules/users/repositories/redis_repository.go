@@ -3,29 +3,46 @@ package repositories
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
 	"github.com/go-redis/redis/v8"
 	"time"
 )
 
+// maxWatchRetries - сколько раз повторяется запись, если пользователя изменили параллельно
+const maxWatchRetries = 10
+
 type RedisRepository struct {
-	client   *redis.Client
-	expireAt time.Duration
-	lastID   models.UserID
+	client redis.UniversalClient
+	keys   keyschema.Schema
+	ttl    time.Duration
+	now    func() time.Time
 }
 
-func NewRedisRepository(client *redis.Client, expiredAt time.Duration) *RedisRepository {
+func NewRedisRepository(client redis.UniversalClient, keys keyschema.Schema, ttl time.Duration) *RedisRepository {
 	return &RedisRepository{
-		client:   client,
-		expireAt: expiredAt,
-		lastID:   0,
+		client: client,
+		keys:   keys,
+		ttl:    ttl,
+		now:    time.Now,
 	}
 }
 
-func (r *RedisRepository) Create(_ context.Context, login string, password []byte) (*models.User, error) {
-	ctx := context.Background()
-	count, err := r.client.Exists(ctx, login).Result()
+// raiseSequenceScript - поднимает счетчик KEYS[1] до ARGV[1], меньшее значение не пишется
+var raiseSequenceScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if current < tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+
+return 0
+`)
+
+// Create - UserID выдается счетчиком redis, уникальность логина обеспечивает SETNX
+func (r *RedisRepository) Create(ctx context.Context, login string, password []byte) (*models.User, error) {
+	count, err := r.client.Exists(ctx, r.keys.UserKey(ctx, login)).Result()
 	if err != nil {
 		return nil, fmt.Errorf("redis.Exists: %w", err)
 	}
@@ -33,27 +50,44 @@ func (r *RedisRepository) Create(_ context.Context, login string, password []byt
 	if count > 0 {
 		return nil, ErrUserAlreadyExists
 	}
-	r.lastID++
+
+	id, err := r.client.Incr(ctx, r.keys.UserSequenceKey(ctx)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis.Incr: %w", err)
+	}
 
 	user := models.User{
-		ID:       r.lastID,
-		Login:    login,
-		Password: password,
+		ID:        models.UserID(id),
+		Login:     login,
+		Password:  password,
+		CreatedAt: r.now().UTC(),
 	}
 
 	data, err := json.Marshal(user)
 	if err != nil {
-		return nil, fmt.Errorf("unmarshal: %w", err)
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+
+	created, err := r.client.SetNX(ctx, r.keys.UserKey(ctx, login), data, r.ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis.SetNX: %w", err)
+	}
+
+	if !created {
+		return nil, ErrUserAlreadyExists
 	}
 
-	err = r.client.Set(ctx, login, data, r.expireAt).Err()
+	err = r.client.Set(ctx, r.keys.UserIndexKey(ctx, user.ID), login, r.ttl).Err()
+	if err != nil {
+		r.client.Del(ctx, r.keys.UserKey(ctx, login))
+		return nil, fmt.Errorf("redis.Set: %w", err)
+	}
 
 	return &user, nil
 }
 
-func (r *RedisRepository) Get(_ context.Context, login string) (*models.User, error) {
-	ctx := context.Background()
-	res, err := r.client.Get(ctx, login).Result()
+func (r *RedisRepository) Get(ctx context.Context, login string) (*models.User, error) {
+	res, err := r.client.Get(ctx, r.keys.UserKey(ctx, login)).Result()
 	if err != nil {
 		return nil, ErrUserNotFound
 	}
@@ -67,3 +101,263 @@ func (r *RedisRepository) Get(_ context.Context, login string) (*models.User, er
 
 	return user, nil
 }
+
+// GetByID - поиск пользователя через индекс UserID -> логин
+func (r *RedisRepository) GetByID(ctx context.Context, userID models.UserID) (*models.User, error) {
+	login, err := r.client.Get(ctx, r.keys.UserIndexKey(ctx, userID)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			err = ErrUserNotFound
+		}
+
+		return nil, err
+	}
+
+	return r.Get(ctx, login)
+}
+
+// Update - заменяет данные существующего пользователя, логин не меняется.
+// Проверка UserID и запись выполняются под WATCH ключа пользователя
+func (r *RedisRepository) Update(ctx context.Context, user models.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	key := r.keys.UserKey(ctx, user.Login)
+
+	return r.watch(ctx, key, func(tx *redis.Tx) error {
+		current, err := readUser(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+
+		if current.ID != user.ID {
+			return ErrUserNotFound
+		}
+
+		return r.write(ctx, tx, key, user.ID, data)
+	})
+}
+
+// Modify - данные читаются и записываются под WATCH ключа пользователя,
+// при параллельной записи изменение повторяется на свежих данных
+func (r *RedisRepository) Modify(
+	ctx context.Context,
+	userID models.UserID,
+	fn func(user *models.User) error,
+) (*models.User, error) {
+	login, err := r.client.Get(ctx, r.keys.UserIndexKey(ctx, userID)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			err = ErrUserNotFound
+		}
+
+		return nil, err
+	}
+
+	key := r.keys.UserKey(ctx, login)
+
+	var user *models.User
+
+	err = r.watch(ctx, key, func(tx *redis.Tx) error {
+		current, err := readUser(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+
+		if current.ID != userID {
+			return ErrUserNotFound
+		}
+
+		if err = fn(current); err != nil {
+			return err
+		}
+
+		if current.ID != userID || current.Login != login {
+			return errLoginChanged
+		}
+
+		data, err := json.Marshal(current)
+		if err != nil {
+			return fmt.Errorf("marshal: %w", err)
+		}
+
+		user = current
+
+		return r.write(ctx, tx, key, userID, data)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// watch - выполняет fn под WATCH key, повторяя при параллельной записи
+func (r *RedisRepository) watch(ctx context.Context, key string, fn func(tx *redis.Tx) error) error {
+	for attempt := 0; attempt < maxWatchRetries; attempt++ {
+		err := r.client.Watch(ctx, fn, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+
+	return ErrUserConflict
+}
+
+// write - записывает данные пользователя в MULTI, срок индекса продлевается после
+func (r *RedisRepository) write(ctx context.Context, tx *redis.Tx, key string, userID models.UserID, data []byte) error {
+	_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetXX(ctx, key, data, r.ttl)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if r.ttl > 0 {
+		err = r.client.Expire(ctx, r.keys.UserIndexKey(ctx, userID), r.ttl).Err()
+		if err != nil {
+			return fmt.Errorf("redis.Expire: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func readUser(ctx context.Context, tx *redis.Tx, key string) (*models.User, error) {
+	data, err := tx.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrUserNotFound
+		}
+
+		return nil, fmt.Errorf("redis.Get: %w", err)
+	}
+
+	user := new(models.User)
+	if err = json.Unmarshal(data, user); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+
+	return user, nil
+}
+
+// Rename - переносит пользователя с логина login на user.Login
+func (r *RedisRepository) Rename(ctx context.Context, login string, user models.User) error {
+	current, err := r.Get(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	if current.ID != user.ID {
+		return ErrUserNotFound
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	if user.Login == login {
+		return r.Update(ctx, user)
+	}
+
+	created, err := r.client.SetNX(ctx, r.keys.UserKey(ctx, user.Login), data, r.ttl).Result()
+	if err != nil {
+		return fmt.Errorf("redis.SetNX: %w", err)
+	}
+
+	if !created {
+		return ErrUserAlreadyExists
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, r.keys.UserIndexKey(ctx, user.ID), user.Login, r.ttl)
+		pipe.Del(ctx, r.keys.UserKey(ctx, login))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("redis.TxPipelined: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisRepository) Delete(ctx context.Context, login string) error {
+	user, err := r.Get(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	err = r.client.Del(ctx, r.keys.UserKey(ctx, login), r.keys.UserIndexKey(ctx, user.ID)).Err()
+	if err != nil {
+		return fmt.Errorf("redis.Del: %w", err)
+	}
+
+	return nil
+}
+
+// Restore - счетчик поднимается до записи, чтобы параллельный Create не выдал тот же UserID,
+// затем SETNX занимает UserID и логин
+func (r *RedisRepository) Restore(ctx context.Context, user models.User) error {
+	err := raiseSequenceScript.Run(ctx, r.client, []string{r.keys.UserSequenceKey(ctx)}, int64(user.ID)).Err()
+	if err != nil {
+		return fmt.Errorf("raiseSequenceScript: %w", err)
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	indexKey := r.keys.UserIndexKey(ctx, user.ID)
+
+	created, err := r.client.SetNX(ctx, indexKey, user.Login, r.ttl).Result()
+	if err != nil {
+		return fmt.Errorf("redis.SetNX: %w", err)
+	}
+
+	if !created {
+		return ErrUserAlreadyExists
+	}
+
+	created, err = r.client.SetNX(ctx, r.keys.UserKey(ctx, user.Login), data, r.ttl).Result()
+	if err == nil && !created {
+		err = ErrUserAlreadyExists
+	}
+
+	if err != nil {
+		r.client.Del(ctx, indexKey)
+		return err
+	}
+
+	return nil
+}
+
+func (r *RedisRepository) Iterate(ctx context.Context, fn func(user models.User) error) error {
+	return keyschema.Scan(ctx, r.client, r.keys.UserKey(ctx, "*"), func(keys []string) error {
+		values, err := keyschema.GetAll(ctx, r.client, keys)
+		if err != nil {
+			return err
+		}
+
+		for _, value := range values {
+			if value == nil {
+				continue
+			}
+
+			user := models.User{}
+			if err = json.Unmarshal([]byte(*value), &user); err != nil {
+				return fmt.Errorf("unmarshal: %w", err)
+			}
+
+			if err = fn(user); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
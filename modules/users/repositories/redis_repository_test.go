@@ -4,11 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
+	"github.com/IlnurShafikov/wallet/services/tenant"
 	"github.com/alicebob/miniredis/v2"
 	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestRedisRepository_Get(t *testing.T) {
@@ -27,6 +31,8 @@ func TestRedisRepository_Get(t *testing.T) {
 
 	repo := &RedisRepository{
 		client: client,
+		keys:   keyschema.Default(),
+		now:    time.Now,
 	}
 
 	user := &models.User{
@@ -60,7 +66,7 @@ func TestRedisRepository_Get(t *testing.T) {
 				userJSON, err := json.Marshal(user)
 				require.NoError(t, err)
 
-				err = r.Set(ctx, login, userJSON, 0).Err()
+				err = r.Set(ctx, repo.keys.UserKey(ctx, login), userJSON, 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: func(t *testing.T, res *models.User, err error) {
@@ -73,7 +79,7 @@ func TestRedisRepository_Get(t *testing.T) {
 				userJSON, err := json.Marshal(user)
 				require.NoError(t, err)
 
-				err = r.Set(ctx, login, userJSON, 0).Err()
+				err = r.Set(ctx, repo.keys.UserKey(ctx, login), userJSON, 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: expErr(ErrUserNotFound),
@@ -103,11 +109,13 @@ func TestRedisRepository_Create(t *testing.T) {
 	login := "user1"
 	lastID := models.UserID(1)
 	ctx := context.Background()
+	created := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
 
 	user := models.User{
-		ID:       lastID,
-		Login:    login,
-		Password: password,
+		ID:        lastID,
+		Login:     login,
+		Password:  password,
+		CreatedAt: created,
 	}
 
 	client := redis.NewClient(&redis.Options{
@@ -116,6 +124,8 @@ func TestRedisRepository_Create(t *testing.T) {
 
 	repo := &RedisRepository{
 		client: client,
+		keys:   keyschema.Default(),
+		now:    func() time.Time { return created },
 	}
 
 	expErr := func(expErr error) func(t *testing.T, res *models.User, err error) {
@@ -139,7 +149,7 @@ func TestRedisRepository_Create(t *testing.T) {
 				userJSON, err := json.Marshal(user)
 				require.NoError(t, err)
 
-				err = r.Set(ctx, login, userJSON, 0).Err()
+				err = r.Set(ctx, repo.keys.UserKey(ctx, login), userJSON, 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: expErr(ErrUserAlreadyExists),
@@ -166,3 +176,199 @@ func TestRedisRepository_Create(t *testing.T) {
 		})
 	}
 }
+
+func TestRedisRepository_GetByID(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := context.Background()
+
+	client := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	repo := NewRedisRepository(client, keyschema.Default(), 0)
+
+	first, err := repo.Create(ctx, "user1", []byte("1"))
+	require.NoError(t, err)
+
+	// после рестарта сервиса счетчик продолжает выдавать новые UserID
+	restarted := NewRedisRepository(client, keyschema.Default(), 0)
+
+	second, err := restarted.Create(ctx, "user2", []byte("2"))
+	require.NoError(t, err)
+	assert.Equal(t, first.ID+1, second.ID)
+
+	_, err = restarted.Create(ctx, "user1", []byte("3"))
+	assert.ErrorIs(t, err, ErrUserAlreadyExists)
+
+	got, err := restarted.GetByID(ctx, second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, second, got)
+
+	_, err = restarted.GetByID(ctx, 100)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	second.Profile.Country = "DE"
+	require.NoError(t, restarted.Update(ctx, *second))
+
+	got, err = restarted.GetByID(ctx, second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "DE", got.Profile.Country)
+
+	err = restarted.Update(ctx, models.User{ID: first.ID, Login: second.Login})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestRedisRepository_Iterate(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := context.Background()
+	brandCtx := tenant.WithTenant(ctx, "brand")
+
+	client := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	repo := NewRedisRepository(client, keyschema.Default(), 0)
+
+	for _, login := range []string{"user1", "user2"} {
+		_, err = repo.Create(ctx, login, []byte("1"))
+		require.NoError(t, err)
+	}
+
+	_, err = repo.Create(brandCtx, "user3", []byte("1"))
+	require.NoError(t, err)
+
+	var logins []string
+	err = repo.Iterate(ctx, func(user models.User) error {
+		logins = append(logins, user.Login)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"user1", "user2"}, logins)
+}
+
+func TestRedisRepository_Rename(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := context.Background()
+
+	client := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	repo := NewRedisRepository(client, keyschema.Default(), 0)
+
+	user, err := repo.Create(ctx, "user1", []byte("1"))
+	require.NoError(t, err)
+
+	_, err = repo.Create(ctx, "user2", []byte("2"))
+	require.NoError(t, err)
+
+	renamed := *user
+	renamed.Login = "user2"
+	assert.ErrorIs(t, repo.Rename(ctx, "user1", renamed), ErrUserAlreadyExists)
+
+	renamed.Login = "user3"
+	require.NoError(t, repo.Rename(ctx, "user1", renamed))
+
+	assert.False(t, s.Exists("user:default:user1"))
+
+	got, err := repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "user3", got.Login)
+}
+
+// параллельные изменения не затирают друг друга
+func TestRedisRepository_Modify(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := context.Background()
+
+	client := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	repo := NewRedisRepository(client, keyschema.Default(), 0)
+
+	user, err := repo.Create(ctx, "user1", []byte("1"))
+	require.NoError(t, err)
+
+	const writers = 5
+
+	var wg sync.WaitGroup
+	for n := 0; n < writers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := repo.Modify(ctx, user.ID, func(user *models.User) error {
+				if user.Account == nil {
+					user.Account = &models.Account{}
+				}
+				user.Account.History = append(user.Account.History, models.StatusChange{Status: models.UserActive})
+				return nil
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	got, err := repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Len(t, got.Account.History, writers)
+
+	_, err = repo.Modify(ctx, user.ID, func(user *models.User) error {
+		user.Login = "user2"
+		return nil
+	})
+	assert.Error(t, err)
+
+	_, err = repo.Modify(ctx, user.ID+1, func(user *models.User) error { return nil })
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+// в cluster ключи пользователей оператора в одном слоте, переименование и удаление работают
+func TestRedisRepository_Cluster(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := tenant.WithTenant(context.Background(), "brand")
+
+	client := redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs: []string{s.Addr()},
+	})
+
+	keys := keyschema.Default()
+	keys.HashTags = true
+	repo := NewRedisRepository(client, keys, 0)
+
+	user, err := repo.Create(ctx, "user1", []byte("1"))
+	require.NoError(t, err)
+	assert.True(t, s.Exists("user:{brand}:user1"))
+	assert.True(t, s.Exists("user_id:{brand}:1"))
+
+	renamed := *user
+	renamed.Login = "user2"
+	require.NoError(t, repo.Rename(ctx, "user1", renamed))
+
+	var logins []string
+	err = repo.Iterate(ctx, func(user models.User) error {
+		logins = append(logins, user.Login)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user2"}, logins)
+
+	require.NoError(t, repo.Delete(ctx, "user2"))
+	assert.False(t, s.Exists("user_id:{brand}:1"))
+}
@@ -0,0 +1,181 @@
+package repositories
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
+	"github.com/IlnurShafikov/wallet/services/postgres/pgtest"
+	"github.com/IlnurShafikov/wallet/services/sqlite"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testRepository - общее поведение постоянных хранилищ пользователей
+type testRepository interface {
+	Create(ctx context.Context, login string, password []byte) (*models.User, error)
+	Get(ctx context.Context, login string) (*models.User, error)
+	GetByID(ctx context.Context, userID models.UserID) (*models.User, error)
+	Update(ctx context.Context, user models.User) error
+	Rename(ctx context.Context, login string, user models.User) error
+	Delete(ctx context.Context, login string) error
+	Iterate(ctx context.Context, fn func(user models.User) error) error
+}
+
+// repositoryConstructor - пустое хранилище и контекст оператора, в котором с ним работает тест
+type repositoryConstructor func(t *testing.T) (testRepository, context.Context)
+
+// repositoryConstructors - реализации, на которых выполняются общие тесты;
+// InMemoryRepository ведет общий счетчик UserID и проверяется отдельно
+func repositoryConstructors() map[string]repositoryConstructor {
+	return map[string]repositoryConstructor{
+		"postgres": func(t *testing.T) (testRepository, context.Context) {
+			db, ctx := pgtest.Open(t)
+			return NewPostgresRepository(db), ctx
+		},
+		"redis": func(t *testing.T) (testRepository, context.Context) {
+			s := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+			t.Cleanup(func() { _ = client.Close() })
+
+			return NewRedisRepository(client, keyschema.Default(), 0), context.Background()
+		},
+		"sqlite": func(t *testing.T) (testRepository, context.Context) {
+			db, err := sqlite.Open(context.Background(), filepath.Join(t.TempDir(), "wallet.db"), time.Second)
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = db.Close() })
+
+			return NewSQLiteRepository(db), context.Background()
+		},
+	}
+}
+
+func TestRepository_Create(t *testing.T) {
+	for name, newRepository := range repositoryConstructors() {
+		t.Run(name, func(t *testing.T) {
+			repo, ctx := newRepository(t)
+
+			first, err := repo.Create(ctx, "user1", []byte("1"))
+			require.NoError(t, err)
+			assert.Equal(t, models.UserID(1), first.ID)
+			assert.Equal(t, "user1", first.Login)
+			assert.Equal(t, []byte("1"), first.Password)
+			assert.False(t, first.CreatedAt.IsZero())
+
+			_, err = repo.Create(ctx, "user1", []byte("2"))
+			assert.ErrorIs(t, err, ErrUserAlreadyExists)
+
+			// неудачная вставка не расходует UserID
+			second, err := repo.Create(ctx, "user2", []byte("2"))
+			require.NoError(t, err)
+			assert.Equal(t, models.UserID(2), second.ID)
+
+			// у каждого оператора свой счетчик и свои логины
+			other, err := repo.Create(tenant.WithTenant(ctx, tenant.FromContext(ctx)+"-brand"), "user1", []byte("3"))
+			require.NoError(t, err)
+			assert.Equal(t, models.UserID(1), other.ID)
+		})
+	}
+}
+
+func TestRepository_Get(t *testing.T) {
+	for name, newRepository := range repositoryConstructors() {
+		t.Run(name, func(t *testing.T) {
+			repo, ctx := newRepository(t)
+
+			user, err := repo.Create(ctx, "user1", []byte("1"))
+			require.NoError(t, err)
+
+			got, err := repo.Get(ctx, "user1")
+			require.NoError(t, err)
+			assert.Equal(t, user.ID, got.ID)
+
+			_, err = repo.Get(ctx, "user2")
+			assert.ErrorIs(t, err, ErrUserNotFound)
+
+			_, err = repo.Get(tenant.WithTenant(ctx, tenant.FromContext(ctx)+"-brand"), "user1")
+			assert.ErrorIs(t, err, ErrUserNotFound)
+
+			got, err = repo.GetByID(ctx, user.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "user1", got.Login)
+
+			_, err = repo.GetByID(ctx, 100)
+			assert.ErrorIs(t, err, ErrUserNotFound)
+		})
+	}
+}
+
+func TestRepository_Update(t *testing.T) {
+	for name, newRepository := range repositoryConstructors() {
+		t.Run(name, func(t *testing.T) {
+			repo, ctx := newRepository(t)
+
+			user, err := repo.Create(ctx, "user1", []byte("1"))
+			require.NoError(t, err)
+
+			second, err := repo.Create(ctx, "user2", []byte("2"))
+			require.NoError(t, err)
+
+			user.Profile.Country = "DE"
+			require.NoError(t, repo.Update(ctx, *user))
+
+			got, err := repo.GetByID(ctx, user.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "DE", got.Profile.Country)
+
+			err = repo.Update(ctx, models.User{ID: user.ID, Login: second.Login})
+			assert.ErrorIs(t, err, ErrUserNotFound)
+
+			renamed := *user
+			renamed.Login = "user2"
+			assert.ErrorIs(t, repo.Rename(ctx, "user1", renamed), ErrUserAlreadyExists)
+
+			renamed.Login = "user3"
+			require.NoError(t, repo.Rename(ctx, "user1", renamed))
+
+			_, err = repo.Get(ctx, "user1")
+			assert.ErrorIs(t, err, ErrUserNotFound)
+
+			got, err = repo.GetByID(ctx, user.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "user3", got.Login)
+
+			require.NoError(t, repo.Delete(ctx, "user3"))
+			assert.ErrorIs(t, repo.Delete(ctx, "user3"), ErrUserNotFound)
+
+			_, err = repo.GetByID(ctx, user.ID)
+			assert.ErrorIs(t, err, ErrUserNotFound)
+		})
+	}
+}
+
+func TestRepository_Iterate(t *testing.T) {
+	for name, newRepository := range repositoryConstructors() {
+		t.Run(name, func(t *testing.T) {
+			repo, ctx := newRepository(t)
+			brandCtx := tenant.WithTenant(ctx, tenant.FromContext(ctx)+"-brand")
+
+			for _, login := range []string{"user1", "user2"} {
+				_, err := repo.Create(ctx, login, []byte("1"))
+				require.NoError(t, err)
+			}
+
+			_, err := repo.Create(brandCtx, "user3", []byte("1"))
+			require.NoError(t, err)
+
+			var logins []string
+			err = repo.Iterate(ctx, func(user models.User) error {
+				logins = append(logins, user.Login)
+				return nil
+			})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"user1", "user2"}, logins)
+		})
+	}
+}
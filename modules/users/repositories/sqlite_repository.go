@@ -0,0 +1,296 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/sqlite"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"time"
+)
+
+// userSequence - имя счетчика UserID в таблице sequences
+const userSequence = "user"
+
+type SQLiteRepository struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+func NewSQLiteRepository(db *sql.DB) *SQLiteRepository {
+	return &SQLiteRepository{
+		db:  db,
+		now: time.Now,
+	}
+}
+
+// Create - UserID выдается счетчиком оператора в той же транзакции,
+// при ошибке вставки счетчик не меняется
+func (r *SQLiteRepository) Create(ctx context.Context, login string, password []byte) (*models.User, error) {
+	tenantID := tenant.FromContext(ctx)
+
+	var user models.User
+
+	err := sqlite.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		var id int64
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO sequences (tenant_id, name, value) VALUES (?, ?, 1)
+			ON CONFLICT (tenant_id, name) DO UPDATE SET value = value + 1
+			RETURNING value`,
+			tenantID, userSequence,
+		).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("next user id: %w", err)
+		}
+
+		user = models.User{
+			ID:        models.UserID(id),
+			Login:     login,
+			Password:  password,
+			CreatedAt: r.now().UTC(),
+		}
+
+		data, err := json.Marshal(user)
+		if err != nil {
+			return fmt.Errorf("marshal: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO users (tenant_id, id, login, data) VALUES (?, ?, ?, ?)`,
+			tenantID, user.ID, login, data,
+		)
+		if err != nil {
+			if sqlite.IsUniqueViolation(err) {
+				return ErrUserAlreadyExists
+			}
+			return fmt.Errorf("insert user: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (r *SQLiteRepository) Get(ctx context.Context, login string) (*models.User, error) {
+	row := r.db.QueryRowContext(ctx,
+		`SELECT data FROM users WHERE tenant_id = ? AND login = ?`,
+		tenant.FromContext(ctx), login,
+	)
+
+	return scanUser(row)
+}
+
+func (r *SQLiteRepository) GetByID(ctx context.Context, userID models.UserID) (*models.User, error) {
+	row := r.db.QueryRowContext(ctx,
+		`SELECT data FROM users WHERE tenant_id = ? AND id = ?`,
+		tenant.FromContext(ctx), userID,
+	)
+
+	return scanUser(row)
+}
+
+// Update - заменяет данные существующего пользователя, логин не меняется
+func (r *SQLiteRepository) Update(ctx context.Context, user models.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE users SET data = ? WHERE tenant_id = ? AND id = ? AND login = ?`,
+		data, tenant.FromContext(ctx), user.ID, user.Login,
+	)
+	if err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+
+	return requireAffected(res)
+}
+
+// Modify - транзакция берет блокировку на запись сразу, параллельные изменения ждут
+func (r *SQLiteRepository) Modify(
+	ctx context.Context,
+	userID models.UserID,
+	fn func(user *models.User) error,
+) (*models.User, error) {
+	tenantID := tenant.FromContext(ctx)
+
+	var user *models.User
+
+	err := sqlite.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		current, err := scanUser(tx.QueryRowContext(ctx,
+			`SELECT data FROM users WHERE tenant_id = ? AND id = ?`,
+			tenantID, userID,
+		))
+		if err != nil {
+			return err
+		}
+
+		login := current.Login
+		if err = fn(current); err != nil {
+			return err
+		}
+
+		if current.ID != userID || current.Login != login {
+			return errLoginChanged
+		}
+
+		data, err := json.Marshal(current)
+		if err != nil {
+			return fmt.Errorf("marshal: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE users SET data = ? WHERE tenant_id = ? AND id = ?`,
+			data, tenantID, userID,
+		)
+		if err != nil {
+			return fmt.Errorf("update user: %w", err)
+		}
+
+		user = current
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Rename - переносит пользователя с логина login на user.Login
+func (r *SQLiteRepository) Rename(ctx context.Context, login string, user models.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE users SET login = ?, data = ? WHERE tenant_id = ? AND id = ? AND login = ?`,
+		user.Login, data, tenant.FromContext(ctx), user.ID, login,
+	)
+	if err != nil {
+		if sqlite.IsUniqueViolation(err) {
+			return ErrUserAlreadyExists
+		}
+		return fmt.Errorf("rename user: %w", err)
+	}
+
+	return requireAffected(res)
+}
+
+func (r *SQLiteRepository) Delete(ctx context.Context, login string) error {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM users WHERE tenant_id = ? AND login = ?`,
+		tenant.FromContext(ctx), login,
+	)
+	if err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+
+	return requireAffected(res)
+}
+
+// Restore - пользователь и счетчик UserID меняются в одной транзакции
+func (r *SQLiteRepository) Restore(ctx context.Context, user models.User) error {
+	tenantID := tenant.FromContext(ctx)
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	return sqlite.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO users (tenant_id, id, login, data) VALUES (?, ?, ?, ?)`,
+			tenantID, user.ID, user.Login, data,
+		)
+		if err != nil {
+			if sqlite.IsUniqueViolation(err) {
+				return ErrUserAlreadyExists
+			}
+			return fmt.Errorf("insert user: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO sequences (tenant_id, name, value) VALUES (?, ?, ?)
+			ON CONFLICT (tenant_id, name) DO UPDATE SET value = max(value, excluded.value)`,
+			tenantID, userSequence, user.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("raise user id: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (r *SQLiteRepository) Iterate(ctx context.Context, fn func(user models.User) error) error {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT data FROM users WHERE tenant_id = ? ORDER BY id`,
+		tenant.FromContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("select users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return err
+		}
+
+		if err = fn(*user); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("select users: %w", err)
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row scanner) (*models.User, error) {
+	var data []byte
+	if err := row.Scan(&data); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("scan user: %w", err)
+	}
+
+	user := new(models.User)
+	if err := json.Unmarshal(data, user); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+
+	return user, nil
+}
+
+func requireAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
@@ -8,6 +8,13 @@ import (
 type Repository interface {
 	Creater
 	Getter
+	IDGetter
+	Updater
+	Modifier
+	Renamer
+	Deleter
+	Iterator
+	Restorer
 }
 
 type Creater interface {
@@ -17,3 +24,38 @@ type Creater interface {
 type Getter interface {
 	Get(ctx context.Context, login string) (*models.User, error)
 }
+
+type IDGetter interface {
+	GetByID(ctx context.Context, userID models.UserID) (*models.User, error)
+}
+
+type Updater interface {
+	Update(ctx context.Context, user models.User) error
+}
+
+// Modifier - меняет пользователя по UserID: fn получает текущие данные,
+// параллельная запись не теряется. Логин меняется только через Renamer,
+// ошибка fn отменяет изменение
+type Modifier interface {
+	Modify(ctx context.Context, userID models.UserID, fn func(user *models.User) error) (*models.User, error)
+}
+
+// Renamer - сохраняет пользователя под новым логином, ID не меняется
+type Renamer interface {
+	Rename(ctx context.Context, login string, user models.User) error
+}
+
+type Deleter interface {
+	Delete(ctx context.Context, login string) error
+}
+
+// Iterator - обход всех пользователей оператора из контекста
+type Iterator interface {
+	Iterate(ctx context.Context, fn func(user models.User) error) error
+}
+
+// Restorer - сохраняет пользователя из резервной копии с его UserID,
+// счетчик UserID поднимается, чтобы новые пользователи не получили занятый ID
+type Restorer interface {
+	Restore(ctx context.Context, user models.User) error
+}
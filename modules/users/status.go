@@ -0,0 +1,152 @@
+package users
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUserSuspended = apierror.New(http.StatusForbidden, "user_suspended", "user is suspended")
+	ErrUserBanned    = apierror.New(http.StatusForbidden, "user_banned", "user is banned")
+	ErrUserErased    = apierror.New(http.StatusForbidden, "user_erased", "user data is erased")
+)
+
+// SetStatusRequest - SuspendedUntil обязателен для приостановки,
+// причина сохраняется в журнале
+type SetStatusRequest struct {
+	Status         models.UserStatus `json:"status"`
+	SuspendedUntil *time.Time        `json:"suspended_until"`
+	Reason         string            `json:"reason"`
+}
+
+func (r SetStatusRequest) Validate(now time.Time) error {
+	var fields []apierror.FieldError
+
+	switch r.Status {
+	case models.UserActive, models.UserBanned:
+		if r.SuspendedUntil != nil {
+			fields = append(fields, apierror.FieldError{
+				Field:   "suspended_until",
+				Code:    "not_allowed",
+				Message: "is allowed only for suspended status",
+			})
+		}
+	case models.UserSuspended:
+		if r.SuspendedUntil == nil || !r.SuspendedUntil.After(now) {
+			fields = append(fields, apierror.FieldError{
+				Field:   "suspended_until",
+				Code:    "invalid",
+				Message: "must be in the future",
+			})
+		}
+	default:
+		fields = append(fields, apierror.FieldError{
+			Field:   "status",
+			Code:    "invalid",
+			Message: "must be active, suspended or banned",
+		})
+	}
+
+	if strings.TrimSpace(r.Reason) == "" {
+		fields = append(fields, apierror.FieldError{
+			Field:   "reason",
+			Code:    "required",
+			Message: "is required",
+		})
+	}
+
+	if len(fields) > 0 {
+		return apierror.Validation(fields)
+	}
+
+	return nil
+}
+
+// SetStatus - меняет статус аккаунта и дописывает изменение в журнал
+func (u *UserService) SetStatus(
+	ctx context.Context,
+	userID models.UserID,
+	req SetStatusRequest,
+) (*models.Account, error) {
+	now := u.now().UTC()
+
+	err := req.Validate(now)
+	if err != nil {
+		return nil, err
+	}
+
+	var until *time.Time
+	if req.SuspendedUntil != nil {
+		t := req.SuspendedUntil.UTC()
+		until = &t
+	}
+
+	user, err := u.repository.Modify(ctx, userID, func(user *models.User) error {
+		if user.Account == nil {
+			user.Account = &models.Account{}
+		}
+
+		user.Account.Status = req.Status
+		user.Account.SuspendedUntil = until
+		user.Account.History = append(user.Account.History, models.StatusChange{
+			Status:         req.Status,
+			SuspendedUntil: until,
+			Reason:         strings.TrimSpace(req.Reason),
+			At:             now,
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user.Account, nil
+}
+
+// CheckActive - ErrUserSuspended с временем окончания или ErrUserBanned
+func (u *UserService) CheckActive(ctx context.Context, userID models.UserID) error {
+	user, err := u.repository.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return u.checkStatus(*user)
+}
+
+func (u *UserService) checkStatus(user models.User) error {
+	if user.ErasedAt != nil {
+		return ErrUserErased
+	}
+
+	now := u.now()
+
+	switch user.StatusAt(now) {
+	case models.UserSuspended:
+		if user.Account.SuspendedUntil != nil {
+			return ErrUserSuspended.WithRetryAfter(user.Account.SuspendedUntil.Sub(now))
+		}
+		return ErrUserSuspended
+	case models.UserBanned:
+		return ErrUserBanned
+	default:
+		return nil
+	}
+}
+
+func (u *UserService) GetAccount(ctx context.Context, userID models.UserID) (*models.Account, error) {
+	user, err := u.repository.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Account == nil {
+		return &models.Account{Status: models.UserActive}, nil
+	}
+
+	return user.Account, nil
+}
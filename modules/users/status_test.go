@@ -0,0 +1,75 @@
+package users
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/modules/users/repositories"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/security"
+	"github.com/IlnurShafikov/wallet/services/throttle"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestUserService_SetStatus(t *testing.T) {
+	log := zerolog.Nop()
+	ctx := context.Background()
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	until := now.Add(24 * time.Hour)
+
+	hashing := security.NewChain(security.NewBcryptHashing("secret"))
+	password, err := hashing.HashPassword("password")
+	require.NoError(t, err)
+
+	repo := repositories.NewInMemoryRepository()
+	user, err := repo.Create(ctx, "user01", password)
+	require.NoError(t, err)
+
+	service := NewUserService(repo, hashing, throttle.NewLimiter(throttle.NewInMemoryRepository(), throttle.DefaultPolicy()), &log)
+	service.now = func() time.Time { return now }
+
+	_, err = service.SetStatus(ctx, user.ID, SetStatusRequest{Status: models.UserSuspended, Reason: "chargeback"})
+	assert.ErrorIs(t, err, apierror.ErrValidation)
+
+	_, err = service.SetStatus(ctx, user.ID, SetStatusRequest{Status: models.UserBanned})
+	assert.ErrorIs(t, err, apierror.ErrValidation)
+
+	_, err = service.SetStatus(ctx, user.ID, SetStatusRequest{
+		Status:         models.UserSuspended,
+		SuspendedUntil: &until,
+		Reason:         "chargeback",
+	})
+	require.NoError(t, err)
+
+	_, err = service.Authorization(ctx, "user01", "password")
+	require.ErrorIs(t, err, ErrUserSuspended)
+
+	var apiErr *apierror.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 24*time.Hour, apiErr.RetryAfter)
+
+	// приостановка закончилась
+	now = until
+	assert.NoError(t, service.CheckActive(ctx, user.ID))
+
+	_, err = service.SetStatus(ctx, user.ID, SetStatusRequest{Status: models.UserBanned, Reason: "fraud"})
+	require.NoError(t, err)
+
+	_, err = service.Authorization(ctx, "user01", "password")
+	assert.ErrorIs(t, err, ErrUserBanned)
+	assert.ErrorIs(t, service.CheckActive(ctx, user.ID), ErrUserBanned)
+
+	account, err := service.SetStatus(ctx, user.ID, SetStatusRequest{Status: models.UserActive, Reason: "appeal accepted"})
+	require.NoError(t, err)
+	assert.NoError(t, service.CheckActive(ctx, user.ID))
+
+	require.Len(t, account.History, 3)
+	assert.Equal(t, []string{"chargeback", "fraud", "appeal accepted"}, []string{
+		account.History[0].Reason,
+		account.History[1].Reason,
+		account.History[2].Reason,
+	})
+}
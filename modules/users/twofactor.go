@@ -0,0 +1,295 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/onetime"
+	"github.com/IlnurShafikov/wallet/services/session"
+	"github.com/IlnurShafikov/wallet/services/totp"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const recoveryCodesCount = 10
+
+var (
+	ErrTwoFactorEnabled     = apierror.New(http.StatusConflict, "two_factor_enabled", "two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled = apierror.New(http.StatusBadRequest, "two_factor_not_enrolled", "two-factor authentication is not enrolled")
+	ErrInvalidTwoFactorCode = apierror.New(http.StatusUnauthorized, "invalid_two_factor_code", "invalid two-factor code")
+	ErrInvalidChallenge     = apierror.New(http.StatusUnauthorized, "invalid_challenge", "login challenge is invalid or expired")
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type TwoFactorService interface {
+	Enroll(ctx context.Context, userID models.UserID) (*Enrollment, error)
+	Confirm(ctx context.Context, userID models.UserID, code string) ([]string, error)
+}
+
+// LoginChallenger - подтверждение входа вторым фактором
+type LoginChallenger interface {
+	// Challenge - пустой токен, если второй фактор не подключен
+	Challenge(ctx context.Context, userID models.UserID) (string, error)
+	CompleteChallenge(ctx context.Context, challenge, code string) (models.UserID, error)
+}
+
+// Enrollment - секрет показывается один раз при подключении
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type confirmTwoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactor struct {
+	repository   Repository
+	challenges   onetime.Repository
+	issuer       string
+	challengeTTL time.Duration
+	now          func() time.Time
+}
+
+func NewTwoFactor(
+	repository Repository,
+	challenges onetime.Repository,
+	issuer string,
+	challengeTTL time.Duration,
+) *TwoFactor {
+	return &TwoFactor{
+		repository:   repository,
+		challenges:   challenges,
+		issuer:       issuer,
+		challengeTTL: challengeTTL,
+		now:          time.Now,
+	}
+}
+
+// Enroll - новый секрет заменяет неподтвержденный
+func (t *TwoFactor) Enroll(ctx context.Context, userID models.UserID) (*Enrollment, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := t.repository.Modify(ctx, userID, func(user *models.User) error {
+		if user.TwoFactor != nil && user.TwoFactor.Enabled {
+			return ErrTwoFactorEnabled
+		}
+
+		user.TwoFactor = &models.TwoFactor{Secret: secret}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Enrollment{
+		Secret: secret,
+		URI:    totp.URI(t.issuer, user.Login, secret),
+	}, nil
+}
+
+// Confirm - включает второй фактор и возвращает коды восстановления
+func (t *TwoFactor) Confirm(ctx context.Context, userID models.UserID, code string) ([]string, error) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = t.repository.Modify(ctx, userID, func(user *models.User) error {
+		if user.TwoFactor == nil {
+			return ErrTwoFactorNotEnrolled
+		}
+
+		if user.TwoFactor.Enabled {
+			return ErrTwoFactorEnabled
+		}
+
+		step, ok := totp.Validate(user.TwoFactor.Secret, code, t.now(), user.TwoFactor.LastStep)
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+
+		user.TwoFactor.Enabled = true
+		user.TwoFactor.LastStep = step
+		user.TwoFactor.RecoveryCodes = hashes
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (t *TwoFactor) Challenge(ctx context.Context, userID models.UserID) (string, error) {
+	user, err := t.repository.GetByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if user.TwoFactor == nil || !user.TwoFactor.Enabled {
+		return "", nil
+	}
+
+	challenge, err := session.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = t.challenges.Save(ctx, session.HashToken(challenge), userID, t.challengeTTL)
+	if err != nil {
+		return "", err
+	}
+
+	return challenge, nil
+}
+
+// CompleteChallenge - принимает TOTP код или код восстановления.
+// Вызов расходует challenge, после неверного кода нужно снова ввести пароль.
+func (t *TwoFactor) CompleteChallenge(ctx context.Context, challenge, code string) (models.UserID, error) {
+	userID, err := t.challenges.Take(ctx, session.HashToken(challenge))
+	if err != nil {
+		if errors.Is(err, onetime.ErrTokenNotFound) {
+			return 0, ErrInvalidChallenge
+		}
+		return 0, err
+	}
+
+	_, err = t.repository.Modify(ctx, userID, func(user *models.User) error {
+		twoFactor := user.TwoFactor
+		if twoFactor == nil || !twoFactor.Enabled {
+			return ErrInvalidChallenge
+		}
+
+		if step, ok := totp.Validate(twoFactor.Secret, code, t.now(), twoFactor.LastStep); ok {
+			twoFactor.LastStep = step
+		} else if !useRecoveryCode(twoFactor, code) {
+			return ErrInvalidTwoFactorCode
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// useRecoveryCode - удаляет использованный код восстановления
+func useRecoveryCode(twoFactor *models.TwoFactor, code string) bool {
+	hash := session.HashToken(normalizeRecoveryCode(code))
+	for i, recoveryCode := range twoFactor.RecoveryCodes {
+		if recoveryCode == hash {
+			twoFactor.RecoveryCodes = append(twoFactor.RecoveryCodes[:i], twoFactor.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// newRecoveryCodes - коды вида abcde-fghij и их хеши
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([]string, 0, recoveryCodesCount)
+
+	for i := 0; i < recoveryCodesCount; i++ {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, fmt.Errorf("generate recovery code: %w", err)
+		}
+
+		raw := strings.ToLower(recoveryEncoding.EncodeToString(buf))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, session.HashToken(raw))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
+
+type TwoFactorHandler struct {
+	service TwoFactorService
+	log     *zerolog.Logger
+}
+
+// RegisterTwoFactorHandler - подключение второго фактора доступно только владельцу сессии
+func RegisterTwoFactorHandler(
+	router fiber.Router,
+	service TwoFactorService,
+	sessions *session.Manager,
+	logger *zerolog.Logger,
+) {
+	h := &TwoFactorHandler{
+		service: service,
+		log:     logger,
+	}
+
+	auth := []fiber.Handler{session.Middleware(sessions), session.Owner("userID")}
+
+	router.Post("/users/:userID/2fa", append(auth, h.enroll)...)
+	router.Post("/users/:userID/2fa/confirm", append(auth, h.confirm)...)
+}
+
+func (h *TwoFactorHandler) enroll(fCtx *fiber.Ctx) error {
+	userID := session.FromContext(fCtx.UserContext()).UserID
+
+	enrollment, err := h.service.Enroll(fCtx.UserContext(), userID)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("two-factor enroll failed")
+		return err
+	}
+
+	return fCtx.Status(fiber.StatusOK).JSON(enrollment)
+}
+
+func (h *TwoFactorHandler) confirm(fCtx *fiber.Ctx) error {
+	userID := session.FromContext(fCtx.UserContext()).UserID
+
+	req := confirmTwoFactorRequest{}
+	if err := json.Unmarshal(fCtx.Body(), &req); err != nil {
+		h.log.Err(err).Msg("unmarshal failed")
+		return err
+	}
+
+	codes, err := h.service.Confirm(fCtx.UserContext(), userID, req.Code)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("two-factor confirm failed")
+		return err
+	}
+
+	h.log.Info().
+		Int("userID", int(userID)).
+		Msg("two-factor enabled")
+
+	return fCtx.Status(fiber.StatusOK).JSON(recoveryCodesResponse{
+		RecoveryCodes: codes,
+	})
+}
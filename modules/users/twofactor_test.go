@@ -0,0 +1,96 @@
+package users
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/modules/users/repositories"
+	"github.com/IlnurShafikov/wallet/services/onetime"
+	"github.com/IlnurShafikov/wallet/services/security"
+	"github.com/IlnurShafikov/wallet/services/throttle"
+	"github.com/IlnurShafikov/wallet/services/totp"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTwoFactor(t *testing.T) {
+	log := zerolog.Nop()
+	ctx := context.Background()
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	repo := repositories.NewInMemoryRepository()
+	user, err := repo.Create(ctx, "user01", []byte("hash"))
+	require.NoError(t, err)
+
+	twoFactor := NewTwoFactor(repo, onetime.NewInMemoryRepository(), "Wallet", time.Minute)
+	twoFactor.now = func() time.Time { return now }
+
+	challenge, err := twoFactor.Challenge(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, challenge)
+
+	_, err = twoFactor.Confirm(ctx, user.ID, "000000")
+	assert.ErrorIs(t, err, ErrTwoFactorNotEnrolled)
+
+	enrollment, err := twoFactor.Enroll(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(enrollment.URI, "otpauth://totp/Wallet:user01?"))
+
+	// до подтверждения вход без второго фактора
+	challenge, err = twoFactor.Challenge(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, challenge)
+
+	code, err := totp.Code(enrollment.Secret, now)
+	require.NoError(t, err)
+
+	recoveryCodes, err := twoFactor.Confirm(ctx, user.ID, code)
+	require.NoError(t, err)
+	assert.Len(t, recoveryCodes, recoveryCodesCount)
+
+	_, err = twoFactor.Enroll(ctx, user.ID)
+	assert.ErrorIs(t, err, ErrTwoFactorEnabled)
+
+	// код подтверждения нельзя использовать повторно
+	challenge, err = twoFactor.Challenge(ctx, user.ID)
+	require.NoError(t, err)
+	require.NotEmpty(t, challenge)
+
+	_, err = twoFactor.CompleteChallenge(ctx, challenge, code)
+	assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+
+	// challenge одноразовый
+	_, err = twoFactor.CompleteChallenge(ctx, challenge, code)
+	assert.ErrorIs(t, err, ErrInvalidChallenge)
+
+	now = now.Add(30 * time.Second)
+	code, err = totp.Code(enrollment.Secret, now)
+	require.NoError(t, err)
+
+	challenge, err = twoFactor.Challenge(ctx, user.ID)
+	require.NoError(t, err)
+
+	userID, err := twoFactor.CompleteChallenge(ctx, challenge, code)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, userID)
+
+	// код восстановления в верхнем регистре и без дефиса
+	recovery := strings.ToUpper(strings.ReplaceAll(recoveryCodes[0], "-", ""))
+	for _, expErr := range []error{nil, ErrInvalidTwoFactorCode} {
+		challenge, err = twoFactor.Challenge(ctx, user.ID)
+		require.NoError(t, err)
+
+		_, err = twoFactor.CompleteChallenge(ctx, challenge, recovery)
+		assert.ErrorIs(t, err, expErr)
+	}
+
+	service := NewUserService(repo, security.NewChain(security.NewBcryptHashing("secret")),
+		throttle.NewLimiter(throttle.NewInMemoryRepository(), throttle.DefaultPolicy()), &log)
+	require.NoError(t, service.ResetTwoFactor(ctx, user.ID))
+
+	challenge, err = twoFactor.Challenge(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, challenge)
+}
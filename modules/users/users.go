@@ -1,45 +1,155 @@
 package users
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"github.com/IlnurShafikov/wallet/models"
 	"github.com/IlnurShafikov/wallet/modules/users/repositories"
 	"github.com/IlnurShafikov/wallet/services/security"
+	"github.com/rs/zerolog"
+	"time"
 )
 
+// errPasswordChanged - пароль сменили, пока пересчитывался хеш
+var errPasswordChanged = errors.New("password changed during rehash")
+
 type Service interface {
 	Authorization(ctx context.Context, login, password string) (models.UserID, error)
 }
 
+// LoginLimiter - ограничение неудачных попыток входа. Acquire заранее учитывает
+// попытку как неудачную, Succeed отменяет это после верного пароля
+type LoginLimiter interface {
+	Acquire(ctx context.Context, login string) error
+	Succeed(ctx context.Context, login string) error
+	Reset(ctx context.Context, login string) error
+}
+
 type UserService struct {
-	repository   Repository
-	hashedVerify security.PasswordVerify
+	repository Repository
+	passwords  security.PasswordManager
+	limiter    LoginLimiter
+	log        *zerolog.Logger
+	now        func() time.Time
 }
 
 func NewUserService(
 	repository Repository,
-	hashedVerify security.PasswordVerify,
+	passwords security.PasswordManager,
+	limiter LoginLimiter,
+	logger *zerolog.Logger,
 ) *UserService {
 	return &UserService{
-		repository:   repository,
-		hashedVerify: hashedVerify,
+		repository: repository,
+		passwords:  passwords,
+		limiter:    limiter,
+		log:        logger,
+		now:        time.Now,
 	}
 }
 
 func (u *UserService) Authorization(ctx context.Context, login, password string) (models.UserID, error) {
+	err := u.limiter.Acquire(ctx, login)
+	if err != nil {
+		return 0, err
+	}
+
+	// неизвестный логин учитывается так же, как неверный пароль
 	user, err := u.repository.Get(ctx, login)
 	if err != nil {
 		if errors.Is(err, repositories.ErrUserNotFound) {
-			err = ErrAuthorizationFailed
+			return 0, ErrAuthorizationFailed
 		}
 		return 0, err
 	}
 
-	err = u.hashedVerify.Verify(password, user.Password)
+	err = u.passwords.Verify(password, user.Password)
 	if err != nil {
 		return 0, ErrAuthorizationFailed
 	}
 
+	// ошибка сброса не мешает входу, счетчик удалится по истечении срока
+	_ = u.limiter.Succeed(ctx, login)
+
+	// статус проверяется после пароля, чтобы не раскрывать его без знания пароля
+	err = u.checkStatus(*user)
+	if err != nil {
+		return 0, err
+	}
+
+	if u.passwords.NeedsRehash(user.Password) {
+		u.rehash(ctx, *user, password)
+	}
+
 	return user.ID, nil
 }
+
+// Unlock - снимает блокировку входа пользователя
+func (u *UserService) Unlock(ctx context.Context, userID models.UserID) error {
+	user, err := u.repository.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return u.limiter.Reset(ctx, user.Login)
+}
+
+// rehash - переводит хеш на основной алгоритм. Ошибка не мешает входу,
+// пересчет повторится при следующей авторизации
+func (u *UserService) rehash(ctx context.Context, user models.User, password string) {
+	hashPassword, err := u.passwords.HashPassword(password)
+	if err != nil {
+		u.log.Err(err).
+			Int("userID", int(user.ID)).
+			Msg("rehash password failed")
+		return
+	}
+
+	_, err = u.repository.Modify(ctx, user.ID, func(current *models.User) error {
+		// пароль успели сменить, новый хеш старого пароля не нужен
+		if !bytes.Equal(current.Password, user.Password) {
+			return errPasswordChanged
+		}
+
+		current.Password = hashPassword
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errPasswordChanged) {
+		u.log.Err(err).
+			Int("userID", int(user.ID)).
+			Msg("save rehashed password failed")
+	}
+}
+
+// ResetTwoFactor - отключает второй фактор, пользователь может подключить его заново
+func (u *UserService) ResetTwoFactor(ctx context.Context, userID models.UserID) error {
+	_, err := u.repository.Modify(ctx, userID, func(user *models.User) error {
+		user.TwoFactor = nil
+		return nil
+	})
+
+	return err
+}
+
+func (u *UserService) GetProfile(ctx context.Context, userID models.UserID) (*models.User, error) {
+	return u.repository.GetByID(ctx, userID)
+}
+
+// UpdateProfile - меняет только переданные поля анкеты
+func (u *UserService) UpdateProfile(
+	ctx context.Context,
+	userID models.UserID,
+	req UpdateProfileRequest,
+) (*models.User, error) {
+	err := req.Validate(u.now())
+	if err != nil {
+		return nil, err
+	}
+
+	return u.repository.Modify(ctx, userID, func(user *models.User) error {
+		req.apply(&user.Profile)
+		return nil
+	})
+}
@@ -0,0 +1,123 @@
+package users
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/modules/users/repositories"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/security"
+	"github.com/IlnurShafikov/wallet/services/throttle"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestUserService_AuthorizationRehash(t *testing.T) {
+	log := zerolog.Nop()
+	ctx := context.Background()
+
+	bcryptHashing := security.NewBcryptHashing("secret")
+	argon2idHashing := security.NewArgon2idHashing("secret", security.Argon2Params{
+		Memory:      1024,
+		Iterations:  1,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	})
+
+	legacy, err := bcryptHashing.HashPassword("password")
+	require.NoError(t, err)
+
+	repo := repositories.NewInMemoryRepository()
+	user, err := repo.Create(ctx, "user01", legacy)
+	require.NoError(t, err)
+
+	limiter := throttle.NewLimiter(throttle.NewInMemoryRepository(), throttle.Policy{
+		MaxFailures:   5,
+		MaxIPFailures: 5,
+		BaseDelay:     time.Nanosecond,
+		MaxDelay:      time.Nanosecond,
+		LockDuration:  time.Minute,
+	})
+
+	service := NewUserService(repo, security.NewChain(argon2idHashing, bcryptHashing), limiter, &log)
+
+	_, err = service.Authorization(ctx, "user01", "wrong")
+	assert.ErrorIs(t, err, ErrAuthorizationFailed)
+
+	stored, err := repo.Get(ctx, "user01")
+	require.NoError(t, err)
+	assert.Equal(t, legacy, stored.Password)
+
+	userID, err := service.Authorization(ctx, "user01", "password")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, userID)
+
+	stored, err = repo.Get(ctx, "user01")
+	require.NoError(t, err)
+	assert.True(t, argon2idHashing.Identify(stored.Password))
+
+	_, err = service.Authorization(ctx, "user01", "password")
+	assert.NoError(t, err)
+}
+
+func TestUserService_AuthorizationLockout(t *testing.T) {
+	log := zerolog.Nop()
+	ctx := throttle.WithClientIP(context.Background(), "10.0.0.1")
+
+	hashing := security.NewChain(security.NewBcryptHashing("secret"))
+	password, err := hashing.HashPassword("password")
+	require.NoError(t, err)
+
+	repo := repositories.NewInMemoryRepository()
+	user, err := repo.Create(ctx, "user01", password)
+	require.NoError(t, err)
+
+	limiter := throttle.NewLimiter(throttle.NewInMemoryRepository(), throttle.Policy{
+		MaxFailures:   3,
+		MaxIPFailures: 100,
+		BaseDelay:     time.Nanosecond,
+		MaxDelay:      time.Nanosecond,
+		LockDuration:  time.Hour,
+	})
+
+	service := NewUserService(repo, hashing, limiter, &log)
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(time.Millisecond)
+		_, err = service.Authorization(ctx, "user01", "wrong")
+		assert.ErrorIs(t, err, ErrAuthorizationFailed)
+	}
+
+	_, err = service.Authorization(ctx, "user01", "password")
+	assert.ErrorIs(t, err, throttle.ErrAccountLocked)
+
+	err = service.Unlock(ctx, user.ID)
+	require.NoError(t, err)
+
+	userID, err := service.Authorization(ctx, "user01", "password")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, userID)
+}
+
+func TestCreateUserRequest_Validate(t *testing.T) {
+	policy := testPolicy
+
+	req := CreateUserRequest{Login: "user01", Password: "Tr0ub4dor", RePassword: "Tr0ub4dor"}
+	assert.NoError(t, req.Validate(policy))
+
+	req = CreateUserRequest{Login: "", Password: "", RePassword: "x"}
+	err := req.Validate(policy)
+	require.ErrorIs(t, err, apierror.ErrValidation)
+
+	var apiErr *apierror.Error
+	require.ErrorAs(t, err, &apiErr)
+
+	fields := make(map[string]bool)
+	for _, field := range apiErr.Fields {
+		fields[field.Field] = true
+	}
+
+	assert.Equal(t, map[string]bool{"login": true, "password": true, "re_password": true}, fields)
+}
@@ -1,6 +1,7 @@
 package wallet
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/IlnurShafikov/wallet/models"
 	"github.com/IlnurShafikov/wallet/modules/wallet/request"
@@ -9,59 +10,66 @@ import (
 	"github.com/rs/zerolog"
 )
 
+// playerStatuses - ошибка, если игроку запрещено делать ставки
+type playerStatuses interface {
+	CheckActive(ctx context.Context, userID models.UserID) error
+}
+
 type Handler struct {
-	wallet *Service
-	log    *zerolog.Logger
+	wallet  *Service
+	players playerStatuses
+	log     *zerolog.Logger
 }
 
 func RegisterWalletHandler(
 	router fiber.Router,
 	wallet *Service,
+	players playerStatuses,
 	logger *zerolog.Logger,
+	providerAuth ...fiber.Handler,
 ) {
 	h := &Handler{
-		wallet: wallet,
-		log:    logger,
+		wallet:  wallet,
+		players: players,
+		log:     logger,
 	}
 
 	walletGroup := router.Group("/wallet")
-	walletGroup.Post("/:userID", h.createWallet)
 	walletGroup.Get("/:userID", h.getBalance)
-	walletGroup.Put("/:userID", h.changeBalance)
-	walletGroup.Post("refund/:userID", h.refundTransaction)
+	walletGroup.Put("/:userID", withMiddlewares(providerAuth, h.activePlayer, h.changeBalance)...)
+	walletGroup.Post("refund/:userID", withMiddlewares(providerAuth, h.refundTransaction)...)
 }
 
-func (h *Handler) createWallet(fCtx *fiber.Ctx) error {
-	userID, err := h.getUserID(fCtx)
-	if err != nil {
-		return err
-	}
+func withMiddlewares(middlewares []fiber.Handler, handlers ...fiber.Handler) []fiber.Handler {
+	res := make([]fiber.Handler, 0, len(middlewares)+len(handlers))
+	res = append(res, middlewares...)
 
-	req := request.CreateWallet{}
-	if err := json.Unmarshal(fCtx.Body(), &req); err != nil {
-		h.log.Err(err).Msg("unmarshal failed")
-		return err
+	return append(res, handlers...)
+}
+
+// activePlayer - не пускает ставки приостановленных и заблокированных игроков,
+// выигрыши по уже сделанным ставкам проходят
+func (h *Handler) activePlayer(fCtx *fiber.Ctx) error {
+	req := request.UpdateBalance{}
+	if err := json.Unmarshal(fCtx.Body(), &req); err != nil || !req.IsBet() {
+		return fCtx.Next()
 	}
 
-	_, err = h.wallet.Create(fCtx.Context(), userID, req.Balance)
+	userID, err := h.getUserID(fCtx)
 	if err != nil {
-		h.log.Err(err).
-			Int("userID", int(userID)).
-			Msg("wallet already exists")
 		return err
 	}
 
-	h.log.Debug().
-		Int("userID", int(userID)).
-		Msg("wallet created")
-
-	err = h.sendJson(fCtx, req.Balance, fiber.StatusCreated)
+	err = h.players.CheckActive(fCtx.UserContext(), userID)
 	if err != nil {
-		h.log.Err(err).Msg("invalid response format")
+		h.log.Warn().
+			Err(err).
+			Int("userID", int(userID)).
+			Msg("bet rejected")
 		return err
 	}
 
-	return nil
+	return fCtx.Next()
 }
 
 func (h *Handler) getBalance(fCtx *fiber.Ctx) error {
@@ -70,7 +78,7 @@ func (h *Handler) getBalance(fCtx *fiber.Ctx) error {
 		return err
 	}
 
-	balance, err := h.wallet.Get(fCtx.Context(), userID)
+	balance, err := h.wallet.Get(fCtx.UserContext(), userID)
 	if err != nil {
 		h.log.Err(err).Msg("wallet not found")
 		return err
@@ -103,7 +111,7 @@ func (h *Handler) changeBalance(fCtx *fiber.Ctx) error {
 		return err
 	}
 
-	balance, err := h.wallet.Change(fCtx.Context(), userID, req)
+	balance, err := h.wallet.Change(fCtx.UserContext(), userID, req)
 	if err != nil {
 		h.log.Err(err).Msg("wallet not found")
 		return err
@@ -136,7 +144,7 @@ func (h *Handler) refundTransaction(fCtx *fiber.Ctx) error {
 		return err
 	}
 
-	balance, err := h.wallet.Refund(fCtx.Context(), userID, req)
+	balance, err := h.wallet.Refund(fCtx.UserContext(), userID, req)
 	if err != nil {
 		h.log.Err(err).
 			Int("userID", int(userID)).
@@ -0,0 +1,111 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/transaction"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errBlocked = errors.New("player is blocked")
+
+type playersStub map[models.UserID]error
+
+func (p playersStub) CheckActive(_ context.Context, userID models.UserID) error {
+	return p[userID]
+}
+
+func TestHandler_ActivePlayer(t *testing.T) {
+	const blocked models.UserID = 2
+
+	ctx := context.Background()
+	log := zerolog.Nop()
+
+	walletRepo := NewInMemoryRepository()
+	require.NoError(t, walletRepo.Create(ctx, blocked, 100))
+
+	service := NewWallet(walletRepo, transaction.NewInMemoryRepository(), tenant.DefaultRegistry(), &log)
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(fCtx *fiber.Ctx, err error) error {
+			return fCtx.Status(http.StatusForbidden).SendString(err.Error())
+		},
+	})
+	RegisterWalletHandler(app, service, playersStub{blocked: errBlocked}, &log)
+
+	bet := `{"amount":-10,"round_id":"4bd0f3a4-6a4c-4b0b-8d43-1a2b3c4d5e6f","transaction_id":"5bd0f3a4-6a4c-4b0b-8d43-1a2b3c4d5e6f"}`
+	req := httptest.NewRequest(http.MethodPut, "/wallet/2", strings.NewReader(bet))
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	balance, err := walletRepo.Get(ctx, blocked)
+	require.NoError(t, err)
+	assert.Equal(t, models.Balance(100), balance)
+
+	// выигрыш по несуществующему раунду доходит до сервиса и падает уже там
+	win := `{"amount":10,"round_id":"4bd0f3a4-6a4c-4b0b-8d43-1a2b3c4d5e6f","transaction_id":"6bd0f3a4-6a4c-4b0b-8d43-1a2b3c4d5e6f"}`
+	req = httptest.NewRequest(http.MethodPut, "/wallet/2", strings.NewReader(win))
+
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+
+	body := make([]byte, 64)
+	n, _ := resp.Body.Read(body)
+	assert.Equal(t, transaction.ErrRoundNotFound.Error(), string(body[:n]))
+}
+
+// пополнение принимается только от провайдера, сессии игрока недостаточно
+func TestPaymentHandler_Deposit(t *testing.T) {
+	ctx := context.Background()
+	log := zerolog.Nop()
+
+	walletRepo := NewInMemoryRepository()
+	trRepo := transaction.NewInMemoryRepository()
+	require.NoError(t, walletRepo.Create(ctx, 1, 0))
+
+	payments := NewPayments(walletRepo, trRepo, trRepo, usersStub{}, DepositLimits{
+		Period:  time.Hour,
+		Amounts: map[models.KYCStatus]models.Amount{models.KYCNone: 1000},
+	})
+
+	allow := func(fCtx *fiber.Ctx) error { return fCtx.Next() }
+	reject := func(fCtx *fiber.Ctx) error { return fCtx.SendStatus(http.StatusUnauthorized) }
+
+	deposit := func(app *fiber.App, paymentID string) int {
+		body := `{"payment_id":"` + paymentID + `","amount":100}`
+		req := httptest.NewRequest(http.MethodPost, "/wallet/1/deposit", strings.NewReader(body))
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+
+		return resp.StatusCode
+	}
+
+	withoutProvider := fiber.New()
+	RegisterPaymentHandler(withoutProvider, payments, &log, []fiber.Handler{allow}, nil)
+	assert.Equal(t, http.StatusNotFound, deposit(withoutProvider, "4bd0f3a4-6a4c-4b0b-8d43-1a2b3c4d5e6f"))
+
+	unsigned := fiber.New()
+	RegisterPaymentHandler(unsigned, payments, &log, []fiber.Handler{allow}, []fiber.Handler{reject})
+	assert.Equal(t, http.StatusUnauthorized, deposit(unsigned, "4bd0f3a4-6a4c-4b0b-8d43-1a2b3c4d5e6f"))
+
+	signed := fiber.New()
+	RegisterPaymentHandler(signed, payments, &log, []fiber.Handler{reject}, []fiber.Handler{allow})
+	assert.Equal(t, http.StatusOK, deposit(signed, "4bd0f3a4-6a4c-4b0b-8d43-1a2b3c4d5e6f"))
+
+	balance, err := walletRepo.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.Balance(100), balance)
+}
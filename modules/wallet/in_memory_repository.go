@@ -2,8 +2,11 @@ package wallet
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/wal"
 	"sync"
 )
 
@@ -15,23 +18,89 @@ var (
 )
 
 type InMemoryRepository struct {
-	mu     sync.Mutex
-	wallet map[models.UserID]models.Balance
+	mu      sync.Mutex
+	wallet  map[models.TenantID]map[models.UserID]models.Balance
+	journal *wal.Log
+}
+
+// walletRecord - запись журнала, итоговый баланс кошелька
+type walletRecord struct {
+	TenantID models.TenantID `json:"tenant_id"`
+	UserID   models.UserID   `json:"user_id"`
+	Balance  models.Balance  `json:"balance"`
 }
 
 // NewInMemoryRepository - создание нового экземпляра кошелька в оп
 func NewInMemoryRepository() *InMemoryRepository {
 	return &InMemoryRepository{
-		wallet: make(map[models.UserID]models.Balance),
+		wallet: make(map[models.TenantID]map[models.UserID]models.Balance),
 	}
 }
 
+// NewDurableInMemoryRepository - кошельки в оп, восстановленные из журнала.
+// Каждое изменение пишется в журнал до применения
+func NewDurableInMemoryRepository(journal *wal.Log) (*InMemoryRepository, error) {
+	repo := NewInMemoryRepository()
+	repo.journal = journal
+
+	err := journal.Load(
+		func(data []byte) error {
+			return json.Unmarshal(data, &repo.wallet)
+		},
+		func(data []byte) error {
+			var record walletRecord
+			if err := json.Unmarshal(data, &record); err != nil {
+				return err
+			}
+
+			repo.wallets(record.TenantID)[record.UserID] = record.Balance
+
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// set - записывает баланс в журнал и в память
+func (i *InMemoryRepository) set(tenantID models.TenantID, userID models.UserID, balance models.Balance) error {
+	if i.journal != nil {
+		err := i.journal.Append(walletRecord{TenantID: tenantID, UserID: userID, Balance: balance})
+		if err != nil {
+			return err
+		}
+	}
+
+	i.wallets(tenantID)[userID] = balance
+
+	if i.journal != nil && i.journal.NeedSnapshot() {
+		// изменение уже в журнале, неудачный снимок повторится при следующей записи
+		_ = i.journal.Snapshot(i.wallet)
+	}
+
+	return nil
+}
+
+// wallets - кошельки оператора
+func (i *InMemoryRepository) wallets(tenantID models.TenantID) map[models.UserID]models.Balance {
+	wallets, ok := i.wallet[tenantID]
+	if !ok {
+		wallets = make(map[models.UserID]models.Balance)
+		i.wallet[tenantID] = wallets
+	}
+
+	return wallets
+}
+
 // Get - Возвращает информацию из кошелька
-func (i *InMemoryRepository) Get(_ context.Context, userID models.UserID) (models.Balance, error) {
+func (i *InMemoryRepository) Get(ctx context.Context, userID models.UserID) (models.Balance, error) {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	balance, ok := i.wallet[userID]
+	balance, ok := i.wallets(tenant.FromContext(ctx))[userID]
 	if !ok {
 		return 0, ErrWalletNotFound
 	}
@@ -41,7 +110,7 @@ func (i *InMemoryRepository) Get(_ context.Context, userID models.UserID) (model
 
 // Create -  создает кошелек
 func (i *InMemoryRepository) Create(
-	_ context.Context,
+	ctx context.Context,
 	userID models.UserID,
 	balance models.Balance,
 ) error {
@@ -52,26 +121,28 @@ func (i *InMemoryRepository) Create(
 		return ErrWalletNotNegativeBalance
 	}
 
-	_, exists := i.wallet[userID]
+	tenantID := tenant.FromContext(ctx)
+
+	_, exists := i.wallets(tenantID)[userID]
 	if exists {
 		return ErrWalletAlreadyExists
 	}
 
-	i.wallet[userID] = balance
-
-	return nil
+	return i.set(tenantID, userID, balance)
 }
 
 // Update - Манипуляции с балансом
 func (i *InMemoryRepository) Update(
-	_ context.Context,
+	ctx context.Context,
 	userID models.UserID,
 	amount models.Amount,
 ) (models.Balance, error) {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	balance, ok := i.wallet[userID]
+	tenantID := tenant.FromContext(ctx)
+
+	balance, ok := i.wallets(tenantID)[userID]
 	if !ok {
 		return 0, ErrWalletNotFound
 	}
@@ -81,7 +152,30 @@ func (i *InMemoryRepository) Update(
 		return 0, ErrWalletNotEnoughMoney
 	}
 
-	i.wallet[userID] = balance
+	if err := i.set(tenantID, userID, balance); err != nil {
+		return 0, err
+	}
 
 	return balance, nil
 }
+
+// Iterate - fn вызывается вне блокировки, по снимку кошельков
+func (i *InMemoryRepository) Iterate(
+	ctx context.Context,
+	fn func(userID models.UserID, balance models.Balance) error,
+) error {
+	i.mu.Lock()
+	wallets := make(map[models.UserID]models.Balance, len(i.wallets(tenant.FromContext(ctx))))
+	for userID, balance := range i.wallets(tenant.FromContext(ctx)) {
+		wallets[userID] = balance
+	}
+	i.mu.Unlock()
+
+	for userID, balance := range wallets {
+		if err := fn(userID, balance); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -3,6 +3,8 @@ package wallet
 import (
 	"context"
 	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/wal"
+	"github.com/stretchr/testify/require"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -29,7 +31,7 @@ func TestCreate(t *testing.T) {
 			name:    "создание существующего кошелька",
 			balance: 10,
 			before: func(uw *InMemoryRepository) {
-				uw.wallet[userID] = 0
+				uw.wallets(models.DefaultTenant)[userID] = 0
 			},
 			expect: ErrWalletAlreadyExists,
 			ctx:    nil,
@@ -64,7 +66,7 @@ func TestGet(t *testing.T) {
 			expectErr: nil,
 			ctx:       nil,
 			before: func(uw *InMemoryRepository) {
-				uw.wallet[userID] = balance
+				uw.wallets(models.DefaultTenant)[userID] = balance
 			},
 		},
 		{
@@ -110,7 +112,7 @@ func TestAdd(t *testing.T) {
 			expectErr: nil,
 			ctx:       nil,
 			before: func(uw *InMemoryRepository) {
-				uw.wallet[userID] = 0
+				uw.wallets(models.DefaultTenant)[userID] = 0
 			},
 		},
 		{
@@ -120,7 +122,7 @@ func TestAdd(t *testing.T) {
 			expectErr: nil,
 			ctx:       nil,
 			before: func(uw *InMemoryRepository) {
-				uw.wallet[userID] = balance
+				uw.wallets(models.DefaultTenant)[userID] = balance
 			},
 		},
 		{
@@ -130,7 +132,7 @@ func TestAdd(t *testing.T) {
 			expectErr: nil,
 			ctx:       nil,
 			before: func(uw *InMemoryRepository) {
-				uw.wallet[userID] = 20
+				uw.wallets(models.DefaultTenant)[userID] = 20
 			},
 		},
 		{
@@ -140,7 +142,7 @@ func TestAdd(t *testing.T) {
 			ctx:       nil,
 			expectErr: ErrWalletNotFound,
 			before: func(uw *InMemoryRepository) {
-				uw.wallet[133] = 0
+				uw.wallets(models.DefaultTenant)[133] = 0
 			},
 		},
 	}
@@ -156,3 +158,44 @@ func TestAdd(t *testing.T) {
 
 	}
 }
+
+func TestDurableInMemoryRepository(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	open := func() (*InMemoryRepository, *wal.Log) {
+		journal, err := wal.Open(dir, "wallets", wal.Options{Sync: wal.SyncAlways, SnapshotEvery: 3})
+		require.NoError(t, err)
+
+		repo, err := NewDurableInMemoryRepository(journal)
+		require.NoError(t, err)
+
+		return repo, journal
+	}
+
+	repo, journal := open()
+	require.NoError(t, repo.Create(ctx, 1, 100))
+	require.NoError(t, repo.Create(ctx, 2, 50))
+
+	_, err := repo.Update(ctx, 1, -30)
+	require.NoError(t, err)
+
+	// отклоненное изменение не попадает в журнал
+	_, err = repo.Update(ctx, 2, -100)
+	assert.ErrorIs(t, err, ErrWalletNotEnoughMoney)
+
+	_, err = repo.Update(ctx, 2, 5)
+	require.NoError(t, err)
+	require.NoError(t, journal.Close())
+
+	repo, journal = open()
+	defer journal.Close()
+
+	balance, err := repo.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.Balance(70), balance)
+
+	balance, err = repo.Get(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, models.Balance(55), balance)
+}
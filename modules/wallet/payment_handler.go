@@ -0,0 +1,129 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/modules/wallet/request"
+	"github.com/IlnurShafikov/wallet/modules/wallet/response"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+type PaymentHandler struct {
+	payments *Payments
+	log      *zerolog.Logger
+}
+
+// RegisterPaymentHandler - вывод и переводы выполняет сам игрок, userAuth проверяет
+// его сессию. Пополнение подтверждает платежный провайдер подписанным запросом,
+// без providerAuth пополнение не регистрируется
+func RegisterPaymentHandler(
+	router fiber.Router,
+	payments *Payments,
+	logger *zerolog.Logger,
+	userAuth []fiber.Handler,
+	providerAuth []fiber.Handler,
+) {
+	h := &PaymentHandler{
+		payments: payments,
+		log:      logger,
+	}
+
+	walletGroup := router.Group("/wallet")
+	if len(providerAuth) > 0 {
+		walletGroup.Post("/:userID/deposit", withMiddlewares(providerAuth, h.deposit)...)
+	}
+	walletGroup.Post("/:userID/withdraw", withMiddlewares(userAuth, h.withdraw)...)
+	walletGroup.Post("/:userID/transfer", withMiddlewares(userAuth, h.transfer)...)
+}
+
+func (h *PaymentHandler) deposit(fCtx *fiber.Ctx) error {
+	return h.payment(fCtx, "deposit", h.payments.Deposit)
+}
+
+func (h *PaymentHandler) withdraw(fCtx *fiber.Ctx) error {
+	return h.payment(fCtx, "withdraw", h.payments.Withdraw)
+}
+
+func (h *PaymentHandler) payment(
+	fCtx *fiber.Ctx,
+	operation string,
+	apply func(ctx context.Context, userID models.UserID, req request.Payment) (models.Balance, error),
+) error {
+	userID, err := h.getUserID(fCtx)
+	if err != nil {
+		return err
+	}
+
+	req := request.Payment{}
+	if err := json.Unmarshal(fCtx.Body(), &req); err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("unmarshal failed")
+		return err
+	}
+
+	balance, err := apply(fCtx.UserContext(), userID, req)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Str("operation", operation).
+			Msg("payment failed")
+		return err
+	}
+
+	h.log.Info().
+		Int("userID", int(userID)).
+		Str("operation", operation).
+		Str("payment_id", req.PaymentID.String()).
+		Msg("payment successful")
+
+	return fCtx.Status(fiber.StatusOK).JSON(response.BalanceResponse{
+		Balance: balance,
+	})
+}
+
+func (h *PaymentHandler) transfer(fCtx *fiber.Ctx) error {
+	userID, err := h.getUserID(fCtx)
+	if err != nil {
+		return err
+	}
+
+	req := request.Transfer{}
+	if err := json.Unmarshal(fCtx.Body(), &req); err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Msg("unmarshal failed")
+		return err
+	}
+
+	balance, err := h.payments.Transfer(fCtx.UserContext(), userID, req)
+	if err != nil {
+		h.log.Err(err).
+			Int("userID", int(userID)).
+			Int("toUserID", int(req.ToUserID)).
+			Msg("transfer failed")
+		return err
+	}
+
+	h.log.Info().
+		Int("userID", int(userID)).
+		Int("toUserID", int(req.ToUserID)).
+		Str("payment_id", req.PaymentID.String()).
+		Msg("transfer successful")
+
+	return fCtx.Status(fiber.StatusOK).JSON(response.BalanceResponse{
+		Balance: balance,
+	})
+}
+
+func (h *PaymentHandler) getUserID(fCtx *fiber.Ctx) (models.UserID, error) {
+	id, err := fCtx.ParamsInt("userID")
+	if err != nil {
+		h.log.Err(err).Msg("invalid variable type")
+		return 0, err
+	}
+
+	return models.UserID(id), nil
+}
@@ -0,0 +1,312 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/modules/wallet/request"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/transaction"
+	"github.com/gofrs/uuid"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrInvalidAmount        = errors.New("amount must be positive")
+	ErrPaymentAlreadyExists = errors.New("payment already exists")
+	ErrTransferToSelf       = errors.New("cannot transfer to the same wallet")
+	ErrVerificationRequired = apierror.New(http.StatusForbidden, "kyc_required", "verified identity is required")
+	ErrDepositLimitExceeded = apierror.New(http.StatusForbidden, "deposit_limit_exceeded", "deposit limit exceeded")
+)
+
+// paymentUsers - статус игрока и проверки личности
+type paymentUsers interface {
+	CheckActive(ctx context.Context, userID models.UserID) error
+	KYCStatus(ctx context.Context, userID models.UserID) (models.KYCStatus, error)
+}
+
+// DepositLimits - сумма пополнений за Period по статусу проверки,
+// для статуса без лимита пополнение запрещено
+type DepositLimits struct {
+	Period  time.Duration
+	Amounts map[models.KYCStatus]models.Amount
+}
+
+// Payments - пополнение, вывод и переводы между кошельками оператора.
+// Платеж сохраняется раундом с идентификатором PaymentID.
+type Payments struct {
+	walletRepository Repository
+	trRepository     transaction.Repository
+	rounds           transaction.Lister
+	users            paymentUsers
+	depositLimits    DepositLimits
+	now              func() time.Time
+}
+
+// NewPayments - rounds нужен для суммы пополнений за период,
+// в нем должны быть и архивные раунды
+func NewPayments(
+	walletRepository Repository,
+	trRepository transaction.Repository,
+	rounds transaction.Lister,
+	users paymentUsers,
+	depositLimits DepositLimits,
+) *Payments {
+	return &Payments{
+		walletRepository: walletRepository,
+		trRepository:     trRepository,
+		rounds:           rounds,
+		users:            users,
+		depositLimits:    depositLimits,
+		now:              time.Now,
+	}
+}
+
+// Deposit - пополнение по подтверждению платежного провайдера. Платеж
+// резервируется до проверки лимита, поэтому параллельные пополнения
+// видят друг друга и вместе не превышают лимит
+func (p *Payments) Deposit(
+	ctx context.Context,
+	userID models.UserID,
+	req request.Payment,
+) (models.Balance, error) {
+	if req.Amount <= 0 {
+		return 0, ErrInvalidAmount
+	}
+
+	err := p.users.CheckActive(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	status, err := p.users.KYCStatus(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	limit := p.depositLimits.Amounts[status]
+	if req.Amount > limit {
+		return 0, ErrDepositLimitExceeded
+	}
+
+	payment, err := p.reserve(ctx, userID, req.PaymentID, req.Amount, models.RoundKindDeposit)
+	if err != nil {
+		return 0, err
+	}
+
+	deposited, err := p.deposited(ctx, userID)
+	if err == nil && deposited > limit {
+		err = ErrDepositLimitExceeded
+	}
+
+	if err != nil {
+		return 0, errors.Join(err, p.cancel(ctx, req.PaymentID, payment))
+	}
+
+	return p.complete(ctx, req.PaymentID, payment)
+}
+
+func (p *Payments) Withdraw(
+	ctx context.Context,
+	userID models.UserID,
+	req request.Payment,
+) (models.Balance, error) {
+	if req.Amount <= 0 {
+		return 0, ErrInvalidAmount
+	}
+
+	err := p.requireVerified(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return p.apply(ctx, userID, req.PaymentID, -req.Amount, models.RoundKindWithdrawal)
+}
+
+// Transfer - возвращает баланс отправителя. Если зачислить получателю не удалось,
+// списание возвращается отправителю.
+func (p *Payments) Transfer(
+	ctx context.Context,
+	userID models.UserID,
+	req request.Transfer,
+) (models.Balance, error) {
+	if req.Amount <= 0 {
+		return 0, ErrInvalidAmount
+	}
+
+	if req.ToUserID == userID {
+		return 0, ErrTransferToSelf
+	}
+
+	err := p.requireVerified(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = p.walletRepository.Get(ctx, req.ToUserID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = p.users.CheckActive(ctx, req.ToUserID)
+	if err != nil {
+		return 0, err
+	}
+
+	balance, err := p.apply(ctx, userID, req.PaymentID, -req.Amount, models.RoundKindTransferOut)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = p.apply(ctx, req.ToUserID, incomingPaymentID(req.PaymentID), req.Amount, models.RoundKindTransferIn)
+	if err != nil {
+		return 0, errors.Join(err, p.rollbackTransfer(ctx, userID, req))
+	}
+
+	return balance, nil
+}
+
+// rollbackTransfer - возвращает списание, в истории оно помечается отмененным как ставка
+func (p *Payments) rollbackTransfer(ctx context.Context, userID models.UserID, req request.Transfer) error {
+	_, err := p.walletRepository.Update(ctx, userID, req.Amount)
+	if err != nil {
+		return fmt.Errorf("rollback transfer: %w", err)
+	}
+
+	round, err := p.trRepository.GetRound(ctx, req.PaymentID)
+	if err != nil {
+		return fmt.Errorf("rollback transfer: %w", err)
+	}
+
+	round.Refunded = true
+
+	err = p.trRepository.UpdateRound(ctx, req.PaymentID, *round)
+	if err != nil {
+		return fmt.Errorf("rollback transfer: %w", err)
+	}
+
+	return nil
+}
+
+// requireVerified - вывод и перевод доступны активному игроку с проверенной личностью
+func (p *Payments) requireVerified(ctx context.Context, userID models.UserID) error {
+	err := p.users.CheckActive(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	status, err := p.users.KYCStatus(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if status != models.KYCVerified {
+		return ErrVerificationRequired
+	}
+
+	return nil
+}
+
+// apply - резервирует PaymentID и меняет баланс
+func (p *Payments) apply(
+	ctx context.Context,
+	userID models.UserID,
+	paymentID models.RoundID,
+	amount models.Amount,
+	kind models.RoundKind,
+) (models.Balance, error) {
+	payment, err := p.reserve(ctx, userID, paymentID, amount, kind)
+	if err != nil {
+		return 0, err
+	}
+
+	return p.complete(ctx, paymentID, payment)
+}
+
+// reserve - занимает PaymentID незавершенным раундом до изменения баланса,
+// из параллельных запросов с одним PaymentID баланс меняет только один
+func (p *Payments) reserve(
+	ctx context.Context,
+	userID models.UserID,
+	paymentID models.RoundID,
+	amount models.Amount,
+	kind models.RoundKind,
+) (models.Round, error) {
+	payment := models.Round{
+		UserID: userID,
+		Bet: models.Transaction{
+			Amount:        amount,
+			TransactionID: paymentID,
+			Created:       p.now(),
+		},
+		Kind: kind,
+	}
+
+	err := p.trRepository.CreateBet(ctx, paymentID, payment)
+	if err != nil {
+		if errors.Is(err, transaction.ErrRoundIdAlreadyExists) {
+			return models.Round{}, ErrPaymentAlreadyExists
+		}
+		return models.Round{}, fmt.Errorf("reserve payment: %w", err)
+	}
+
+	return payment, nil
+}
+
+// complete - меняет баланс и завершает платеж. Если баланс не изменился,
+// платеж отмечается отмененным. Платеж, который не удалось завершить после
+// изменения баланса, остается незавершенным и учитывается в балансе
+// проверкой согласованности
+func (p *Payments) complete(ctx context.Context, paymentID models.RoundID, payment models.Round) (models.Balance, error) {
+	balance, err := p.walletRepository.Update(ctx, payment.UserID, payment.Bet.Amount)
+	if err != nil {
+		return 0, errors.Join(fmt.Errorf("change balance: %w", err), p.cancel(ctx, paymentID, payment))
+	}
+
+	payment.Finished = true
+
+	err = p.trRepository.UpdateRound(ctx, paymentID, payment)
+	if err != nil {
+		return 0, fmt.Errorf("finish payment: %w", err)
+	}
+
+	return balance, nil
+}
+
+// cancel - отмененный платеж не меняет баланс, PaymentID остается занятым
+func (p *Payments) cancel(ctx context.Context, paymentID models.RoundID, payment models.Round) error {
+	payment.Refunded = true
+
+	err := p.trRepository.UpdateRound(ctx, paymentID, payment)
+	if err != nil {
+		return fmt.Errorf("cancel payment: %w", err)
+	}
+
+	return nil
+}
+
+// deposited - сумма пополнений за период, включая зарезервированные
+func (p *Payments) deposited(ctx context.Context, userID models.UserID) (models.Amount, error) {
+	rounds, err := p.rounds.ListByUser(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("list payments: %w", err)
+	}
+
+	since := p.now().Add(-p.depositLimits.Period)
+
+	var total models.Amount
+	for _, round := range rounds {
+		if round.Kind == models.RoundKindDeposit && !round.Refunded && !round.Bet.Created.Before(since) {
+			total += round.Bet.Amount
+		}
+	}
+
+	return total, nil
+}
+
+// incomingPaymentID - идентификатор зачисления получателю, выводится из PaymentID
+func incomingPaymentID(paymentID models.RoundID) models.RoundID {
+	return uuid.NewV5(paymentID, string(models.RoundKindTransferIn))
+}
@@ -0,0 +1,277 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/modules/wallet/request"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/transaction"
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errPlayerBanned = errors.New("player banned")
+
+// usersStub - статусы проверки и заблокированные игроки
+type usersStub struct {
+	kyc    map[models.UserID]models.KYCStatus
+	banned map[models.UserID]bool
+}
+
+func (u usersStub) CheckActive(_ context.Context, userID models.UserID) error {
+	if u.banned[userID] {
+		return errPlayerBanned
+	}
+
+	return nil
+}
+
+func (u usersStub) KYCStatus(_ context.Context, userID models.UserID) (models.KYCStatus, error) {
+	status, ok := u.kyc[userID]
+	if !ok {
+		return models.KYCNone, nil
+	}
+
+	return status, nil
+}
+
+func TestPayments(t *testing.T) {
+	const (
+		verified   models.UserID = 1
+		unverified models.UserID = 2
+		banned     models.UserID = 3
+	)
+
+	ctx := context.Background()
+
+	walletRepo := NewInMemoryRepository()
+	trRepo := transaction.NewInMemoryRepository()
+
+	require.NoError(t, walletRepo.Create(ctx, verified, 0))
+	require.NoError(t, walletRepo.Create(ctx, unverified, 0))
+	require.NoError(t, walletRepo.Create(ctx, banned, 0))
+
+	users := usersStub{
+		kyc:    map[models.UserID]models.KYCStatus{verified: models.KYCVerified, banned: models.KYCVerified},
+		banned: map[models.UserID]bool{banned: true},
+	}
+	payments := NewPayments(walletRepo, trRepo, trRepo, users, DepositLimits{
+		Period: 24 * time.Hour,
+		Amounts: map[models.KYCStatus]models.Amount{
+			models.KYCNone:     150,
+			models.KYCVerified: 1000,
+		},
+	})
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	payments.now = func() time.Time { return now }
+
+	paymentID := uuid.Must(uuid.NewV4())
+
+	_, err := payments.Deposit(ctx, unverified, request.Payment{PaymentID: paymentID, Amount: 151})
+	assert.ErrorIs(t, err, ErrDepositLimitExceeded)
+
+	_, err = payments.Deposit(ctx, unverified, request.Payment{PaymentID: paymentID, Amount: 0})
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	balance, err := payments.Deposit(ctx, unverified, request.Payment{PaymentID: paymentID, Amount: 100})
+	require.NoError(t, err)
+	assert.Equal(t, models.Balance(100), balance)
+
+	_, err = payments.Deposit(ctx, unverified, request.Payment{PaymentID: paymentID, Amount: 100})
+	assert.ErrorIs(t, err, ErrPaymentAlreadyExists)
+
+	round, err := trRepo.GetRound(ctx, paymentID)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoundKindDeposit, round.Kind)
+	assert.True(t, round.Finished)
+
+	// лимит на сумму пополнений за период, отклоненное пополнение отменяется
+	rejectedID := uuid.Must(uuid.NewV4())
+	_, err = payments.Deposit(ctx, unverified, request.Payment{PaymentID: rejectedID, Amount: 100})
+	assert.ErrorIs(t, err, ErrDepositLimitExceeded)
+
+	round, err = trRepo.GetRound(ctx, rejectedID)
+	require.NoError(t, err)
+	assert.True(t, round.Refunded)
+
+	now = now.Add(25 * time.Hour)
+	balance, err = payments.Deposit(ctx, unverified, request.Payment{PaymentID: uuid.Must(uuid.NewV4()), Amount: 100})
+	require.NoError(t, err)
+	assert.Equal(t, models.Balance(200), balance)
+
+	// пополнение, вывод и перевод недоступны заблокированному игроку
+	_, err = payments.Deposit(ctx, banned, request.Payment{PaymentID: uuid.Must(uuid.NewV4()), Amount: 10})
+	assert.ErrorIs(t, err, errPlayerBanned)
+
+	_, err = payments.Withdraw(ctx, banned, request.Payment{PaymentID: uuid.Must(uuid.NewV4()), Amount: 10})
+	assert.ErrorIs(t, err, errPlayerBanned)
+
+	_, err = payments.Transfer(ctx, verified, request.Transfer{PaymentID: uuid.Must(uuid.NewV4()), ToUserID: banned, Amount: 10})
+	assert.ErrorIs(t, err, errPlayerBanned)
+
+	_, err = payments.Withdraw(ctx, unverified, request.Payment{PaymentID: uuid.Must(uuid.NewV4()), Amount: 10})
+	assert.ErrorIs(t, err, ErrVerificationRequired)
+
+	_, err = payments.Transfer(ctx, unverified, request.Transfer{PaymentID: uuid.Must(uuid.NewV4()), ToUserID: verified, Amount: 10})
+	assert.ErrorIs(t, err, ErrVerificationRequired)
+
+	_, err = payments.Deposit(ctx, verified, request.Payment{PaymentID: uuid.Must(uuid.NewV4()), Amount: 1000})
+	require.NoError(t, err)
+
+	_, err = payments.Deposit(ctx, verified, request.Payment{PaymentID: uuid.Must(uuid.NewV4()), Amount: 1})
+	assert.ErrorIs(t, err, ErrDepositLimitExceeded)
+
+	balance, err = payments.Withdraw(ctx, verified, request.Payment{PaymentID: uuid.Must(uuid.NewV4()), Amount: 300})
+	require.NoError(t, err)
+	assert.Equal(t, models.Balance(700), balance)
+
+	// при нехватке средств платеж отменяется, повтор PaymentID отклоняется
+	failedID := uuid.Must(uuid.NewV4())
+	_, err = payments.Withdraw(ctx, verified, request.Payment{PaymentID: failedID, Amount: 701})
+	assert.ErrorIs(t, err, ErrWalletNotEnoughMoney)
+
+	round, err = trRepo.GetRound(ctx, failedID)
+	require.NoError(t, err)
+	assert.True(t, round.Refunded)
+
+	_, err = payments.Withdraw(ctx, verified, request.Payment{PaymentID: failedID, Amount: 1})
+	assert.ErrorIs(t, err, ErrPaymentAlreadyExists)
+
+	transferID := uuid.Must(uuid.NewV4())
+	balance, err = payments.Transfer(ctx, verified, request.Transfer{PaymentID: transferID, ToUserID: unverified, Amount: 200})
+	require.NoError(t, err)
+	assert.Equal(t, models.Balance(500), balance)
+
+	balance, err = walletRepo.Get(ctx, unverified)
+	require.NoError(t, err)
+	assert.Equal(t, models.Balance(400), balance)
+
+	incoming, err := trRepo.GetRound(ctx, incomingPaymentID(transferID))
+	require.NoError(t, err)
+	assert.Equal(t, models.RoundKindTransferIn, incoming.Kind)
+	assert.Equal(t, unverified, incoming.UserID)
+
+	_, err = payments.Transfer(ctx, verified, request.Transfer{PaymentID: uuid.Must(uuid.NewV4()), ToUserID: verified, Amount: 1})
+	assert.ErrorIs(t, err, ErrTransferToSelf)
+
+	_, err = payments.Transfer(ctx, verified, request.Transfer{PaymentID: uuid.Must(uuid.NewV4()), ToUserID: 404, Amount: 1})
+	assert.ErrorIs(t, err, ErrWalletNotFound)
+}
+
+// параллельные платежи с одним PaymentID меняют баланс один раз
+func TestPayments_ParallelSamePaymentID(t *testing.T) {
+	ctx := context.Background()
+
+	walletRepo := NewInMemoryRepository()
+	trRepo := transaction.NewInMemoryRepository()
+	require.NoError(t, walletRepo.Create(ctx, 1, 1000))
+
+	users := usersStub{kyc: map[models.UserID]models.KYCStatus{1: models.KYCVerified}}
+	payments := NewPayments(walletRepo, trRepo, trRepo, users, DepositLimits{Period: time.Hour})
+
+	paymentID := uuid.Must(uuid.NewV4())
+
+	const requests = 10
+
+	var wg sync.WaitGroup
+	for n := 0; n < requests; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, _ = payments.Withdraw(ctx, 1, request.Payment{PaymentID: paymentID, Amount: 100})
+		}()
+	}
+	wg.Wait()
+
+	balance, err := walletRepo.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.Balance(900), balance)
+}
+
+// платежи и начальный баланс хранятся раундами, но возврат и выигрыш по ним запрещены
+func TestPayments_GameOperations(t *testing.T) {
+	const (
+		sender    models.UserID = 1
+		recipient models.UserID = 2
+	)
+
+	ctx := context.Background()
+	log := zerolog.Nop()
+
+	walletRepo := NewInMemoryRepository()
+	trRepo := transaction.NewInMemoryRepository()
+	provisioner := NewProvisioner(walletRepo, trRepo, tenant.DefaultRegistry(), tenant.WalletPolicy{InitialBalance: 100})
+
+	_, err := provisioner.Provision(ctx, sender)
+	require.NoError(t, err)
+	_, err = provisioner.Provision(ctx, recipient)
+	require.NoError(t, err)
+
+	users := usersStub{kyc: map[models.UserID]models.KYCStatus{sender: models.KYCVerified}}
+	payments := NewPayments(walletRepo, trRepo, trRepo, users, DepositLimits{
+		Period:  time.Hour,
+		Amounts: map[models.KYCStatus]models.Amount{models.KYCVerified: 1000},
+	})
+	service := NewWallet(walletRepo, trRepo, tenant.DefaultRegistry(), &log)
+
+	deposit := uuid.Must(uuid.NewV4())
+	withdrawal := uuid.Must(uuid.NewV4())
+	transfer := uuid.Must(uuid.NewV4())
+	cancelled := uuid.Must(uuid.NewV4())
+
+	_, err = payments.Deposit(ctx, sender, request.Payment{PaymentID: deposit, Amount: 800})
+	require.NoError(t, err)
+	_, err = payments.Withdraw(ctx, sender, request.Payment{PaymentID: withdrawal, Amount: 100})
+	require.NoError(t, err)
+	_, err = payments.Transfer(ctx, sender, request.Transfer{PaymentID: transfer, ToUserID: recipient, Amount: 50})
+	require.NoError(t, err)
+	// отмененный по лимиту платеж остается незавершенным раундом без выигрыша
+	_, err = payments.Deposit(ctx, sender, request.Payment{PaymentID: cancelled, Amount: 300})
+	require.ErrorIs(t, err, ErrDepositLimitExceeded)
+
+	tests := []struct {
+		name    string
+		userID  models.UserID
+		roundID models.RoundID
+	}{
+		{name: "deposit", userID: sender, roundID: deposit},
+		{name: "withdrawal", userID: sender, roundID: withdrawal},
+		{name: "transfer out", userID: sender, roundID: transfer},
+		{name: "transfer in", userID: recipient, roundID: incomingPaymentID(transfer)},
+		{name: "cancelled deposit", userID: sender, roundID: cancelled},
+		{name: "opening balance", userID: sender, roundID: OpeningRoundID(sender)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := service.Refund(ctx, tc.userID, request.RefundTransaction{RoundID: tc.roundID})
+			assert.ErrorIs(t, err, ErrNotGameRound)
+
+			_, err = service.Change(ctx, tc.userID, request.UpdateBalance{
+				Amount:        10,
+				RoundID:       tc.roundID,
+				TransactionID: uuid.Must(uuid.NewV4()),
+			})
+			assert.ErrorIs(t, err, ErrNotGameRound)
+		})
+	}
+
+	// чужой платеж выглядит как несуществующий раунд
+	_, err = service.Refund(ctx, recipient, request.RefundTransaction{RoundID: deposit})
+	assert.ErrorIs(t, err, transaction.ErrRoundNotFound)
+
+	balance, err := walletRepo.Get(ctx, sender)
+	require.NoError(t, err)
+	assert.Equal(t, models.Balance(750), balance)
+
+	balance, err = walletRepo.Get(ctx, recipient)
+	require.NoError(t, err)
+	assert.Equal(t, models.Balance(150), balance)
+}
@@ -0,0 +1,135 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/postgres"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PostgresRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgresRepository(db *pgxpool.Pool) *PostgresRepository {
+	return &PostgresRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresRepository) Get(ctx context.Context, userID models.UserID) (models.Balance, error) {
+	var balance int64
+
+	err := r.db.QueryRow(ctx,
+		`SELECT balance FROM wallets WHERE tenant_id = $1 AND user_id = $2`,
+		tenant.FromContext(ctx), userID,
+	).Scan(&balance)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrWalletNotFound
+		}
+		return 0, fmt.Errorf("select wallet: %w", err)
+	}
+
+	return models.Balance(balance), nil
+}
+
+func (r *PostgresRepository) Create(ctx context.Context, userID models.UserID, balance models.Balance) error {
+	if balance < 0 {
+		return ErrWalletNotNegativeBalance
+	}
+
+	_, err := r.db.Exec(ctx,
+		`INSERT INTO wallets (tenant_id, user_id, balance) VALUES ($1, $2, $3)`,
+		tenant.FromContext(ctx), userID, balance,
+	)
+	if err != nil {
+		if postgres.IsUniqueViolation(err) {
+			return ErrWalletAlreadyExists
+		}
+		return fmt.Errorf("insert wallet: %w", err)
+	}
+
+	return nil
+}
+
+// Update - строка кошелька блокируется SELECT ... FOR UPDATE до конца
+// транзакции, параллельные изменения одного кошелька выполняются по очереди
+func (r *PostgresRepository) Update(
+	ctx context.Context,
+	userID models.UserID,
+	amount models.Amount,
+) (models.Balance, error) {
+	tenantID := tenant.FromContext(ctx)
+
+	var balance int64
+
+	err := postgres.InTx(ctx, r.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx,
+			`SELECT balance FROM wallets WHERE tenant_id = $1 AND user_id = $2 FOR UPDATE`,
+			tenantID, userID,
+		).Scan(&balance)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrWalletNotFound
+			}
+			return fmt.Errorf("select wallet: %w", err)
+		}
+
+		balance += int64(amount)
+		if balance < 0 {
+			return ErrWalletNotEnoughMoney
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE wallets SET balance = $1 WHERE tenant_id = $2 AND user_id = $3`,
+			balance, tenantID, userID,
+		)
+		if err != nil {
+			return fmt.Errorf("update wallet: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return models.Balance(balance), nil
+}
+
+func (r *PostgresRepository) Iterate(
+	ctx context.Context,
+	fn func(userID models.UserID, balance models.Balance) error,
+) error {
+	rows, err := r.db.Query(ctx,
+		`SELECT user_id, balance FROM wallets WHERE tenant_id = $1 ORDER BY user_id`,
+		tenant.FromContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("select wallets: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, balance int64
+
+		if err = rows.Scan(&userID, &balance); err != nil {
+			return fmt.Errorf("scan wallet: %w", err)
+		}
+
+		if err = fn(models.UserID(userID), models.Balance(balance)); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("select wallets: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/transaction"
+	"github.com/gofrs/uuid"
+	"strconv"
+	"time"
+)
+
+// ErrOpeningMismatch - раунд начального баланса уже записан и расходится с новым кошельком
+var ErrOpeningMismatch = errors.New("opening balance is already recorded with other data")
+
+// openingNamespace - пространство имен идентификаторов раундов начального баланса
+var openingNamespace = uuid.Must(uuid.FromString("3f6c1d8e-2b7a-4e59-9c41-7d0a5e8b6f12"))
+
+// OpeningRoundID - раунд, в котором записан начальный баланс кошелька userID
+func OpeningRoundID(userID models.UserID) models.RoundID {
+	return uuid.NewV5(openingNamespace, strconv.Itoa(int(userID)))
+}
+
+// Provisioner - создает кошелек при регистрации игрока,
+// начальный баланс задается политикой оператора, а не клиентом.
+// Кошелек у игрока один: хранилища держат один баланс на UserID, а валюта
+// операции только проверяется по списку валют оператора. Кошельки по валютам
+// требуют ключа кошелька с валютой во всех хранилищах и миграции данных.
+// Начальный баланс записывается раундом RoundKindOpening, чтобы сверка
+// не зависела от политики, действующей на момент проверки
+type Provisioner struct {
+	walletRepository Repository
+	trRepository     transaction.Repository
+	tenants          tenantConfigs
+	defaultPolicy    tenant.WalletPolicy
+	now              func() time.Time
+}
+
+func NewProvisioner(
+	walletRepository Repository,
+	trRepository transaction.Repository,
+	tenants tenantConfigs,
+	defaultPolicy tenant.WalletPolicy,
+) *Provisioner {
+	return &Provisioner{
+		walletRepository: walletRepository,
+		trRepository:     trRepository,
+		tenants:          tenants,
+		defaultPolicy:    defaultPolicy,
+		now:              time.Now,
+	}
+}
+
+func (p *Provisioner) Provision(ctx context.Context, userID models.UserID) (models.Balance, error) {
+	cfg, ok := p.tenants.Get(tenant.FromContext(ctx))
+	if !ok {
+		return 0, tenant.ErrUnknownTenant
+	}
+
+	policy := p.defaultPolicy
+	if cfg.Wallet != nil {
+		policy = *cfg.Wallet
+	}
+
+	now := p.now()
+	balance := policy.StartBalance(now)
+
+	// раунд пишется до кошелька: кошелек без записи о начальном балансе
+	// сверка приняла бы за созданный до появления таких записей
+	roundID := OpeningRoundID(userID)
+	opening := models.Round{
+		UserID:   userID,
+		Bet:      models.Transaction{Amount: models.Amount(balance), TransactionID: roundID, Created: now},
+		Finished: true,
+		Kind:     models.RoundKindOpening,
+	}
+
+	err := p.trRepository.CreateBet(ctx, roundID, opening)
+	if errors.Is(err, transaction.ErrRoundIdAlreadyExists) {
+		// повтор после сбоя создания кошелька, записанный раунд должен совпадать с кошельком
+		err = p.checkOpening(ctx, roundID, opening)
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("record opening balance: %w", err)
+	}
+
+	err = p.walletRepository.Create(ctx, userID, balance)
+	if err != nil {
+		return 0, err
+	}
+
+	return balance, nil
+}
+
+// checkOpening - ранее записанный раунд начального баланса совпадает с opening
+func (p *Provisioner) checkOpening(ctx context.Context, roundID models.RoundID, opening models.Round) error {
+	stored, err := p.trRepository.GetRound(ctx, roundID)
+	if err != nil {
+		return err
+	}
+
+	if stored.UserID != opening.UserID ||
+		stored.Kind != opening.Kind ||
+		stored.Bet.Amount != opening.Bet.Amount ||
+		stored.Win != nil ||
+		stored.Refunded {
+		return ErrOpeningMismatch
+	}
+
+	return nil
+}
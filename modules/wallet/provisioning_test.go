@@ -0,0 +1,124 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/transaction"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestProvisioner_Provision(t *testing.T) {
+	const userID = 1992
+
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	bonusEnded := now.Add(-time.Hour)
+
+	tenants, err := tenant.NewRegistry([]tenant.Config{
+		{ID: models.DefaultTenant},
+		{
+			ID: "brand",
+			Wallet: &tenant.WalletPolicy{
+				InitialBalance:    50,
+				WelcomeBonus:      500,
+				WelcomeBonusUntil: &bonusEnded,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	defaultPolicy := tenant.WalletPolicy{InitialBalance: 10, WelcomeBonus: 100}
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		before     func(repo *InMemoryRepository, trRepo *transaction.InMemoryRepository)
+		expBalance models.Balance
+		expErr     error
+	}{
+		{
+			name:       "default policy with welcome bonus",
+			ctx:        ctx,
+			before:     func(repo *InMemoryRepository, trRepo *transaction.InMemoryRepository) {},
+			expBalance: 110,
+		},
+		{
+			name:       "tenant policy with finished welcome bonus",
+			ctx:        tenant.WithTenant(ctx, "brand"),
+			before:     func(repo *InMemoryRepository, trRepo *transaction.InMemoryRepository) {},
+			expBalance: 50,
+		},
+		{
+			name:   "unknown tenant",
+			ctx:    tenant.WithTenant(ctx, "other"),
+			before: func(repo *InMemoryRepository, trRepo *transaction.InMemoryRepository) {},
+			expErr: tenant.ErrUnknownTenant,
+		},
+		{
+			name: "opening balance recorded by previous attempt",
+			ctx:  ctx,
+			before: func(repo *InMemoryRepository, trRepo *transaction.InMemoryRepository) {
+				round := models.Round{UserID: userID, Bet: models.Transaction{Amount: 110}, Finished: true, Kind: models.RoundKindOpening}
+				require.NoError(t, trRepo.CreateBet(ctx, OpeningRoundID(userID), round))
+			},
+			expBalance: 110,
+		},
+		{
+			name: "opening balance recorded with other amount",
+			ctx:  ctx,
+			before: func(repo *InMemoryRepository, trRepo *transaction.InMemoryRepository) {
+				round := models.Round{UserID: userID, Bet: models.Transaction{Amount: 10}, Finished: true, Kind: models.RoundKindOpening}
+				require.NoError(t, trRepo.CreateBet(ctx, OpeningRoundID(userID), round))
+			},
+			expErr: ErrOpeningMismatch,
+		},
+		{
+			name: "wallet already exists",
+			ctx:  ctx,
+			before: func(repo *InMemoryRepository, trRepo *transaction.InMemoryRepository) {
+				repo.wallets(models.DefaultTenant)[userID] = 0
+			},
+			expErr: ErrWalletAlreadyExists,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := NewInMemoryRepository()
+			trRepo := transaction.NewInMemoryRepository()
+			tc.before(repo, trRepo)
+
+			p := NewProvisioner(repo, trRepo, tenants, defaultPolicy)
+			p.now = func() time.Time { return now }
+
+			balance, err := p.Provision(tc.ctx, userID)
+			assert.ErrorIs(t, err, tc.expErr)
+			assert.Equal(t, tc.expBalance, balance)
+
+			if tc.expErr != nil {
+				// кошелек не создается, если начальный баланс не записан или расходится
+				if !errors.Is(tc.expErr, ErrWalletAlreadyExists) {
+					_, err = repo.Get(tc.ctx, userID)
+					assert.ErrorIs(t, err, ErrWalletNotFound)
+				}
+
+				return
+			}
+
+			opening, err := trRepo.GetRound(tc.ctx, OpeningRoundID(userID))
+			require.NoError(t, err)
+			assert.Equal(t, models.RoundKindOpening, opening.Kind)
+			assert.Equal(t, models.Amount(tc.expBalance), opening.Bet.Amount)
+			assert.True(t, opening.Finished)
+
+			// уже записанный раунд начального баланса не мешает, повтор останавливает кошелек
+			_, err = p.Provision(tc.ctx, userID)
+			assert.ErrorIs(t, err, ErrWalletAlreadyExists)
+		})
+	}
+}
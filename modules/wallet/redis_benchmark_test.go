@@ -0,0 +1,86 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+// benchClient - REDIS_BENCH_ADDR для замеров на настоящем redis (база очищается),
+// иначе miniredis
+func benchClient(b *testing.B) *redis.Client {
+	addr := os.Getenv("REDIS_BENCH_ADDR")
+	if addr == "" {
+		s, err := miniredis.Run()
+		require.NoError(b, err)
+		b.Cleanup(s.Close)
+
+		addr = s.Addr()
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	require.NoError(b, client.FlushDB(context.Background()).Err())
+	b.Cleanup(func() { _ = client.Close() })
+
+	return client
+}
+
+// legacyUpdate - изменение баланса до перехода на INCRBY: чтение, проверка и запись
+func legacyUpdate(ctx context.Context, client *redis.Client, key string, amount models.Amount) error {
+	data, err := client.Get(ctx, key).Bytes()
+	if err != nil {
+		return err
+	}
+
+	var balance models.Balance
+	if err = json.Unmarshal(data, &balance); err != nil {
+		return err
+	}
+
+	balance += models.Balance(amount)
+
+	data, err = json.Marshal(balance)
+	if err != nil {
+		return err
+	}
+
+	return client.Set(ctx, key, data, 0).Err()
+}
+
+func BenchmarkRedisRepository_Update(b *testing.B) {
+	ctx := context.Background()
+
+	b.Run("json", func(b *testing.B) {
+		client := benchClient(b)
+		repo := NewRedisRepository(client, keyschema.Default(), 0)
+		require.NoError(b, repo.Create(ctx, 1, 1_000_000))
+
+		key := repo.keys.WalletKey(ctx, 1)
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := legacyUpdate(ctx, client, key, 1); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("incrby", func(b *testing.B) {
+		client := benchClient(b)
+		repo := NewRedisRepository(client, keyschema.Default(), 0)
+		require.NoError(b, repo.Create(ctx, 1, 1_000_000))
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.Update(ctx, 1, 1); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -2,31 +2,60 @@ package wallet
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
 	"github.com/go-redis/redis/v8"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type RedisRepository struct {
-	client   *redis.Client
-	expireAt time.Duration
+	client redis.UniversalClient
+	keys   keyschema.Schema
+	ttl    time.Duration
 }
 
-func NewRedisRepository(client *redis.Client, expiredAt time.Duration) *RedisRepository {
+func NewRedisRepository(client redis.UniversalClient, keys keyschema.Schema, ttl time.Duration) *RedisRepository {
 	return &RedisRepository{
-		client:   client,
-		expireAt: expiredAt,
+		client: client,
+		keys:   keys,
+		ttl:    ttl,
 	}
 }
 
+// updateScript - атомарно меняет баланс через INCRBY, не допуская отрицательного.
+// KEYS[1] - кошелек, ARGV - сумма и срок жизни в мс. Ответ -1 - кошелька нет,
+// -2 - недостаточно средств, иначе новый баланс
+var updateScript = redis.NewScript(`
+local balance = redis.call('GET', KEYS[1])
+if not balance then
+	return -1
+end
+
+if tonumber(balance) + tonumber(ARGV[1]) < 0 then
+	return -2
+end
+
+local updated = redis.call('INCRBY', KEYS[1], ARGV[1])
+if tonumber(ARGV[2]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+else
+	redis.call('PERSIST', KEYS[1])
+end
+
+return updated
+`)
+
+// Get - баланс хранится целым числом. Старый формат - JSON число,
+// для целого баланса он совпадает с записью числа
 func (r *RedisRepository) Get(
 	ctx context.Context,
 	userID models.UserID,
 ) (models.Balance, error) {
-	res, err := r.client.Get(ctx, userID.String()).Result()
+	balance, err := r.client.Get(ctx, r.keys.WalletKey(ctx, userID)).Int64()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
 			err = ErrWalletNotFound
@@ -34,14 +63,7 @@ func (r *RedisRepository) Get(
 		return 0, err
 	}
 
-	balance := new(models.Balance)
-
-	err = json.Unmarshal([]byte(res), &balance)
-	if err != nil {
-		return 0, fmt.Errorf("unmarshal: %w", err)
-	}
-
-	return *balance, nil
+	return models.Balance(balance), nil
 }
 
 func (r *RedisRepository) Create(
@@ -53,25 +75,15 @@ func (r *RedisRepository) Create(
 		return ErrWalletNotNegativeBalance
 	}
 
-	count, err := r.client.Exists(ctx, userID.String()).Result()
+	created, err := r.client.SetNX(ctx, r.keys.WalletKey(ctx, userID), int64(balance), r.ttl).Result()
 	if err != nil {
-		return fmt.Errorf("redis.Exists: %w", err)
+		return fmt.Errorf("redis.SetNX: %w", err)
 	}
 
-	if count > 0 {
+	if !created {
 		return ErrWalletAlreadyExists
 	}
 
-	data, err := json.Marshal(balance)
-	if err != nil {
-		return fmt.Errorf("marshal: %w", err)
-	}
-
-	err = r.client.Set(ctx, userID.String(), data, r.expireAt).Err()
-	if err != nil {
-		return fmt.Errorf("redis.Set: %w", err)
-	}
-
 	return nil
 }
 
@@ -80,33 +92,55 @@ func (r *RedisRepository) Update(
 	userID models.UserID,
 	amount models.Amount,
 ) (models.Balance, error) {
-	res, err := r.client.Get(ctx, userID.String()).Result()
+	key := r.keys.WalletKey(ctx, userID)
+
+	balance, err := updateScript.Run(ctx, r.client, []string{key}, int64(amount), r.ttl.Milliseconds()).Int64()
 	if err != nil {
+		return 0, fmt.Errorf("updateScript: %w", err)
+	}
+
+	switch balance {
+	case -1:
 		return 0, ErrWalletNotFound
+	case -2:
+		return 0, ErrWalletNotEnoughMoney
 	}
 
-	balance := new(models.Balance)
+	return models.Balance(balance), nil
+}
 
-	err = json.Unmarshal([]byte(res), balance)
-	if err != nil {
-		return 0, fmt.Errorf("unmarshal: %w", err)
-	}
+func (r *RedisRepository) Iterate(
+	ctx context.Context,
+	fn func(userID models.UserID, balance models.Balance) error,
+) error {
+	prefix := r.keys.WalletPrefix(ctx)
 
-	*balance += models.Balance(amount)
+	return keyschema.Scan(ctx, r.client, prefix+"*", func(keys []string) error {
+		values, err := keyschema.GetAll(ctx, r.client, keys)
+		if err != nil {
+			return err
+		}
 
-	if *balance < 0 {
-		return 0, ErrWalletNotEnoughMoney
-	}
+		for n, value := range values {
+			if value == nil {
+				continue
+			}
 
-	data, err := json.Marshal(balance)
-	if err != nil {
-		return 0, fmt.Errorf("marshal: %w", err)
-	}
+			userID, err := strconv.Atoi(strings.TrimPrefix(keys[n], prefix))
+			if err != nil {
+				return fmt.Errorf("parse user id %s: %w", keys[n], err)
+			}
 
-	err = r.client.Set(ctx, userID.String(), data, r.expireAt).Err()
-	if err != nil {
-		return 0, fmt.Errorf("redis.Set: %w", err)
-	}
+			balance, err := strconv.ParseInt(*value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("parse balance %s: %w", keys[n], err)
+			}
+
+			if err = fn(models.UserID(userID), models.Balance(balance)); err != nil {
+				return err
+			}
+		}
 
-	return *balance, nil
+		return nil
+	})
 }
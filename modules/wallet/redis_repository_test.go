@@ -4,11 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
 	"github.com/alicebob/miniredis/v2"
 	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestRedisRepository_Get(t *testing.T) {
@@ -26,6 +30,7 @@ func TestRedisRepository_Get(t *testing.T) {
 
 	repo := &RedisRepository{
 		client: client,
+		keys:   keyschema.Default(),
 	}
 
 	expErr := func(expErr error) func(t *testing.T, res models.Balance, err error) {
@@ -53,7 +58,7 @@ func TestRedisRepository_Get(t *testing.T) {
 				balanceJSON, err := json.Marshal(balance)
 				require.NoError(t, err)
 
-				err = r.Set(ctx, userID.String(), balanceJSON, 0).Err()
+				err = r.Set(ctx, repo.keys.WalletKey(ctx, userID), balanceJSON, 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: func(t *testing.T, res models.Balance, err error) {
@@ -89,6 +94,7 @@ func TestRedisRepository_Create(t *testing.T) {
 	})
 	repo := &RedisRepository{
 		client: client,
+		keys:   keyschema.Default(),
 	}
 
 	expErr := func(expErr error) func(t *testing.T, err error) {
@@ -118,7 +124,7 @@ func TestRedisRepository_Create(t *testing.T) {
 				balanceJSON, err := json.Marshal(balance)
 				require.NoError(t, err)
 
-				err = r.Set(ctx, userID.String(), balanceJSON, 0).Err()
+				err = r.Set(ctx, repo.keys.WalletKey(ctx, userID), balanceJSON, 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: expErr(ErrWalletAlreadyExists),
@@ -160,6 +166,7 @@ func TestRedisRepository_Update(t *testing.T) {
 
 	repo := &RedisRepository{
 		client: client,
+		keys:   keyschema.Default(),
 	}
 
 	expErr := func(expErr error) func(t *testing.T, res models.Balance, err error) {
@@ -190,7 +197,7 @@ func TestRedisRepository_Update(t *testing.T) {
 				balanceJSON, err := json.Marshal(balance)
 				require.NoError(t, err)
 
-				err = r.Set(ctx, userID.String(), balanceJSON, 0).Err()
+				err = r.Set(ctx, repo.keys.WalletKey(ctx, userID), balanceJSON, 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: expErr(ErrWalletNotEnoughMoney),
@@ -202,7 +209,7 @@ func TestRedisRepository_Update(t *testing.T) {
 				balanceJSON, err := json.Marshal(balance)
 				require.NoError(t, err)
 
-				err = r.Set(ctx, userID.String(), balanceJSON, 0).Err()
+				err = r.Set(ctx, repo.keys.WalletKey(ctx, userID), balanceJSON, 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: func(t *testing.T, res models.Balance, err error) {
@@ -216,7 +223,7 @@ func TestRedisRepository_Update(t *testing.T) {
 				balanceJSON, err := json.Marshal(balance)
 				require.NoError(t, err)
 
-				err = r.Set(ctx, userID.String(), balanceJSON, 0).Err()
+				err = r.Set(ctx, repo.keys.WalletKey(ctx, userID), balanceJSON, 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: func(t *testing.T, res models.Balance, err error) {
@@ -237,3 +244,63 @@ func TestRedisRepository_Update(t *testing.T) {
 		})
 	}
 }
+
+// кошелек без срока жизни не получает его при изменении баланса
+func TestRedisRepository_TTL(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := context.Background()
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+
+	repo := NewRedisRepository(client, keyschema.Default(), 0)
+	require.NoError(t, repo.Create(ctx, 1, 100))
+
+	_, err = repo.Update(ctx, 1, -10)
+	require.NoError(t, err)
+	assert.Zero(t, s.TTL(repo.keys.WalletKey(ctx, 1)))
+
+	repo = NewRedisRepository(client, keyschema.Default(), time.Hour)
+	_, err = repo.Update(ctx, 1, -10)
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, s.TTL(repo.keys.WalletKey(ctx, 1)))
+}
+
+// параллельные списания не уводят баланс в минус
+func TestRedisRepository_ConcurrentUpdate(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := context.Background()
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	repo := NewRedisRepository(client, keyschema.Default(), 0)
+
+	// баланс в старом формате - JSON число
+	require.NoError(t, client.Set(ctx, repo.keys.WalletKey(ctx, 1), "100", 0).Err())
+
+	var (
+		wg       sync.WaitGroup
+		rejected atomic.Int32
+	)
+
+	for n := 0; n < 20; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, err := repo.Update(ctx, 1, -10); err != nil {
+				assert.ErrorIs(t, err, ErrWalletNotEnoughMoney)
+				rejected.Add(1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	balance, err := repo.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Zero(t, balance)
+	assert.Equal(t, int32(10), rejected.Load())
+}
@@ -0,0 +1,159 @@
+package wallet
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
+	"github.com/IlnurShafikov/wallet/services/postgres/pgtest"
+	"github.com/IlnurShafikov/wallet/services/sqlite"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// repositoryConstructor - пустое хранилище и контекст оператора, в котором с ним работает тест
+type repositoryConstructor func(t *testing.T) (Repository, context.Context)
+
+// repositoryConstructors - реализации Repository, на которых выполняются общие тесты
+func repositoryConstructors() map[string]repositoryConstructor {
+	return map[string]repositoryConstructor{
+		"in memory": func(t *testing.T) (Repository, context.Context) {
+			return NewInMemoryRepository(), context.Background()
+		},
+		"postgres": func(t *testing.T) (Repository, context.Context) {
+			db, ctx := pgtest.Open(t)
+			return NewPostgresRepository(db), ctx
+		},
+		"redis": func(t *testing.T) (Repository, context.Context) {
+			s := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+			t.Cleanup(func() { _ = client.Close() })
+
+			return NewRedisRepository(client, keyschema.Default(), 0), context.Background()
+		},
+		"sqlite": func(t *testing.T) (Repository, context.Context) {
+			db, err := sqlite.Open(context.Background(), filepath.Join(t.TempDir(), "wallet.db"), 5*time.Second)
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = db.Close() })
+
+			return NewSQLiteRepository(db), context.Background()
+		},
+	}
+}
+
+func TestRepository_Update(t *testing.T) {
+	const userID models.UserID = 1992
+
+	tests := []struct {
+		name      string
+		before    func(t *testing.T, ctx context.Context, repo Repository)
+		amount    models.Amount
+		expect    models.Balance
+		expectErr error
+	}{
+		{
+			name:      "update wallet: wallet not found",
+			before:    func(t *testing.T, ctx context.Context, repo Repository) {},
+			amount:    10,
+			expectErr: ErrWalletNotFound,
+		}, {
+			name: "update wallet: not enough money",
+			before: func(t *testing.T, ctx context.Context, repo Repository) {
+				require.NoError(t, repo.Create(ctx, userID, 5))
+			},
+			amount:    -10,
+			expectErr: ErrWalletNotEnoughMoney,
+		}, {
+			name: "update wallet successfully",
+			before: func(t *testing.T, ctx context.Context, repo Repository) {
+				require.NoError(t, repo.Create(ctx, userID, 100))
+			},
+			amount: -10,
+			expect: 90,
+		},
+	}
+
+	for name, newRepository := range repositoryConstructors() {
+		for _, tc := range tests {
+			t.Run(name+": "+tc.name, func(t *testing.T) {
+				repo, ctx := newRepository(t)
+				tc.before(t, ctx, repo)
+
+				balance, err := repo.Update(ctx, userID, tc.amount)
+				assert.ErrorIs(t, err, tc.expectErr)
+				assert.Equal(t, tc.expect, balance)
+
+				if tc.expectErr == nil {
+					stored, err := repo.Get(ctx, userID)
+					require.NoError(t, err)
+					assert.Equal(t, tc.expect, stored)
+				}
+			})
+		}
+	}
+}
+
+func TestRepository_Create(t *testing.T) {
+	for name, newRepository := range repositoryConstructors() {
+		t.Run(name, func(t *testing.T) {
+			repo, ctx := newRepository(t)
+
+			assert.ErrorIs(t, repo.Create(ctx, 1, -1), ErrWalletNotNegativeBalance)
+			require.NoError(t, repo.Create(ctx, 1, 100))
+			assert.ErrorIs(t, repo.Create(ctx, 1, 100), ErrWalletAlreadyExists)
+
+			_, err := repo.Get(tenant.WithTenant(ctx, tenant.FromContext(ctx)+"-brand"), 1)
+			assert.ErrorIs(t, err, ErrWalletNotFound)
+
+			balance, err := repo.Get(ctx, 1)
+			require.NoError(t, err)
+			assert.Equal(t, models.Balance(100), balance)
+		})
+	}
+}
+
+// параллельные списания не уводят баланс в минус и не теряют изменения
+func TestRepository_ConcurrentUpdate(t *testing.T) {
+	for name, newRepository := range repositoryConstructors() {
+		t.Run(name, func(t *testing.T) {
+			repo, ctx := newRepository(t)
+
+			require.NoError(t, repo.Create(ctx, 1, 100))
+
+			var (
+				wg       sync.WaitGroup
+				mu       sync.Mutex
+				rejected int
+			)
+
+			for n := 0; n < 20; n++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					_, err := repo.Update(ctx, 1, -10)
+					if err != nil {
+						assert.ErrorIs(t, err, ErrWalletNotEnoughMoney)
+
+						mu.Lock()
+						rejected++
+						mu.Unlock()
+					}
+				}()
+			}
+
+			wg.Wait()
+
+			balance, err := repo.Get(ctx, 1)
+			require.NoError(t, err)
+			assert.Zero(t, balance)
+			assert.Equal(t, 10, rejected)
+		})
+	}
+}
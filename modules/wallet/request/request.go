@@ -4,15 +4,13 @@ import (
 	"github.com/IlnurShafikov/wallet/models"
 )
 
-type CreateWallet struct {
-	Balance models.Balance `json:"balance"`
-}
-
 type UpdateBalance struct {
 	Amount        models.Amount        `json:"amount"`
 	RoundID       models.RoundID       `json:"round_id"`
 	TransactionID models.TransactionID `json:"transaction_id"`
 	Finished      bool                 `json:"finished"`
+	// Currency - валюта операции, проверяется по настройкам оператора
+	Currency string `json:"currency,omitempty"`
 }
 
 func (u UpdateBalance) IsBet() bool {
@@ -27,3 +25,15 @@ func (u UpdateBalance) IsWin() bool {
 type RefundTransaction struct {
 	RoundID models.RoundID `json:"round_id"`
 }
+
+// Payment - пополнение или вывод, PaymentID делает запрос идемпотентным
+type Payment struct {
+	PaymentID models.RoundID `json:"payment_id"`
+	Amount    models.Amount  `json:"amount"`
+}
+
+type Transfer struct {
+	PaymentID models.RoundID `json:"payment_id"`
+	ToUserID  models.UserID  `json:"to_user_id"`
+	Amount    models.Amount  `json:"amount"`
+}
@@ -0,0 +1,137 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/sqlite"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+)
+
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRepository(db *sql.DB) *SQLiteRepository {
+	return &SQLiteRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteRepository) Get(ctx context.Context, userID models.UserID) (models.Balance, error) {
+	var balance models.Balance
+
+	err := r.db.QueryRowContext(ctx,
+		`SELECT balance FROM wallets WHERE tenant_id = ? AND user_id = ?`,
+		tenant.FromContext(ctx), userID,
+	).Scan(&balance)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrWalletNotFound
+		}
+		return 0, fmt.Errorf("select wallet: %w", err)
+	}
+
+	return balance, nil
+}
+
+func (r *SQLiteRepository) Create(ctx context.Context, userID models.UserID, balance models.Balance) error {
+	if balance < 0 {
+		return ErrWalletNotNegativeBalance
+	}
+
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO wallets (tenant_id, user_id, balance) VALUES (?, ?, ?)`,
+		tenant.FromContext(ctx), userID, balance,
+	)
+	if err != nil {
+		if sqlite.IsUniqueViolation(err) {
+			return ErrWalletAlreadyExists
+		}
+		return fmt.Errorf("insert wallet: %w", err)
+	}
+
+	return nil
+}
+
+// Update - чтение и запись баланса в одной транзакции, параллельные
+// изменения одного кошелька выполняются по очереди
+func (r *SQLiteRepository) Update(
+	ctx context.Context,
+	userID models.UserID,
+	amount models.Amount,
+) (models.Balance, error) {
+	tenantID := tenant.FromContext(ctx)
+
+	var balance models.Balance
+
+	err := sqlite.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx,
+			`SELECT balance FROM wallets WHERE tenant_id = ? AND user_id = ?`,
+			tenantID, userID,
+		).Scan(&balance)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrWalletNotFound
+			}
+			return fmt.Errorf("select wallet: %w", err)
+		}
+
+		balance += models.Balance(amount)
+		if balance < 0 {
+			return ErrWalletNotEnoughMoney
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE wallets SET balance = ? WHERE tenant_id = ? AND user_id = ?`,
+			balance, tenantID, userID,
+		)
+		if err != nil {
+			return fmt.Errorf("update wallet: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return balance, nil
+}
+
+func (r *SQLiteRepository) Iterate(
+	ctx context.Context,
+	fn func(userID models.UserID, balance models.Balance) error,
+) error {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT user_id, balance FROM wallets WHERE tenant_id = ? ORDER BY user_id`,
+		tenant.FromContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("select wallets: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			userID  models.UserID
+			balance models.Balance
+		)
+
+		if err = rows.Scan(&userID, &balance); err != nil {
+			return fmt.Errorf("scan wallet: %w", err)
+		}
+
+		if err = fn(userID, balance); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("select wallets: %w", err)
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/IlnurShafikov/wallet/models"
 	"github.com/IlnurShafikov/wallet/modules/wallet/request"
+	"github.com/IlnurShafikov/wallet/services/tenant"
 	"github.com/IlnurShafikov/wallet/services/transaction"
 	"github.com/rs/zerolog"
 	"time"
@@ -17,6 +18,11 @@ type Repository interface {
 	Update(context.Context, models.UserID, models.Amount) (models.Balance, error)
 }
 
+// Iterator - обход всех кошельков оператора из контекста
+type Iterator interface {
+	Iterate(ctx context.Context, fn func(userID models.UserID, balance models.Balance) error) error
+}
+
 var (
 	ErrRefundAlreadyExists = errors.New("refund already exists")
 	ErrNotRefund           = errors.New("no way to roll back transactions")
@@ -24,22 +30,34 @@ var (
 	ErrWinAlreadyExists    = errors.New("win already exists")
 	ErrRoundFinished       = errors.New("round finished")
 	ErrUpdateRoundFailed   = errors.New("update round failed")
+	ErrCurrencyNotAllowed  = errors.New("currency is not allowed")
+	ErrBetLimitExceeded    = errors.New("bet limit exceeded")
+	ErrWinLimitExceeded    = errors.New("win limit exceeded")
+	// ErrNotGameRound - раунд с этим идентификатором хранит платеж или начальный баланс
+	ErrNotGameRound = errors.New("round is not a game round")
 )
 
+type tenantConfigs interface {
+	Get(id models.TenantID) (tenant.Config, bool)
+}
+
 type Service struct {
 	walletRepository Repository
 	trRepository     transaction.Repository
+	tenants          tenantConfigs
 	log              *zerolog.Logger
 }
 
 func NewWallet(
 	walletRepository Repository,
 	trRepository transaction.Repository,
+	tenants tenantConfigs,
 	logger *zerolog.Logger,
 ) *Service {
 	return &Service{
 		walletRepository: walletRepository,
 		trRepository:     trRepository,
+		tenants:          tenants,
 		log:              logger,
 	}
 }
@@ -59,24 +77,12 @@ func (w *Service) Update(
 	return w.walletRepository.Update(ctx, userID, amount)
 }
 
-func (w *Service) Create(
-	ctx context.Context,
-	userID models.UserID,
-	balance models.Balance,
-) (models.Balance, error) {
-	err := w.walletRepository.Create(ctx, userID, balance)
-	if err != nil {
-		return 0, err
-	}
-	return balance, nil
-}
-
 func (w *Service) Refund(
 	ctx context.Context,
 	userID models.UserID,
 	req request.RefundTransaction,
 ) (models.Balance, error) {
-	round, err := w.trRepository.GetRound(ctx, req.RoundID)
+	round, err := w.gameRound(ctx, userID, req.RoundID)
 	if err != nil {
 		return 0, err
 	}
@@ -112,6 +118,11 @@ func (w *Service) Change(
 	userID models.UserID,
 	req request.UpdateBalance,
 ) (models.Balance, error) {
+	err := w.checkTenantRules(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+
 	if req.IsBet() {
 		return w.createBet(ctx, userID, req)
 	} else if req.IsWin() {
@@ -121,6 +132,52 @@ func (w *Service) Change(
 	return 0, errors.New("amount is not be zero")
 }
 
+// checkTenantRules - проверка валюты и лимитов оператора
+func (w *Service) checkTenantRules(ctx context.Context, req request.UpdateBalance) error {
+	cfg, ok := w.tenants.Get(tenant.FromContext(ctx))
+	if !ok {
+		return tenant.ErrUnknownTenant
+	}
+
+	if req.Currency != "" && !cfg.AllowsCurrency(req.Currency) {
+		return ErrCurrencyNotAllowed
+	}
+
+	if req.IsBet() && cfg.Limits.MaxBet > 0 && -req.Amount > cfg.Limits.MaxBet {
+		return ErrBetLimitExceeded
+	}
+
+	if req.IsWin() && cfg.Limits.MaxWin > 0 && req.Amount > cfg.Limits.MaxWin {
+		return ErrWinLimitExceeded
+	}
+
+	return nil
+}
+
+// gameRound - игровой раунд игрока userID. Платежи хранятся раундами
+// в том же хранилище, возврат или выигрыш по ним менял бы баланс в обход
+// платежей. Чужой раунд не отличается от несуществующего
+func (w *Service) gameRound(
+	ctx context.Context,
+	userID models.UserID,
+	roundID models.RoundID,
+) (*models.Round, error) {
+	round, err := w.trRepository.GetRound(ctx, roundID)
+	if err != nil {
+		return nil, err
+	}
+
+	if round.UserID != userID {
+		return nil, transaction.ErrRoundNotFound
+	}
+
+	if round.Kind != models.RoundKindGame {
+		return nil, ErrNotGameRound
+	}
+
+	return round, nil
+}
+
 func (w *Service) createBet(
 	ctx context.Context,
 	userID models.UserID,
@@ -165,7 +222,7 @@ func (w *Service) setWin(
 	userID models.UserID,
 	req request.UpdateBalance,
 ) (models.Balance, error) {
-	round, err := w.trRepository.GetRound(ctx, req.RoundID)
+	round, err := w.gameRound(ctx, userID, req.RoundID)
 	if err != nil {
 		return 0, err
 	}
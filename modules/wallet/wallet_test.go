@@ -6,6 +6,7 @@ import (
 	"github.com/IlnurShafikov/wallet/mocks"
 	"github.com/IlnurShafikov/wallet/models"
 	"github.com/IlnurShafikov/wallet/modules/wallet/request"
+	"github.com/IlnurShafikov/wallet/services/tenant"
 	"github.com/IlnurShafikov/wallet/services/transaction"
 	"github.com/golang/mock/gomock"
 	"github.com/google/uuid"
@@ -127,7 +128,7 @@ func TestWallet_Get(t *testing.T) {
 			m := newMock(ctrl)
 			tt.before(m)
 
-			srv := NewWallet(m.walletRepo, m.mockTrRepo, &log)
+			srv := NewWallet(m.walletRepo, m.mockTrRepo, tenant.DefaultRegistry(), &log)
 			balance, err := srv.Get(ctx, userID)
 			assert.ErrorIs(t, err, tt.err)
 			assert.Equal(t, tt.exp, balance)
@@ -320,7 +321,7 @@ func TestWallet_Refund(t *testing.T) {
 			m := newMock(ctrl)
 			tt.before(m)
 
-			srv := NewWallet(m.walletRepo, m.mockTrRepo, &log)
+			srv := NewWallet(m.walletRepo, m.mockTrRepo, tenant.DefaultRegistry(), &log)
 			balance, err := srv.Refund(ctx, userID, req)
 
 			assert.ErrorIs(t, tt.expectErr, err)
@@ -448,7 +449,7 @@ func TestWallet_CreateBet(t *testing.T) {
 			m := newMock(ctrl)
 			tt.before(m)
 
-			srv := NewWallet(m.walletRepo, m.mockTrRepo, &log)
+			srv := NewWallet(m.walletRepo, m.mockTrRepo, tenant.DefaultRegistry(), &log)
 			balance, err := srv.createBet(ctx, userID, req)
 			assert.ErrorIs(t, err, tt.expErr)
 			assert.Equal(t, tt.expBalance, balance)
@@ -615,10 +616,73 @@ func TestWallet_SetWin(t *testing.T) {
 			m := newMock(ctrl)
 			tt.before(m)
 
-			srv := NewWallet(m.walletRepo, m.mockTrRepo, &log)
+			srv := NewWallet(m.walletRepo, m.mockTrRepo, tenant.DefaultRegistry(), &log)
 			balance, err := srv.setWin(ctx, userID, req)
 			assert.ErrorIs(t, tt.expErr, err)
 			assert.Equal(t, tt.expBalance, balance)
 		})
 	}
 }
+
+func TestWallet_TenantRules(t *testing.T) {
+	const userID = 1992
+
+	tenants, err := tenant.NewRegistry([]tenant.Config{
+		{
+			ID:         models.DefaultTenant,
+			Currencies: []string{"EUR"},
+			Limits:     tenant.Limits{MaxBet: 100, MaxWin: 1000},
+		},
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		req    request.UpdateBalance
+		expErr error
+	}{
+		{
+			name:   "currency not allowed",
+			ctx:    ctx,
+			req:    request.UpdateBalance{Amount: -10, Currency: "USD"},
+			expErr: ErrCurrencyNotAllowed,
+		},
+		{
+			name:   "bet limit exceeded",
+			ctx:    ctx,
+			req:    request.UpdateBalance{Amount: -101, Currency: "EUR"},
+			expErr: ErrBetLimitExceeded,
+		},
+		{
+			name:   "win limit exceeded",
+			ctx:    ctx,
+			req:    request.UpdateBalance{Amount: 1001},
+			expErr: ErrWinLimitExceeded,
+		},
+		{
+			name:   "unknown tenant",
+			ctx:    tenant.WithTenant(ctx, "brand2"),
+			req:    request.UpdateBalance{Amount: -10},
+			expErr: tenant.ErrUnknownTenant,
+		},
+	}
+
+	log := zerolog.Nop()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			m := newMock(ctrl)
+
+			srv := NewWallet(m.walletRepo, m.mockTrRepo, tenants, &log)
+			balance, err := srv.Change(tt.ctx, userID, tt.req)
+			assert.ErrorIs(t, err, tt.expErr)
+			assert.Zero(t, balance)
+		})
+	}
+}
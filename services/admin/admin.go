@@ -0,0 +1,31 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"strings"
+)
+
+const bearerPrefix = "Bearer "
+
+var ErrUnauthorized = apierror.New(http.StatusUnauthorized, "admin_unauthorized", "admin token is missing or invalid")
+
+// Middleware - пропускает запросы с заголовком Authorization: Bearer <token>,
+// при пустом токене административные методы недоступны
+func Middleware(token string) fiber.Handler {
+	return func(fCtx *fiber.Ctx) error {
+		header := fCtx.Get(fiber.HeaderAuthorization)
+		if token == "" || !strings.HasPrefix(header, bearerPrefix) {
+			return ErrUnauthorized
+		}
+
+		actual := strings.TrimPrefix(header, bearerPrefix)
+		if subtle.ConstantTimeCompare([]byte(actual), []byte(token)) != 1 {
+			return ErrUnauthorized
+		}
+
+		return fCtx.Next()
+	}
+}
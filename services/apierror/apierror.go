@@ -0,0 +1,66 @@
+package apierror
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var ErrValidation = New(http.StatusBadRequest, "validation_failed", "validation failed")
+
+// Error - ошибка API с HTTP статусом и машиночитаемым кодом
+type Error struct {
+	Status int
+	Code   string
+	// RetryAfter - через сколько можно повторить запрос, 0 - не задано
+	RetryAfter time.Duration
+	// Fields - ошибки отдельных полей запроса
+	Fields []FieldError
+	err    error
+}
+
+// FieldError - нарушенное правило для поля запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func New(status int, code, message string) *Error {
+	return &Error{
+		Status: status,
+		Code:   code,
+		err:    errors.New(message),
+	}
+}
+
+// WithRetryAfter - копия ошибки с подсказкой, когда можно повторить запрос
+func (e *Error) WithRetryAfter(retryAfter time.Duration) *Error {
+	err := *e
+	err.RetryAfter = retryAfter
+
+	return &err
+}
+
+// Validation - ErrValidation со списком ошибок полей
+func Validation(fields []FieldError) *Error {
+	err := *ErrValidation
+	err.Fields = fields
+
+	return &err
+}
+
+func (e *Error) Error() string {
+	return e.err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Is - ошибки с одинаковым кодом считаются одной ошибкой,
+// поэтому копия из WithRetryAfter совпадает с исходной
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
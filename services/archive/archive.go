@@ -0,0 +1,389 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/transaction"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const indexFile = "index.jsonl"
+
+// Archive - рассчитанные раунды в сжатых файлах JSONL, разложенных по оператору
+// и дате ставки: <dir>/<оператор>/<2006-01-02>/<batch>.jsonl.gz. Каждый перенос
+// пишет новый файл целиком, поэтому недописанных файлов не бывает.
+// Индекс index.jsonl связывает раунд с пользователем и файлом, держится в памяти.
+// Раунд, перенесенный повторно, берется из последнего файла
+type Archive struct {
+	mu     sync.RWMutex
+	dir    string
+	index  *os.File
+	rounds map[models.TenantID]map[models.RoundID]entry
+	users  map[models.TenantID]map[models.UserID][]models.RoundID
+}
+
+type entry struct {
+	userID models.UserID
+	file   string
+}
+
+// indexRecord - строка индекса, File относительно каталога архива
+type indexRecord struct {
+	TenantID models.TenantID `json:"tenant_id"`
+	RoundID  models.RoundID  `json:"round_id"`
+	UserID   models.UserID   `json:"user_id"`
+	File     string          `json:"file"`
+}
+
+// Open - открывает архив в каталоге dir и загружает индекс
+func Open(dir string) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("os.MkdirAll: %w", err)
+	}
+
+	index, err := os.OpenFile(filepath.Join(dir, indexFile), os.O_RDWR|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile: %w", err)
+	}
+
+	a := &Archive{
+		dir:    dir,
+		index:  index,
+		rounds: make(map[models.TenantID]map[models.RoundID]entry),
+		users:  make(map[models.TenantID]map[models.UserID][]models.RoundID),
+	}
+
+	if err = a.loadIndex(); err != nil {
+		_ = index.Close()
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// loadIndex - строка без перевода строки в конце осталась от прерванной
+// записи, она отбрасывается: раунды из нее еще не удалены из хранилища
+func (a *Archive) loadIndex() error {
+	reader := bufio.NewReader(a.index)
+
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if err = a.index.Truncate(offset); err != nil {
+				return fmt.Errorf("index.Truncate: %w", err)
+			}
+
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("read index: %w", err)
+		}
+
+		record := indexRecord{}
+		if err = json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("index at offset %d: %w", offset, err)
+		}
+
+		a.add(record)
+		offset += int64(len(line))
+	}
+
+	if _, err := a.index.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("index.Seek: %w", err)
+	}
+
+	return nil
+}
+
+func (a *Archive) add(record indexRecord) {
+	rounds, ok := a.rounds[record.TenantID]
+	if !ok {
+		rounds = make(map[models.RoundID]entry)
+		a.rounds[record.TenantID] = rounds
+		a.users[record.TenantID] = make(map[models.UserID][]models.RoundID)
+	}
+
+	if _, exists := rounds[record.RoundID]; !exists {
+		a.users[record.TenantID][record.UserID] = append(a.users[record.TenantID][record.UserID], record.RoundID)
+	}
+
+	rounds[record.RoundID] = entry{userID: record.UserID, file: record.File}
+}
+
+// Put - записывает раунды оператора в архив. После возврата без ошибки
+// раунды можно удалять из хранилища
+func (a *Archive) Put(ctx context.Context, rounds []transaction.UserRound) error {
+	if len(rounds) == 0 {
+		return nil
+	}
+
+	tenantID := tenant.FromContext(ctx)
+	batch := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	byFile := make(map[string][]transaction.UserRound)
+	for _, round := range rounds {
+		file := filepath.Join(
+			url.PathEscape(string(tenantID)),
+			round.Bet.Created.UTC().Format(time.DateOnly),
+			batch+".jsonl.gz",
+		)
+		byFile[file] = append(byFile[file], round)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var index bytes.Buffer
+	for file, rounds := range byFile {
+		if err := a.writeFile(file, rounds); err != nil {
+			return err
+		}
+
+		for _, round := range rounds {
+			line, err := json.Marshal(indexRecord{
+				TenantID: tenantID,
+				RoundID:  round.RoundID,
+				UserID:   round.UserID,
+				File:     file,
+			})
+			if err != nil {
+				return fmt.Errorf("marshal: %w", err)
+			}
+
+			index.Write(line)
+			index.WriteByte('\n')
+		}
+	}
+
+	if _, err := a.index.Write(index.Bytes()); err != nil {
+		return fmt.Errorf("index.Write: %w", err)
+	}
+
+	if err := a.index.Sync(); err != nil {
+		return fmt.Errorf("index.Sync: %w", err)
+	}
+
+	for file, rounds := range byFile {
+		for _, round := range rounds {
+			a.add(indexRecord{TenantID: tenantID, RoundID: round.RoundID, UserID: round.UserID, File: file})
+		}
+	}
+
+	return nil
+}
+
+// writeFile - пишет файл через временный, чтобы в архиве не было недописанных файлов
+func (a *Archive) writeFile(file string, rounds []transaction.UserRound) error {
+	path := filepath.Join(a.dir, file)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("os.MkdirAll: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".archive-*")
+	if err != nil {
+		return fmt.Errorf("os.CreateTemp: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	writer := gzip.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, round := range rounds {
+		if err = encoder.Encode(round); err != nil {
+			return fmt.Errorf("encode: %w", err)
+		}
+	}
+
+	if err = writer.Close(); err != nil {
+		return fmt.Errorf("gzip.Close: %w", err)
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("file.Sync: %w", err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("file.Close: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("os.Rename: %w", err)
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir - фиксирует переименование файла в каталоге
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("os.Open: %w", err)
+	}
+	defer file.Close()
+
+	if err = file.Sync(); err != nil {
+		return fmt.Errorf("dir.Sync: %w", err)
+	}
+
+	return nil
+}
+
+// Has - раунд есть в архиве
+func (a *Archive) Has(ctx context.Context, roundID models.RoundID) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	_, ok := a.rounds[tenant.FromContext(ctx)][roundID]
+
+	return ok
+}
+
+// GetRound - раунд из архива или transaction.ErrRoundNotFound
+func (a *Archive) GetRound(ctx context.Context, roundID models.RoundID) (*models.Round, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	entry, ok := a.rounds[tenant.FromContext(ctx)][roundID]
+	if !ok {
+		return nil, transaction.ErrRoundNotFound
+	}
+
+	rounds, err := a.readFile(entry.file)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, round := range rounds {
+		if round.RoundID == roundID {
+			return &round.Round, nil
+		}
+	}
+
+	return nil, fmt.Errorf("round %s not found in %s: %w", roundID, entry.file, transaction.ErrRoundNotFound)
+}
+
+// ListByUser - архивные раунды пользователя, от старых к новым
+func (a *Archive) ListByUser(ctx context.Context, userID models.UserID) ([]transaction.UserRound, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	tenantID := tenant.FromContext(ctx)
+
+	wanted := make(map[string]map[models.RoundID]bool)
+	for _, roundID := range a.users[tenantID][userID] {
+		file := a.rounds[tenantID][roundID].file
+		if wanted[file] == nil {
+			wanted[file] = make(map[models.RoundID]bool)
+		}
+
+		wanted[file][roundID] = true
+	}
+
+	var result []transaction.UserRound
+	for file, ids := range wanted {
+		rounds, err := a.readFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, round := range rounds {
+			if ids[round.RoundID] {
+				result = append(result, round)
+			}
+		}
+	}
+
+	sortRounds(result)
+
+	return result, nil
+}
+
+// Iterate - все архивные раунды оператора, файлы читаются по одному
+func (a *Archive) Iterate(ctx context.Context, fn func(round transaction.UserRound) error) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	byFile := make(map[string]map[models.RoundID]bool)
+	for roundID, entry := range a.rounds[tenant.FromContext(ctx)] {
+		if byFile[entry.file] == nil {
+			byFile[entry.file] = make(map[models.RoundID]bool)
+		}
+
+		byFile[entry.file][roundID] = true
+	}
+
+	for file, ids := range byFile {
+		rounds, err := a.readFile(file)
+		if err != nil {
+			return err
+		}
+
+		for _, round := range rounds {
+			if !ids[round.RoundID] {
+				continue
+			}
+
+			if err = fn(round); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (a *Archive) readFile(file string) ([]transaction.UserRound, error) {
+	f, err := os.Open(filepath.Join(a.dir, file))
+	if err != nil {
+		return nil, fmt.Errorf("os.Open: %w", err)
+	}
+	defer f.Close()
+
+	reader, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("gzip.NewReader %s: %w", file, err)
+	}
+	defer reader.Close()
+
+	var rounds []transaction.UserRound
+
+	decoder := json.NewDecoder(reader)
+	for {
+		round := transaction.UserRound{}
+		err = decoder.Decode(&round)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", file, err)
+		}
+
+		rounds = append(rounds, round)
+	}
+
+	return rounds, nil
+}
+
+// Close - закрывает файл индекса
+func (a *Archive) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.index.Close()
+}
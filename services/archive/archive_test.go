@@ -0,0 +1,262 @@
+package archive
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/transaction"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var created = time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+func settledRound(userID models.UserID, created time.Time) transaction.UserRound {
+	return transaction.UserRound{
+		RoundID: models.RoundID(uuid.New()),
+		Round: models.Round{
+			UserID:   userID,
+			Bet:      models.Transaction{Amount: -10, TransactionID: models.TransactionID(uuid.New()), Created: created},
+			Win:      &models.Transaction{Amount: 20, TransactionID: models.TransactionID(uuid.New()), Created: created},
+			Finished: true,
+		},
+	}
+}
+
+func TestArchive_PutAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := Open(dir)
+	require.NoError(t, err)
+
+	first := settledRound(1, created)
+	second := settledRound(1, created.Add(-24*time.Hour))
+	other := settledRound(2, created)
+	require.NoError(t, store.Put(ctx, []transaction.UserRound{first, second, other}))
+
+	// раунды разложены по дате ставки
+	files, err := filepath.Glob(filepath.Join(dir, string(models.DefaultTenant), "*", "*.jsonl.gz"))
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	require.NoError(t, store.Close())
+
+	// строка индекса, оборванная сбоем, отбрасывается
+	index, err := os.OpenFile(filepath.Join(dir, indexFile), os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = index.WriteString(`{"tenant_id":"default","round_id":`)
+	require.NoError(t, err)
+	require.NoError(t, index.Close())
+
+	store, err = Open(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	round, err := store.GetRound(ctx, first.RoundID)
+	require.NoError(t, err)
+	assert.Equal(t, first.Bet.TransactionID, round.Bet.TransactionID)
+	assert.True(t, round.Finished)
+
+	rounds, err := store.ListByUser(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, rounds, 2)
+	assert.Equal(t, second.RoundID, rounds[0].RoundID)
+	assert.Equal(t, first.RoundID, rounds[1].RoundID)
+
+	_, err = store.GetRound(tenant.WithTenant(ctx, "other"), first.RoundID)
+	assert.ErrorIs(t, err, transaction.ErrRoundNotFound)
+
+	// повторно перенесенный раунд читается из последнего файла
+	first.Refunded = true
+	require.NoError(t, store.Put(ctx, []transaction.UserRound{first}))
+
+	round, err = store.GetRound(ctx, first.RoundID)
+	require.NoError(t, err)
+	assert.True(t, round.Refunded)
+
+	rounds, err = store.ListByUser(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, rounds, 2)
+}
+
+func TestRepository(t *testing.T) {
+	ctx := context.Background()
+
+	hot := transaction.NewInMemoryRepository()
+	store, err := Open(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+
+	repo := NewRepository(hot, hot, store)
+
+	archived := settledRound(1, created)
+	require.NoError(t, store.Put(ctx, []transaction.UserRound{archived}))
+
+	open := models.RoundID(uuid.New())
+	require.NoError(t, repo.CreateBet(ctx, open, models.Round{UserID: 1, Bet: models.Transaction{Amount: -5, Created: created.Add(time.Hour)}}))
+
+	round, err := repo.GetRound(ctx, archived.RoundID)
+	require.NoError(t, err)
+	assert.Equal(t, archived.Bet.TransactionID, round.Bet.TransactionID)
+
+	_, err = repo.GetRound(ctx, models.RoundID(uuid.New()))
+	assert.ErrorIs(t, err, transaction.ErrRoundNotFound)
+
+	err = repo.CreateBet(ctx, archived.RoundID, archived.Round)
+	assert.ErrorIs(t, err, transaction.ErrRoundIdAlreadyExists)
+
+	err = repo.SetWin(ctx, archived.RoundID, models.Transaction{Amount: 1})
+	assert.ErrorIs(t, err, transaction.ErrTransactionAlreadyExists)
+
+	err = repo.SetWin(ctx, models.RoundID(uuid.New()), models.Transaction{Amount: 1})
+	assert.ErrorIs(t, err, transaction.ErrRoundNotFound)
+
+	rounds, err := repo.ListByUser(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, rounds, 2)
+	assert.Equal(t, archived.RoundID, rounds[0].RoundID)
+	assert.Equal(t, open, rounds[1].RoundID)
+
+	// измененный архивный раунд обновляется в архиве и не возвращается в хранилище
+	refunded := archived.Round
+	refunded.Refunded = true
+	require.NoError(t, repo.UpdateRound(ctx, archived.RoundID, refunded))
+
+	_, err = hot.GetRound(ctx, archived.RoundID)
+	assert.ErrorIs(t, err, transaction.ErrRoundNotFound)
+
+	round, err = repo.GetRound(ctx, archived.RoundID)
+	require.NoError(t, err)
+	assert.True(t, round.Refunded)
+
+	err = repo.UpdateRound(ctx, models.RoundID(uuid.New()), refunded)
+	assert.ErrorIs(t, err, transaction.ErrRoundNotFound)
+
+	rounds, err = repo.ListByUser(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, rounds, 2)
+	assert.True(t, rounds[0].Refunded)
+
+	var iterated []transaction.UserRound
+	require.NoError(t, repo.Iterate(ctx, func(round transaction.UserRound) error {
+		iterated = append(iterated, round)
+		return nil
+	}))
+	assert.ElementsMatch(t, rounds, iterated)
+}
+
+func TestArchiver_ArchiveOnce(t *testing.T) {
+	ctx := context.Background()
+	now := created.Add(48 * time.Hour)
+
+	hot := transaction.NewInMemoryRepository()
+	store, err := Open(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+
+	logger := zerolog.Nop()
+	archiver := NewArchiver(hot, store, []models.TenantID{models.DefaultTenant, "other"}, 24*time.Hour, 2, &logger)
+	archiver.now = func() time.Time { return now }
+
+	var settled []models.RoundID
+	for n := 0; n < 3; n++ {
+		round := settledRound(1, created)
+		require.NoError(t, hot.CreateBet(ctx, round.RoundID, round.Round))
+		settled = append(settled, round.RoundID)
+	}
+
+	otherCtx := tenant.WithTenant(ctx, "other")
+	otherRound := settledRound(1, created)
+	require.NoError(t, hot.CreateBet(otherCtx, otherRound.RoundID, otherRound.Round))
+
+	open := models.RoundID(uuid.New())
+	require.NoError(t, hot.CreateBet(ctx, open, models.Round{UserID: 1, Bet: models.Transaction{Amount: -10, Created: created}}))
+
+	recent := settledRound(1, now.Add(-time.Hour))
+	require.NoError(t, hot.CreateBet(ctx, recent.RoundID, recent.Round))
+
+	moved, err := archiver.ArchiveOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 4, moved)
+
+	for _, roundID := range settled {
+		_, err = hot.GetRound(ctx, roundID)
+		assert.ErrorIs(t, err, transaction.ErrRoundNotFound)
+		assert.True(t, store.Has(ctx, roundID))
+	}
+
+	assert.True(t, store.Has(otherCtx, otherRound.RoundID))
+	assert.False(t, store.Has(ctx, otherRound.RoundID))
+
+	_, err = hot.GetRound(ctx, open)
+	assert.NoError(t, err)
+
+	_, err = hot.GetRound(ctx, recent.RoundID)
+	assert.NoError(t, err)
+
+	moved, err = archiver.ArchiveOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, moved)
+}
+
+// changingRepository - раунд меняют между чтением и удалением архиватором
+type changingRepository struct {
+	*transaction.InMemoryRepository
+	change func(ctx context.Context)
+}
+
+func (r *changingRepository) DeleteRounds(ctx context.Context, rounds []transaction.UserRound) (int, error) {
+	r.change(ctx)
+	r.change = func(context.Context) {}
+
+	return r.InMemoryRepository.DeleteRounds(ctx, rounds)
+}
+
+// раунд, измененный во время переноса, остается в хранилище до следующего прохода
+func TestArchiver_ChangedRound(t *testing.T) {
+	ctx := context.Background()
+	now := created.Add(48 * time.Hour)
+
+	store, err := Open(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+
+	round := settledRound(1, created)
+	round.Win = nil
+
+	refunded := round.Round
+	refunded.Refunded = true
+
+	hot := &changingRepository{InMemoryRepository: transaction.NewInMemoryRepository()}
+	hot.change = func(ctx context.Context) {
+		require.NoError(t, hot.UpdateRound(ctx, round.RoundID, refunded))
+	}
+	require.NoError(t, hot.CreateBet(ctx, round.RoundID, round.Round))
+
+	logger := zerolog.Nop()
+	archiver := NewArchiver(hot, store, []models.TenantID{models.DefaultTenant}, 24*time.Hour, 10, &logger)
+	archiver.now = func() time.Time { return now }
+
+	moved, err := archiver.ArchiveOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, moved)
+
+	stored, err := hot.GetRound(ctx, round.RoundID)
+	require.NoError(t, err)
+	assert.True(t, stored.Refunded)
+
+	moved, err = archiver.ArchiveOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, moved)
+
+	archived, err := store.GetRound(ctx, round.RoundID)
+	require.NoError(t, err)
+	assert.True(t, archived.Refunded)
+}
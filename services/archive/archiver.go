@@ -0,0 +1,113 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/transaction"
+	"github.com/rs/zerolog"
+	"time"
+)
+
+// Archiver - переносит рассчитанные раунды старше minAge из хранилища в архив.
+// Раунд удаляется из хранилища только после записи в архив, поэтому при сбое
+// раунд может оказаться в обоих местах, но не потеряется. Хранилище при этом
+// читается первым, его копия новее архивной
+type Archiver struct {
+	hot       transaction.Archivable
+	archive   *Archive
+	tenants   []models.TenantID
+	minAge    time.Duration
+	batchSize int
+	now       func() time.Time
+	log       *zerolog.Logger
+}
+
+func NewArchiver(
+	hot transaction.Archivable,
+	archive *Archive,
+	tenants []models.TenantID,
+	minAge time.Duration,
+	batchSize int,
+	logger *zerolog.Logger,
+) *Archiver {
+	return &Archiver{
+		hot:       hot,
+		archive:   archive,
+		tenants:   tenants,
+		minAge:    minAge,
+		batchSize: batchSize,
+		now:       time.Now,
+		log:       logger,
+	}
+}
+
+// Run - переносит раунды раз в interval, пока не отменен ctx
+func (a *Archiver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		moved, err := a.ArchiveOnce(ctx)
+		if err != nil {
+			a.log.Error().Err(err).Int("rounds", moved).Msg("failed archive settled rounds")
+		} else if moved > 0 {
+			a.log.Info().Int("rounds", moved).Msg("settled rounds archived")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ArchiveOnce - один проход по всем операторам, возвращает число перенесенных раундов.
+// Ошибка одного оператора не останавливает перенос у остальных
+func (a *Archiver) ArchiveOnce(ctx context.Context) (int, error) {
+	var (
+		total    int
+		firstErr error
+	)
+
+	for _, tenantID := range a.tenants {
+		moved, err := a.archiveTenant(tenant.WithTenant(ctx, tenantID))
+		total += moved
+
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("tenant %s: %w", tenantID, err)
+		}
+	}
+
+	return total, firstErr
+}
+
+// archiveTenant - раунд удаляется из хранилища, только если не изменился
+// после чтения. Измененный раунд остается в хранилище и переносится заново
+// при следующем проходе, архивная копия до этого не читается
+func (a *Archiver) archiveTenant(ctx context.Context) (int, error) {
+	before := a.now().Add(-a.minAge)
+
+	var total int
+	err := a.hot.Settled(ctx, before, a.batchSize, func(rounds []transaction.UserRound) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := a.archive.Put(ctx, rounds); err != nil {
+			return fmt.Errorf("archive.Put: %w", err)
+		}
+
+		deleted, err := a.hot.DeleteRounds(ctx, rounds)
+		total += deleted
+		if err != nil {
+			return fmt.Errorf("delete rounds: %w", err)
+		}
+
+		return nil
+	})
+
+	return total, err
+}
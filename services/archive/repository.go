@@ -0,0 +1,139 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/transaction"
+	"sort"
+)
+
+// Repository - хранилище раундов, которое ищет в архиве раунды,
+// уже перенесенные из основного хранилища
+type Repository struct {
+	hot     transaction.Repository
+	lister  transaction.Lister
+	archive *Archive
+}
+
+func NewRepository(hot transaction.Repository, lister transaction.Lister, archive *Archive) *Repository {
+	return &Repository{
+		hot:     hot,
+		lister:  lister,
+		archive: archive,
+	}
+}
+
+func (r *Repository) GetRound(ctx context.Context, roundID models.RoundID) (*models.Round, error) {
+	round, err := r.hot.GetRound(ctx, roundID)
+	if errors.Is(err, transaction.ErrRoundNotFound) {
+		return r.archive.GetRound(ctx, roundID)
+	}
+
+	return round, err
+}
+
+// CreateBet - идентификатор архивного раунда занят так же, как идентификатор раунда в хранилище
+func (r *Repository) CreateBet(ctx context.Context, roundID models.RoundID, round models.Round) error {
+	if r.archive.Has(ctx, roundID) {
+		return transaction.ErrRoundIdAlreadyExists
+	}
+
+	return r.hot.CreateBet(ctx, roundID, round)
+}
+
+// SetWin - в архив попадают только рассчитанные раунды, поэтому выигрыш
+// в архивный раунд не записывается, ошибка та же, что дало бы хранилище
+func (r *Repository) SetWin(ctx context.Context, roundID models.RoundID, win models.Transaction) error {
+	err := r.hot.SetWin(ctx, roundID, win)
+	if !errors.Is(err, transaction.ErrRoundNotFound) {
+		return err
+	}
+
+	round, err := r.archive.GetRound(ctx, roundID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case round.Win != nil:
+		return transaction.ErrTransactionAlreadyExists
+	case round.Finished:
+		return transaction.ErrRoundFinished
+	default:
+		return transaction.ErrRoundRefundAlreadyExists
+	}
+}
+
+// UpdateRound - архивный раунд (возврат платежа) обновляется в архиве,
+// в хранилище он не возвращается и повторно не переносится
+func (r *Repository) UpdateRound(ctx context.Context, roundID models.RoundID, round models.Round) error {
+	err := r.hot.UpdateRound(ctx, roundID, round)
+	if !errors.Is(err, transaction.ErrRoundNotFound) || !r.archive.Has(ctx, roundID) {
+		return err
+	}
+
+	return r.archive.Put(ctx, []transaction.UserRound{{RoundID: roundID, Round: round}})
+}
+
+// ListByUser - раунды из хранилища и архива, раунд из хранилища новее архивного
+func (r *Repository) ListByUser(ctx context.Context, userID models.UserID) ([]transaction.UserRound, error) {
+	hot, err := r.lister.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	archived, err := r.archive.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[models.RoundID]bool, len(hot))
+	for _, round := range hot {
+		seen[round.RoundID] = true
+	}
+
+	result := hot
+	for _, round := range archived {
+		if !seen[round.RoundID] {
+			result = append(result, round)
+		}
+	}
+
+	sortRounds(result)
+
+	return result, nil
+}
+
+// Iterate - раунды хранилища, затем архивные раунды, которых нет в хранилище
+func (r *Repository) Iterate(ctx context.Context, fn func(round transaction.UserRound) error) error {
+	hot, ok := r.hot.(transaction.Iterator)
+	if !ok {
+		return errors.New("round storage does not support iteration")
+	}
+
+	seen := make(map[models.RoundID]bool)
+
+	err := hot.Iterate(ctx, func(round transaction.UserRound) error {
+		seen[round.RoundID] = true
+		return fn(round)
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.archive.Iterate(ctx, func(round transaction.UserRound) error {
+		if seen[round.RoundID] {
+			return nil
+		}
+
+		return fn(round)
+	})
+}
+
+// sortRounds - по времени ставки, от старых к новым
+func sortRounds(rounds []transaction.UserRound) {
+	sort.Slice(rounds, func(i, j int) bool {
+		return rounds[i].Bet.Created.Before(rounds[j].Bet.Created)
+	})
+}
@@ -0,0 +1,131 @@
+package keyschema
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"strings"
+)
+
+// Schema - префиксы ключей redis по типу сущности,
+// итоговый ключ имеет вид <тип>:<оператор>:<id>
+type Schema struct {
+	// HashTags - ключи пользователей вида <тип>:{<оператор>}:<id>, чтобы в cluster
+	// пользователи оператора были в одном слоте и переименование оставалось атомарным
+	HashTags bool
+	Wallet   string
+	User     string
+	Round    string
+	// UserIndex - индекс UserID -> логин
+	UserIndex string
+	// Sequence - счетчики для выдачи идентификаторов
+	Sequence string
+	Session  string
+	// UserSessions - множество сессий пользователя
+	UserSessions string
+	// Throttle - счетчики неудачных попыток входа
+	Throttle string
+	// Nonce - использованные nonce подписи провайдеров
+	Nonce string
+	// PasswordReset - токены сброса пароля
+	PasswordReset string
+	// LoginChallenge - незавершенные входы со вторым фактором
+	LoginChallenge string
+}
+
+func Default() Schema {
+	return Schema{
+		Wallet:         "wallet",
+		User:           "user",
+		Round:          "round",
+		UserIndex:      "user_id",
+		Sequence:       "seq",
+		Session:        "session",
+		UserSessions:   "user_sessions",
+		Throttle:       "throttle",
+		Nonce:          "nonce",
+		PasswordReset:  "password_reset",
+		LoginChallenge: "login_challenge",
+	}
+}
+
+// families - префиксы всех типов сущностей схемы
+func (s Schema) families() []string {
+	return []string{
+		s.Wallet, s.User, s.Round, s.UserIndex, s.Sequence, s.Session, s.UserSessions,
+		s.Throttle, s.Nonce, s.PasswordReset, s.LoginChallenge,
+	}
+}
+
+// Owns - ключ начинается с префикса одного из типов сущностей схемы
+func (s Schema) Owns(key string) bool {
+	prefix, _, found := strings.Cut(key, ":")
+	if !found {
+		return false
+	}
+
+	for _, family := range s.families() {
+		if family != "" && prefix == family {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s Schema) WalletKey(ctx context.Context, userID models.UserID) string {
+	return s.Wallet + ":" + tenant.Key(ctx, userID.String())
+}
+
+// WalletPrefix - общий префикс ключей кошельков оператора
+func (s Schema) WalletPrefix(ctx context.Context) string {
+	return s.Wallet + ":" + tenant.Key(ctx, "")
+}
+
+func (s Schema) UserKey(ctx context.Context, login string) string {
+	return s.userFamily(ctx, s.User, login)
+}
+
+func (s Schema) UserIndexKey(ctx context.Context, userID models.UserID) string {
+	return s.userFamily(ctx, s.UserIndex, userID.String())
+}
+
+// UserSequenceKey - счетчик UserID оператора
+func (s Schema) UserSequenceKey(ctx context.Context) string {
+	return s.userFamily(ctx, s.Sequence, s.User)
+}
+
+// userFamily - ключи, которые меняются вместе с пользователем
+func (s Schema) userFamily(ctx context.Context, prefix, id string) string {
+	if s.HashTags {
+		return prefix + ":{" + string(tenant.FromContext(ctx)) + "}:" + id
+	}
+
+	return prefix + ":" + tenant.Key(ctx, id)
+}
+
+func (s Schema) SessionKey(ctx context.Context, tokenHash string) string {
+	return s.Session + ":" + tenant.Key(ctx, tokenHash)
+}
+
+func (s Schema) UserSessionsKey(ctx context.Context, userID models.UserID) string {
+	return s.UserSessions + ":" + tenant.Key(ctx, userID.String())
+}
+
+func (s Schema) RoundKey(ctx context.Context, roundID models.RoundID) string {
+	return s.Round + ":" + tenant.Key(ctx, roundID.String())
+}
+
+// RoundPrefix - общий префикс ключей раундов оператора
+func (s Schema) RoundPrefix(ctx context.Context) string {
+	return s.Round + ":" + tenant.Key(ctx, "")
+}
+
+// ThrottleKey - счетчик попыток, key уже содержит оператора
+func (s Schema) ThrottleKey(key string) string {
+	return s.Throttle + ":" + key
+}
+
+func (s Schema) NonceKey(providerID, nonce string) string {
+	return s.Nonce + ":" + providerID + ":" + nonce
+}
@@ -0,0 +1,274 @@
+package keyschema
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/go-redis/redis/v8"
+	"github.com/gofrs/uuid"
+	"strconv"
+	"strings"
+)
+
+const scanCount = 500
+
+// MigrateResult - итог переноса ключей
+type MigrateResult struct {
+	Wallets   int
+	Users     int
+	Rounds    int
+	Skipped   int
+	Conflicts []string
+}
+
+// Migrate - переименовывает ключи без префикса типа в ключи схемы.
+// Поддерживаются ключи без оператора (<id>) и ключи вида <оператор>:<id>.
+// Тип сущности определяется по значению, т.к. по ключу wallet "5"
+// и пользователь с логином "5" неразличимы. TTL ключей сохраняется.
+// Для перенесенных пользователей строится индекс UserID -> логин,
+// а счетчик UserID поднимается до максимального найденного значения.
+// В cluster ключей старого формата нет, а RENAME между слотами невозможен,
+// поэтому перенос там не поддерживается
+func Migrate(
+	ctx context.Context,
+	client redis.UniversalClient,
+	schema Schema,
+	tenants []models.TenantID,
+	dryRun bool,
+) (*MigrateResult, error) {
+	if _, ok := client.(*redis.ClusterClient); ok {
+		return nil, errors.New("key migration is not supported in redis cluster")
+	}
+
+	m := &migrator{
+		client: client,
+		schema: schema,
+		known:  make(map[models.TenantID]bool, len(tenants)),
+		dryRun: dryRun,
+		maxIDs: make(map[models.TenantID]models.UserID),
+		result: &MigrateResult{},
+	}
+
+	for _, id := range tenants {
+		m.known[id] = true
+	}
+
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(ctx, cursor, "*", scanCount).Result()
+		if err != nil {
+			return nil, fmt.Errorf("redis.Scan: %w", err)
+		}
+
+		for _, key := range keys {
+			err = m.migrateKey(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if !dryRun {
+		for tenantID, maxID := range m.maxIDs {
+			err := m.raiseSequence(tenant.WithTenant(ctx, tenantID), maxID)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return m.result, nil
+}
+
+type migrator struct {
+	client redis.UniversalClient
+	schema Schema
+	known  map[models.TenantID]bool
+	dryRun bool
+	maxIDs map[models.TenantID]models.UserID
+	result *MigrateResult
+}
+
+func (m *migrator) migrateKey(ctx context.Context, key string) error {
+	// ключи схемы уже перенесены или созданы в новом формате
+	if m.schema.Owns(key) {
+		m.result.Skipped++
+		return nil
+	}
+
+	value, err := m.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) || strings.Contains(err.Error(), "WRONGTYPE") {
+			m.result.Skipped++
+			return nil
+		}
+
+		return fmt.Errorf("redis.Get: %w", err)
+	}
+
+	tenantID, id := splitKey(key, m.known)
+	tenantCtx := tenant.WithTenant(ctx, tenantID)
+
+	var (
+		newKey  string
+		counter *int
+		user    *models.User
+	)
+
+	switch kind(value) {
+	case kindWallet:
+		userID, err := strconv.Atoi(id)
+		if err != nil {
+			m.result.Skipped++
+			return nil
+		}
+
+		newKey, counter = m.schema.WalletKey(tenantCtx, models.UserID(userID)), &m.result.Wallets
+	case kindRound:
+		roundID, err := uuid.FromString(id)
+		if err != nil {
+			m.result.Skipped++
+			return nil
+		}
+
+		newKey, counter = m.schema.RoundKey(tenantCtx, roundID), &m.result.Rounds
+	case kindUser:
+		user = new(models.User)
+		if err = json.Unmarshal(value, user); err != nil || user.Login != id {
+			m.result.Skipped++
+			return nil
+		}
+
+		newKey, counter = m.schema.UserKey(tenantCtx, user.Login), &m.result.Users
+	default:
+		m.result.Skipped++
+		return nil
+	}
+
+	if newKey == key {
+		m.result.Skipped++
+		return nil
+	}
+
+	if m.dryRun {
+		*counter++
+		return nil
+	}
+
+	// RENAMENX сохраняет TTL и не перезаписывает существующий ключ
+	renamed, err := m.client.RenameNX(ctx, key, newKey).Result()
+	if err != nil {
+		return fmt.Errorf("redis.RenameNX: %w", err)
+	}
+
+	if !renamed {
+		m.result.Conflicts = append(m.result.Conflicts, key)
+		return nil
+	}
+
+	*counter++
+
+	if user != nil {
+		return m.indexUser(tenantCtx, newKey, user)
+	}
+
+	return nil
+}
+
+func (m *migrator) indexUser(ctx context.Context, userKey string, user *models.User) error {
+	ttl, err := m.client.PTTL(ctx, userKey).Result()
+	if err != nil {
+		return fmt.Errorf("redis.PTTL: %w", err)
+	}
+
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	err = m.client.SetNX(ctx, m.schema.UserIndexKey(ctx, user.ID), user.Login, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("redis.SetNX: %w", err)
+	}
+
+	tenantID := tenant.FromContext(ctx)
+	if user.ID > m.maxIDs[tenantID] {
+		m.maxIDs[tenantID] = user.ID
+	}
+
+	return nil
+}
+
+// raiseSequence - счетчик не должен выдавать уже занятые UserID
+func (m *migrator) raiseSequence(ctx context.Context, maxID models.UserID) error {
+	key := m.schema.UserSequenceKey(ctx)
+
+	current, err := m.client.Get(ctx, key).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("redis.Get: %w", err)
+	}
+
+	if current >= int64(maxID) {
+		return nil
+	}
+
+	err = m.client.Set(ctx, key, int64(maxID), 0).Err()
+	if err != nil {
+		return fmt.Errorf("redis.Set: %w", err)
+	}
+
+	return nil
+}
+
+// splitKey - выделяет оператора из ключа вида <оператор>:<id>
+func splitKey(key string, known map[models.TenantID]bool) (models.TenantID, string) {
+	prefix, id, found := strings.Cut(key, ":")
+	if found && known[models.TenantID(prefix)] {
+		return models.TenantID(prefix), id
+	}
+
+	return models.DefaultTenant, key
+}
+
+type valueKind int
+
+const (
+	kindUnknown valueKind = iota
+	kindWallet
+	kindUser
+	kindRound
+)
+
+func kind(value []byte) valueKind {
+	value = bytes.TrimSpace(value)
+
+	var balance models.Balance
+	if json.Unmarshal(value, &balance) == nil {
+		return kindWallet
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(value, &fields) != nil {
+		return kindUnknown
+	}
+
+	if _, ok := fields["bet"]; ok {
+		if _, ok = fields["user_id"]; ok {
+			return kindRound
+		}
+	}
+
+	if _, ok := fields["Login"]; ok {
+		return kindUser
+	}
+
+	return kindUnknown
+}
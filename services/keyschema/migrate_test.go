@@ -0,0 +1,90 @@
+package keyschema
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMigrate(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := context.Background()
+	brandCtx := tenant.WithTenant(ctx, "brand")
+	schema := Default()
+
+	client := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	roundID := uuid.Must(uuid.FromString("123e4567-e89b-12d3-a456-426614174000"))
+
+	userJSON, err := json.Marshal(models.User{ID: 1, Login: "5", Password: []byte("hash")})
+	require.NoError(t, err)
+
+	roundJSON, err := json.Marshal(models.Round{UserID: 5, Bet: models.Transaction{Amount: -10}})
+	require.NoError(t, err)
+
+	// кошелек 5 и пользователь с логином "5" из разных операторов
+	require.NoError(t, client.Set(ctx, "5", "100", time.Hour).Err())
+	require.NoError(t, client.Set(ctx, "brand:5", userJSON, 0).Err())
+	require.NoError(t, client.Set(ctx, roundID.String(), roundJSON, 0).Err())
+	require.NoError(t, client.Set(ctx, "nonce:provider:abc", 1, 0).Err())
+	require.NoError(t, client.Set(ctx, "password_reset:default:hash", 5, 0).Err())
+	require.NoError(t, client.Set(ctx, schema.WalletKey(ctx, 7), "1", 0).Err())
+
+	tenants := []models.TenantID{models.DefaultTenant, "brand"}
+
+	dry, err := Migrate(ctx, client, schema, tenants, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, dry.Wallets)
+	assert.True(t, s.Exists("5"))
+
+	result, err := Migrate(ctx, client, schema, tenants, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Wallets)
+	assert.Equal(t, 1, result.Users)
+	assert.Equal(t, 1, result.Rounds)
+	assert.Empty(t, result.Conflicts)
+
+	balance, err := client.Get(ctx, schema.WalletKey(ctx, 5)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, "100", balance)
+	assert.Greater(t, s.TTL(schema.WalletKey(ctx, 5)), time.Duration(0))
+
+	assert.True(t, s.Exists(schema.UserKey(brandCtx, "5")))
+	login, err := client.Get(ctx, schema.UserIndexKey(brandCtx, 1)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, "5", login)
+	seq, err := client.Get(ctx, schema.UserSequenceKey(brandCtx)).Int()
+	require.NoError(t, err)
+	assert.Equal(t, 1, seq)
+	assert.True(t, s.Exists(schema.RoundKey(ctx, roundID)))
+	assert.True(t, s.Exists("nonce:provider:abc"))
+	assert.True(t, s.Exists("password_reset:default:hash"))
+
+	again, err := Migrate(ctx, client, schema, tenants, false)
+	require.NoError(t, err)
+	assert.Zero(t, again.Wallets+again.Users+again.Rounds)
+}
+
+func TestSchema_Owns(t *testing.T) {
+	schema := Default()
+	schema.LoginChallenge = "challenge"
+
+	assert.True(t, schema.Owns("challenge:default:hash"))
+	assert.True(t, schema.Owns(schema.ThrottleKey("login:default:user01")))
+	assert.False(t, schema.Owns("login_challenge:default:hash"))
+	assert.False(t, schema.Owns("brand:5"))
+	assert.False(t, schema.Owns("5"))
+}
@@ -0,0 +1,83 @@
+package keyschema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"sync"
+)
+
+// Scan - перебирает ключи по шаблону пачками. В cluster SCAN видит только
+// ключи своего узла, поэтому обходятся все мастера; fn вызывается
+// последовательно, но порядок пачек разных узлов не определен
+func Scan(ctx context.Context, client redis.UniversalClient, match string, fn func(keys []string) error) error {
+	cluster, ok := client.(*redis.ClusterClient)
+	if !ok {
+		return scanNode(ctx, client, match, fn)
+	}
+
+	var mu sync.Mutex
+
+	return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		return scanNode(ctx, node, match, func(keys []string) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return fn(keys)
+		})
+	})
+}
+
+func scanNode(ctx context.Context, client redis.Cmdable, match string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(ctx, cursor, match, scanCount).Result()
+		if err != nil {
+			return fmt.Errorf("redis.Scan: %w", err)
+		}
+
+		if len(keys) > 0 {
+			if err = fn(keys); err != nil {
+				return err
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// GetAll - значения ключей в порядке keys, nil для отсутствующих. В отличие
+// от MGet работает с ключами из разных слотов cluster
+func GetAll(ctx context.Context, client redis.UniversalClient, keys []string) ([]*string, error) {
+	cmds := make([]*redis.StringCmd, len(keys))
+
+	_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("redis.Pipelined: %w", err)
+	}
+
+	values := make([]*string, len(keys))
+	for i, cmd := range cmds {
+		value, err := cmd.Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("redis.Get: %w", err)
+		}
+
+		values[i] = &value
+	}
+
+	return values, nil
+}
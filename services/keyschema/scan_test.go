@@ -0,0 +1,90 @@
+package keyschema
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := context.Background()
+
+	// miniredis отвечает на CLUSTER SLOTS как кластер из одного узла
+	clients := map[string]redis.UniversalClient{
+		"standalone": redis.NewClient(&redis.Options{Addr: s.Addr()}),
+		"cluster":    redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{s.Addr()}}),
+	}
+
+	for n := 0; n < 1200; n++ {
+		s.Set("round:default:"+strconv.Itoa(n), strconv.Itoa(n))
+	}
+	s.Set("wallet:default:1", "100")
+
+	for name, client := range clients {
+		t.Run(name, func(t *testing.T) {
+			var keys []string
+			err := Scan(ctx, client, "round:*", func(batch []string) error {
+				keys = append(keys, batch...)
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Len(t, keys, 1200)
+
+			values, err := GetAll(ctx, client, []string{"round:default:7", "round:default:missing", "wallet:default:1"})
+			require.NoError(t, err)
+			require.Len(t, values, 3)
+			assert.Equal(t, "7", *values[0])
+			assert.Nil(t, values[1])
+			assert.Equal(t, "100", *values[2])
+		})
+	}
+
+	_, err = Migrate(ctx, clients["cluster"], Default(), nil, true)
+	assert.Error(t, err)
+}
+
+func TestSchema_HashTags(t *testing.T) {
+	ctx := tenant.WithTenant(context.Background(), "brand")
+
+	schema := Default()
+	assert.Equal(t, "user:brand:bob", schema.UserKey(ctx, "bob"))
+	assert.Equal(t, "user_id:brand:1", schema.UserIndexKey(ctx, 1))
+	assert.Equal(t, "seq:brand:user", schema.UserSequenceKey(ctx))
+
+	schema.HashTags = true
+	keys := []string{schema.UserKey(ctx, "bob"), schema.UserIndexKey(ctx, 1), schema.UserSequenceKey(ctx)}
+	assert.Equal(t, []string{"user:{brand}:bob", "user_id:{brand}:1", "seq:{brand}:user"}, keys)
+
+	// ключи пользователей оператора попадают в один слот cluster
+	for _, key := range keys {
+		assert.Equal(t, slot(keys[0]), slot(key))
+	}
+
+	// кошельки и раунды не привязаны к слоту оператора
+	assert.Equal(t, "wallet:brand:1", schema.WalletKey(ctx, 1))
+}
+
+// slot - часть ключа, по которой cluster выбирает слот
+func slot(key string) string {
+	start := -1
+	for i, c := range key {
+		if c == '{' && start < 0 {
+			start = i
+		}
+
+		if c == '}' && start >= 0 && i > start+1 {
+			return key[start+1 : i]
+		}
+	}
+
+	return key
+}
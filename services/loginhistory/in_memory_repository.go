@@ -0,0 +1,71 @@
+package loginhistory
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"sync"
+)
+
+type InMemoryRepository struct {
+	mu      sync.Mutex
+	entries map[models.TenantID]map[models.UserID][]Entry
+	size    int
+}
+
+func NewInMemoryRepository(size int) *InMemoryRepository {
+	return &InMemoryRepository{
+		entries: make(map[models.TenantID]map[models.UserID][]Entry),
+		size:    size,
+	}
+}
+
+func (i *InMemoryRepository) Add(ctx context.Context, entry Entry) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	tenantID := tenant.FromContext(ctx)
+
+	users, ok := i.entries[tenantID]
+	if !ok {
+		users = make(map[models.UserID][]Entry)
+		i.entries[tenantID] = users
+	}
+
+	entries := append(users[entry.UserID], entry)
+	if len(entries) > i.size {
+		entries = entries[len(entries)-i.size:]
+	}
+	users[entry.UserID] = entries
+
+	return nil
+}
+
+func (i *InMemoryRepository) List(
+	ctx context.Context,
+	userID models.UserID,
+	offset, limit int,
+) ([]Entry, int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// записи хранятся от старых к новым
+	entries := i.entries[tenant.FromContext(ctx)][userID]
+	total := len(entries)
+
+	result := make([]Entry, 0, limit)
+	for n := total - 1 - offset; n >= 0 && len(result) < limit; n-- {
+		result = append(result, entries[n])
+	}
+
+	return result, total, nil
+}
+
+func (i *InMemoryRepository) DeleteByUser(ctx context.Context, userID models.UserID) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delete(i.entries[tenant.FromContext(ctx)], userID)
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package loginhistory
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/models"
+	"time"
+)
+
+// DefaultSize - сколько последних попыток входа хранится на пользователя
+const DefaultSize = 1000
+
+// Entry - попытка входа пользователя
+type Entry struct {
+	UserID    models.UserID `json:"user_id"`
+	Success   bool          `json:"success"`
+	Reason    string        `json:"reason,omitempty"`
+	IP        string        `json:"ip"`
+	UserAgent string        `json:"user_agent"`
+	At        time.Time     `json:"at"`
+}
+
+type Repository interface {
+	// Add - сохраняет попытку, самые старые записи сверх размера истории удаляются
+	Add(ctx context.Context, entry Entry) error
+	// List - записи от новых к старым и общее количество записей
+	List(ctx context.Context, userID models.UserID, offset, limit int) ([]Entry, int, error)
+	DeleteByUser(ctx context.Context, userID models.UserID) error
+}
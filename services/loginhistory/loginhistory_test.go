@@ -0,0 +1,78 @@
+package loginhistory
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRepository(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	client := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	repositories := map[string]Repository{
+		"in memory": NewInMemoryRepository(3),
+		"redis":     NewRedisRepository(client, 3),
+	}
+
+	at := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	for name, repo := range repositories {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			for n := 0; n < 5; n++ {
+				err := repo.Add(ctx, Entry{
+					UserID:  1,
+					Success: n%2 == 0,
+					IP:      "10.0.0.1",
+					At:      at.Add(time.Duration(n) * time.Minute),
+				})
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, repo.Add(ctx, Entry{UserID: 2, At: at}))
+
+			entries, total, err := repo.List(ctx, 1, 0, 2)
+			require.NoError(t, err)
+			assert.Equal(t, 3, total)
+			require.Len(t, entries, 2)
+			assert.Equal(t, at.Add(4*time.Minute), entries[0].At)
+			assert.Equal(t, at.Add(3*time.Minute), entries[1].At)
+
+			entries, _, err = repo.List(ctx, 1, 2, 2)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, at.Add(2*time.Minute), entries[0].At)
+
+			entries, _, err = repo.List(ctx, 1, 5, 2)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+
+			entries, total, err = repo.List(tenant.WithTenant(ctx, "brand"), 1, 0, 10)
+			require.NoError(t, err)
+			assert.Zero(t, total)
+			assert.Empty(t, entries)
+
+			require.NoError(t, repo.DeleteByUser(ctx, 1))
+
+			_, total, err = repo.List(ctx, 1, 0, 10)
+			require.NoError(t, err)
+			assert.Zero(t, total)
+
+			_, total, err = repo.List(ctx, 2, 0, 10)
+			require.NoError(t, err)
+			assert.Equal(t, 1, total)
+		})
+	}
+}
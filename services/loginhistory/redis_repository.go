@@ -0,0 +1,91 @@
+package loginhistory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/go-redis/redis/v8"
+	"strconv"
+)
+
+type RedisRepository struct {
+	client redis.UniversalClient
+	size   int
+}
+
+func NewRedisRepository(client redis.UniversalClient, size int) *RedisRepository {
+	return &RedisRepository{
+		client: client,
+		size:   size,
+	}
+}
+
+func (r *RedisRepository) Add(ctx context.Context, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	key := historyKey(ctx, entry.UserID)
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, key, data)
+		pipe.LTrim(ctx, key, 0, int64(r.size-1))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("redis.TxPipelined: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisRepository) List(
+	ctx context.Context,
+	userID models.UserID,
+	offset, limit int,
+) ([]Entry, int, error) {
+	key := historyKey(ctx, userID)
+
+	var (
+		total *redis.IntCmd
+		items *redis.StringSliceCmd
+	)
+
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		total = pipe.LLen(ctx, key)
+		items = pipe.LRange(ctx, key, int64(offset), int64(offset+limit-1))
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("redis.TxPipelined: %w", err)
+	}
+
+	entries := make([]Entry, 0, len(items.Val()))
+	for _, data := range items.Val() {
+		entry := Entry{}
+		if err = json.Unmarshal([]byte(data), &entry); err != nil {
+			return nil, 0, fmt.Errorf("json.Unmarshal: %w", err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, int(total.Val()), nil
+}
+
+func (r *RedisRepository) DeleteByUser(ctx context.Context, userID models.UserID) error {
+	err := r.client.Del(ctx, historyKey(ctx, userID)).Err()
+	if err != nil {
+		return fmt.Errorf("redis.Del: %w", err)
+	}
+
+	return nil
+}
+
+// historyKey - список попыток входа пользователя, новые в начале
+func historyKey(ctx context.Context, userID models.UserID) string {
+	return "login_history:" + tenant.Key(ctx, strconv.Itoa(int(userID)))
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/rs/zerolog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Message - сообщение пользователю, To - адрес доставки
+type Message struct {
+	UserID   models.UserID   `json:"user_id"`
+	TenantID models.TenantID `json:"tenant_id"`
+	To       string          `json:"to"`
+	Subject  string          `json:"subject"`
+	Text     string          `json:"text"`
+}
+
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogNotifier - пишет сообщения в лог, для локальной разработки
+type LogNotifier struct {
+	log *zerolog.Logger
+}
+
+func NewLogNotifier(logger *zerolog.Logger) *LogNotifier {
+	return &LogNotifier{
+		log: logger,
+	}
+}
+
+func (l *LogNotifier) Send(_ context.Context, msg Message) error {
+	l.log.Info().
+		Int("userID", int(msg.UserID)).
+		Str("tenant", string(msg.TenantID)).
+		Str("to", msg.To).
+		Str("subject", msg.Subject).
+		Msg(msg.Text)
+
+	return nil
+}
+
+// FileNotifier - дописывает сообщения в файл построчно в JSON
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+	now  func() time.Time
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{
+		path: path,
+		now:  time.Now,
+	}
+}
+
+func (f *FileNotifier) Send(_ context.Context, msg Message) error {
+	line, err := json.Marshal(struct {
+		Message
+		SentAt time.Time `json:"sent_at"`
+	}{
+		Message: msg,
+		SentAt:  f.now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open notifications file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("write notification: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package onetime
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"sync"
+	"time"
+)
+
+type token struct {
+	userID   models.UserID
+	expireAt time.Time
+}
+
+type InMemoryRepository struct {
+	mu     sync.Mutex
+	tokens map[string]token
+	now    func() time.Time
+}
+
+func NewInMemoryRepository() *InMemoryRepository {
+	return &InMemoryRepository{
+		tokens: make(map[string]token),
+		now:    time.Now,
+	}
+}
+
+func (i *InMemoryRepository) Save(
+	ctx context.Context,
+	tokenHash string,
+	userID models.UserID,
+	ttl time.Duration,
+) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := i.now()
+	i.cleanup(now)
+
+	i.tokens[tenant.Key(ctx, tokenHash)] = token{
+		userID:   userID,
+		expireAt: now.Add(ttl),
+	}
+
+	return nil
+}
+
+func (i *InMemoryRepository) Peek(ctx context.Context, tokenHash string) (models.UserID, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.cleanup(i.now())
+
+	t, ok := i.tokens[tenant.Key(ctx, tokenHash)]
+	if !ok {
+		return 0, ErrTokenNotFound
+	}
+
+	return t.userID, nil
+}
+
+func (i *InMemoryRepository) Take(ctx context.Context, tokenHash string) (models.UserID, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.cleanup(i.now())
+
+	key := tenant.Key(ctx, tokenHash)
+	t, ok := i.tokens[key]
+	if !ok {
+		return 0, ErrTokenNotFound
+	}
+
+	delete(i.tokens, key)
+
+	return t.userID, nil
+}
+
+// cleanup - удаляет просроченные токены
+func (i *InMemoryRepository) cleanup(now time.Time) {
+	for key, t := range i.tokens {
+		if !now.Before(t.expireAt) {
+			delete(i.tokens, key)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package onetime
+
+import (
+	"context"
+	"errors"
+	"github.com/IlnurShafikov/wallet/models"
+	"time"
+)
+
+var ErrTokenNotFound = errors.New("token not found")
+
+// Repository - одноразовые токены пользователя с ограниченным сроком жизни:
+// сброс пароля, подтверждение входа. Хранятся только хеши.
+type Repository interface {
+	Save(ctx context.Context, tokenHash string, userID models.UserID, ttl time.Duration) error
+	// Peek - возвращает пользователя, не удаляя токен
+	Peek(ctx context.Context, tokenHash string) (models.UserID, error)
+	// Take - возвращает пользователя и удаляет токен
+	Take(ctx context.Context, tokenHash string) (models.UserID, error)
+}
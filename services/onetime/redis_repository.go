@@ -0,0 +1,66 @@
+package onetime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/go-redis/redis/v8"
+	"time"
+)
+
+type RedisRepository struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisRepository - prefix из keyschema.Schema отделяет токены разного назначения
+func NewRedisRepository(client redis.UniversalClient, prefix string) *RedisRepository {
+	return &RedisRepository{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (r *RedisRepository) Save(
+	ctx context.Context,
+	tokenHash string,
+	userID models.UserID,
+	ttl time.Duration,
+) error {
+	err := r.client.Set(ctx, r.key(ctx, tokenHash), int(userID), ttl).Err()
+	if err != nil {
+		return fmt.Errorf("redis.Set: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisRepository) Peek(ctx context.Context, tokenHash string) (models.UserID, error) {
+	userID, err := r.client.Get(ctx, r.key(ctx, tokenHash)).Int()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, ErrTokenNotFound
+		}
+		return 0, fmt.Errorf("redis.Get: %w", err)
+	}
+
+	return models.UserID(userID), nil
+}
+
+func (r *RedisRepository) Take(ctx context.Context, tokenHash string) (models.UserID, error) {
+	userID, err := r.client.GetDel(ctx, r.key(ctx, tokenHash)).Int()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, ErrTokenNotFound
+		}
+		return 0, fmt.Errorf("redis.GetDel: %w", err)
+	}
+
+	return models.UserID(userID), nil
+}
+
+func (r *RedisRepository) key(ctx context.Context, tokenHash string) string {
+	return r.prefix + ":" + tenant.Key(ctx, tokenHash)
+}
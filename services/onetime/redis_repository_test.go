@@ -0,0 +1,49 @@
+package onetime
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisRepository_Take(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := context.Background()
+
+	client := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	repo := NewRedisRepository(client, keyschema.Default().PasswordReset)
+
+	require.NoError(t, repo.Save(ctx, "hash1", 7, time.Minute))
+	require.NoError(t, repo.Save(ctx, "hash2", 8, time.Minute))
+
+	// Peek не расходует токен
+	userID, err := repo.Peek(ctx, "hash1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 7, userID)
+
+	userID, err = repo.Take(ctx, "hash1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 7, userID)
+
+	_, err = repo.Take(ctx, "hash1")
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+
+	_, err = repo.Peek(ctx, "hash1")
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+
+	s.FastForward(2 * time.Minute)
+
+	_, err = repo.Take(ctx, "hash2")
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+}
@@ -0,0 +1,124 @@
+package passwordpolicy
+
+import (
+	_ "embed"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+var (
+	commonPasswords = parseCommonPasswords(commonPasswordsFile)
+	loginFormat     = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+)
+
+// Policy - требования к логину и паролю
+type Policy struct {
+	MinLength     int
+	MaxLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// RejectCommon - запрет паролей из списка распространенных
+	RejectCommon   bool
+	LoginMinLength int
+	LoginMaxLength int
+}
+
+// ValidateLogin - логин из латинских букв, цифр и ._- начинается с буквы или цифры
+func (p Policy) ValidateLogin(login string) []apierror.FieldError {
+	const field = "login"
+
+	var errs []apierror.FieldError
+
+	length := utf8.RuneCountInString(login)
+	if length < p.LoginMinLength {
+		errs = append(errs, fieldError(field, "too_short", "must be at least %d characters", p.LoginMinLength))
+	}
+
+	if length > p.LoginMaxLength {
+		errs = append(errs, fieldError(field, "too_long", "must be at most %d characters", p.LoginMaxLength))
+	}
+
+	if login != "" && !loginFormat.MatchString(login) {
+		errs = append(errs, fieldError(field, "invalid_format", "may contain only latin letters, digits and ._-"))
+	}
+
+	return errs
+}
+
+// ValidatePassword - field - имя поля запроса с паролем
+func (p Policy) ValidatePassword(field, login, password string) []apierror.FieldError {
+	var errs []apierror.FieldError
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		errs = append(errs, fieldError(field, "too_short", "must be at least %d characters", p.MinLength))
+	}
+
+	if p.MaxLength > 0 && length > p.MaxLength {
+		errs = append(errs, fieldError(field, "too_long", "must be at most %d characters", p.MaxLength))
+	}
+
+	classes := []struct {
+		required bool
+		is       func(r rune) bool
+		code     string
+		message  string
+	}{
+		{p.RequireLower, unicode.IsLower, "missing_lower", "must contain a lowercase letter"},
+		{p.RequireUpper, unicode.IsUpper, "missing_upper", "must contain an uppercase letter"},
+		{p.RequireDigit, unicode.IsDigit, "missing_digit", "must contain a digit"},
+		{p.RequireSymbol, isSymbol, "missing_symbol", "must contain a symbol"},
+	}
+
+	for _, class := range classes {
+		if class.required && strings.IndexFunc(password, class.is) < 0 {
+			errs = append(errs, fieldError(field, class.code, class.message))
+		}
+	}
+
+	lower := strings.ToLower(password)
+	if p.RejectCommon && commonPasswords[lower] {
+		errs = append(errs, fieldError(field, "too_common", "is too common"))
+	}
+
+	if login != "" && strings.Contains(lower, strings.ToLower(login)) {
+		errs = append(errs, fieldError(field, "contains_login", "must not contain the login"))
+	}
+
+	return errs
+}
+
+func isSymbol(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+func fieldError(field, code, format string, args ...any) apierror.FieldError {
+	return apierror.FieldError{
+		Field:   field,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func parseCommonPasswords(file string) map[string]bool {
+	passwords := make(map[string]bool)
+	for _, line := range strings.Split(file, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		passwords[strings.ToLower(line)] = true
+	}
+
+	return passwords
+}
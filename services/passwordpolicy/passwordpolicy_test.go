@@ -0,0 +1,88 @@
+package passwordpolicy
+
+import (
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func fieldCodes(errs []apierror.FieldError) []string {
+	var codes []string
+	for _, err := range errs {
+		codes = append(codes, err.Code)
+	}
+
+	return codes
+}
+
+var testPolicy = Policy{
+	MinLength:      8,
+	MaxLength:      128,
+	RequireLower:   true,
+	RequireUpper:   true,
+	RequireDigit:   true,
+	RejectCommon:   true,
+	LoginMinLength: 3,
+	LoginMaxLength: 32,
+}
+
+func TestPolicy_ValidatePassword(t *testing.T) {
+	policy := testPolicy
+
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		expCodes []string
+	}{
+		{
+			name:     "valid",
+			login:    "user01",
+			password: "Tr0ub4dor",
+		},
+		{
+			name:     "empty",
+			login:    "user01",
+			password: "",
+			expCodes: []string{"too_short", "missing_lower", "missing_upper", "missing_digit"},
+		},
+		{
+			name:     "common password in any case",
+			login:    "user01",
+			password: "Password123",
+			expCodes: []string{"too_common"},
+		},
+		{
+			name:     "contains login",
+			login:    "Ilnur",
+			password: "myILNUR2024",
+			expCodes: []string{"contains_login"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			errs := policy.ValidatePassword("password", tc.login, tc.password)
+			assert.Equal(t, tc.expCodes, fieldCodes(errs))
+
+			for _, err := range errs {
+				assert.Equal(t, "password", err.Field)
+			}
+		})
+	}
+
+	policy.RequireSymbol = true
+	assert.Equal(t, []string{"missing_symbol"}, fieldCodes(policy.ValidatePassword("password", "user01", "Tr0ub4dor")))
+	assert.Empty(t, policy.ValidatePassword("password", "user01", "Tr0ub4dor!"))
+}
+
+func TestPolicy_ValidateLogin(t *testing.T) {
+	policy := testPolicy
+
+	assert.Empty(t, policy.ValidateLogin("user.name_01"))
+	assert.Equal(t, []string{"too_short"}, fieldCodes(policy.ValidateLogin("")))
+	assert.Equal(t, []string{"too_short"}, fieldCodes(policy.ValidateLogin("ab")))
+	assert.Equal(t, []string{"invalid_format"}, fieldCodes(policy.ValidateLogin("_user")))
+	assert.Equal(t, []string{"invalid_format"}, fieldCodes(policy.ValidateLogin("user name")))
+	assert.Equal(t, []string{"too_long"}, fieldCodes(policy.ValidateLogin("a123456789012345678901234567890123")))
+}
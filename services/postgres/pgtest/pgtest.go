@@ -0,0 +1,31 @@
+package pgtest
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/postgres"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"os"
+	"testing"
+)
+
+// Open - пул к базе из POSTGRES_TEST_DSN, без переменной тест пропускается.
+// Контекст несет нового оператора, поэтому тесты не мешают друг другу и база не очищается
+func Open(t testing.TB) (*pgxpool.Pool, context.Context) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+
+	db, err := postgres.Open(context.Background(), dsn, postgres.Pool{MaxConns: 10})
+	if err != nil {
+		t.Fatalf("postgres.Open: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	ctx := tenant.WithTenant(context.Background(), models.TenantID("test-"+uuid.Must(uuid.NewV4()).String()))
+
+	return db, ctx
+}
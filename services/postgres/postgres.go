@@ -0,0 +1,122 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/services/sqlschema"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// migrationLock - ключ pg_advisory_lock, чтобы миграции при одновременном
+// старте нескольких экземпляров применялись один раз
+const migrationLock = 7_304_112
+
+// uniqueViolation - код ошибки нарушения PRIMARY KEY или UNIQUE индекса
+const uniqueViolation = "23505"
+
+// Pool - настройки пула соединений, нулевые значения оставляют настройки pgx
+type Pool struct {
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+}
+
+// Open - создает пул соединений и применяет миграции
+func Open(ctx context.Context, dsn string, pool Pool) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("pgxpool.ParseConfig: %w", err)
+	}
+
+	if pool.MaxConns > 0 {
+		cfg.MaxConns = pool.MaxConns
+	}
+
+	if pool.MinConns > 0 {
+		cfg.MinConns = pool.MinConns
+	}
+
+	if pool.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = pool.MaxConnLifetime
+	}
+
+	if pool.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = pool.MaxConnIdleTime
+	}
+
+	db, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("pgxpool.New: %w", err)
+	}
+
+	if err = db.Ping(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("pgxpool.Ping: %w", err)
+	}
+
+	if err = Migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Migrate - применяет по порядку миграции sqlschema, которых нет в schema_migrations
+func Migrate(ctx context.Context, db *pgxpool.Pool) error {
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("pgxpool.Acquire: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLock); err != nil {
+		return fmt.Errorf("lock migrations: %w", err)
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLock)
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	return sqlschema.Migrate(ctx, sqlschema.Postgres, conn.Begin, apply)
+}
+
+func apply(ctx context.Context, tx pgx.Tx, migration sqlschema.Migration) error {
+	var applied bool
+	err := tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`,
+		migration.Version,
+	).Scan(&applied)
+	if err != nil || applied {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, migration.Script); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, migration.Version)
+
+	return err
+}
+
+// InTx - выполняет fn в транзакции, при ошибке транзакция откатывается
+func InTx(ctx context.Context, db *pgxpool.Pool, fn func(tx pgx.Tx) error) error {
+	return sqlschema.InTx(ctx, db.Begin, fn)
+}
+
+// IsUniqueViolation - нарушение PRIMARY KEY или UNIQUE индекса
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
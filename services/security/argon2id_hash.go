@@ -0,0 +1,181 @@
+package security
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// Границы параметров, прочитанных из хеша: измененная запись не должна
+// заставить сервер выделить гигабайты памяти на одну попытку входа.
+// Параметры из конфигурации разрешены всегда, даже если больше границ
+const (
+	maxArgon2Memory      = 256 * 1024
+	maxArgon2Iterations  = 16
+	maxArgon2Parallelism = 16
+	minArgon2SaltLength  = 8
+	minArgon2KeyLength   = 16
+	maxArgon2KeyLength   = 64
+)
+
+var (
+	ErrMismatchedPassword = errors.New("password does not match")
+	ErrInvalidHash        = errors.New("invalid password hash")
+)
+
+// Argon2Params - параметры argon2id, сохраняются в самом хеше
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func DefaultArgon2Params() Argon2Params {
+	return Argon2Params{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+// Argon2idHashing - хеш в формате $argon2id$v=19$m=65536,t=3,p=2$<соль>$<ключ>.
+// Секрет подмешивается через HMAC, поэтому длина пароля не ограничена.
+type Argon2idHashing struct {
+	secret string
+	params Argon2Params
+}
+
+var _ = Algorithm(&Argon2idHashing{})
+
+func NewArgon2idHashing(secret string, params Argon2Params) *Argon2idHashing {
+	return &Argon2idHashing{
+		secret: secret,
+		params: params,
+	}
+}
+
+func (a *Argon2idHashing) HashPassword(password string) ([]byte, error) {
+	salt := make([]byte, a.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+
+	key := argon2.IDKey(a.pepper(password), salt, a.params.Iterations, a.params.Memory, a.params.Parallelism, a.params.KeyLength)
+
+	encoded := fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		a.params.Memory,
+		a.params.Iterations,
+		a.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return []byte(encoded), nil
+}
+
+func (a *Argon2idHashing) Verify(password string, hashPassword []byte) error {
+	params, salt, key, err := a.decode(hashPassword)
+	if err != nil {
+		return err
+	}
+
+	actual := argon2.IDKey(a.pepper(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, actual) != 1 {
+		return ErrMismatchedPassword
+	}
+
+	return nil
+}
+
+func (a *Argon2idHashing) Identify(hashPassword []byte) bool {
+	return bytes.HasPrefix(hashPassword, []byte(argon2idPrefix))
+}
+
+// NeedsRehash - хеш создан с другими параметрами
+func (a *Argon2idHashing) NeedsRehash(hashPassword []byte) bool {
+	params, _, _, err := a.decode(hashPassword)
+	if err != nil {
+		return true
+	}
+
+	return params.Memory != a.params.Memory ||
+		params.Iterations != a.params.Iterations ||
+		params.Parallelism != a.params.Parallelism ||
+		params.KeyLength != a.params.KeyLength
+}
+
+func (a *Argon2idHashing) pepper(password string) []byte {
+	mac := hmac.New(sha256.New, []byte(a.secret))
+	mac.Write([]byte(password))
+
+	return mac.Sum(nil)
+}
+
+// decode - разбирает хеш и отклоняет параметры за границами
+func (a *Argon2idHashing) decode(hashPassword []byte) (Argon2Params, []byte, []byte, error) {
+	params, salt, key, err := decodeArgon2id(hashPassword)
+	if err != nil {
+		return params, nil, nil, err
+	}
+
+	valid := params.Memory <= max(a.params.Memory, maxArgon2Memory) &&
+		params.Iterations >= 1 && params.Iterations <= max(a.params.Iterations, maxArgon2Iterations) &&
+		params.Parallelism >= 1 && params.Parallelism <= max(a.params.Parallelism, maxArgon2Parallelism) &&
+		params.Memory >= 8*uint32(params.Parallelism) &&
+		params.SaltLength >= minArgon2SaltLength &&
+		params.KeyLength >= minArgon2KeyLength && params.KeyLength <= max(a.params.KeyLength, maxArgon2KeyLength)
+	if !valid {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	return params, salt, key, nil
+}
+
+func decodeArgon2id(hashPassword []byte) (Argon2Params, []byte, []byte, error) {
+	params := Argon2Params{}
+
+	parts := strings.Split(string(hashPassword), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
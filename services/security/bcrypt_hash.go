@@ -1,6 +1,7 @@
 package security
 
 import (
+	"bytes"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -8,7 +9,7 @@ type BcryptHashing struct {
 	secret string
 }
 
-var _ = Password(&BcryptHashing{})
+var _ = Algorithm(&BcryptHashing{})
 
 func NewBcryptHashing(secret string) *BcryptHashing {
 	return &BcryptHashing{secret: secret}
@@ -34,3 +35,13 @@ func (p *BcryptHashing) Verify(password string, hashPassword []byte) error {
 
 	return nil
 }
+
+func (p *BcryptHashing) Identify(hashPassword []byte) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if bytes.HasPrefix(hashPassword, []byte(prefix)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,49 @@
+package security
+
+import (
+	"errors"
+)
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// Chain - хеширует основным алгоритмом, а проверяет хеши всех известных,
+// хеши не основного алгоритма помечаются для пересчета
+type Chain struct {
+	primary    Algorithm
+	algorithms []Algorithm
+}
+
+var _ = PasswordManager(&Chain{})
+
+func NewChain(primary Algorithm, legacy ...Algorithm) *Chain {
+	return &Chain{
+		primary:    primary,
+		algorithms: append([]Algorithm{primary}, legacy...),
+	}
+}
+
+func (c *Chain) HashPassword(password string) ([]byte, error) {
+	return c.primary.HashPassword(password)
+}
+
+func (c *Chain) Verify(password string, hashPassword []byte) error {
+	for _, algorithm := range c.algorithms {
+		if algorithm.Identify(hashPassword) {
+			return algorithm.Verify(password, hashPassword)
+		}
+	}
+
+	return ErrUnknownHashFormat
+}
+
+func (c *Chain) NeedsRehash(hashPassword []byte) bool {
+	if !c.primary.Identify(hashPassword) {
+		return true
+	}
+
+	if rehasher, ok := c.primary.(PasswordRehasher); ok {
+		return rehasher.NeedsRehash(hashPassword)
+	}
+
+	return false
+}
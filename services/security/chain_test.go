@@ -0,0 +1,69 @@
+package security
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func testArgon2Params() Argon2Params {
+	return Argon2Params{
+		Memory:      1024,
+		Iterations:  1,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+func TestArgon2idHashing(t *testing.T) {
+	hashing := NewArgon2idHashing("secret", testArgon2Params())
+
+	// пароль длиннее 72 байт: bcrypt отбросил бы окончание
+	long := strings.Repeat("a", 80)
+
+	hash, err := hashing.HashPassword(long + "1")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(hash), "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	assert.NoError(t, hashing.Verify(long+"1", hash))
+	assert.ErrorIs(t, hashing.Verify(long+"2", hash), ErrMismatchedPassword)
+	assert.ErrorIs(t, NewArgon2idHashing("other", testArgon2Params()).Verify(long+"1", hash), ErrMismatchedPassword)
+	assert.ErrorIs(t, hashing.Verify("1", []byte("$argon2id$broken")), ErrInvalidHash)
+
+	assert.False(t, hashing.NeedsRehash(hash))
+	assert.True(t, NewArgon2idHashing("secret", DefaultArgon2Params()).NeedsRehash(hash))
+
+	// параметры измененной записи за границами не вычисляются
+	parts := strings.Split(string(hash), "$")
+	for _, tampered := range []string{"m=4194304,t=1,p=1", "m=1024,t=1000,p=1", "m=1024,t=0,p=1", "m=1024,t=1,p=0"} {
+		parts[3] = tampered
+		assert.ErrorIs(t, hashing.Verify(long+"1", []byte(strings.Join(parts, "$"))), ErrInvalidHash, tampered)
+	}
+
+	// пустой ключ совпал бы с любым паролем
+	parts = strings.Split(string(hash), "$")
+	parts[5] = ""
+	assert.ErrorIs(t, hashing.Verify("any", []byte(strings.Join(parts, "$"))), ErrInvalidHash)
+}
+
+func TestChain(t *testing.T) {
+	bcryptHashing := NewBcryptHashing("secret")
+	argon2idHashing := NewArgon2idHashing("secret", testArgon2Params())
+	chain := NewChain(argon2idHashing, bcryptHashing)
+
+	legacy, err := bcryptHashing.HashPassword("password")
+	require.NoError(t, err)
+
+	current, err := chain.HashPassword("password")
+	require.NoError(t, err)
+
+	assert.NoError(t, chain.Verify("password", legacy))
+	assert.NoError(t, chain.Verify("password", current))
+	assert.Error(t, chain.Verify("wrong", legacy))
+	assert.ErrorIs(t, chain.Verify("password", []byte("plain")), ErrUnknownHashFormat)
+
+	assert.True(t, chain.NeedsRehash(legacy))
+	assert.False(t, chain.NeedsRehash(current))
+}
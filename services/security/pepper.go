@@ -0,0 +1,90 @@
+package security
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// pepperTag - префикс хеша с версией перца: $pv=2$argon2id$...,
+// хеши без префикса созданы перцем версии 0
+const pepperTag = "$pv="
+
+var ErrUnknownPepper = errors.New("unknown pepper version")
+
+// Peppered - хранит версию перца в хеше и проверяет пароль перцем этой версии,
+// хеши с устаревшей версией помечаются для пересчета
+type Peppered struct {
+	current  int
+	managers map[int]PasswordManager
+}
+
+var _ = PasswordManager(&Peppered{})
+
+// NewPeppered - managers содержит менеджер паролей для каждой версии перца
+func NewPeppered(current int, managers map[int]PasswordManager) (*Peppered, error) {
+	if _, ok := managers[current]; !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownPepper, current)
+	}
+
+	return &Peppered{
+		current:  current,
+		managers: managers,
+	}, nil
+}
+
+func (p *Peppered) HashPassword(password string) ([]byte, error) {
+	hashPassword, err := p.managers[p.current].HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := pepperTag + strconv.Itoa(p.current)
+
+	return append([]byte(tag), hashPassword...), nil
+}
+
+func (p *Peppered) Verify(password string, hashPassword []byte) error {
+	version, inner, err := PepperVersion(hashPassword)
+	if err != nil {
+		return err
+	}
+
+	manager, ok := p.managers[version]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownPepper, version)
+	}
+
+	return manager.Verify(password, inner)
+}
+
+func (p *Peppered) NeedsRehash(hashPassword []byte) bool {
+	version, inner, err := PepperVersion(hashPassword)
+	if err != nil || version != p.current {
+		return true
+	}
+
+	return p.managers[p.current].NeedsRehash(inner)
+}
+
+// PepperVersion - версия перца и хеш без префикса версии
+func PepperVersion(hashPassword []byte) (int, []byte, error) {
+	if !bytes.HasPrefix(hashPassword, []byte(pepperTag)) {
+		return 0, hashPassword, nil
+	}
+
+	rest := hashPassword[len(pepperTag):]
+
+	end := bytes.IndexByte(rest, '$')
+	if end <= 0 {
+		return 0, nil, ErrInvalidHash
+	}
+
+	version, err := strconv.Atoi(string(rest[:end]))
+	if err != nil {
+		return 0, nil, ErrInvalidHash
+	}
+
+	return version, rest[end:], nil
+}
@@ -0,0 +1,51 @@
+package security
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPeppered(t *testing.T) {
+	newManager := func(secret string) PasswordManager {
+		return NewChain(NewArgon2idHashing(secret, testArgon2Params()))
+	}
+
+	managers := map[int]PasswordManager{
+		0: newManager("runli"),
+		1: newManager("pepper1"),
+		2: newManager("pepper2"),
+	}
+
+	legacy, err := NewArgon2idHashing("runli", testArgon2Params()).HashPassword("password")
+	require.NoError(t, err)
+
+	before, err := NewPeppered(1, map[int]PasswordManager{0: managers[0], 1: managers[1]})
+	require.NoError(t, err)
+
+	hashV1, err := before.HashPassword("password")
+	require.NoError(t, err)
+
+	version, _, err := PepperVersion(hashV1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, version)
+
+	// ротация: текущая версия 2, старые хеши продолжают проверяться
+	after, err := NewPeppered(2, managers)
+	require.NoError(t, err)
+
+	assert.NoError(t, after.Verify("password", hashV1))
+	assert.NoError(t, after.Verify("password", legacy))
+	assert.Error(t, after.Verify("wrong", hashV1))
+	assert.True(t, after.NeedsRehash(hashV1))
+	assert.True(t, after.NeedsRehash(legacy))
+
+	hashV2, err := after.HashPassword("password")
+	require.NoError(t, err)
+	assert.False(t, after.NeedsRehash(hashV2))
+
+	// перец версии 2 удален из конфигурации раньше времени
+	_, err = NewPeppered(2, map[int]PasswordManager{1: managers[1]})
+	assert.ErrorIs(t, err, ErrUnknownPepper)
+	assert.ErrorIs(t, before.Verify("password", hashV2), ErrUnknownPepper)
+}
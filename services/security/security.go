@@ -12,3 +12,21 @@ type PasswordVerify interface {
 type PasswordHasher interface {
 	HashPassword(password string) ([]byte, error)
 }
+
+// PasswordRehasher - определяет, что хеш нужно пересчитать
+// (устаревший алгоритм или параметры)
+type PasswordRehasher interface {
+	NeedsRehash(hashPassword []byte) bool
+}
+
+// PasswordManager - хеширование, проверка и миграция хешей паролей
+type PasswordManager interface {
+	Password
+	PasswordRehasher
+}
+
+// Algorithm - алгоритм, умеющий распознавать свои хеши
+type Algorithm interface {
+	Password
+	Identify(hashPassword []byte) bool
+}
@@ -0,0 +1,114 @@
+package session
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"sync"
+	"time"
+)
+
+type InMemoryRepository struct {
+	mu       sync.Mutex
+	sessions map[models.TenantID]map[string]Session
+	now      func() time.Time
+}
+
+func NewInMemoryRepository() *InMemoryRepository {
+	return &InMemoryRepository{
+		sessions: make(map[models.TenantID]map[string]Session),
+		now:      time.Now,
+	}
+}
+
+// tenantSessions - сессии оператора по хешу токена
+func (i *InMemoryRepository) tenantSessions(tenantID models.TenantID) map[string]Session {
+	sessions, ok := i.sessions[tenantID]
+	if !ok {
+		sessions = make(map[string]Session)
+		i.sessions[tenantID] = sessions
+	}
+
+	return sessions
+}
+
+func (i *InMemoryRepository) Create(ctx context.Context, tokenHash string, session Session) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	sessions := i.tenantSessions(tenant.FromContext(ctx))
+	i.cleanup(sessions)
+	sessions[tokenHash] = session
+
+	return nil
+}
+
+func (i *InMemoryRepository) Get(ctx context.Context, tokenHash string) (*Session, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	session, ok := i.tenantSessions(tenant.FromContext(ctx))[tokenHash]
+	if !ok || !i.now().Before(session.ExpiresAt) {
+		return nil, ErrSessionNotFound
+	}
+
+	return &session, nil
+}
+
+func (i *InMemoryRepository) ListByUser(ctx context.Context, userID models.UserID) ([]Session, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	sessions := i.tenantSessions(tenant.FromContext(ctx))
+	i.cleanup(sessions)
+
+	var result []Session
+	for _, session := range sessions {
+		if session.UserID == userID {
+			result = append(result, session)
+		}
+	}
+
+	return result, nil
+}
+
+func (i *InMemoryRepository) Delete(ctx context.Context, userID models.UserID, sessionID string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	sessions := i.tenantSessions(tenant.FromContext(ctx))
+	i.cleanup(sessions)
+
+	for tokenHash, session := range sessions {
+		if session.UserID == userID && session.ID == sessionID {
+			delete(sessions, tokenHash)
+			return nil
+		}
+	}
+
+	return ErrSessionNotFound
+}
+
+func (i *InMemoryRepository) DeleteByUser(ctx context.Context, userID models.UserID) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	sessions := i.tenantSessions(tenant.FromContext(ctx))
+	for tokenHash, session := range sessions {
+		if session.UserID == userID {
+			delete(sessions, tokenHash)
+		}
+	}
+
+	return nil
+}
+
+// cleanup - удаляет истекшие сессии
+func (i *InMemoryRepository) cleanup(sessions map[string]Session) {
+	now := i.now()
+	for tokenHash, session := range sessions {
+		if !now.Before(session.ExpiresAt) {
+			delete(sessions, tokenHash)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package session
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"strings"
+)
+
+const bearerPrefix = "Bearer "
+
+var ErrForbidden = apierror.New(http.StatusForbidden, "session_forbidden", "session belongs to another user")
+
+type contextKey struct{}
+
+// Middleware - требует токен сессии в заголовке Authorization: Bearer <token>.
+// Запрос выполняется у оператора, у которого открыта сессия
+func Middleware(manager *Manager) fiber.Handler {
+	return func(fCtx *fiber.Ctx) error {
+		header := fCtx.Get(fiber.HeaderAuthorization)
+		if !strings.HasPrefix(header, bearerPrefix) {
+			return ErrUnauthorized
+		}
+
+		session, err := manager.Authenticate(fCtx.UserContext(), strings.TrimPrefix(header, bearerPrefix))
+		if err != nil {
+			return err
+		}
+
+		if session.TenantID != "" {
+			if err = tenant.Bind(fCtx, session.TenantID); err != nil {
+				return err
+			}
+		}
+
+		fCtx.SetUserContext(WithSession(fCtx.UserContext(), session))
+
+		return fCtx.Next()
+	}
+}
+
+// Owner - пропускает только сессию пользователя из параметра пути,
+// ставится после Middleware
+func Owner(param string) fiber.Handler {
+	return func(fCtx *fiber.Ctx) error {
+		userID, err := fCtx.ParamsInt(param)
+		if err != nil {
+			return err
+		}
+
+		session := FromContext(fCtx.UserContext())
+		if session == nil {
+			return ErrUnauthorized
+		}
+
+		if int(session.UserID) != userID {
+			return ErrForbidden
+		}
+
+		return fCtx.Next()
+	}
+}
+
+func WithSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, contextKey{}, session)
+}
+
+// FromContext - сессия запроса, nil если запрос без сессии
+func FromContext(ctx context.Context) *Session {
+	session, _ := ctx.Value(contextKey{}).(*Session)
+	return session
+}
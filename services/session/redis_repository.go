@@ -0,0 +1,191 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
+	"github.com/go-redis/redis/v8"
+	"time"
+)
+
+type RedisRepository struct {
+	client redis.UniversalClient
+	keys   keyschema.Schema
+	now    func() time.Time
+}
+
+func NewRedisRepository(client redis.UniversalClient, keys keyschema.Schema) *RedisRepository {
+	return &RedisRepository{
+		client: client,
+		keys:   keys,
+		now:    time.Now,
+	}
+}
+
+func (r *RedisRepository) Create(ctx context.Context, tokenHash string, session Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	ttl := session.ExpiresAt.Sub(r.now())
+	userKey := r.keys.UserSessionsKey(ctx, session.UserID)
+
+	// сессия и множество могут быть в разных слотах cluster, поэтому пишутся
+	// по очереди: сначала множество, чтобы сессия не осталась без отзыва
+	// через DeleteByUser. Хеш без сессии удалится при следующем чтении множества
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, userKey, tokenHash)
+		pipe.Expire(ctx, userKey, ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("redis.TxPipelined: %w", err)
+	}
+
+	err = r.client.Set(ctx, r.keys.SessionKey(ctx, tokenHash), data, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("redis.Set: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisRepository) Get(ctx context.Context, tokenHash string) (*Session, error) {
+	data, err := r.client.Get(ctx, r.keys.SessionKey(ctx, tokenHash)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("redis.Get: %w", err)
+	}
+
+	session := Session{}
+	if err = json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	return &session, nil
+}
+
+func (r *RedisRepository) ListByUser(ctx context.Context, userID models.UserID) ([]Session, error) {
+	sessions, err := r.userSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Session, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, session)
+	}
+
+	return result, nil
+}
+
+func (r *RedisRepository) Delete(ctx context.Context, userID models.UserID, sessionID string) error {
+	sessions, err := r.userSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for tokenHash, session := range sessions {
+		if session.ID != sessionID {
+			continue
+		}
+
+		err = r.client.Del(ctx, r.keys.SessionKey(ctx, tokenHash)).Err()
+		if err != nil {
+			return fmt.Errorf("redis.Del: %w", err)
+		}
+
+		err = r.client.SRem(ctx, r.keys.UserSessionsKey(ctx, userID), tokenHash).Err()
+		if err != nil {
+			return fmt.Errorf("redis.SRem: %w", err)
+		}
+
+		return nil
+	}
+
+	return ErrSessionNotFound
+}
+
+// userSessions - сессии пользователя по хешу токена, хеши истекших сессий
+// удаляются из множества
+func (r *RedisRepository) userSessions(ctx context.Context, userID models.UserID) (map[string]Session, error) {
+	userKey := r.keys.UserSessionsKey(ctx, userID)
+
+	hashes, err := r.client.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis.SMembers: %w", err)
+	}
+
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(hashes))
+	for _, tokenHash := range hashes {
+		keys = append(keys, r.keys.SessionKey(ctx, tokenHash))
+	}
+
+	values, err := keyschema.GetAll(ctx, r.client, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make(map[string]Session, len(hashes))
+	var expired []interface{}
+
+	for i, value := range values {
+		if value == nil {
+			expired = append(expired, hashes[i])
+			continue
+		}
+
+		session := Session{}
+		if err = json.Unmarshal([]byte(*value), &session); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal: %w", err)
+		}
+
+		sessions[hashes[i]] = session
+	}
+
+	if len(expired) > 0 {
+		err = r.client.SRem(ctx, userKey, expired...).Err()
+		if err != nil {
+			return nil, fmt.Errorf("redis.SRem: %w", err)
+		}
+	}
+
+	return sessions, nil
+}
+
+func (r *RedisRepository) DeleteByUser(ctx context.Context, userID models.UserID) error {
+	userKey := r.keys.UserSessionsKey(ctx, userID)
+
+	hashes, err := r.client.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return fmt.Errorf("redis.SMembers: %w", err)
+	}
+
+	// множество удаляется последним, чтобы при сбое повторный вызов нашел оставшиеся сессии
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, tokenHash := range hashes {
+			pipe.Del(ctx, r.keys.SessionKey(ctx, tokenHash))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("redis.Pipelined: %w", err)
+	}
+
+	err = r.client.Del(ctx, userKey).Err()
+	if err != nil {
+		return fmt.Errorf("redis.Del: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const tokenSize = 32
+
+var (
+	ErrSessionNotFound = apierror.New(http.StatusNotFound, "session_not_found", "session not found")
+	ErrUnauthorized    = apierror.New(http.StatusUnauthorized, "session_invalid", "session is missing or expired")
+)
+
+// Session - сессия пользователя, токен хранится только в виде хеша
+type Session struct {
+	ID     string        `json:"id"`
+	UserID models.UserID `json:"user_id"`
+	// TenantID - оператор, у которого открыта сессия, пустой у сессий до привязки
+	TenantID  models.TenantID `json:"tenant_id,omitempty"`
+	IP        string          `json:"ip"`
+	UserAgent string          `json:"user_agent"`
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// Client - откуда открыта сессия
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+type Repository interface {
+	Create(ctx context.Context, tokenHash string, session Session) error
+	Get(ctx context.Context, tokenHash string) (*Session, error)
+	// ListByUser - действующие сессии пользователя
+	ListByUser(ctx context.Context, userID models.UserID) ([]Session, error)
+	// Delete - завершает одну сессию пользователя по ее ID
+	Delete(ctx context.Context, userID models.UserID, sessionID string) error
+	// DeleteByUser - завершает все сессии пользователя
+	DeleteByUser(ctx context.Context, userID models.UserID) error
+}
+
+type Manager struct {
+	repository Repository
+	ttl        time.Duration
+	now        func() time.Time
+}
+
+func NewManager(repository Repository, ttl time.Duration) *Manager {
+	return &Manager{
+		repository: repository,
+		ttl:        ttl,
+		now:        time.Now,
+	}
+}
+
+// Start - создает сессию и возвращает токен, который больше нигде не сохраняется
+func (m *Manager) Start(ctx context.Context, userID models.UserID, client Client) (string, *Session, error) {
+	token, err := NewToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	id, err := NewToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := m.now().UTC()
+	session := Session{
+		ID:        id[:16],
+		UserID:    userID,
+		TenantID:  tenant.FromContext(ctx),
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		CreatedAt: now,
+		ExpiresAt: now.Add(m.ttl),
+	}
+
+	err = m.repository.Create(ctx, HashToken(token), session)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, &session, nil
+}
+
+func (m *Manager) Authenticate(ctx context.Context, token string) (*Session, error) {
+	session, err := m.repository.Get(ctx, HashToken(token))
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil, ErrUnauthorized
+		}
+		return nil, err
+	}
+
+	if !m.now().Before(session.ExpiresAt) {
+		return nil, ErrUnauthorized
+	}
+
+	return session, nil
+}
+
+// List - действующие сессии пользователя, новые первыми
+func (m *Manager) List(ctx context.Context, userID models.UserID) ([]Session, error) {
+	sessions, err := m.repository.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	active := make([]Session, 0, len(sessions))
+	for _, session := range sessions {
+		if now.Before(session.ExpiresAt) {
+			active = append(active, session)
+		}
+	}
+
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].CreatedAt.After(active[j].CreatedAt)
+	})
+
+	return active, nil
+}
+
+func (m *Manager) Revoke(ctx context.Context, userID models.UserID, sessionID string) error {
+	return m.repository.Delete(ctx, userID, sessionID)
+}
+
+func (m *Manager) RevokeUser(ctx context.Context, userID models.UserID) error {
+	return m.repository.DeleteByUser(ctx, userID)
+}
+
+// NewToken - случайный токен в base64url
+func NewToken() (string, error) {
+	buf := make([]byte, tokenSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,102 @@
+package session
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestManager(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	client := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	clusterServer, err := miniredis.Run()
+	require.NoError(t, err)
+	defer clusterServer.Close()
+
+	// сессия и множество сессий пользователя в разных слотах
+	cluster := redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs: []string{clusterServer.Addr()},
+	})
+
+	repositories := map[string]Repository{
+		"in memory":     NewInMemoryRepository(),
+		"redis":         NewRedisRepository(client, keyschema.Default()),
+		"redis cluster": NewRedisRepository(cluster, keyschema.Default()),
+	}
+
+	for name, repo := range repositories {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			manager := NewManager(repo, time.Hour)
+
+			client := Client{IP: "10.0.0.1", UserAgent: "test"}
+
+			token1, started, err := manager.Start(ctx, 1, client)
+			require.NoError(t, err)
+
+			token2, _, err := manager.Start(ctx, 1, client)
+			require.NoError(t, err)
+
+			other, _, err := manager.Start(ctx, 2, client)
+			require.NoError(t, err)
+
+			userSession, err := manager.Authenticate(ctx, token1)
+			require.NoError(t, err)
+			assert.Equal(t, started.ID, userSession.ID)
+			assert.Equal(t, models.DefaultTenant, userSession.TenantID)
+
+			_, err = manager.Authenticate(tenant.WithTenant(ctx, "brand"), token1)
+			assert.ErrorIs(t, err, ErrUnauthorized)
+
+			_, err = manager.Authenticate(ctx, "unknown")
+			assert.ErrorIs(t, err, ErrUnauthorized)
+
+			listed, err := manager.List(ctx, 1)
+			require.NoError(t, err)
+			require.Len(t, listed, 2)
+			assert.Equal(t, client.IP, listed[0].IP)
+			assert.Equal(t, client.UserAgent, listed[0].UserAgent)
+
+			assert.ErrorIs(t, manager.Revoke(ctx, 2, started.ID), ErrSessionNotFound)
+			require.NoError(t, manager.Revoke(ctx, 1, started.ID))
+
+			_, err = manager.Authenticate(ctx, token1)
+			assert.ErrorIs(t, err, ErrUnauthorized)
+
+			_, err = manager.Authenticate(ctx, token2)
+			assert.NoError(t, err)
+
+			listed, err = manager.List(ctx, 1)
+			require.NoError(t, err)
+			assert.Len(t, listed, 1)
+
+			require.NoError(t, manager.RevokeUser(ctx, 1))
+
+			for _, token := range []string{token1, token2} {
+				_, err = manager.Authenticate(ctx, token)
+				assert.ErrorIs(t, err, ErrUnauthorized)
+			}
+
+			_, err = manager.Authenticate(ctx, other)
+			assert.NoError(t, err)
+
+			manager.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+			_, err = manager.Authenticate(ctx, other)
+			assert.ErrorIs(t, err, ErrUnauthorized)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package signature
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// cleanupInterval - как часто удаляются просроченные nonce. Просроченный nonce
+// до удаления не мешает: при проверке сравнивается время его истечения
+const cleanupInterval = time.Minute
+
+type InMemoryRepository struct {
+	mu          sync.Mutex
+	nonces      map[string]time.Time
+	nextCleanup time.Time
+	now         func() time.Time
+}
+
+func NewInMemoryRepository() *InMemoryRepository {
+	return &InMemoryRepository{
+		nonces: make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+func (i *InMemoryRepository) Remember(
+	_ context.Context,
+	providerID, nonce string,
+	ttl time.Duration,
+) (bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := i.now()
+	i.cleanup(now)
+
+	key := providerID + ":" + nonce
+	if expireAt, exists := i.nonces[key]; exists && now.Before(expireAt) {
+		return false, nil
+	}
+
+	i.nonces[key] = now.Add(ttl)
+
+	return true, nil
+}
+
+// cleanup - удаляет просроченные nonce не чаще раза в cleanupInterval,
+// чтобы не обходить всю таблицу на каждом запросе
+func (i *InMemoryRepository) cleanup(now time.Time) {
+	if now.Before(i.nextCleanup) {
+		return
+	}
+
+	i.nextCleanup = now.Add(cleanupInterval)
+
+	for key, expireAt := range i.nonces {
+		if !now.Before(expireAt) {
+			delete(i.nonces, key)
+		}
+	}
+}
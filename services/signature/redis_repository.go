@@ -0,0 +1,34 @@
+package signature
+
+import (
+	"context"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
+	"github.com/go-redis/redis/v8"
+	"time"
+)
+
+type RedisRepository struct {
+	client redis.UniversalClient
+	keys   keyschema.Schema
+}
+
+func NewRedisRepository(client redis.UniversalClient, keys keyschema.Schema) *RedisRepository {
+	return &RedisRepository{
+		client: client,
+		keys:   keys,
+	}
+}
+
+func (r *RedisRepository) Remember(
+	ctx context.Context,
+	providerID, nonce string,
+	ttl time.Duration,
+) (bool, error) {
+	ok, err := r.client.SetNX(ctx, r.keys.NonceKey(providerID, nonce), 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis.SetNX: %w", err)
+	}
+
+	return ok, nil
+}
@@ -0,0 +1,47 @@
+package signature
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisRepository_Remember(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := context.Background()
+
+	client := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	keys := keyschema.Default()
+	keys.Nonce = "custom_nonce"
+	repo := NewRedisRepository(client, keys)
+
+	fresh, err := repo.Remember(ctx, "provider1", "nonce", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, fresh)
+	assert.True(t, s.Exists("custom_nonce:provider1:nonce"))
+
+	fresh, err = repo.Remember(ctx, "provider1", "nonce", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, fresh)
+
+	fresh, err = repo.Remember(ctx, "provider2", "nonce", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, fresh)
+
+	s.FastForward(2 * time.Minute)
+
+	fresh, err = repo.Remember(ctx, "provider1", "nonce", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, fresh)
+}
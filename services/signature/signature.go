@@ -0,0 +1,162 @@
+package signature
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderProvider  = "X-Provider-ID"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+	HeaderSignature = "X-Signature"
+)
+
+var (
+	ErrSignatureMissing = apierror.New(http.StatusUnauthorized, "signature_missing", "signature headers are missing")
+	ErrUnknownProvider  = apierror.New(http.StatusUnauthorized, "unknown_provider", "unknown provider")
+	ErrTimestampInvalid = apierror.New(http.StatusUnauthorized, "timestamp_invalid", "timestamp is invalid")
+	ErrTimestampSkewed  = apierror.New(http.StatusUnauthorized, "timestamp_skewed", "timestamp is out of the allowed window")
+	ErrInvalidSignature = apierror.New(http.StatusUnauthorized, "invalid_signature", "invalid signature")
+	ErrNonceReused      = apierror.New(http.StatusUnauthorized, "nonce_reused", "nonce already used")
+)
+
+// Repository - хранилище использованных nonce
+type Repository interface {
+	// Remember - сохраняет nonce на ttl, возвращает false если nonce уже был
+	Remember(ctx context.Context, providerID, nonce string, ttl time.Duration) (bool, error)
+}
+
+// ProviderTenants - привязка провайдеров к операторам
+type ProviderTenants interface {
+	ProviderTenant(providerID string) models.TenantID
+}
+
+// Verifier - проверка HMAC подписи запросов от игровых провайдеров
+type Verifier struct {
+	secrets map[string][]byte
+	tenants ProviderTenants
+	nonces  Repository
+	maxSkew time.Duration
+	now     func() time.Time
+}
+
+func NewVerifier(
+	secrets map[string]string,
+	tenants ProviderTenants,
+	nonces Repository,
+	maxSkew time.Duration,
+) *Verifier {
+	keys := make(map[string][]byte, len(secrets))
+	for provider, secret := range secrets {
+		keys[provider] = []byte(secret)
+	}
+
+	return &Verifier{
+		secrets: keys,
+		tenants: tenants,
+		nonces:  nonces,
+		maxSkew: maxSkew,
+		now:     time.Now,
+	}
+}
+
+// Sign - подпись запроса: hex(HMAC-SHA256(secret, method + "\n" + path + "\n" + timestamp + "\n" + nonce + "\n" + body)).
+// path - путь с query как в строке запроса, например /wallet/1/bet?currency=EUR.
+// Метод и путь подписываются, чтобы подписанное тело нельзя было отправить в кошелек другого пользователя
+func Sign(secret []byte, method, path, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	for _, part := range []string{method, path, timestamp, nonce} {
+		mac.Write([]byte(part))
+		mac.Write([]byte("\n"))
+	}
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (v *Verifier) Verify(
+	ctx context.Context,
+	providerID, timestamp, nonce, signature string,
+	method, path string,
+	body []byte,
+) error {
+	if providerID == "" || timestamp == "" || nonce == "" || signature == "" {
+		return ErrSignatureMissing
+	}
+
+	secret, ok := v.secrets[providerID]
+	if !ok {
+		return ErrUnknownProvider
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrTimestampInvalid
+	}
+
+	skew := v.now().Sub(time.Unix(unix, 0))
+	if skew > v.maxSkew || skew < -v.maxSkew {
+		return ErrTimestampSkewed
+	}
+
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	actual, _ := hex.DecodeString(Sign(secret, method, path, timestamp, nonce, body))
+	if !hmac.Equal(expected, actual) {
+		return ErrInvalidSignature
+	}
+
+	// nonce достаточно помнить пока timestamp находится в допустимом окне
+	fresh, err := v.nonces.Remember(ctx, providerID, nonce, 2*v.maxSkew)
+	if err != nil {
+		return fmt.Errorf("remember nonce: %w", err)
+	}
+
+	if !fresh {
+		return ErrNonceReused
+	}
+
+	return nil
+}
+
+// Middleware - fiber middleware, пропускающий только подписанные запросы.
+// Запрос выполняется у оператора, к которому привязан провайдер
+func (v *Verifier) Middleware() fiber.Handler {
+	return func(fCtx *fiber.Ctx) error {
+		providerID := fCtx.Get(HeaderProvider)
+
+		err := v.Verify(
+			fCtx.UserContext(),
+			providerID,
+			fCtx.Get(HeaderTimestamp),
+			fCtx.Get(HeaderNonce),
+			fCtx.Get(HeaderSignature),
+			fCtx.Method(),
+			fCtx.OriginalURL(),
+			fCtx.Body(),
+		)
+		if err != nil {
+			return err
+		}
+
+		if err = tenant.Bind(fCtx, v.tenants.ProviderTenant(providerID)); err != nil {
+			return err
+		}
+
+		return fCtx.Next()
+	}
+}
@@ -0,0 +1,199 @@
+package signature
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifier_Verify(t *testing.T) {
+	const (
+		provider = "provider1"
+		secret   = "secret1"
+		nonce    = "nonce-1"
+		path     = "/wallet/1/bet"
+	)
+
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"amount":-10}`)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	skewed := strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)
+	ctx := context.Background()
+	sign := func(secret, timestamp string) string {
+		return Sign([]byte(secret), http.MethodPost, path, timestamp, nonce, body)
+	}
+
+	tests := []struct {
+		name      string
+		provider  string
+		timestamp string
+		nonce     string
+		signature string
+		method    string
+		path      string
+		before    func(v *Verifier)
+		expectErr error
+	}{
+		{
+			name:      "valid signature",
+			provider:  provider,
+			timestamp: timestamp,
+			nonce:     nonce,
+			signature: sign(secret, timestamp),
+			before:    func(v *Verifier) {},
+		},
+		{
+			name:      "missing headers",
+			provider:  provider,
+			timestamp: timestamp,
+			before:    func(v *Verifier) {},
+			expectErr: ErrSignatureMissing,
+		},
+		{
+			name:      "unknown provider",
+			provider:  "provider2",
+			timestamp: timestamp,
+			nonce:     nonce,
+			signature: sign(secret, timestamp),
+			before:    func(v *Verifier) {},
+			expectErr: ErrUnknownProvider,
+		},
+		{
+			name:      "timestamp skewed",
+			provider:  provider,
+			timestamp: skewed,
+			nonce:     nonce,
+			signature: sign(secret, skewed),
+			before:    func(v *Verifier) {},
+			expectErr: ErrTimestampSkewed,
+		},
+		{
+			name:      "wrong secret",
+			provider:  provider,
+			timestamp: timestamp,
+			nonce:     nonce,
+			signature: sign("other", timestamp),
+			before:    func(v *Verifier) {},
+			expectErr: ErrInvalidSignature,
+		},
+		{
+			name:      "other user path",
+			provider:  provider,
+			timestamp: timestamp,
+			nonce:     nonce,
+			signature: sign(secret, timestamp),
+			path:      "/wallet/2/bet",
+			before:    func(v *Verifier) {},
+			expectErr: ErrInvalidSignature,
+		},
+		{
+			name:      "other method",
+			provider:  provider,
+			timestamp: timestamp,
+			nonce:     nonce,
+			signature: sign(secret, timestamp),
+			method:    http.MethodPut,
+			before:    func(v *Verifier) {},
+			expectErr: ErrInvalidSignature,
+		},
+		{
+			name:      "nonce reused",
+			provider:  provider,
+			timestamp: timestamp,
+			nonce:     nonce,
+			signature: sign(secret, timestamp),
+			before: func(v *Verifier) {
+				_, _ = v.nonces.Remember(ctx, provider, nonce, time.Minute)
+			},
+			expectErr: ErrNonceReused,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v := NewVerifier(map[string]string{provider: secret}, tenant.DefaultRegistry(), NewInMemoryRepository(), 5*time.Minute)
+			v.now = func() time.Time { return now }
+			tc.before(v)
+
+			method, requestPath := http.MethodPost, path
+			if tc.method != "" {
+				method = tc.method
+			}
+			if tc.path != "" {
+				requestPath = tc.path
+			}
+
+			err := v.Verify(ctx, tc.provider, tc.timestamp, tc.nonce, tc.signature, method, requestPath, body)
+			assert.ErrorIs(t, err, tc.expectErr)
+		})
+	}
+}
+
+// подписанный запрос выполняется у оператора провайдера, чужой заголовок оператора отклоняется
+func TestVerifier_MiddlewareTenant(t *testing.T) {
+	registry, err := tenant.NewRegistry([]tenant.Config{
+		{ID: models.DefaultTenant},
+		{ID: "brand", Providers: []string{"provider1"}},
+	})
+	require.NoError(t, err)
+
+	verifier := NewVerifier(map[string]string{"provider1": "secret1"}, registry, NewInMemoryRepository(), time.Minute)
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(fCtx *fiber.Ctx, err error) error {
+			apiErr := &apierror.Error{}
+			if errors.As(err, &apiErr) {
+				return fCtx.SendStatus(apiErr.Status)
+			}
+
+			return fCtx.SendStatus(http.StatusInternalServerError)
+		},
+	})
+	app.Use(tenant.Middleware(registry))
+	app.Post("/wallet/:userID/bet", verifier.Middleware(), func(fCtx *fiber.Ctx) error {
+		return fCtx.SendString(string(tenant.FromContext(fCtx.UserContext())))
+	})
+
+	request := func(nonce, tenantHeader string) *http.Response {
+		body := []byte(`{"amount":-10}`)
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+		req := httptest.NewRequest(http.MethodPost, "/wallet/1/bet", bytes.NewReader(body))
+		req.Header.Set(HeaderProvider, "provider1")
+		req.Header.Set(HeaderTimestamp, timestamp)
+		req.Header.Set(HeaderNonce, nonce)
+		req.Header.Set(HeaderSignature, Sign([]byte("secret1"), http.MethodPost, "/wallet/1/bet", timestamp, nonce, body))
+		if tenantHeader != "" {
+			req.Header.Set(tenant.HeaderTenant, tenantHeader)
+		}
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+
+		return resp
+	}
+
+	resp := request("nonce-1", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	tenantID, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "brand", string(tenantID))
+
+	resp = request("nonce-2", "brand")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = request("nonce-3", string(models.DefaultTenant))
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
@@ -0,0 +1,112 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/services/sqlschema"
+	driver "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Open - открывает базу и применяет миграции. Транзакции берут блокировку
+// на запись сразу (BEGIN IMMEDIATE), конкурирующие запросы ждут busyTimeout
+func Open(ctx context.Context, file string, busyTimeout time.Duration) (*sql.DB, error) {
+	params := url.Values{}
+	params.Add("_pragma", "busy_timeout("+strconv.FormatInt(busyTimeout.Milliseconds(), 10)+")")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+file+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("sql.Open: %w", err)
+	}
+
+	if err = db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("db.Ping: %w", err)
+	}
+
+	if err = Migrate(ctx, db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Migrate - применяет по порядку миграции sqlschema, которых нет в schema_migrations
+func Migrate(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	return sqlschema.Migrate(ctx, sqlschema.SQLite, begin(db), apply)
+}
+
+func apply(ctx context.Context, tx sqlTx, migration sqlschema.Migration) error {
+	var applied int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations WHERE version = ?`, migration.Version).Scan(&applied)
+	if err != nil || applied > 0 {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, migration.Script); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+		migration.Version, time.Now().UTC().Format(time.RFC3339),
+	)
+
+	return err
+}
+
+// InTx - выполняет fn в транзакции, при ошибке транзакция откатывается
+func InTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	return sqlschema.InTx(ctx, begin(db), func(tx sqlTx) error {
+		return fn(tx.Tx)
+	})
+}
+
+// sqlTx - *sql.Tx с завершением в форме sqlschema.Tx
+type sqlTx struct {
+	*sql.Tx
+}
+
+func (tx sqlTx) Commit(context.Context) error {
+	return tx.Tx.Commit()
+}
+
+func (tx sqlTx) Rollback(context.Context) error {
+	return tx.Tx.Rollback()
+}
+
+func begin(db *sql.DB) func(ctx context.Context) (sqlTx, error) {
+	return func(ctx context.Context) (sqlTx, error) {
+		tx, err := db.BeginTx(ctx, nil)
+		return sqlTx{Tx: tx}, err
+	}
+}
+
+// IsUniqueViolation - нарушение PRIMARY KEY или UNIQUE индекса
+func IsUniqueViolation(err error) bool {
+	var sqliteErr *driver.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	code := sqliteErr.Code()
+
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
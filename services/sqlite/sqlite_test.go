@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "wallet.db")
+
+	db, err := Open(ctx, file, time.Second)
+	require.NoError(t, err)
+
+	_, err = db.ExecContext(ctx, `INSERT INTO wallets (tenant_id, user_id, balance) VALUES ('default', 1, 10)`)
+	require.NoError(t, err)
+
+	_, err = db.ExecContext(ctx, `INSERT INTO wallets (tenant_id, user_id, balance) VALUES ('default', 1, 20)`)
+	assert.True(t, IsUniqueViolation(err))
+
+	_, err = db.ExecContext(ctx, `INSERT INTO wallets (tenant_id, user_id, balance) VALUES ('default', 2, -1)`)
+	require.Error(t, err)
+	assert.False(t, IsUniqueViolation(err))
+
+	require.NoError(t, db.Close())
+
+	// повторное открытие не применяет миграции заново и не теряет данные
+	db, err = Open(ctx, file, time.Second)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var migrations int
+	require.NoError(t, db.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations`).Scan(&migrations))
+	assert.Equal(t, 1, migrations)
+
+	var balance int
+	require.NoError(t, db.QueryRowContext(ctx, `SELECT balance FROM wallets WHERE user_id = 1`).Scan(&balance))
+	assert.Equal(t, 10, balance)
+}
+
+func TestInTx(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := Open(ctx, filepath.Join(t.TempDir(), "wallet.db"), time.Second)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = InTx(ctx, db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO wallets (tenant_id, user_id, balance) VALUES ('default', 1, 10)`)
+		require.NoError(t, err)
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO wallets (tenant_id, user_id, balance) VALUES ('default', 1, 10)`)
+		return err
+	})
+	require.Error(t, err)
+
+	var count int
+	require.NoError(t, db.QueryRowContext(ctx, `SELECT COUNT(*) FROM wallets`).Scan(&count))
+	assert.Zero(t, count)
+}
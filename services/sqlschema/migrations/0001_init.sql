@@ -0,0 +1,34 @@
+CREATE TABLE sequences (
+    tenant_id TEXT          NOT NULL,
+    name      TEXT          NOT NULL,
+    value     {{.BigInt}} NOT NULL,
+    PRIMARY KEY (tenant_id, name)
+);
+
+-- users.data - пользователь целиком в JSON, как в redis
+CREATE TABLE users (
+    tenant_id TEXT          NOT NULL,
+    id        {{.BigInt}} NOT NULL,
+    login     TEXT          NOT NULL,
+    data      {{.JSON}}   NOT NULL,
+    PRIMARY KEY (tenant_id, id)
+);
+
+CREATE UNIQUE INDEX users_login ON users (tenant_id, login);
+
+CREATE TABLE wallets (
+    tenant_id TEXT          NOT NULL,
+    user_id   {{.BigInt}} NOT NULL,
+    balance   {{.BigInt}} NOT NULL CHECK (balance >= 0),
+    PRIMARY KEY (tenant_id, user_id)
+);
+
+CREATE TABLE rounds (
+    tenant_id TEXT          NOT NULL,
+    round_id  {{.UUID}}   NOT NULL,
+    user_id   {{.BigInt}} NOT NULL,
+    data      {{.JSON}}   NOT NULL,
+    PRIMARY KEY (tenant_id, round_id)
+);
+
+CREATE INDEX rounds_user ON rounds (tenant_id, user_id);
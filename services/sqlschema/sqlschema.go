@@ -0,0 +1,119 @@
+package sqlschema
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Dialect - типы колонок, которыми схема SQLite отличается от схемы Postgres
+type Dialect struct {
+	BigInt string
+	JSON   string
+	UUID   string
+}
+
+var (
+	SQLite   = Dialect{BigInt: "INTEGER", JSON: "TEXT", UUID: "TEXT"}
+	Postgres = Dialect{BigInt: "BIGINT", JSON: "JSONB", UUID: "UUID"}
+)
+
+// Migration - миграция схемы, версия - числовой префикс имени файла
+type Migration struct {
+	Version int
+	Name    string
+	Script  string
+}
+
+// Migrations - миграции по возрастанию версии, собранные под dialect
+func Migrations(dialect Dialect) ([]Migration, error) {
+	files, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+
+	result := make([]Migration, 0, len(files))
+	for _, file := range files {
+		version, err := strconv.Atoi(strings.SplitN(file.Name(), "_", 2)[0])
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", file.Name(), err)
+		}
+
+		tmpl, err := template.ParseFS(migrations, path.Join("migrations", file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", file.Name(), err)
+		}
+
+		var script bytes.Buffer
+		if err = tmpl.Execute(&script, dialect); err != nil {
+			return nil, fmt.Errorf("migration %s: %w", file.Name(), err)
+		}
+
+		result = append(result, Migration{Version: version, Name: file.Name(), Script: script.String()})
+	}
+
+	return result, nil
+}
+
+// Migrate - применяет миграции по порядку, каждую в своей транзакции.
+// apply сам проверяет, нет ли версии в schema_migrations, и записывает ее
+func Migrate[T Tx](
+	ctx context.Context,
+	dialect Dialect,
+	begin func(ctx context.Context) (T, error),
+	apply func(ctx context.Context, tx T, migration Migration) error,
+) error {
+	list, err := Migrations(dialect)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range list {
+		err = InTx(ctx, begin, func(tx T) error {
+			return apply(ctx, tx, migration)
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", migration.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Tx - транзакция базы, которую завершает InTx
+type Tx interface {
+	Commit(ctx context.Context) error
+	Rollback(ctx context.Context) error
+}
+
+// InTx - выполняет fn в транзакции, при ошибке транзакция откатывается
+func InTx[T Tx](ctx context.Context, begin func(ctx context.Context) (T, error), fn func(tx T) error) error {
+	tx, err := begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+
+	return nil
+}
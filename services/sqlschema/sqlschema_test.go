@@ -0,0 +1,65 @@
+package sqlschema
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	sqlite, err := Migrations(SQLite)
+	require.NoError(t, err)
+	require.NotEmpty(t, sqlite)
+
+	postgres, err := Migrations(Postgres)
+	require.NoError(t, err)
+	require.Len(t, postgres, len(sqlite))
+
+	assert.Equal(t, 1, sqlite[0].Version)
+	assert.Contains(t, sqlite[0].Script, "data      TEXT")
+	assert.Contains(t, postgres[0].Script, "data      JSONB")
+	assert.Contains(t, postgres[0].Script, "round_id  UUID")
+
+	for _, migration := range append(sqlite, postgres...) {
+		assert.NotContains(t, migration.Script, "{{")
+	}
+}
+
+// testTx - транзакция, которая запоминает, чем закончилась
+type testTx struct {
+	committed  bool
+	rolledBack bool
+}
+
+func (tx *testTx) Commit(context.Context) error {
+	tx.committed = true
+	return nil
+}
+
+func (tx *testTx) Rollback(context.Context) error {
+	if !tx.committed {
+		tx.rolledBack = true
+	}
+
+	return nil
+}
+
+func TestInTx(t *testing.T) {
+	ctx := context.Background()
+
+	tx := &testTx{}
+	begin := func(context.Context) (*testTx, error) { return tx, nil }
+
+	require.NoError(t, InTx(ctx, begin, func(*testTx) error { return nil }))
+	assert.True(t, tx.committed)
+	assert.False(t, tx.rolledBack)
+
+	errFailed := errors.New("failed")
+
+	tx = &testTx{}
+	assert.ErrorIs(t, InTx(ctx, begin, func(*testTx) error { return errFailed }), errFailed)
+	assert.False(t, tx.committed)
+	assert.True(t, tx.rolledBack)
+}
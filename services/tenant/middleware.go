@@ -0,0 +1,47 @@
+package tenant
+
+import (
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+)
+
+const HeaderTenant = "X-Tenant-ID"
+
+var (
+	ErrUnknownTenant  = apierror.New(http.StatusBadRequest, "unknown_tenant", "unknown tenant")
+	ErrTenantMismatch = apierror.New(http.StatusForbidden, "tenant_mismatch", "tenant does not match credentials")
+)
+
+// Middleware - определяет оператора по заголовку и кладет его в контекст запроса.
+// Заголовку верят только запросы без учетных данных (регистрация, вход),
+// для подписанных запросов и сессий оператор переопределяется через Bind
+func Middleware(registry *Registry) fiber.Handler {
+	return func(fCtx *fiber.Ctx) error {
+		id := models.TenantID(fCtx.Get(HeaderTenant))
+		if id == "" {
+			id = models.DefaultTenant
+		}
+
+		if _, ok := registry.Get(id); !ok {
+			return ErrUnknownTenant
+		}
+
+		fCtx.SetUserContext(WithTenant(fCtx.UserContext(), id))
+
+		return fCtx.Next()
+	}
+}
+
+// Bind - кладет в контекст оператора из учетных данных запроса.
+// Заголовок оператора, если передан, должен с ним совпадать
+func Bind(fCtx *fiber.Ctx, id models.TenantID) error {
+	if header := fCtx.Get(HeaderTenant); header != "" && models.TenantID(header) != id {
+		return ErrTenantMismatch
+	}
+
+	fCtx.SetUserContext(WithTenant(fCtx.UserContext(), id))
+
+	return nil
+}
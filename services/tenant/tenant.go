@@ -0,0 +1,177 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"os"
+	"regexp"
+	"time"
+)
+
+type ctxKey struct{}
+
+var validID = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Limits - ограничения на операции с кошельком, 0 - без ограничения
+type Limits struct {
+	MaxBet models.Amount `json:"max_bet"`
+	MaxWin models.Amount `json:"max_win"`
+}
+
+// WalletPolicy - начальный баланс кошелька, создаваемого при регистрации
+type WalletPolicy struct {
+	InitialBalance models.Balance `json:"initial_balance"`
+	WelcomeBonus   models.Balance `json:"welcome_bonus"`
+	// WelcomeBonusUntil - окончание акции, nil - бессрочно
+	WelcomeBonusUntil *time.Time `json:"welcome_bonus_until,omitempty"`
+}
+
+// StartBalance - баланс нового кошелька на момент now
+func (p WalletPolicy) StartBalance(now time.Time) models.Balance {
+	balance := p.InitialBalance
+	if p.WelcomeBonusUntil == nil || now.Before(*p.WelcomeBonusUntil) {
+		balance += p.WelcomeBonus
+	}
+
+	return balance
+}
+
+// Config - настройки оператора
+type Config struct {
+	ID         models.TenantID `json:"id"`
+	Currencies []string        `json:"currencies"`
+	Limits     Limits          `json:"limits"`
+	// Wallet - политика оператора, nil - используется общая из конфигурации
+	Wallet *WalletPolicy `json:"wallet,omitempty"`
+	// Providers - игровые провайдеры оператора. Подписанный запрос провайдера
+	// всегда относится к его оператору, провайдер без оператора - к DefaultTenant
+	Providers []string `json:"providers,omitempty"`
+}
+
+// AllowsCurrency - пустой список валют разрешает любую валюту
+func (c Config) AllowsCurrency(currency string) bool {
+	if len(c.Currencies) == 0 {
+		return true
+	}
+
+	for _, allowed := range c.Currencies {
+		if allowed == currency {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Registry struct {
+	tenants   map[models.TenantID]Config
+	providers map[string]models.TenantID
+}
+
+func NewRegistry(configs []Config) (*Registry, error) {
+	tenants := make(map[models.TenantID]Config, len(configs))
+	providers := make(map[string]models.TenantID)
+	for _, cfg := range configs {
+		if !validID.MatchString(string(cfg.ID)) {
+			return nil, fmt.Errorf("invalid tenant id: %q", cfg.ID)
+		}
+
+		if _, exists := tenants[cfg.ID]; exists {
+			return nil, fmt.Errorf("duplicate tenant id: %s", cfg.ID)
+		}
+
+		if cfg.Wallet != nil && (cfg.Wallet.InitialBalance < 0 || cfg.Wallet.WelcomeBonus < 0) {
+			return nil, fmt.Errorf("negative wallet policy for tenant: %s", cfg.ID)
+		}
+
+		for _, provider := range cfg.Providers {
+			if owner, exists := providers[provider]; exists {
+				return nil, fmt.Errorf("provider %s belongs to tenants %s and %s", provider, owner, cfg.ID)
+			}
+
+			providers[provider] = cfg.ID
+		}
+
+		tenants[cfg.ID] = cfg
+	}
+
+	return &Registry{tenants: tenants, providers: providers}, nil
+}
+
+// DefaultRegistry - единственный оператор без ограничений
+func DefaultRegistry() *Registry {
+	return &Registry{
+		tenants: map[models.TenantID]Config{
+			models.DefaultTenant: {ID: models.DefaultTenant},
+		},
+		providers: map[string]models.TenantID{},
+	}
+}
+
+// Load - читает настройки операторов из JSON файла,
+// без файла используется DefaultRegistry
+func Load(path string) (*Registry, error) {
+	if path == "" {
+		return DefaultRegistry(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read tenants: %w", err)
+	}
+
+	var configs []Config
+	if err = json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("unmarshal tenants: %w", err)
+	}
+
+	return NewRegistry(configs)
+}
+
+func (r *Registry) Get(id models.TenantID) (Config, bool) {
+	cfg, ok := r.tenants[id]
+	return cfg, ok
+}
+
+// ProviderTenant - оператор, к которому привязан провайдер
+func (r *Registry) ProviderTenant(providerID string) models.TenantID {
+	if id, ok := r.providers[providerID]; ok {
+		return id
+	}
+
+	return models.DefaultTenant
+}
+
+func (r *Registry) IDs() []models.TenantID {
+	ids := make([]models.TenantID, 0, len(r.tenants))
+	for id := range r.tenants {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func WithTenant(ctx context.Context, id models.TenantID) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext - оператор текущего запроса, DefaultTenant если не задан
+func FromContext(ctx context.Context) models.TenantID {
+	if ctx == nil {
+		return models.DefaultTenant
+	}
+
+	id, ok := ctx.Value(ctxKey{}).(models.TenantID)
+	if !ok {
+		return models.DefaultTenant
+	}
+
+	return id
+}
+
+// Key - ключ хранилища в пространстве оператора
+func Key(ctx context.Context, key string) string {
+	return string(FromContext(ctx)) + ":" + key
+}
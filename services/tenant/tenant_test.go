@@ -0,0 +1,56 @@
+package tenant
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewRegistry(t *testing.T) {
+	tests := []struct {
+		name      string
+		configs   []Config
+		expectErr bool
+	}{
+		{
+			name:    "valid tenants",
+			configs: []Config{{ID: "brand-1"}, {ID: "brand_2"}},
+		},
+		{
+			name:      "invalid tenant id",
+			configs:   []Config{{ID: "brand:1"}},
+			expectErr: true,
+		},
+		{
+			name:      "empty tenant id",
+			configs:   []Config{{ID: ""}},
+			expectErr: true,
+		},
+		{
+			name:      "provider of two tenants",
+			configs:   []Config{{ID: "brand-1", Providers: []string{"p1"}}, {ID: "brand-2", Providers: []string{"p1"}}},
+			expectErr: true,
+		},
+		{
+			name:      "duplicate tenant id",
+			configs:   []Config{{ID: "brand"}, {ID: "brand"}},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewRegistry(tc.configs)
+			assert.Equal(t, tc.expectErr, err != nil)
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+	ctx := context.Background()
+
+	assert.Equal(t, "default:1", Key(ctx, "1"))
+	assert.Equal(t, "brand:1", Key(WithTenant(ctx, "brand"), "1"))
+	assert.Equal(t, models.DefaultTenant, FromContext(nil))
+}
@@ -0,0 +1,100 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type record struct {
+	attempts Attempts
+	expireAt time.Time
+}
+
+type InMemoryRepository struct {
+	mu       sync.Mutex
+	attempts map[string]record
+	now      func() time.Time
+}
+
+func NewInMemoryRepository() *InMemoryRepository {
+	return &InMemoryRepository{
+		attempts: make(map[string]record),
+		now:      time.Now,
+	}
+}
+
+func (i *InMemoryRepository) Get(_ context.Context, key string) (Attempts, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.cleanup(i.now())
+
+	return i.attempts[key].attempts, nil
+}
+
+// Acquire - проверка и запись неудачи выполняются под одной блокировкой
+func (i *InMemoryRepository) Acquire(
+	_ context.Context,
+	key string,
+	rule Rule,
+	at time.Time,
+	ttl time.Duration,
+) (int, time.Duration, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.cleanup(i.now())
+
+	rec := i.attempts[key]
+	if failures := rec.attempts.Failures; failures > 0 {
+		if wait := rec.attempts.LastFailure.Add(rule.Wait(failures)).Sub(at); wait > 0 {
+			return failures, wait, nil
+		}
+	}
+
+	rec.attempts.Failures++
+	rec.attempts.LastFailure = at
+	rec.expireAt = i.now().Add(ttl)
+	i.attempts[key] = rec
+
+	return rec.attempts.Failures, 0, nil
+}
+
+func (i *InMemoryRepository) Release(_ context.Context, key string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	rec, ok := i.attempts[key]
+	if !ok {
+		return nil
+	}
+
+	if rec.attempts.Failures <= 1 {
+		delete(i.attempts, key)
+		return nil
+	}
+
+	rec.attempts.Failures--
+	i.attempts[key] = rec
+
+	return nil
+}
+
+func (i *InMemoryRepository) Reset(_ context.Context, key string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delete(i.attempts, key)
+
+	return nil
+}
+
+// cleanup - удаляет просроченные счетчики
+func (i *InMemoryRepository) cleanup(now time.Time) {
+	for key, rec := range i.attempts {
+		if !now.Before(rec.expireAt) {
+			delete(i.attempts, key)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
+	"github.com/go-redis/redis/v8"
+	"strconv"
+	"time"
+)
+
+const (
+	fieldFailures    = "failures"
+	fieldLastFailure = "last_failure"
+)
+
+type RedisRepository struct {
+	client redis.UniversalClient
+	keys   keyschema.Schema
+}
+
+func NewRedisRepository(client redis.UniversalClient, keys keyschema.Schema) *RedisRepository {
+	return &RedisRepository{
+		client: client,
+		keys:   keys,
+	}
+}
+
+func (r *RedisRepository) Get(ctx context.Context, key string) (Attempts, error) {
+	values, err := r.client.HGetAll(ctx, r.keys.ThrottleKey(key)).Result()
+	if err != nil {
+		return Attempts{}, fmt.Errorf("redis.HGetAll: %w", err)
+	}
+
+	return parseAttempts(values)
+}
+
+// acquireScript - KEYS[1] счетчик; ARGV: время попытки и ttl (мс), затем правило:
+// BaseDelay, MaxDelay, MaxFailures, Lock. Время и задержки в наносекундах.
+// Возвращает {число неудач, оставшееся ожидание}
+var acquireScript = redis.NewScript(`
+local failures = tonumber(redis.call('HGET', KEYS[1], 'failures') or '0')
+local now = tonumber(ARGV[1])
+
+if failures > 0 then
+	local base, maxDelay = tonumber(ARGV[3]), tonumber(ARGV[4])
+	local maxFailures, lock = tonumber(ARGV[5]), tonumber(ARGV[6])
+
+	local wait = lock
+	if failures < maxFailures then
+		wait = base
+		for i = 2, failures do
+			if wait >= maxDelay then
+				break
+			end
+			wait = wait * 2
+		end
+		wait = math.min(wait, maxDelay)
+	end
+
+	local last = tonumber(redis.call('HGET', KEYS[1], 'last_failure') or '0')
+	local remaining = last + wait - now
+	if remaining > 0 then
+		return {failures, remaining}
+	end
+end
+
+failures = redis.call('HINCRBY', KEYS[1], 'failures', 1)
+redis.call('HSET', KEYS[1], 'last_failure', ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+
+return {failures, 0}
+`)
+
+// releaseScript - уменьшает счетчик KEYS[1], последняя неудача удаляет ключ
+var releaseScript = redis.NewScript(`
+local failures = tonumber(redis.call('HGET', KEYS[1], 'failures') or '0')
+if failures <= 1 then
+	redis.call('DEL', KEYS[1])
+else
+	redis.call('HINCRBY', KEYS[1], 'failures', -1)
+end
+
+return 0
+`)
+
+// Acquire - проверка и запись неудачи выполняются одним скриптом
+func (r *RedisRepository) Acquire(
+	ctx context.Context,
+	key string,
+	rule Rule,
+	at time.Time,
+	ttl time.Duration,
+) (int, time.Duration, error) {
+	res, err := acquireScript.Run(ctx, r.client, []string{r.keys.ThrottleKey(key)},
+		at.UnixNano(),
+		ttl.Milliseconds(),
+		int64(rule.BaseDelay),
+		int64(rule.MaxDelay),
+		rule.MaxFailures,
+		int64(rule.Lock),
+	).Int64Slice()
+	if err != nil {
+		return 0, 0, fmt.Errorf("acquireScript: %w", err)
+	}
+
+	if len(res) != 2 {
+		return 0, 0, fmt.Errorf("acquireScript: unexpected result %v", res)
+	}
+
+	return int(res[0]), time.Duration(res[1]), nil
+}
+
+func (r *RedisRepository) Release(ctx context.Context, key string) error {
+	err := releaseScript.Run(ctx, r.client, []string{r.keys.ThrottleKey(key)}).Err()
+	if err != nil {
+		return fmt.Errorf("releaseScript: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisRepository) Reset(ctx context.Context, key string) error {
+	err := r.client.Del(ctx, r.keys.ThrottleKey(key)).Err()
+	if err != nil {
+		return fmt.Errorf("redis.Del: %w", err)
+	}
+
+	return nil
+}
+
+func parseAttempts(values map[string]string) (Attempts, error) {
+	if len(values) == 0 {
+		return Attempts{}, nil
+	}
+
+	failures, err := strconv.Atoi(values[fieldFailures])
+	if err != nil {
+		return Attempts{}, fmt.Errorf("parse failures: %w", err)
+	}
+
+	lastFailure, err := strconv.ParseInt(values[fieldLastFailure], 10, 64)
+	if err != nil {
+		return Attempts{}, fmt.Errorf("parse last failure: %w", err)
+	}
+
+	return Attempts{
+		Failures:    failures,
+		LastFailure: time.Unix(0, lastFailure),
+	}, nil
+}
@@ -0,0 +1,138 @@
+package throttle
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRedisRepository(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := context.Background()
+	at := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	client := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	repo := NewRedisRepository(client, keyschema.Default())
+	rule := Rule{
+		BaseDelay:   time.Second,
+		MaxDelay:    time.Minute,
+		MaxFailures: 3,
+		Lock:        10 * time.Minute,
+	}
+
+	attempts, err := repo.Get(ctx, "login:default:user01")
+	require.NoError(t, err)
+	assert.Equal(t, Attempts{}, attempts)
+
+	failures, wait, err := repo.Acquire(ctx, "login:default:user01", rule, at, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, failures)
+	assert.Zero(t, wait)
+
+	// до истечения задержки попытка не учитывается
+	failures, wait, err = repo.Acquire(ctx, "login:default:user01", rule, at.Add(time.Second/2), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, failures)
+	assert.Equal(t, time.Second/2, wait)
+
+	failures, wait, err = repo.Acquire(ctx, "login:default:user01", rule, at.Add(time.Second), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 2, failures)
+	assert.Zero(t, wait)
+
+	attempts, err = repo.Get(ctx, "login:default:user01")
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts.Failures)
+	assert.True(t, at.Add(time.Second).Equal(attempts.LastFailure))
+
+	_, wait, err = repo.Acquire(ctx, "login:default:user01", rule, at.Add(time.Second), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, wait)
+
+	// блокировка после MaxFailures
+	_, _, err = repo.Acquire(ctx, "login:default:user01", rule, at.Add(3*time.Second), time.Minute)
+	require.NoError(t, err)
+
+	failures, wait, err = repo.Acquire(ctx, "login:default:user01", rule, at.Add(3*time.Second), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 3, failures)
+	assert.Equal(t, 10*time.Minute, wait)
+
+	require.NoError(t, repo.Release(ctx, "login:default:user01"))
+
+	attempts, err = repo.Get(ctx, "login:default:user01")
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts.Failures)
+
+	require.NoError(t, repo.Reset(ctx, "login:default:user01"))
+
+	attempts, err = repo.Get(ctx, "login:default:user01")
+	require.NoError(t, err)
+	assert.Equal(t, 0, attempts.Failures)
+
+	_, _, err = repo.Acquire(ctx, "ip:10.0.0.1", Rule{MaxFailures: 5}, at, time.Minute)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.Release(ctx, "ip:10.0.0.1"))
+	assert.False(t, s.Exists("throttle:ip:10.0.0.1"))
+
+	_, _, err = repo.Acquire(ctx, "ip:10.0.0.1", Rule{MaxFailures: 5}, at, time.Minute)
+	require.NoError(t, err)
+
+	s.FastForward(2 * time.Minute)
+
+	attempts, err = repo.Get(ctx, "ip:10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, attempts.Failures)
+}
+
+// параллельные попытки одного логина: проверку проходит только одна
+func TestRedisRepository_AcquireParallel(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := context.Background()
+	at := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	client := redis.NewClient(&redis.Options{
+		Addr: s.Addr(),
+	})
+
+	repo := NewRedisRepository(client, keyschema.Default())
+	rule := Rule{BaseDelay: time.Second, MaxDelay: time.Minute, MaxFailures: 5, Lock: time.Hour}
+
+	const attempts = 20
+
+	var (
+		wg      sync.WaitGroup
+		allowed atomic.Int32
+	)
+	for n := 0; n < attempts; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, wait, err := repo.Acquire(ctx, "login:default:user01", rule, at, time.Minute)
+			if assert.NoError(t, err) && wait == 0 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), allowed.Load())
+}
@@ -0,0 +1,204 @@
+package throttle
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrTooManyAttempts = apierror.New(http.StatusTooManyRequests, "too_many_attempts", "too many failed login attempts")
+	ErrAccountLocked   = apierror.New(http.StatusLocked, "account_locked", "account is temporarily locked")
+)
+
+type clientIPKey struct{}
+
+// Attempts - неудачные попытки входа по ключу
+type Attempts struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+type Repository interface {
+	Get(ctx context.Context, key string) (Attempts, error)
+	// Acquire - атомарно проверяет rule и, если ждать не нужно, заранее учитывает
+	// попытку как неудачную. Возвращает число неудач и оставшееся ожидание,
+	// счетчик удаляется через ttl после последней неудачи
+	Acquire(ctx context.Context, key string, rule Rule, at time.Time, ttl time.Duration) (int, time.Duration, error)
+	// Release - отменяет одну заранее учтенную неудачу
+	Release(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+// Rule - после n неудач ожидание BaseDelay*2^(n-1), но не больше MaxDelay,
+// после MaxFailures неудач - Lock
+type Rule struct {
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	MaxFailures int
+	Lock        time.Duration
+}
+
+// Wait - ожидание после failures неудач, отсчитывается от последней неудачи
+func (r Rule) Wait(failures int) time.Duration {
+	if failures == 0 {
+		return 0
+	}
+
+	if failures >= r.MaxFailures {
+		return r.Lock
+	}
+
+	delay := r.BaseDelay
+	for i := 1; i < failures && delay < r.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, r.MaxDelay)
+}
+
+// Policy - после каждой неудачи логин ждет BaseDelay*2^(n-1), но не больше MaxDelay,
+// после MaxFailures неудач логин блокируется на LockDuration.
+// С одного IP допускается MaxIPFailures неудач на любые логины.
+type Policy struct {
+	MaxFailures   int
+	MaxIPFailures int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	LockDuration  time.Duration
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxFailures:   5,
+		MaxIPFailures: 100,
+		BaseDelay:     time.Second,
+		MaxDelay:      time.Minute,
+		LockDuration:  15 * time.Minute,
+	}
+}
+
+// Limiter - ограничивает попытки входа по логину и по IP клиента
+type Limiter struct {
+	repository Repository
+	policy     Policy
+	scope      string
+	now        func() time.Time
+}
+
+func NewLimiter(repository Repository, policy Policy) *Limiter {
+	return &Limiter{
+		repository: repository,
+		policy:     policy,
+		now:        time.Now,
+	}
+}
+
+// Scoped - ограничитель с той же политикой и отдельными счетчиками,
+// например для запросов сброса пароля
+func (l *Limiter) Scoped(scope string) *Limiter {
+	scoped := *l
+	scoped.scope = scope + ":"
+
+	return &scoped
+}
+
+// WithClientIP - IP клиента для учета попыток входа
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// Acquire - проверяет ограничения IP и логина и сразу учитывает попытку как неудачную,
+// поэтому параллельные попытки не проходят проверку до записи неудачи.
+// Возвращает ErrTooManyAttempts или ErrAccountLocked с временем ожидания.
+// После успешной попытки вызывается Succeed
+func (l *Limiter) Acquire(ctx context.Context, login string) error {
+	now := l.now()
+	ttl := max(l.policy.LockDuration, l.policy.MaxDelay)
+
+	if ip := ClientIP(ctx); ip != "" {
+		_, wait, err := l.repository.Acquire(ctx, l.ipKey(ip), l.ipRule(), now, ttl)
+		if err != nil {
+			return err
+		}
+
+		if wait > 0 {
+			return ErrTooManyAttempts.WithRetryAfter(wait)
+		}
+	}
+
+	failures, wait, err := l.repository.Acquire(ctx, l.loginKey(ctx, login), l.loginRule(), now, ttl)
+	if err == nil && wait > 0 {
+		// попытка не выполнялась, неудача IP не учитывается
+		err = l.release(ctx)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if wait > 0 {
+		if failures >= l.policy.MaxFailures {
+			return ErrAccountLocked.WithRetryAfter(wait)
+		}
+
+		return ErrTooManyAttempts.WithRetryAfter(wait)
+	}
+
+	return nil
+}
+
+// Succeed - попытка оказалась успешной: неудачи логина сбрасываются,
+// заранее учтенная неудача IP отменяется
+func (l *Limiter) Succeed(ctx context.Context, login string) error {
+	if err := l.Reset(ctx, login); err != nil {
+		return err
+	}
+
+	return l.release(ctx)
+}
+
+func (l *Limiter) release(ctx context.Context) error {
+	if ip := ClientIP(ctx); ip != "" {
+		return l.repository.Release(ctx, l.ipKey(ip))
+	}
+
+	return nil
+}
+
+// Reset - сбрасывает неудачи логина после разблокировки или сброса пароля
+func (l *Limiter) Reset(ctx context.Context, login string) error {
+	return l.repository.Reset(ctx, l.loginKey(ctx, login))
+}
+
+func (l *Limiter) loginRule() Rule {
+	return Rule{
+		BaseDelay:   l.policy.BaseDelay,
+		MaxDelay:    l.policy.MaxDelay,
+		MaxFailures: l.policy.MaxFailures,
+		Lock:        l.policy.LockDuration,
+	}
+}
+
+// ipRule - с одного IP неудачи на любые логины без задержки до MaxIPFailures
+func (l *Limiter) ipRule() Rule {
+	return Rule{
+		MaxFailures: l.policy.MaxIPFailures,
+		Lock:        l.policy.LockDuration,
+	}
+}
+
+func (l *Limiter) loginKey(ctx context.Context, login string) string {
+	return l.scope + "login:" + tenant.Key(ctx, login)
+}
+
+func (l *Limiter) ipKey(ip string) string {
+	return l.scope + "ip:" + ip
+}
@@ -0,0 +1,106 @@
+package throttle
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/services/apierror"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	ctx := WithClientIP(context.Background(), "10.0.0.1")
+
+	repo := NewInMemoryRepository()
+	repo.now = func() time.Time { return now }
+
+	limiter := NewLimiter(repo, Policy{
+		MaxFailures:   3,
+		MaxIPFailures: 5,
+		BaseDelay:     time.Second,
+		MaxDelay:      time.Minute,
+		LockDuration:  10 * time.Minute,
+	})
+	limiter.now = func() time.Time { return now }
+
+	retryAfter := func(err error) time.Duration {
+		var apiErr *apierror.Error
+		require.ErrorAs(t, err, &apiErr)
+		return apiErr.RetryAfter
+	}
+
+	// экспоненциальная задержка: 1s, 2s
+	require.NoError(t, limiter.Acquire(ctx, "user01"))
+	err := limiter.Acquire(ctx, "user01")
+	assert.ErrorIs(t, err, ErrTooManyAttempts)
+	assert.Equal(t, time.Second, retryAfter(err))
+
+	now = now.Add(time.Second)
+	require.NoError(t, limiter.Acquire(ctx, "user01"))
+
+	err = limiter.Acquire(ctx, "user01")
+	assert.Equal(t, 2*time.Second, retryAfter(err))
+
+	// другой оператор считается отдельно
+	require.NoError(t, limiter.Acquire(tenant.WithTenant(ctx, "brand"), "user01"))
+	require.NoError(t, limiter.Succeed(tenant.WithTenant(ctx, "brand"), "user01"))
+
+	// блокировка после MaxFailures
+	now = now.Add(2 * time.Second)
+	require.NoError(t, limiter.Acquire(ctx, "user01"))
+	err = limiter.Acquire(ctx, "user01")
+	assert.ErrorIs(t, err, ErrAccountLocked)
+	assert.Equal(t, 10*time.Minute, retryAfter(err))
+
+	now = now.Add(10 * time.Minute)
+	require.NoError(t, limiter.Acquire(ctx, "user01"))
+
+	// успешная попытка сбрасывает логин и не расходует лимит IP
+	require.NoError(t, limiter.Succeed(ctx, "user01"))
+	require.NoError(t, limiter.Acquire(ctx, "user01"))
+	require.NoError(t, limiter.Succeed(ctx, "user01"))
+
+	// ограничение по IP для разных логинов, отклоненные попытки не учитываются
+	for _, login := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, limiter.Acquire(ctx, login))
+	}
+	assert.ErrorIs(t, limiter.Acquire(ctx, "f"), ErrTooManyAttempts)
+	assert.NoError(t, limiter.Acquire(context.Background(), "g"))
+
+	require.NoError(t, limiter.Reset(ctx, "a"))
+	assert.ErrorIs(t, limiter.Acquire(ctx, "a"), ErrTooManyAttempts)
+
+	// отдельные счетчики для другой области
+	assert.NoError(t, limiter.Scoped("reset").Acquire(ctx, "a"))
+}
+
+// параллельные попытки одного логина: проверку проходит только одна
+func TestLimiter_Parallel(t *testing.T) {
+	limiter := NewLimiter(NewInMemoryRepository(), DefaultPolicy())
+	ctx := context.Background()
+
+	const attempts = 20
+
+	var (
+		wg      sync.WaitGroup
+		allowed atomic.Int32
+	)
+	for n := 0; n < attempts; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if limiter.Acquire(ctx, "user01") == nil {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), allowed.Load())
+}
@@ -0,0 +1,69 @@
+package totp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// векторы из приложения B RFC 6238 для SHA1
+func TestHOTP_RFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		exp  string
+	}{
+		{unix: 59, exp: "94287082"},
+		{unix: 1111111109, exp: "07081804"},
+		{unix: 1111111111, exp: "14050471"},
+		{unix: 1234567890, exp: "89005924"},
+		{unix: 2000000000, exp: "69279037"},
+		{unix: 20000000000, exp: "65353130"},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.exp, hotp(key, Step(time.Unix(tc.unix, 0)), 8))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+
+	code, err := Code(secret, now)
+	require.NoError(t, err)
+
+	step, ok := Validate(secret, code, now, 0)
+	require.True(t, ok)
+	assert.Equal(t, Step(now), step)
+
+	// повторное использование того же кода
+	_, ok = Validate(secret, code, now, step)
+	assert.False(t, ok)
+
+	// код предыдущего шага допускается
+	_, ok = Validate(secret, code, now.Add(period*time.Second), 0)
+	assert.True(t, ok)
+
+	_, ok = Validate(secret, code, now.Add(2*period*time.Second), 0)
+	assert.False(t, ok)
+
+	_, ok = Validate(secret, "12345", now, 0)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("Wallet", "user01", "JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Wallet:user01", uri.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", uri.Query().Get("secret"))
+	assert.Equal(t, "Wallet", uri.Query().Get("issuer"))
+}
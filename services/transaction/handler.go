@@ -36,7 +36,7 @@ func (h *Handler) getTransaction(fCtx *fiber.Ctx) error {
 		return err
 	}
 
-	round, err := h.transactions.GetRound(fCtx.Context(), req.RoundID)
+	round, err := h.transactions.GetRound(fCtx.UserContext(), req.RoundID)
 	if err != nil {
 		h.log.Err(err).Msg("get transaction round failed")
 		return ErrRoundNotFound
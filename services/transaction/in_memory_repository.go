@@ -2,9 +2,13 @@ package transaction
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/IlnurShafikov/wallet/services/wal"
 	"sync"
+	"time"
 )
 
 var (
@@ -13,25 +17,116 @@ var (
 	ErrTransactionNotFound      = errors.New("transaction_id not found")
 	ErrTransactionAlreadyExists = errors.New("transaction_id already exists")
 	ErrRoundFinished            = errors.New("round is finished")
+	ErrRoundConflict            = errors.New("round changed concurrently")
 	ErrRoundRefundAlreadyExists = errors.New("round is refunded")
 )
 
 type InMemoryRepository struct {
 	mu           sync.Mutex
-	transactions map[models.RoundID]models.Round
+	transactions map[models.TenantID]map[models.RoundID]models.Round
+	journal      *wal.Log
+}
+
+// roundRecord - запись журнала, раунд целиком или его удаление
+type roundRecord struct {
+	TenantID models.TenantID `json:"tenant_id"`
+	RoundID  models.RoundID  `json:"round_id"`
+	Round    models.Round    `json:"round"`
+	Deleted  bool            `json:"deleted,omitempty"`
 }
 
 func NewInMemoryRepository() *InMemoryRepository {
 	return &InMemoryRepository{
-		transactions: make(map[models.RoundID]models.Round),
+		transactions: make(map[models.TenantID]map[models.RoundID]models.Round),
+	}
+}
+
+// NewDurableInMemoryRepository - раунды в оп, восстановленные из журнала.
+// Каждое изменение пишется в журнал до применения
+func NewDurableInMemoryRepository(journal *wal.Log) (*InMemoryRepository, error) {
+	repo := NewInMemoryRepository()
+	repo.journal = journal
+
+	err := journal.Load(
+		func(data []byte) error {
+			return json.Unmarshal(data, &repo.transactions)
+		},
+		func(data []byte) error {
+			var record roundRecord
+			if err := json.Unmarshal(data, &record); err != nil {
+				return err
+			}
+
+			if record.Deleted {
+				delete(repo.rounds(record.TenantID), record.RoundID)
+				return nil
+			}
+
+			repo.rounds(record.TenantID)[record.RoundID] = record.Round
+
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// set - записывает раунд в журнал и в память
+func (i *InMemoryRepository) set(tenantID models.TenantID, roundID models.RoundID, round models.Round) error {
+	if i.journal != nil {
+		err := i.journal.Append(roundRecord{TenantID: tenantID, RoundID: roundID, Round: round})
+		if err != nil {
+			return err
+		}
+	}
+
+	i.rounds(tenantID)[roundID] = round
+	i.snapshot()
+
+	return nil
+}
+
+// remove - записывает удаление раунда в журнал и удаляет из памяти
+func (i *InMemoryRepository) remove(tenantID models.TenantID, roundID models.RoundID) error {
+	if i.journal != nil {
+		err := i.journal.Append(roundRecord{TenantID: tenantID, RoundID: roundID, Deleted: true})
+		if err != nil {
+			return err
+		}
+	}
+
+	delete(i.rounds(tenantID), roundID)
+	i.snapshot()
+
+	return nil
+}
+
+func (i *InMemoryRepository) snapshot() {
+	if i.journal != nil && i.journal.NeedSnapshot() {
+		// изменение уже в журнале, неудачный снимок повторится при следующей записи
+		_ = i.journal.Snapshot(i.transactions)
 	}
 }
 
-func (i *InMemoryRepository) GetRound(_ context.Context, roundID models.RoundID) (*models.Round, error) {
+// rounds - раунды оператора
+func (i *InMemoryRepository) rounds(tenantID models.TenantID) map[models.RoundID]models.Round {
+	rounds, ok := i.transactions[tenantID]
+	if !ok {
+		rounds = make(map[models.RoundID]models.Round)
+		i.transactions[tenantID] = rounds
+	}
+
+	return rounds
+}
+
+func (i *InMemoryRepository) GetRound(ctx context.Context, roundID models.RoundID) (*models.Round, error) {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	round, exists := i.transactions[roundID]
+	round, exists := i.rounds(tenant.FromContext(ctx))[roundID]
 	if !exists {
 		return nil, ErrRoundNotFound
 	}
@@ -39,25 +134,27 @@ func (i *InMemoryRepository) GetRound(_ context.Context, roundID models.RoundID)
 	return &round, nil
 }
 
-func (i *InMemoryRepository) CreateBet(_ context.Context, roundID models.RoundID, round models.Round) error {
+func (i *InMemoryRepository) CreateBet(ctx context.Context, roundID models.RoundID, round models.Round) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	_, exists := i.transactions[roundID]
+	tenantID := tenant.FromContext(ctx)
+
+	_, exists := i.rounds(tenantID)[roundID]
 	if exists {
 		return ErrRoundIdAlreadyExists
 	}
 
-	i.transactions[roundID] = round
-
-	return nil
+	return i.set(tenantID, roundID, round)
 }
 
-func (i *InMemoryRepository) SetWin(_ context.Context, roundID models.RoundID, winRound models.Transaction) error {
+func (i *InMemoryRepository) SetWin(ctx context.Context, roundID models.RoundID, winRound models.Transaction) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	round, exists := i.transactions[roundID]
+	tenantID := tenant.FromContext(ctx)
+
+	round, exists := i.rounds(tenantID)[roundID]
 	if !exists {
 		return ErrRoundNotFound
 	}
@@ -74,7 +171,7 @@ func (i *InMemoryRepository) SetWin(_ context.Context, roundID models.RoundID, w
 		return ErrRoundRefundAlreadyExists
 	}
 
-	i.transactions[roundID] = models.Round{
+	return i.set(tenantID, roundID, models.Round{
 		UserID: round.UserID,
 		Bet:    round.Bet,
 		Win: &models.Transaction{
@@ -84,22 +181,105 @@ func (i *InMemoryRepository) SetWin(_ context.Context, roundID models.RoundID, w
 		},
 		Finished: true,
 		Refunded: false,
-	}
-
-	return nil
+	})
 }
 
-func (i *InMemoryRepository) UpdateRound(_ context.Context, roundID models.RoundID, updateRound models.Round) error {
+func (i *InMemoryRepository) UpdateRound(ctx context.Context, roundID models.RoundID, updateRound models.Round) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	_, exists := i.transactions[roundID]
+	tenantID := tenant.FromContext(ctx)
+
+	_, exists := i.rounds(tenantID)[roundID]
 	if !exists {
 		return ErrRoundNotFound
 	}
 
-	i.transactions[roundID] = updateRound
+	return i.set(tenantID, roundID, updateRound)
+}
+
+// ListByUser - все раунды пользователя, от старых к новым
+func (i *InMemoryRepository) ListByUser(ctx context.Context, userID models.UserID) ([]UserRound, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var result []UserRound
+	for roundID, round := range i.rounds(tenant.FromContext(ctx)) {
+		if round.UserID == userID {
+			result = append(result, UserRound{RoundID: roundID, Round: round})
+		}
+	}
+
+	sortRounds(result)
+
+	return result, nil
+}
+
+// Settled - fn вызывается вне блокировки, по снимку рассчитанных раундов
+func (i *InMemoryRepository) Settled(
+	ctx context.Context,
+	before time.Time,
+	batchSize int,
+	fn func(rounds []UserRound) error,
+) error {
+	i.mu.Lock()
+	var settled []UserRound
+	for roundID, round := range i.rounds(tenant.FromContext(ctx)) {
+		if isSettled(round, before) {
+			settled = append(settled, UserRound{RoundID: roundID, Round: round})
+		}
+	}
+	i.mu.Unlock()
+
+	for len(settled) > 0 {
+		batch := settled[:min(batchSize, len(settled))]
+		settled = settled[len(batch):]
+
+		if err := fn(batch); err != nil {
+			return err
+		}
+	}
 
 	return nil
+}
+
+func (i *InMemoryRepository) DeleteRounds(ctx context.Context, rounds []UserRound) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	tenantID := tenant.FromContext(ctx)
+
+	var deleted int
+	for _, round := range rounds {
+		current, exists := i.rounds(tenantID)[round.RoundID]
+		if !exists || !sameRound(current, round.Round) {
+			continue
+		}
+
+		if err := i.remove(tenantID, round.RoundID); err != nil {
+			return deleted, err
+		}
+
+		deleted++
+	}
 
+	return deleted, nil
+}
+
+// Iterate - fn вызывается вне блокировки, по снимку раундов
+func (i *InMemoryRepository) Iterate(ctx context.Context, fn func(round UserRound) error) error {
+	i.mu.Lock()
+	rounds := make([]UserRound, 0, len(i.rounds(tenant.FromContext(ctx))))
+	for roundID, round := range i.rounds(tenant.FromContext(ctx)) {
+		rounds = append(rounds, UserRound{RoundID: roundID, Round: round})
+	}
+	i.mu.Unlock()
+
+	for _, round := range rounds {
+		if err := fn(round); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -3,6 +3,7 @@ package transaction
 import (
 	"context"
 	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/wal"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -33,7 +34,7 @@ func TestGetRound(t *testing.T) {
 			name:    "проверка существующего раунда",
 			roundID: models.RoundID(roundID),
 			before: func(uw *InMemoryRepository) {
-				uw.transactions[models.RoundID(roundID)] = round
+				uw.rounds(models.DefaultTenant)[models.RoundID(roundID)] = round
 			},
 			ctx:    nil,
 			expect: nil,
@@ -94,7 +95,7 @@ func TestSetWin(t *testing.T) {
 			roundID:  models.RoundID(roundID),
 			winRound: win,
 			before: func(uw *InMemoryRepository) {
-				uw.transactions[models.RoundID(roundID)] = models.Round{
+				uw.rounds(models.DefaultTenant)[models.RoundID(roundID)] = models.Round{
 					UserID:   123,
 					Bet:      *bet,
 					Win:      nil,
@@ -110,7 +111,7 @@ func TestSetWin(t *testing.T) {
 			roundID:  models.RoundID(roundID),
 			winRound: win,
 			before: func(uw *InMemoryRepository) {
-				uw.transactions[models.RoundID(roundID)] = models.Round{
+				uw.rounds(models.DefaultTenant)[models.RoundID(roundID)] = models.Round{
 					UserID:   123,
 					Bet:      *bet,
 					Win:      &win,
@@ -126,7 +127,7 @@ func TestSetWin(t *testing.T) {
 			roundID:  models.RoundID(roundID),
 			winRound: win,
 			before: func(uw *InMemoryRepository) {
-				uw.transactions[models.RoundID(roundID)] = models.Round{
+				uw.rounds(models.DefaultTenant)[models.RoundID(roundID)] = models.Round{
 					UserID:   123,
 					Bet:      *bet,
 					Win:      nil,
@@ -141,7 +142,7 @@ func TestSetWin(t *testing.T) {
 			name:    "проверка на добавление в не существующий раунд",
 			roundID: models.RoundID(noTransaction),
 			before: func(uw *InMemoryRepository) {
-				uw.transactions[models.RoundID(roundID)] = models.Round{
+				uw.rounds(models.DefaultTenant)[models.RoundID(roundID)] = models.Round{
 					UserID:   123,
 					Bet:      *bet,
 					Win:      nil,
@@ -206,7 +207,7 @@ func TestCreateBet(t *testing.T) {
 			name:    "проверка не существующего раунда",
 			roundID: models.RoundID(roundID),
 			before: func(uw *InMemoryRepository) {
-				uw.transactions[models.RoundID(roundID)] = models.Round{
+				uw.rounds(models.DefaultTenant)[models.RoundID(roundID)] = models.Round{
 					UserID:   123,
 					Bet:      *bet,
 					Win:      nil,
@@ -228,3 +229,57 @@ func TestCreateBet(t *testing.T) {
 		})
 	}
 }
+
+func TestDurableInMemoryRepository(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	open := func() (*InMemoryRepository, *wal.Log) {
+		journal, err := wal.Open(dir, "rounds", wal.Options{Sync: wal.SyncAlways, SnapshotEvery: 2})
+		require.NoError(t, err)
+
+		repo, err := NewDurableInMemoryRepository(journal)
+		require.NoError(t, err)
+
+		return repo, journal
+	}
+
+	first := models.RoundID(uuid.New())
+	second := models.RoundID(uuid.New())
+	bet := models.Transaction{Amount: -10, Created: time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)}
+	win := models.Transaction{Amount: 20, Created: bet.Created.Add(time.Minute)}
+
+	repo, journal := open()
+	require.NoError(t, repo.CreateBet(ctx, first, models.Round{UserID: 1, Bet: bet}))
+	require.NoError(t, repo.CreateBet(ctx, second, models.Round{UserID: 1, Bet: bet}))
+	require.NoError(t, repo.SetWin(ctx, first, win))
+	require.NoError(t, repo.UpdateRound(ctx, second, models.Round{UserID: 1, Bet: bet, Refunded: true}))
+	require.NoError(t, journal.Close())
+
+	repo, journal = open()
+	defer journal.Close()
+
+	round, err := repo.GetRound(ctx, first)
+	require.NoError(t, err)
+	assert.Equal(t, &models.Round{UserID: 1, Bet: bet, Win: &win, Finished: true}, round)
+
+	refunded, err := repo.GetRound(ctx, second)
+	require.NoError(t, err)
+	assert.True(t, refunded.Refunded)
+
+	// устаревшая копия раунда не удаляет его
+	refunded.Refunded = false
+	deleted, err := repo.DeleteRounds(ctx, []UserRound{{RoundID: first, Round: *round}, {RoundID: second, Round: *refunded}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	require.NoError(t, journal.Close())
+
+	repo, journal = open()
+	defer journal.Close()
+
+	_, err = repo.GetRound(ctx, first)
+	assert.ErrorIs(t, err, ErrRoundNotFound)
+
+	_, err = repo.GetRound(ctx, second)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,348 @@
+package transaction
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/postgres"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+type PostgresRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgresRepository(db *pgxpool.Pool) *PostgresRepository {
+	return &PostgresRepository{
+		db: db,
+	}
+}
+
+// pgQuerier - *pgxpool.Pool или pgx.Tx
+type pgQuerier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func (r *PostgresRepository) GetRound(ctx context.Context, roundID models.RoundID) (*models.Round, error) {
+	return getPostgresRound(ctx, r.db, roundID, "")
+}
+
+func (r *PostgresRepository) CreateBet(ctx context.Context, roundID models.RoundID, round models.Round) error {
+	data, err := json.Marshal(round)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	_, err = r.db.Exec(ctx,
+		`INSERT INTO rounds (tenant_id, round_id, user_id, data) VALUES ($1, $2, $3, $4)`,
+		tenant.FromContext(ctx), roundID.String(), round.UserID, data,
+	)
+	if err != nil {
+		if postgres.IsUniqueViolation(err) {
+			return ErrRoundIdAlreadyExists
+		}
+		return fmt.Errorf("insert round: %w", err)
+	}
+
+	return nil
+}
+
+// SetWin - раунд блокируется до конца транзакции, два выигрыша
+// по одному раунду не пройдут
+func (r *PostgresRepository) SetWin(ctx context.Context, roundID models.RoundID, winTransaction models.Transaction) error {
+	return postgres.InTx(ctx, r.db, func(tx pgx.Tx) error {
+		round, err := getPostgresRound(ctx, tx, roundID, " FOR UPDATE")
+		if err != nil {
+			return err
+		}
+
+		if round.Win != nil {
+			return ErrTransactionAlreadyExists
+		}
+
+		if round.Refunded {
+			return ErrRoundRefundAlreadyExists
+		}
+
+		if round.Finished {
+			return ErrRoundFinished
+		}
+
+		round.Win = &winTransaction
+		round.Finished = true
+
+		return updatePostgresRound(ctx, tx, roundID, *round)
+	})
+}
+
+func (r *PostgresRepository) UpdateRound(ctx context.Context, roundID models.RoundID, round models.Round) error {
+	return updatePostgresRound(ctx, r.db, roundID, round)
+}
+
+// ListByUser - все раунды пользователя, от старых к новым
+func (r *PostgresRepository) ListByUser(ctx context.Context, userID models.UserID) ([]UserRound, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT round_id::text, data FROM rounds WHERE tenant_id = $1 AND user_id = $2`,
+		tenant.FromContext(ctx), userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select rounds: %w", err)
+	}
+	defer rows.Close()
+
+	var result []UserRound
+	for rows.Next() {
+		var (
+			id   string
+			data []byte
+		)
+
+		if err = rows.Scan(&id, &data); err != nil {
+			return nil, fmt.Errorf("scan round: %w", err)
+		}
+
+		roundID, err := uuid.FromString(id)
+		if err != nil {
+			return nil, fmt.Errorf("parse round id: %w", err)
+		}
+
+		round := models.Round{}
+		if err = json.Unmarshal(data, &round); err != nil {
+			return nil, fmt.Errorf("unmarshal: %w", err)
+		}
+
+		result = append(result, UserRound{RoundID: roundID, Round: round})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("select rounds: %w", err)
+	}
+
+	sortRounds(result)
+
+	return result, nil
+}
+
+// getPostgresRound - lock добавляется в конец запроса, например " FOR UPDATE"
+func getPostgresRound(ctx context.Context, q pgQuerier, roundID models.RoundID, lock string) (*models.Round, error) {
+	var data []byte
+
+	err := q.QueryRow(ctx,
+		`SELECT data FROM rounds WHERE tenant_id = $1 AND round_id = $2`+lock,
+		tenant.FromContext(ctx), roundID.String(),
+	).Scan(&data)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRoundNotFound
+		}
+		return nil, fmt.Errorf("select round: %w", err)
+	}
+
+	round := new(models.Round)
+	if err = json.Unmarshal(data, round); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+
+	return round, nil
+}
+
+func updatePostgresRound(ctx context.Context, q pgQuerier, roundID models.RoundID, round models.Round) error {
+	data, err := json.Marshal(round)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	tag, err := q.Exec(ctx,
+		`UPDATE rounds SET user_id = $1, data = $2 WHERE tenant_id = $3 AND round_id = $4`,
+		round.UserID, data, tenant.FromContext(ctx), roundID.String(),
+	)
+	if err != nil {
+		return fmt.Errorf("update round: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrRoundNotFound
+	}
+
+	return nil
+}
+
+// Settled - раунды читаются страницами по round_id, поэтому удаление
+// прочитанных раундов в fn не сдвигает следующую страницу
+func (r *PostgresRepository) Settled(
+	ctx context.Context,
+	before time.Time,
+	batchSize int,
+	fn func(rounds []UserRound) error,
+) error {
+	after := uuid.Nil.String()
+
+	for {
+		page, last, err := r.settledPage(ctx, before, after, batchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(page) > 0 {
+			if err = fn(page); err != nil {
+				return err
+			}
+		}
+
+		if last == "" {
+			return nil
+		}
+
+		after = last
+	}
+}
+
+// settledPage - рассчитанные раунды среди следующих limit завершенных или
+// возвращенных раундов после after. last пуст, если страница последняя
+func (r *PostgresRepository) settledPage(
+	ctx context.Context,
+	before time.Time,
+	after string,
+	limit int,
+) (result []UserRound, last string, err error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT round_id::text, data FROM rounds WHERE tenant_id = $1 AND round_id > $2::uuid
+			AND ((data->>'finished')::boolean OR (data->>'refunded')::boolean)
+			ORDER BY round_id LIMIT $3`,
+		tenant.FromContext(ctx), after, limit,
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("select rounds: %w", err)
+	}
+	defer rows.Close()
+
+	var count int
+	for rows.Next() {
+		var (
+			id   string
+			data []byte
+		)
+
+		if err = rows.Scan(&id, &data); err != nil {
+			return nil, "", fmt.Errorf("scan round: %w", err)
+		}
+
+		roundID, err := uuid.FromString(id)
+		if err != nil {
+			return nil, "", fmt.Errorf("parse round id: %w", err)
+		}
+
+		round := models.Round{}
+		if err = json.Unmarshal(data, &round); err != nil {
+			return nil, "", fmt.Errorf("unmarshal: %w", err)
+		}
+
+		if isSettled(round, before) {
+			result = append(result, UserRound{RoundID: roundID, Round: round})
+		}
+
+		count++
+		last = id
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("select rounds: %w", err)
+	}
+
+	if count < limit {
+		last = ""
+	}
+
+	return result, last, nil
+}
+
+// DeleteRounds - раунд блокируется FOR UPDATE, сравнивается и удаляется в одной транзакции
+func (r *PostgresRepository) DeleteRounds(ctx context.Context, rounds []UserRound) (int, error) {
+	var deleted int
+
+	err := postgres.InTx(ctx, r.db, func(tx pgx.Tx) error {
+		deleted = 0
+
+		for _, round := range rounds {
+			current, err := getPostgresRound(ctx, tx, round.RoundID, " FOR UPDATE")
+			if errors.Is(err, ErrRoundNotFound) {
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if !sameRound(*current, round.Round) {
+				continue
+			}
+
+			_, err = tx.Exec(ctx,
+				`DELETE FROM rounds WHERE tenant_id = $1 AND round_id = $2`,
+				tenant.FromContext(ctx), round.RoundID.String(),
+			)
+			if err != nil {
+				return fmt.Errorf("delete round: %w", err)
+			}
+
+			deleted++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+func (r *PostgresRepository) Iterate(ctx context.Context, fn func(round UserRound) error) error {
+	rows, err := r.db.Query(ctx,
+		`SELECT round_id::text, data FROM rounds WHERE tenant_id = $1 ORDER BY round_id`,
+		tenant.FromContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("select rounds: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id   string
+			data []byte
+		)
+
+		if err = rows.Scan(&id, &data); err != nil {
+			return fmt.Errorf("scan round: %w", err)
+		}
+
+		roundID, err := uuid.FromString(id)
+		if err != nil {
+			return fmt.Errorf("parse round id: %w", err)
+		}
+
+		round := models.Round{}
+		if err = json.Unmarshal(data, &round); err != nil {
+			return fmt.Errorf("unmarshal: %w", err)
+		}
+
+		if err = fn(UserRound{RoundID: roundID, Round: round}); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("select rounds: %w", err)
+	}
+
+	return nil
+}
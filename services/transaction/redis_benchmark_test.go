@@ -0,0 +1,133 @@
+package transaction
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+)
+
+// benchClient - REDIS_BENCH_ADDR для замеров на настоящем redis (база очищается),
+// иначе miniredis, на котором память не измеряется
+func benchClient(b *testing.B) *redis.Client {
+	addr := os.Getenv("REDIS_BENCH_ADDR")
+	if addr == "" {
+		s, err := miniredis.Run()
+		require.NoError(b, err)
+		b.Cleanup(s.Close)
+
+		addr = s.Addr()
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	require.NoError(b, client.FlushDB(context.Background()).Err())
+	b.Cleanup(func() { _ = client.Close() })
+
+	return client
+}
+
+// reportMemory - средний размер ключа по MEMORY USAGE, если redis его поддерживает
+func reportMemory(b *testing.B, client *redis.Client, keys []string) {
+	ctx := context.Background()
+
+	if len(keys) > 1000 {
+		keys = keys[:1000]
+	}
+
+	var total int64
+	for _, key := range keys {
+		size, err := client.MemoryUsage(ctx, key).Result()
+		if err != nil {
+			return
+		}
+
+		total += size
+	}
+
+	b.ReportMetric(float64(total)/float64(len(keys)), "bytes/round")
+}
+
+// legacySetWin - выигрыш в формате до перехода на hash: раунд читается
+// и перезаписывается JSON строкой целиком
+func legacySetWin(ctx context.Context, client *redis.Client, key string, win models.Transaction) error {
+	data, err := client.Get(ctx, key).Bytes()
+	if err != nil {
+		return err
+	}
+
+	round := models.Round{}
+	if err = json.Unmarshal(data, &round); err != nil {
+		return err
+	}
+
+	round.Win = &win
+	round.Finished = true
+
+	data, err = json.Marshal(round)
+	if err != nil {
+		return err
+	}
+
+	return client.Set(ctx, key, data, 0).Err()
+}
+
+func BenchmarkRedisRepository_SetWin(b *testing.B) {
+	ctx := context.Background()
+	created := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	bet := models.Transaction{Amount: -10, TransactionID: models.TransactionID(uuid.New()), Created: created}
+	win := models.Transaction{Amount: 25, TransactionID: models.TransactionID(uuid.New()), Created: created}
+
+	b.Run("json", func(b *testing.B) {
+		client := benchClient(b)
+		repo := NewRedisRepository(client, keyschema.Default(), TTL{})
+
+		data, err := json.Marshal(models.Round{UserID: 1, Bet: bet})
+		require.NoError(b, err)
+
+		keys := make([]string, b.N)
+		for i := range keys {
+			keys[i] = repo.keys.RoundKey(ctx, models.RoundID(uuid.New()))
+			require.NoError(b, client.Set(ctx, keys[i], data, 0).Err())
+		}
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err = legacySetWin(ctx, client, keys[i], win); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StopTimer()
+
+		reportMemory(b, client, keys)
+	})
+
+	b.Run("hash", func(b *testing.B) {
+		client := benchClient(b)
+		repo := NewRedisRepository(client, keyschema.Default(), TTL{})
+
+		roundIDs := make([]models.RoundID, b.N)
+		keys := make([]string, b.N)
+		for i := range roundIDs {
+			roundIDs[i] = models.RoundID(uuid.New())
+			keys[i] = repo.keys.RoundKey(ctx, roundIDs[i])
+			require.NoError(b, repo.CreateBet(ctx, roundIDs[i], models.Round{UserID: 1, Bet: bet}))
+		}
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := repo.SetWin(ctx, roundIDs[i], win); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StopTimer()
+
+		reportMemory(b, client, keys)
+	})
+}
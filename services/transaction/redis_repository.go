@@ -6,111 +6,363 @@ import (
 	"errors"
 	"fmt"
 	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
 	"github.com/go-redis/redis/v8"
+	"github.com/gofrs/uuid"
+	"strings"
 	"time"
 )
 
+// errRoundChanged - раунд изменился после чтения и не удаляется
+var errRoundChanged = errors.New("round changed")
+
+// maxWatchRetries - сколько раз повторяется запись, если раунд изменили параллельно
+const maxWatchRetries = 10
+
 type RedisRepository struct {
-	client   *redis.Client
-	expireAt time.Duration
+	client redis.UniversalClient
+	keys   keyschema.Schema
+	ttl    TTL
+}
+
+// TTL - время жизни раунда, 0 - без срока. Срок отсчитывается от последней
+// записи, при выигрыше или возврате раунд получает срок Finished
+type TTL struct {
+	Open     time.Duration
+	Finished time.Duration
 }
 
-func NewRedisRepository(client *redis.Client, expiredAt time.Duration) *RedisRepository {
+// forRound - срок жизни раунда в его текущем состоянии
+func (t TTL) forRound(round models.Round) time.Duration {
+	if round.Finished || round.Refunded {
+		return t.Finished
+	}
+
+	return t.Open
+}
+
+func NewRedisRepository(client redis.UniversalClient, keys keyschema.Schema, ttl TTL) *RedisRepository {
 	return &RedisRepository{
-		client:   client,
-		expireAt: expiredAt,
+		client: client,
+		keys:   keys,
+		ttl:    ttl,
 	}
 }
 
+// setWinScript - выигрыш пишется отдельными полями без перезаписи раунда.
+// KEYS[1] - раунд, ARGV - сумма, транзакция и время выигрыша, срок жизни в мс
+var setWinScript = redis.NewScript(`
+local kind = redis.call('TYPE', KEYS[1]).ok
+if kind == 'none' then
+	return 'not_found'
+end
+if kind ~= 'hash' then
+	return 'legacy'
+end
+
+local state = redis.call('HMGET', KEYS[1], 'win_amount', 'refunded', 'finished')
+if state[1] then
+	return 'win_exists'
+end
+if state[2] == '1' then
+	return 'refunded'
+end
+if state[3] == '1' then
+	return 'finished'
+end
+
+redis.call('HSET', KEYS[1], 'win_amount', ARGV[1], 'win_transaction_id', ARGV[2], 'win_created', ARGV[3], 'finished', '1')
+if tonumber(ARGV[4]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+else
+	redis.call('PERSIST', KEYS[1])
+end
+
+return 'ok'
+`)
+
+// setWinErrors - ответы setWinScript
+var setWinErrors = map[string]error{
+	"not_found":  ErrRoundNotFound,
+	"win_exists": ErrTransactionAlreadyExists,
+	"refunded":   ErrRoundRefundAlreadyExists,
+	"finished":   ErrRoundFinished,
+}
+
+// UpdateRound - заменяет существующий раунд под WATCH ключа,
+// удаленный или истекший раунд не создается заново
 func (r *RedisRepository) UpdateRound(ctx context.Context, roundID models.RoundID, round models.Round) error {
-	data, err := json.Marshal(round)
-	if err != nil {
-		return fmt.Errorf("marshal: %w", err)
+	key := r.keys.RoundKey(ctx, roundID)
+
+	update := func(tx *redis.Tx) error {
+		count, err := tx.Exists(ctx, key).Result()
+		if err != nil {
+			return fmt.Errorf("redis.Exists: %w", err)
+		}
+
+		if count == 0 {
+			return ErrRoundNotFound
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			r.writeRound(ctx, pipe, key, round)
+			return nil
+		})
+
+		return err
 	}
 
-	err = r.client.Set(ctx, roundID.String(), data, r.expireAt).Err()
-	if err != nil {
-		return fmt.Errorf("redis.Set: %w", err)
+	for attempt := 0; attempt < maxWatchRetries; attempt++ {
+		err := r.client.Watch(ctx, update, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
 	}
 
-	return nil
+	return ErrRoundConflict
+}
+
+// writeRound - заменяет раунд целиком, в том числе записанный JSON строкой
+func (r *RedisRepository) writeRound(ctx context.Context, pipe redis.Pipeliner, key string, round models.Round) {
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, encodeRound(round)...)
+
+	if ttl := r.ttl.forRound(round); ttl > 0 {
+		pipe.PExpire(ctx, key, ttl)
+	}
 }
 
-// Create
-// Update
-// Get
 func (r *RedisRepository) GetRound(ctx context.Context, roundID models.RoundID) (*models.Round, error) {
-	res, err := r.client.Get(ctx, roundID.String()).Result()
+	rounds, err := r.getRounds(ctx, []string{r.keys.RoundKey(ctx, roundID)})
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			err = ErrRoundNotFound
-		}
-
 		return nil, err
 	}
 
-	round := new(models.Round)
-
-	err = json.Unmarshal([]byte(res), round)
-	if err != nil {
-		return nil, fmt.Errorf("unmarshal: %w", err)
+	if rounds[0] == nil {
+		return nil, ErrRoundNotFound
 	}
 
-	return round, nil
+	return rounds[0], nil
 }
 
+// CreateBet - проверка и запись под WATCH ключа раунда, из параллельных
+// запросов с одним roundID раунд создает только один
 func (r *RedisRepository) CreateBet(ctx context.Context, roundID models.RoundID, round models.Round) error {
-	count, err := r.client.Exists(ctx, roundID.String()).Result()
-	if err != nil {
-		return fmt.Errorf("redis.Exists: %w", err)
-	}
+	key := r.keys.RoundKey(ctx, roundID)
+
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		count, err := tx.Exists(ctx, key).Result()
+		if err != nil {
+			return fmt.Errorf("redis.Exists: %w", err)
+		}
+
+		if count > 0 {
+			return ErrRoundIdAlreadyExists
+		}
 
-	if count > 0 {
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			r.writeRound(ctx, pipe, key, round)
+			return nil
+		})
+
+		return err
+	}, key)
+	if errors.Is(err, redis.TxFailedErr) {
+		// раунд записан параллельным запросом
 		return ErrRoundIdAlreadyExists
 	}
 
-	err = r.UpdateRound(ctx, roundID, round)
+	return err
+}
+
+func (r *RedisRepository) SetWin(ctx context.Context, roundID models.RoundID, winTransaction models.Transaction) error {
+	key := r.keys.RoundKey(ctx, roundID)
+
+	args := encodeWin(winTransaction)
+	values := []interface{}{args[1], args[3], args[5], r.ttl.Finished.Milliseconds()}
+
+	res, err := setWinScript.Run(ctx, r.client, []string{key}, values...).Text()
+	if err == nil && res == "legacy" {
+		// раунд записан JSON строкой до перехода на hash
+		if err = r.upgradeRound(ctx, key); err != nil {
+			return err
+		}
+
+		res, err = setWinScript.Run(ctx, r.client, []string{key}, values...).Text()
+	}
+
 	if err != nil {
+		return fmt.Errorf("setWinScript: %w", err)
+	}
+
+	if err, ok := setWinErrors[res]; ok {
 		return err
 	}
 
 	return nil
 }
 
-func (r *RedisRepository) SetWin(ctx context.Context, roundID models.RoundID, winTransaction models.Transaction) error {
-	res, err := r.client.Get(ctx, roundID.String()).Result()
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			err = ErrRoundNotFound
+// upgradeRound - переписывает раунд из JSON строки в hash, сохраняя срок жизни
+func (r *RedisRepository) upgradeRound(ctx context.Context, key string) error {
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) || isWrongType(err) {
+			// раунд удален или уже переписан другим запросом
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("redis.Get: %w", err)
+		}
+
+		ttl, err := tx.PTTL(ctx, key).Result()
+		if err != nil {
+			return fmt.Errorf("redis.PTTL: %w", err)
 		}
+
+		round := models.Round{}
+		if err = json.Unmarshal(data, &round); err != nil {
+			return fmt.Errorf("unmarshal: %w", err)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			pipe.HSet(ctx, key, encodeRound(round)...)
+			if ttl > 0 {
+				pipe.PExpire(ctx, key, ttl)
+			}
+			return nil
+		})
+
 		return err
+	}, key)
+	if err != nil {
+		return fmt.Errorf("upgrade round: %w", err)
 	}
-	round := new(models.Round)
 
-	err = json.Unmarshal([]byte(res), round)
+	return nil
+}
+
+// ListByUser - все раунды пользователя, от старых к новым. Индекса по
+// пользователю нет, поэтому перебираются все раунды оператора
+func (r *RedisRepository) ListByUser(ctx context.Context, userID models.UserID) ([]UserRound, error) {
+	var result []UserRound
+
+	err := r.Iterate(ctx, func(round UserRound) error {
+		if round.UserID == userID {
+			result = append(result, round)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("unmarshal: %w", err)
+		return nil, err
 	}
 
-	if round.Win != nil {
-		return ErrTransactionAlreadyExists
-	}
+	sortRounds(result)
 
-	if round.Refunded == true {
-		return ErrRoundRefundAlreadyExists
-	}
+	return result, nil
+}
 
-	if round.Finished == true {
-		return ErrRoundFinished
-	}
+// Settled - один проход SCAN по раундам оператора, fn получает раунды,
+// как только их набралось batchSize
+func (r *RedisRepository) Settled(
+	ctx context.Context,
+	before time.Time,
+	batchSize int,
+	fn func(rounds []UserRound) error,
+) error {
+	var batch []UserRound
+
+	err := r.Iterate(ctx, func(round UserRound) error {
+		if !isSettled(round.Round, before) {
+			return nil
+		}
 
-	round.Win = &winTransaction
-	round.Finished = true
+		batch = append(batch, round)
+		if len(batch) < batchSize {
+			return nil
+		}
+
+		err := fn(batch)
+		batch = nil
 
-	err = r.UpdateRound(ctx, roundID, *round)
+		return err
+	})
 	if err != nil {
 		return err
 	}
 
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+
 	return nil
 }
+
+// Iterate - раунды читаются пачками SCAN, порядок не определен
+func (r *RedisRepository) Iterate(ctx context.Context, fn func(round UserRound) error) error {
+	prefix := r.keys.RoundPrefix(ctx)
+
+	return keyschema.Scan(ctx, r.client, prefix+"*", func(keys []string) error {
+		rounds, err := r.getRounds(ctx, keys)
+		if err != nil {
+			return err
+		}
+
+		for n, round := range rounds {
+			if round == nil {
+				continue
+			}
+
+			roundID, err := uuid.FromString(strings.TrimPrefix(keys[n], prefix))
+			if err != nil {
+				return fmt.Errorf("parse round id: %w", err)
+			}
+
+			if err = fn(UserRound{RoundID: roundID, Round: *round}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeleteRounds - раунд сравнивается и удаляется под WATCH ключа. Раунд,
+// измененный после чтения, остается в хранилище до следующего переноса
+func (r *RedisRepository) DeleteRounds(ctx context.Context, rounds []UserRound) (int, error) {
+	var deleted int
+
+	for _, round := range rounds {
+		key := r.keys.RoundKey(ctx, round.RoundID)
+
+		err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+			current, err := readRounds(ctx, tx, []string{key})
+			if err != nil {
+				return err
+			}
+
+			if current[0] == nil || !sameRound(*current[0], round.Round) {
+				return errRoundChanged
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Del(ctx, key)
+				return nil
+			})
+
+			return err
+		}, key)
+
+		switch {
+		case err == nil:
+			deleted++
+		case errors.Is(err, errRoundChanged), errors.Is(err, redis.TxFailedErr):
+		default:
+			return deleted, fmt.Errorf("delete round: %w", err)
+		}
+	}
+
+	return deleted, nil
+}
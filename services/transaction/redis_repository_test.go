@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
 	"github.com/alicebob/miniredis/v2"
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
@@ -34,6 +35,7 @@ func TestRedisRepository_GetRound(t *testing.T) {
 
 	repo := &RedisRepository{
 		client: client,
+		keys:   keyschema.Default(),
 	}
 
 	roundBet := &models.Round{
@@ -70,7 +72,7 @@ func TestRedisRepository_GetRound(t *testing.T) {
 			name:    "get round: unmarshal error",
 			roundID: models.RoundID(roundID),
 			before: func(t *testing.T, r *redis.Client) {
-				err := r.Set(ctx, roundID.String(), "invalid json", 0).Err()
+				err := r.Set(ctx, repo.keys.RoundKey(ctx, models.RoundID(roundID)), "invalid json", 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: func(t *testing.T, req *models.Round, err error) {
@@ -82,7 +84,7 @@ func TestRedisRepository_GetRound(t *testing.T) {
 			before: func(t *testing.T, r *redis.Client) {
 				roundJSON, err := json.Marshal(roundBet)
 				require.NoError(t, err)
-				err = r.Set(ctx, roundID.String(), roundJSON, 0).Err()
+				err = r.Set(ctx, repo.keys.RoundKey(ctx, models.RoundID(roundID)), roundJSON, 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: func(t *testing.T, req *models.Round, err error) {
@@ -126,6 +128,7 @@ func TestRedisRepository_CreateBet(t *testing.T) {
 
 	repo := &RedisRepository{
 		client: client,
+		keys:   keyschema.Default(),
 	}
 
 	roundBet := &models.Round{
@@ -160,7 +163,7 @@ func TestRedisRepository_CreateBet(t *testing.T) {
 			before: func(t *testing.T, r *redis.Client) {
 				roundJSON, err := json.Marshal(roundBet)
 				require.NoError(t, err)
-				err = r.Set(ctx, roundID.String(), roundJSON, 0).Err()
+				err = r.Set(ctx, repo.keys.RoundKey(ctx, models.RoundID(roundID)), roundJSON, 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: expErr(ErrRoundIdAlreadyExists),
@@ -212,6 +215,7 @@ func TestInMemoryRepository_SetWin(t *testing.T) {
 
 	repo := &RedisRepository{
 		client: client,
+		keys:   keyschema.Default(),
 	}
 
 	winTransaction := models.Transaction{
@@ -268,7 +272,7 @@ func TestInMemoryRepository_SetWin(t *testing.T) {
 			roundID:        models.RoundID(roundID),
 			winTransaction: winTransaction,
 			before: func(t *testing.T, r *redis.Client) {
-				err = r.Set(ctx, roundID.String(), "invalid json", 0).Err()
+				err = r.Set(ctx, repo.keys.RoundKey(ctx, models.RoundID(roundID)), "invalid json", 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: func(t *testing.T, err error) {
@@ -286,7 +290,7 @@ func TestInMemoryRepository_SetWin(t *testing.T) {
 				roundJSON, err := json.Marshal(round)
 				require.NoError(t, err)
 
-				err = r.Set(ctx, roundID.String(), roundJSON, 0).Err()
+				err = r.Set(ctx, repo.keys.RoundKey(ctx, models.RoundID(roundID)), roundJSON, 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: expErr(ErrTransactionAlreadyExists),
@@ -301,7 +305,7 @@ func TestInMemoryRepository_SetWin(t *testing.T) {
 				roundJSON, err := json.Marshal(round)
 				require.NoError(t, err)
 
-				err = r.Set(ctx, roundID.String(), roundJSON, 0).Err()
+				err = r.Set(ctx, repo.keys.RoundKey(ctx, models.RoundID(roundID)), roundJSON, 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: expErr(ErrRoundRefundAlreadyExists),
@@ -315,7 +319,7 @@ func TestInMemoryRepository_SetWin(t *testing.T) {
 				roundJSON, err := json.Marshal(round)
 				require.NoError(t, err)
 
-				err = r.Set(ctx, roundID.String(), roundJSON, 0).Err()
+				err = r.Set(ctx, repo.keys.RoundKey(ctx, models.RoundID(roundID)), roundJSON, 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: expErr(ErrRoundFinished),
@@ -325,7 +329,7 @@ func TestInMemoryRepository_SetWin(t *testing.T) {
 			roundID:        models.RoundID(roundID),
 			winTransaction: winTransaction,
 			before: func(t *testing.T, r *redis.Client) {
-				err := r.Set(ctx, roundID.String(), "invalid json", 0).Err()
+				err := r.Set(ctx, repo.keys.RoundKey(ctx, models.RoundID(roundID)), "invalid json", 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: func(t *testing.T, err error) {
@@ -342,7 +346,7 @@ func TestInMemoryRepository_SetWin(t *testing.T) {
 				roundJson, err := json.Marshal(round)
 				require.NoError(t, err)
 
-				err = r.Set(ctx, newRoundID.String(), roundJson, 0).Err()
+				err = r.Set(ctx, repo.keys.RoundKey(ctx, models.RoundID(newRoundID)), roundJson, 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: expErr(nil),
@@ -385,6 +389,7 @@ func TestInMemoryRepository_SaveRound(t *testing.T) {
 
 	repo := &RedisRepository{
 		client: client,
+		keys:   keyschema.Default(),
 	}
 
 	roundBet := &models.Round{
@@ -445,7 +450,7 @@ func TestInMemoryRepository_SaveRound(t *testing.T) {
 				roundJSON, err := json.Marshal(roundBet)
 				require.NoError(t, err)
 
-				err = r.Set(ctx, roundID.String(), roundJSON, 0).Err()
+				err = r.Set(ctx, repo.keys.RoundKey(ctx, models.RoundID(roundID)), roundJSON, 0).Err()
 				require.NoError(t, err)
 			},
 			checkRes: expErr(nil),
@@ -464,3 +469,89 @@ func TestInMemoryRepository_SaveRound(t *testing.T) {
 		})
 	}
 }
+
+// открытый раунд живет TTL.Open, после выигрыша или возврата - TTL.Finished от момента расчета
+func TestRedisRepository_TTL(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := context.Background()
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	repo := NewRedisRepository(client, keyschema.Default(), TTL{Open: 0, Finished: time.Hour})
+
+	won := models.RoundID(uuid.New())
+	refunded := models.RoundID(uuid.New())
+	bet := models.Round{UserID: 1, Bet: models.Transaction{Amount: -10}}
+
+	require.NoError(t, repo.CreateBet(ctx, won, bet))
+	require.NoError(t, repo.CreateBet(ctx, refunded, bet))
+	assert.Zero(t, s.TTL(repo.keys.RoundKey(ctx, won)))
+
+	require.NoError(t, repo.SetWin(ctx, won, models.Transaction{Amount: 20}))
+	assert.Equal(t, time.Hour, s.TTL(repo.keys.RoundKey(ctx, won)))
+
+	bet.Refunded = true
+	require.NoError(t, repo.UpdateRound(ctx, refunded, bet))
+	assert.Equal(t, time.Hour, s.TTL(repo.keys.RoundKey(ctx, refunded)))
+
+	repo.ttl = TTL{Open: time.Minute, Finished: time.Hour}
+
+	open := models.RoundID(uuid.New())
+	require.NoError(t, repo.CreateBet(ctx, open, models.Round{UserID: 1}))
+	assert.Equal(t, time.Minute, s.TTL(repo.keys.RoundKey(ctx, open)))
+}
+
+// раунды хранятся hash, раунды в JSON строках читаются и переписываются при выигрыше
+func TestRedisRepository_HashStorage(t *testing.T) {
+	s, err := miniredis.Run()
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := context.Background()
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	repo := NewRedisRepository(client, keyschema.Default(), TTL{Finished: time.Hour})
+
+	created := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	bet := models.Transaction{Amount: -10, TransactionID: models.TransactionID(uuid.New()), Created: created}
+	win := models.Transaction{Amount: 25, TransactionID: models.TransactionID(uuid.New()), Created: created.Add(time.Minute)}
+
+	current := models.RoundID(uuid.New())
+	require.NoError(t, repo.CreateBet(ctx, current, models.Round{UserID: 1, Bet: bet}))
+
+	key := repo.keys.RoundKey(ctx, current)
+	assert.Equal(t, "hash", s.Type(key))
+	assert.Equal(t, "-10", s.HGet(key, fieldBetAmount))
+	fields, err := s.HKeys(key)
+	require.NoError(t, err)
+	assert.NotContains(t, fields, fieldWinAmount)
+
+	require.NoError(t, repo.SetWin(ctx, current, win))
+	assert.Equal(t, "25", s.HGet(key, fieldWinAmount))
+	assert.Equal(t, "1", s.HGet(key, fieldFinished))
+	assert.Equal(t, time.Hour, s.TTL(key))
+
+	got, err := repo.GetRound(ctx, current)
+	require.NoError(t, err)
+	assert.Equal(t, &models.Round{UserID: 1, Bet: bet, Win: &win, Finished: true}, got)
+
+	legacy := models.RoundID(uuid.New())
+	legacyKey := repo.keys.RoundKey(ctx, legacy)
+	legacyJSON, err := json.Marshal(models.Round{UserID: 1, Bet: bet, Kind: models.RoundKindDeposit})
+	require.NoError(t, err)
+	require.NoError(t, client.Set(ctx, legacyKey, legacyJSON, 30*time.Minute).Err())
+
+	rounds, err := repo.ListByUser(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, rounds, 2)
+
+	require.NoError(t, repo.SetWin(ctx, legacy, win))
+	assert.Equal(t, "hash", s.Type(legacyKey))
+	assert.Equal(t, string(models.RoundKindDeposit), s.HGet(legacyKey, fieldKind))
+
+	got, err = repo.GetRound(ctx, legacy)
+	require.NoError(t, err)
+	assert.Equal(t, &models.Round{UserID: 1, Bet: bet, Win: &win, Finished: true, Kind: models.RoundKindDeposit}, got)
+
+	assert.ErrorIs(t, repo.SetWin(ctx, legacy, win), ErrTransactionAlreadyExists)
+}
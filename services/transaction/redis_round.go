@@ -0,0 +1,209 @@
+package transaction
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/go-redis/redis/v8"
+	"github.com/gofrs/uuid"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Поля hash раунда. Суммы хранятся целыми, чтобы их можно было менять HINCRBY,
+// выигрыш и тип раунда отсутствуют, пока не заданы
+const (
+	fieldUserID           = "user_id"
+	fieldBetAmount        = "bet_amount"
+	fieldBetTransactionID = "bet_transaction_id"
+	fieldBetCreated       = "bet_created"
+	fieldWinAmount        = "win_amount"
+	fieldWinTransactionID = "win_transaction_id"
+	fieldWinCreated       = "win_created"
+	fieldFinished         = "finished"
+	fieldRefunded         = "refunded"
+	fieldKind             = "kind"
+)
+
+// encodeRound - пары поле-значение для HSET
+func encodeRound(round models.Round) []interface{} {
+	values := []interface{}{
+		fieldUserID, int(round.UserID),
+		fieldBetAmount, int(round.Bet.Amount),
+		fieldBetTransactionID, round.Bet.TransactionID.String(),
+		fieldBetCreated, round.Bet.Created.Format(time.RFC3339Nano),
+		fieldFinished, formatBool(round.Finished),
+		fieldRefunded, formatBool(round.Refunded),
+	}
+
+	if round.Win != nil {
+		values = append(values, encodeWin(*round.Win)...)
+	}
+
+	if round.Kind != models.RoundKindGame {
+		values = append(values, fieldKind, string(round.Kind))
+	}
+
+	return values
+}
+
+func encodeWin(win models.Transaction) []interface{} {
+	return []interface{}{
+		fieldWinAmount, int(win.Amount),
+		fieldWinTransactionID, win.TransactionID.String(),
+		fieldWinCreated, win.Created.Format(time.RFC3339Nano),
+	}
+}
+
+func decodeRound(fields map[string]string) (*models.Round, error) {
+	userID, err := strconv.Atoi(fields[fieldUserID])
+	if err != nil {
+		return nil, fmt.Errorf("field %s: %w", fieldUserID, err)
+	}
+
+	bet, err := decodeTransaction(fields, fieldBetAmount, fieldBetTransactionID, fieldBetCreated)
+	if err != nil {
+		return nil, err
+	}
+
+	round := &models.Round{
+		UserID:   models.UserID(userID),
+		Bet:      *bet,
+		Finished: fields[fieldFinished] == "1",
+		Refunded: fields[fieldRefunded] == "1",
+		Kind:     models.RoundKind(fields[fieldKind]),
+	}
+
+	if _, ok := fields[fieldWinAmount]; ok {
+		round.Win, err = decodeTransaction(fields, fieldWinAmount, fieldWinTransactionID, fieldWinCreated)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return round, nil
+}
+
+func decodeTransaction(fields map[string]string, amountField, idField, createdField string) (*models.Transaction, error) {
+	amount, err := strconv.Atoi(fields[amountField])
+	if err != nil {
+		return nil, fmt.Errorf("field %s: %w", amountField, err)
+	}
+
+	transactionID, err := uuid.FromString(fields[idField])
+	if err != nil {
+		return nil, fmt.Errorf("field %s: %w", idField, err)
+	}
+
+	created, err := time.Parse(time.RFC3339Nano, fields[createdField])
+	if err != nil {
+		return nil, fmt.Errorf("field %s: %w", createdField, err)
+	}
+
+	return &models.Transaction{
+		Amount:        models.Amount(amount),
+		TransactionID: transactionID,
+		Created:       created,
+	}, nil
+}
+
+func formatBool(value bool) string {
+	if value {
+		return "1"
+	}
+
+	return "0"
+}
+
+// isWrongType - ключ хранится в другом формате, для раундов - JSON строкой
+func isWrongType(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE")
+}
+
+// pipeliner - клиент redis или *redis.Tx под WATCH
+type pipeliner interface {
+	Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error)
+}
+
+// getRounds - раунды в порядке keys, nil для отсутствующих. Раунды, записанные
+// до перехода на hash, читаются как JSON строки
+func (r *RedisRepository) getRounds(ctx context.Context, keys []string) ([]*models.Round, error) {
+	return readRounds(ctx, r.client, keys)
+}
+
+func readRounds(ctx context.Context, client pipeliner, keys []string) ([]*models.Round, error) {
+	cmds := make([]*redis.StringStringMapCmd, len(keys))
+
+	_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.HGetAll(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && !isWrongType(err) {
+		return nil, fmt.Errorf("redis.Pipelined: %w", err)
+	}
+
+	rounds := make([]*models.Round, len(keys))
+
+	var legacy []int
+	for i, cmd := range cmds {
+		fields, err := cmd.Result()
+		if isWrongType(err) {
+			legacy = append(legacy, i)
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("redis.HGetAll: %w", err)
+		}
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		rounds[i], err = decodeRound(fields)
+		if err != nil {
+			return nil, fmt.Errorf("decode round %s: %w", keys[i], err)
+		}
+	}
+
+	if len(legacy) == 0 {
+		return rounds, nil
+	}
+
+	legacyCmds := make([]*redis.StringCmd, len(legacy))
+
+	_, err = client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for n, i := range legacy {
+			legacyCmds[n] = pipe.Get(ctx, keys[i])
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("redis.Pipelined: %w", err)
+	}
+
+	for n, i := range legacy {
+		data, err := legacyCmds[n].Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("redis.Get: %w", err)
+		}
+
+		round := new(models.Round)
+		if err = json.Unmarshal(data, round); err != nil {
+			return nil, fmt.Errorf("unmarshal: %w", err)
+		}
+
+		rounds[i] = round
+	}
+
+	return rounds, nil
+}
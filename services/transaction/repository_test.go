@@ -0,0 +1,340 @@
+package transaction
+
+import (
+	"context"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/keyschema"
+	"github.com/IlnurShafikov/wallet/services/postgres/pgtest"
+	"github.com/IlnurShafikov/wallet/services/sqlite"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRepository - хранилище раундов с выборкой по пользователю и переносом в архив
+type testRepository interface {
+	Repository
+	Lister
+	Archivable
+}
+
+// repositoryConstructor - пустое хранилище и контекст оператора, в котором с ним работает тест
+type repositoryConstructor func(t *testing.T) (testRepository, context.Context)
+
+// repositoryConstructors - реализации Repository, на которых выполняются общие тесты
+func repositoryConstructors() map[string]repositoryConstructor {
+	return map[string]repositoryConstructor{
+		"in memory": func(t *testing.T) (testRepository, context.Context) {
+			return NewInMemoryRepository(), context.Background()
+		},
+		"postgres": func(t *testing.T) (testRepository, context.Context) {
+			db, ctx := pgtest.Open(t)
+			return NewPostgresRepository(db), ctx
+		},
+		"redis": func(t *testing.T) (testRepository, context.Context) {
+			s := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+			t.Cleanup(func() { _ = client.Close() })
+
+			return NewRedisRepository(client, keyschema.Default(), TTL{}), context.Background()
+		},
+		"sqlite": func(t *testing.T) (testRepository, context.Context) {
+			db, err := sqlite.Open(context.Background(), filepath.Join(t.TempDir(), "wallet.db"), time.Second)
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = db.Close() })
+
+			return NewSQLiteRepository(db), context.Background()
+		},
+	}
+}
+
+func TestRepository_SetWin(t *testing.T) {
+	roundID := models.RoundID(uuid.MustParse("123e4567-e89b-12d3-a456-426614174001"))
+
+	bet := models.Transaction{
+		Amount:        -10,
+		TransactionID: models.TransactionID(uuid.MustParse("123e4567-e89b-12d3-a456-426614174002")),
+		Created:       time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	win := models.Transaction{
+		Amount:        10,
+		TransactionID: models.TransactionID(uuid.MustParse("123e4567-e89b-12d3-a456-426614174003")),
+		Created:       time.Date(2024, time.June, 1, 12, 1, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name      string
+		round     *models.Round
+		expectErr error
+	}{
+		{
+			name:  "set win successfully",
+			round: &models.Round{UserID: 123, Bet: bet},
+		}, {
+			name:      "set win: round with win",
+			round:     &models.Round{UserID: 123, Bet: bet, Win: &win},
+			expectErr: ErrTransactionAlreadyExists,
+		}, {
+			name:      "set win: finished round",
+			round:     &models.Round{UserID: 123, Bet: bet, Finished: true},
+			expectErr: ErrRoundFinished,
+		}, {
+			name:      "set win: refunded round",
+			round:     &models.Round{UserID: 123, Bet: bet, Refunded: true},
+			expectErr: ErrRoundRefundAlreadyExists,
+		}, {
+			name:      "set win: round not found",
+			expectErr: ErrRoundNotFound,
+		},
+	}
+
+	for name, newRepository := range repositoryConstructors() {
+		for _, tc := range tests {
+			t.Run(name+": "+tc.name, func(t *testing.T) {
+				repo, ctx := newRepository(t)
+
+				if tc.round != nil {
+					require.NoError(t, repo.CreateBet(ctx, roundID, *tc.round))
+				}
+
+				err := repo.SetWin(ctx, roundID, win)
+				assert.ErrorIs(t, err, tc.expectErr)
+
+				if tc.expectErr == nil {
+					round, err := repo.GetRound(ctx, roundID)
+					require.NoError(t, err)
+					assert.Equal(t, &models.Round{UserID: 123, Bet: bet, Win: &win, Finished: true}, round)
+				}
+			})
+		}
+	}
+}
+
+func TestRepository_Round(t *testing.T) {
+	for name, newRepository := range repositoryConstructors() {
+		t.Run(name, func(t *testing.T) {
+			repo, ctx := newRepository(t)
+
+			roundID := models.RoundID(uuid.New())
+			bet := models.Transaction{Amount: -10, Created: time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)}
+			round := models.Round{UserID: 123, Bet: bet}
+
+			_, err := repo.GetRound(ctx, roundID)
+			assert.ErrorIs(t, err, ErrRoundNotFound)
+			assert.ErrorIs(t, repo.UpdateRound(ctx, roundID, round), ErrRoundNotFound)
+
+			require.NoError(t, repo.CreateBet(ctx, roundID, round))
+			assert.ErrorIs(t, repo.CreateBet(ctx, roundID, round), ErrRoundIdAlreadyExists)
+
+			_, err = repo.GetRound(tenant.WithTenant(ctx, tenant.FromContext(ctx)+"-brand"), roundID)
+			assert.ErrorIs(t, err, ErrRoundNotFound)
+
+			round.Refunded = true
+			require.NoError(t, repo.UpdateRound(ctx, roundID, round))
+
+			got, err := repo.GetRound(ctx, roundID)
+			require.NoError(t, err)
+			assert.Equal(t, &round, got)
+
+			rounds, err := repo.ListByUser(ctx, 123)
+			require.NoError(t, err)
+			require.Len(t, rounds, 1)
+			assert.Equal(t, roundID, rounds[0].RoundID)
+		})
+	}
+}
+
+func TestRepository_ListByUser(t *testing.T) {
+	created := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	for name, newRepository := range repositoryConstructors() {
+		t.Run(name, func(t *testing.T) {
+			repo, ctx := newRepository(t)
+
+			var roundIDs []models.RoundID
+			for n := 0; n < 3; n++ {
+				roundID := models.RoundID(uuid.New())
+				roundIDs = append(roundIDs, roundID)
+
+				err := repo.CreateBet(ctx, roundID, models.Round{
+					UserID: 1,
+					Bet: models.Transaction{
+						Amount:  -10,
+						Created: created.Add(time.Duration(2-n) * time.Minute),
+					},
+				})
+				require.NoError(t, err)
+			}
+
+			err := repo.CreateBet(ctx, models.RoundID(uuid.New()), models.Round{UserID: 2})
+			require.NoError(t, err)
+
+			rounds, err := repo.ListByUser(ctx, 1)
+			require.NoError(t, err)
+			require.Len(t, rounds, 3)
+			assert.Equal(t, roundIDs[2], rounds[0].RoundID)
+			assert.Equal(t, roundIDs[0], rounds[2].RoundID)
+			assert.Equal(t, models.Amount(-10), rounds[0].Bet.Amount)
+
+			rounds, err = repo.ListByUser(ctx, 3)
+			require.NoError(t, err)
+			assert.Empty(t, rounds)
+		})
+	}
+}
+
+// в архив попадают только рассчитанные раунды со ставкой раньше before
+func TestRepository_Settled(t *testing.T) {
+	before := time.Date(2024, time.June, 2, 0, 0, 0, 0, time.UTC)
+	old := before.Add(-time.Hour)
+
+	for name, newRepository := range repositoryConstructors() {
+		t.Run(name, func(t *testing.T) {
+			repo, ctx := newRepository(t)
+
+			rounds := map[string]models.Round{
+				"open":     {UserID: 1, Bet: models.Transaction{Amount: -10, Created: old}},
+				"finished": {UserID: 1, Bet: models.Transaction{Amount: -10, Created: old}, Finished: true},
+				"refunded": {UserID: 2, Bet: models.Transaction{Amount: -10, Created: old}, Refunded: true},
+				"recent":   {UserID: 1, Bet: models.Transaction{Amount: -10, Created: before}, Finished: true},
+			}
+
+			ids := make(map[string]models.RoundID, len(rounds))
+			for key, round := range rounds {
+				ids[key] = models.RoundID(uuid.New())
+				require.NoError(t, repo.CreateBet(ctx, ids[key], round))
+			}
+
+			collect := func(ctx context.Context, batchSize int) ([]UserRound, int) {
+				var (
+					result  []UserRound
+					batches int
+				)
+
+				err := repo.Settled(ctx, before, batchSize, func(rounds []UserRound) error {
+					assert.LessOrEqual(t, len(rounds), batchSize)
+					result = append(result, rounds...)
+					batches++
+					return nil
+				})
+				require.NoError(t, err)
+
+				return result, batches
+			}
+
+			settled, _ := collect(ctx, 10)
+
+			var got []models.RoundID
+			for _, round := range settled {
+				got = append(got, round.RoundID)
+			}
+			assert.ElementsMatch(t, []models.RoundID{ids["finished"], ids["refunded"]}, got)
+
+			_, batches := collect(ctx, 1)
+			assert.Equal(t, 2, batches)
+
+			other, _ := collect(tenant.WithTenant(ctx, tenant.FromContext(ctx)+"-other"), 10)
+			assert.Empty(t, other)
+
+			// раунд, измененный после чтения, не удаляется
+			changed := settled[0]
+			changed.Finished = !changed.Finished
+			changed.Refunded = !changed.Refunded
+
+			deleted, err := repo.DeleteRounds(ctx, []UserRound{changed})
+			require.NoError(t, err)
+			assert.Zero(t, deleted)
+
+			deleted, err = repo.DeleteRounds(ctx, settled)
+			require.NoError(t, err)
+			assert.Equal(t, 2, deleted)
+
+			_, err = repo.GetRound(ctx, ids["finished"])
+			assert.ErrorIs(t, err, ErrRoundNotFound)
+
+			_, err = repo.GetRound(ctx, ids["open"])
+			assert.NoError(t, err)
+
+			settled, _ = collect(ctx, 10)
+			assert.Empty(t, settled)
+		})
+	}
+}
+
+// удаление в fn не начинает проход заново и не пропускает раунды
+func TestRepository_SettledDelete(t *testing.T) {
+	before := time.Date(2024, time.June, 2, 0, 0, 0, 0, time.UTC)
+
+	for name, newRepository := range repositoryConstructors() {
+		t.Run(name, func(t *testing.T) {
+			repo, ctx := newRepository(t)
+
+			var ids []models.RoundID
+			for n := 0; n < 7; n++ {
+				roundID := models.RoundID(uuid.New())
+				ids = append(ids, roundID)
+
+				round := models.Round{UserID: 1, Bet: models.Transaction{Amount: -10, Created: before.Add(-time.Hour)}, Finished: true}
+				require.NoError(t, repo.CreateBet(ctx, roundID, round))
+			}
+
+			var seen []models.RoundID
+			err := repo.Settled(ctx, before, 2, func(rounds []UserRound) error {
+				for _, round := range rounds {
+					seen = append(seen, round.RoundID)
+				}
+
+				deleted, err := repo.DeleteRounds(ctx, rounds)
+				assert.Equal(t, len(rounds), deleted)
+
+				return err
+			})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, ids, seen)
+		})
+	}
+}
+
+// только один из параллельных выигрышей по раунду проходит
+func TestRepository_ConcurrentSetWin(t *testing.T) {
+	for name, newRepository := range repositoryConstructors() {
+		t.Run(name, func(t *testing.T) {
+			repo, ctx := newRepository(t)
+
+			roundID := models.RoundID(uuid.New())
+			require.NoError(t, repo.CreateBet(ctx, roundID, models.Round{UserID: 1, Bet: models.Transaction{Amount: -10}}))
+
+			var (
+				wg  sync.WaitGroup
+				mu  sync.Mutex
+				won int
+			)
+
+			for n := 0; n < 10; n++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					err := repo.SetWin(ctx, roundID, models.Transaction{Amount: 10})
+					if err == nil {
+						mu.Lock()
+						won++
+						mu.Unlock()
+					}
+				}()
+			}
+
+			wg.Wait()
+
+			assert.Equal(t, 1, won)
+		})
+	}
+}
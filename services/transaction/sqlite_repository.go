@@ -0,0 +1,349 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IlnurShafikov/wallet/models"
+	"github.com/IlnurShafikov/wallet/services/sqlite"
+	"github.com/IlnurShafikov/wallet/services/tenant"
+	"github.com/gofrs/uuid"
+	"time"
+)
+
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRepository(db *sql.DB) *SQLiteRepository {
+	return &SQLiteRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteRepository) GetRound(ctx context.Context, roundID models.RoundID) (*models.Round, error) {
+	return getRound(ctx, r.db, roundID)
+}
+
+func (r *SQLiteRepository) CreateBet(ctx context.Context, roundID models.RoundID, round models.Round) error {
+	data, err := json.Marshal(round)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	_, err = r.db.ExecContext(ctx,
+		`INSERT INTO rounds (tenant_id, round_id, user_id, data) VALUES (?, ?, ?, ?)`,
+		tenant.FromContext(ctx), roundID.String(), round.UserID, data,
+	)
+	if err != nil {
+		if sqlite.IsUniqueViolation(err) {
+			return ErrRoundIdAlreadyExists
+		}
+		return fmt.Errorf("insert round: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) SetWin(ctx context.Context, roundID models.RoundID, winTransaction models.Transaction) error {
+	return sqlite.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		round, err := getRound(ctx, tx, roundID)
+		if err != nil {
+			return err
+		}
+
+		if round.Win != nil {
+			return ErrTransactionAlreadyExists
+		}
+
+		if round.Refunded {
+			return ErrRoundRefundAlreadyExists
+		}
+
+		if round.Finished {
+			return ErrRoundFinished
+		}
+
+		round.Win = &winTransaction
+		round.Finished = true
+
+		return updateRound(ctx, tx, roundID, *round)
+	})
+}
+
+func (r *SQLiteRepository) UpdateRound(ctx context.Context, roundID models.RoundID, round models.Round) error {
+	return updateRound(ctx, r.db, roundID, round)
+}
+
+// ListByUser - все раунды пользователя, от старых к новым
+func (r *SQLiteRepository) ListByUser(ctx context.Context, userID models.UserID) ([]UserRound, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT round_id, data FROM rounds WHERE tenant_id = ? AND user_id = ?`,
+		tenant.FromContext(ctx), userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select rounds: %w", err)
+	}
+	defer rows.Close()
+
+	var result []UserRound
+	for rows.Next() {
+		var (
+			id   string
+			data []byte
+		)
+
+		if err = rows.Scan(&id, &data); err != nil {
+			return nil, fmt.Errorf("scan round: %w", err)
+		}
+
+		roundID, err := uuid.FromString(id)
+		if err != nil {
+			return nil, fmt.Errorf("parse round id: %w", err)
+		}
+
+		round := models.Round{}
+		if err = json.Unmarshal(data, &round); err != nil {
+			return nil, fmt.Errorf("unmarshal: %w", err)
+		}
+
+		result = append(result, UserRound{RoundID: roundID, Round: round})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("select rounds: %w", err)
+	}
+
+	sortRounds(result)
+
+	return result, nil
+}
+
+// querier - *sql.DB или *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func getRound(ctx context.Context, q querier, roundID models.RoundID) (*models.Round, error) {
+	var data []byte
+
+	err := q.QueryRowContext(ctx,
+		`SELECT data FROM rounds WHERE tenant_id = ? AND round_id = ?`,
+		tenant.FromContext(ctx), roundID.String(),
+	).Scan(&data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRoundNotFound
+		}
+		return nil, fmt.Errorf("select round: %w", err)
+	}
+
+	round := new(models.Round)
+	if err = json.Unmarshal(data, round); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+
+	return round, nil
+}
+
+func updateRound(ctx context.Context, q querier, roundID models.RoundID, round models.Round) error {
+	data, err := json.Marshal(round)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	res, err := q.ExecContext(ctx,
+		`UPDATE rounds SET user_id = ?, data = ? WHERE tenant_id = ? AND round_id = ?`,
+		round.UserID, data, tenant.FromContext(ctx), roundID.String(),
+	)
+	if err != nil {
+		return fmt.Errorf("update round: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+
+	if affected == 0 {
+		return ErrRoundNotFound
+	}
+
+	return nil
+}
+
+// Settled - раунды читаются страницами по round_id, поэтому удаление
+// прочитанных раундов в fn не сдвигает следующую страницу
+func (r *SQLiteRepository) Settled(
+	ctx context.Context,
+	before time.Time,
+	batchSize int,
+	fn func(rounds []UserRound) error,
+) error {
+	after := uuid.Nil.String()
+
+	for {
+		page, last, err := r.settledPage(ctx, before, after, batchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(page) > 0 {
+			if err = fn(page); err != nil {
+				return err
+			}
+		}
+
+		if last == "" {
+			return nil
+		}
+
+		after = last
+	}
+}
+
+// settledPage - рассчитанные раунды среди следующих limit завершенных или
+// возвращенных раундов после after. last пуст, если страница последняя
+func (r *SQLiteRepository) settledPage(
+	ctx context.Context,
+	before time.Time,
+	after string,
+	limit int,
+) (result []UserRound, last string, err error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT round_id, data FROM rounds WHERE tenant_id = ? AND round_id > ?
+			AND (json_extract(data, '$.finished') OR json_extract(data, '$.refunded'))
+			ORDER BY round_id LIMIT ?`,
+		tenant.FromContext(ctx), after, limit,
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("select rounds: %w", err)
+	}
+	defer rows.Close()
+
+	var count int
+	for rows.Next() {
+		var (
+			id   string
+			data []byte
+		)
+
+		if err = rows.Scan(&id, &data); err != nil {
+			return nil, "", fmt.Errorf("scan round: %w", err)
+		}
+
+		roundID, err := uuid.FromString(id)
+		if err != nil {
+			return nil, "", fmt.Errorf("parse round id: %w", err)
+		}
+
+		round := models.Round{}
+		if err = json.Unmarshal(data, &round); err != nil {
+			return nil, "", fmt.Errorf("unmarshal: %w", err)
+		}
+
+		if isSettled(round, before) {
+			result = append(result, UserRound{RoundID: roundID, Round: round})
+		}
+
+		count++
+		last = id
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("select rounds: %w", err)
+	}
+
+	if count < limit {
+		last = ""
+	}
+
+	return result, last, nil
+}
+
+// DeleteRounds - раунд сравнивается и удаляется в одной транзакции,
+// BEGIN IMMEDIATE не дает изменить его между проверкой и удалением
+func (r *SQLiteRepository) DeleteRounds(ctx context.Context, rounds []UserRound) (int, error) {
+	var deleted int
+
+	err := sqlite.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		deleted = 0
+
+		for _, round := range rounds {
+			current, err := getRound(ctx, tx, round.RoundID)
+			if errors.Is(err, ErrRoundNotFound) {
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if !sameRound(*current, round.Round) {
+				continue
+			}
+
+			_, err = tx.ExecContext(ctx,
+				`DELETE FROM rounds WHERE tenant_id = ? AND round_id = ?`,
+				tenant.FromContext(ctx), round.RoundID.String(),
+			)
+			if err != nil {
+				return fmt.Errorf("delete round: %w", err)
+			}
+
+			deleted++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+func (r *SQLiteRepository) Iterate(ctx context.Context, fn func(round UserRound) error) error {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT round_id, data FROM rounds WHERE tenant_id = ? ORDER BY round_id`,
+		tenant.FromContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("select rounds: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id   string
+			data []byte
+		)
+
+		if err = rows.Scan(&id, &data); err != nil {
+			return fmt.Errorf("scan round: %w", err)
+		}
+
+		roundID, err := uuid.FromString(id)
+		if err != nil {
+			return fmt.Errorf("parse round id: %w", err)
+		}
+
+		round := models.Round{}
+		if err = json.Unmarshal(data, &round); err != nil {
+			return fmt.Errorf("unmarshal: %w", err)
+		}
+
+		if err = fn(UserRound{RoundID: roundID, Round: round}); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("select rounds: %w", err)
+	}
+
+	return nil
+}
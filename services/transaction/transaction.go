@@ -3,6 +3,8 @@ package transaction
 import (
 	"context"
 	"github.com/IlnurShafikov/wallet/models"
+	"sort"
+	"time"
 )
 
 type Repository interface {
@@ -11,3 +13,60 @@ type Repository interface {
 	SetWin(context.Context, models.RoundID, models.Transaction) error
 	UpdateRound(context.Context, models.RoundID, models.Round) error
 }
+
+// Lister - выборка раундов пользователя для выгрузки данных
+type Lister interface {
+	ListByUser(ctx context.Context, userID models.UserID) ([]UserRound, error)
+}
+
+// Iterator - обход всех раундов оператора из контекста
+type Iterator interface {
+	Iterate(ctx context.Context, fn func(round UserRound) error) error
+}
+
+// Archivable - хранилище, из которого рассчитанные раунды переносятся в архив
+type Archivable interface {
+	// Settled - завершенные или возвращенные раунды оператора со ставкой
+	// раньше before, за один проход пачками до batchSize. fn может удалять
+	// переданные раунды, проход от этого не начинается заново
+	Settled(ctx context.Context, before time.Time, batchSize int, fn func(rounds []UserRound) error) error
+	// DeleteRounds - удаляет раунды, уже записанные в архив, если они не
+	// изменились с момента чтения. Возвращает число удаленных раундов
+	DeleteRounds(ctx context.Context, rounds []UserRound) (int, error)
+}
+
+// sameRound - раунд в хранилище совпадает с прочитанным ранее
+func sameRound(a, b models.Round) bool {
+	if (a.Win == nil) != (b.Win == nil) {
+		return false
+	}
+
+	if a.Win != nil && !sameTransaction(*a.Win, *b.Win) {
+		return false
+	}
+
+	return a.UserID == b.UserID && sameTransaction(a.Bet, b.Bet) &&
+		a.Finished == b.Finished && a.Refunded == b.Refunded && a.Kind == b.Kind
+}
+
+func sameTransaction(a, b models.Transaction) bool {
+	return a.Amount == b.Amount && a.TransactionID == b.TransactionID && a.Created.Equal(b.Created)
+}
+
+// isSettled - раунд больше не меняется и может быть перенесен в архив
+func isSettled(round models.Round, before time.Time) bool {
+	return (round.Finished || round.Refunded) && round.Bet.Created.Before(before)
+}
+
+// UserRound - раунд вместе с его идентификатором
+type UserRound struct {
+	RoundID models.RoundID `json:"round_id"`
+	models.Round
+}
+
+// sortRounds - по времени ставки, от старых к новым
+func sortRounds(rounds []UserRound) {
+	sort.Slice(rounds, func(i, j int) bool {
+		return rounds[i].Bet.Created.Before(rounds[j].Bet.Created)
+	})
+}
@@ -0,0 +1,399 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Sync - когда изменения сбрасываются на диск
+type Sync string
+
+const (
+	// SyncAlways - fsync после каждой записи, изменение не теряется даже при сбое ОС
+	SyncAlways Sync = "always"
+	// SyncInterval - fsync раз в Interval, при сбое ОС теряются изменения за интервал
+	SyncInterval Sync = "interval"
+	// SyncNone - сброс на диск остается за ОС
+	SyncNone Sync = "none"
+)
+
+// headerSize - длина и crc32 записи
+const headerSize = 8
+
+// maxRecordSize - защита от чтения мусора как длины записи
+const maxRecordSize = 64 << 20
+
+var (
+	ErrCorrupted = errors.New("wal is corrupted")
+	ErrClosed    = errors.New("wal is closed")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type Options struct {
+	Sync     Sync
+	Interval time.Duration
+	// SnapshotEvery - после скольких записей в журнале делать снимок, 0 - не делать
+	SnapshotEvery int
+}
+
+// Log - журнал изменений одного хранилища: файл <name>.log с записями
+// и файл <name>.snapshot с последним снимком состояния.
+// Запись в файле - длина, crc32 и JSON
+type Log struct {
+	mu       sync.Mutex
+	opts     Options
+	path     string
+	snapshot string
+	file     *os.File
+	size     int64
+	records  int
+	dirty    bool
+	closed   bool
+	done     chan struct{}
+}
+
+// Open - открывает журнал в каталоге dir, каталог создается при необходимости
+func Open(dir, name string, opts Options) (*Log, error) {
+	switch opts.Sync {
+	case SyncAlways, SyncNone:
+	case SyncInterval:
+		if opts.Interval <= 0 {
+			return nil, errors.New("wal sync interval must be positive")
+		}
+	default:
+		return nil, fmt.Errorf("unknown wal sync mode: %s", opts.Sync)
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("os.MkdirAll: %w", err)
+	}
+
+	path := filepath.Join(dir, name+".log")
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile: %w", err)
+	}
+
+	l := &Log{
+		opts:     opts,
+		path:     path,
+		snapshot: filepath.Join(dir, name+".snapshot"),
+		file:     file,
+		done:     make(chan struct{}),
+	}
+
+	if opts.Sync == SyncInterval {
+		go l.syncLoop()
+	}
+
+	return l, nil
+}
+
+// Load - восстанавливает состояние: restore получает снимок, если он есть,
+// apply - записи журнала по порядку. Недописанная последняя запись (сбой во
+// время записи) отбрасывается, запись с неверной контрольной суммой - ErrCorrupted
+func (l *Log) Load(restore func(data []byte) error, apply func(data []byte) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err := l.loadSnapshot(restore)
+	if err != nil {
+		return err
+	}
+
+	if _, err = l.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("file.Seek: %w", err)
+	}
+
+	reader := bufio.NewReader(l.file)
+
+	var offset int64
+	for {
+		data, size, err := readRecord(reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// хвост от прерванной записи, дальше пишем поверх него
+			if err = l.file.Truncate(offset); err != nil {
+				return fmt.Errorf("file.Truncate: %w", err)
+			}
+
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s at offset %d: %w", l.path, offset, err)
+		}
+
+		if err = apply(data); err != nil {
+			return fmt.Errorf("%s at offset %d: %w", l.path, offset, err)
+		}
+
+		offset += size
+		l.records++
+	}
+
+	if _, err = l.file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("file.Seek: %w", err)
+	}
+
+	l.size = offset
+
+	return nil
+}
+
+func (l *Log) loadSnapshot(restore func(data []byte) error) error {
+	file, err := os.Open(l.snapshot)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("os.Open: %w", err)
+	}
+	defer file.Close()
+
+	// снимок переименовывается только после полной записи,
+	// поэтому недописанный снимок - тоже повреждение
+	data, _, err := readRecord(bufio.NewReader(file))
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			err = ErrCorrupted
+		}
+
+		return fmt.Errorf("%s: %w", l.snapshot, err)
+	}
+
+	if err = restore(data); err != nil {
+		return fmt.Errorf("%s: %w", l.snapshot, err)
+	}
+
+	return nil
+}
+
+// Append - дописывает изменение в журнал. Вызывающий применяет изменение
+// только после успешной записи
+func (l *Log) Append(record any) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	framed := frame(data)
+	if _, err = l.file.Write(framed); err != nil {
+		// обрезаем частично записанную запись, чтобы следующие записи не легли после нее
+		l.rollback()
+
+		return fmt.Errorf("file.Write: %w", err)
+	}
+
+	if l.opts.Sync == SyncAlways {
+		if err = l.file.Sync(); err != nil {
+			// вызывающий не применит изменение, значит и в журнале его быть не должно
+			l.rollback()
+
+			return fmt.Errorf("file.Sync: %w", err)
+		}
+	} else {
+		l.dirty = true
+	}
+
+	l.size += int64(len(framed))
+	l.records++
+
+	return nil
+}
+
+// rollback - обрезает журнал до размера перед неудачной записью
+func (l *Log) rollback() {
+	_ = l.file.Truncate(l.size)
+	_, _ = l.file.Seek(l.size, io.SeekStart)
+}
+
+// NeedSnapshot - набралось достаточно записей для нового снимка
+func (l *Log) NeedSnapshot() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.opts.SnapshotEvery > 0 && l.records >= l.opts.SnapshotEvery
+}
+
+// Snapshot - атомарно сохраняет снимок состояния и очищает журнал.
+// Если сбой случится между заменой снимка и очисткой журнала, записи журнала
+// применятся к новому снимку повторно, поэтому записи должны быть идемпотентны
+func (l *Log) Snapshot(state any) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	tmp := l.snapshot + ".tmp"
+	if err = writeFile(tmp, frame(data)); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, l.snapshot); err != nil {
+		return fmt.Errorf("os.Rename: %w", err)
+	}
+
+	if err = syncDir(filepath.Dir(l.snapshot)); err != nil {
+		return err
+	}
+
+	if err = l.file.Truncate(0); err != nil {
+		return fmt.Errorf("file.Truncate: %w", err)
+	}
+
+	if _, err = l.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("file.Seek: %w", err)
+	}
+
+	if err = l.file.Sync(); err != nil {
+		return fmt.Errorf("file.Sync: %w", err)
+	}
+
+	l.size = 0
+	l.records = 0
+	l.dirty = false
+
+	return nil
+}
+
+// Close - сбрасывает журнал на диск и закрывает файл
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil
+	}
+
+	l.closed = true
+	close(l.done)
+
+	err := l.file.Sync()
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (l *Log) syncLoop() {
+	ticker := time.NewTicker(l.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			if l.dirty && !l.closed {
+				// ошибка повторится на следующем тике или при Close
+				if l.file.Sync() == nil {
+					l.dirty = false
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+func frame(data []byte) []byte {
+	buf := make([]byte, headerSize+len(data))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.Checksum(data, crcTable))
+	copy(buf[headerSize:], data)
+
+	return buf
+}
+
+// readRecord - io.EOF в конце файла, io.ErrUnexpectedEOF на недописанной записи
+func readRecord(reader io.Reader) ([]byte, int64, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, 0, err
+	}
+
+	size := binary.LittleEndian.Uint32(header[0:4])
+	if size > maxRecordSize {
+		return nil, 0, ErrCorrupted
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, 0, err
+	}
+
+	if crc32.Checksum(data, crcTable) != binary.LittleEndian.Uint32(header[4:8]) {
+		return nil, 0, ErrCorrupted
+	}
+
+	return data, int64(headerSize + size), nil
+}
+
+func writeFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile: %w", err)
+	}
+
+	if _, err = file.Write(data); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("file.Write: %w", err)
+	}
+
+	if err = file.Sync(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("file.Sync: %w", err)
+	}
+
+	return file.Close()
+}
+
+// syncDir - фиксирует переименование файла в каталоге
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("os.Open: %w", err)
+	}
+	defer file.Close()
+
+	if err = file.Sync(); err != nil {
+		return fmt.Errorf("dir.Sync: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package wal
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type record struct {
+	Key   string `json:"key"`
+	Value int    `json:"value"`
+}
+
+// load - состояние после восстановления из журнала
+func load(t *testing.T, log *Log) (map[string]int, error) {
+	state := make(map[string]int)
+
+	err := log.Load(
+		func(data []byte) error {
+			return json.Unmarshal(data, &state)
+		},
+		func(data []byte) error {
+			var r record
+			if err := json.Unmarshal(data, &r); err != nil {
+				return err
+			}
+
+			state[r.Key] = r.Value
+
+			return nil
+		},
+	)
+
+	return state, err
+}
+
+func TestOpen_SyncMode(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := Open(dir, "test", Options{Sync: "sometimes"})
+	assert.Error(t, err)
+
+	_, err = Open(dir, "test", Options{Sync: SyncInterval})
+	assert.Error(t, err)
+
+	log, err := Open(dir, "test", Options{Sync: SyncInterval, Interval: time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, log.Append(record{Key: "a", Value: 1}))
+	require.NoError(t, log.Close())
+
+	assert.ErrorIs(t, log.Append(record{Key: "a", Value: 2}), ErrClosed)
+}
+
+func TestLog_Replay(t *testing.T) {
+	dir := t.TempDir()
+
+	log, err := Open(dir, "test", Options{Sync: SyncAlways})
+	require.NoError(t, err)
+
+	state, err := load(t, log)
+	require.NoError(t, err)
+	assert.Empty(t, state)
+
+	require.NoError(t, log.Append(record{Key: "a", Value: 1}))
+	require.NoError(t, log.Append(record{Key: "b", Value: 2}))
+	require.NoError(t, log.Append(record{Key: "a", Value: 3}))
+	require.NoError(t, log.Close())
+
+	log, err = Open(dir, "test", Options{Sync: SyncAlways})
+	require.NoError(t, err)
+	defer log.Close()
+
+	state, err = load(t, log)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 3, "b": 2}, state)
+}
+
+func TestLog_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	log, err := Open(dir, "test", Options{Sync: SyncNone, SnapshotEvery: 2})
+	require.NoError(t, err)
+
+	_, err = load(t, log)
+	require.NoError(t, err)
+
+	require.NoError(t, log.Append(record{Key: "a", Value: 1}))
+	assert.False(t, log.NeedSnapshot())
+
+	require.NoError(t, log.Append(record{Key: "b", Value: 2}))
+	assert.True(t, log.NeedSnapshot())
+
+	require.NoError(t, log.Snapshot(map[string]int{"a": 1, "b": 2}))
+	assert.False(t, log.NeedSnapshot())
+
+	info, err := os.Stat(filepath.Join(dir, "test.log"))
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+
+	require.NoError(t, log.Append(record{Key: "b", Value: 5}))
+	require.NoError(t, log.Close())
+
+	log, err = Open(dir, "test", Options{Sync: SyncNone})
+	require.NoError(t, err)
+	defer log.Close()
+
+	state, err := load(t, log)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 1, "b": 5}, state)
+}
+
+// недописанная запись в конце отбрасывается, следующие записи пишутся на ее место
+func TestLog_TornTail(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.log")
+
+	log, err := Open(dir, "test", Options{Sync: SyncAlways})
+	require.NoError(t, err)
+	require.NoError(t, log.Append(record{Key: "a", Value: 1}))
+	require.NoError(t, log.Append(record{Key: "b", Value: 2}))
+	require.NoError(t, log.Close())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-3))
+
+	log, err = Open(dir, "test", Options{Sync: SyncAlways})
+	require.NoError(t, err)
+
+	state, err := load(t, log)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 1}, state)
+
+	require.NoError(t, log.Append(record{Key: "c", Value: 3}))
+	require.NoError(t, log.Close())
+
+	log, err = Open(dir, "test", Options{Sync: SyncAlways})
+	require.NoError(t, err)
+	defer log.Close()
+
+	state, err = load(t, log)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 1, "c": 3}, state)
+}
+
+func TestLog_Corrupted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.log")
+
+	log, err := Open(dir, "test", Options{Sync: SyncAlways})
+	require.NoError(t, err)
+	require.NoError(t, log.Append(record{Key: "a", Value: 1}))
+	require.NoError(t, log.Append(record{Key: "b", Value: 2}))
+	require.NoError(t, log.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// портим значение в первой записи
+	data[headerSize+len(`{"key":"a","value":`)] = '7'
+	require.NoError(t, os.WriteFile(path, data, 0o640))
+
+	log, err = Open(dir, "test", Options{Sync: SyncAlways})
+	require.NoError(t, err)
+	defer log.Close()
+
+	_, err = load(t, log)
+	assert.ErrorIs(t, err, ErrCorrupted)
+
+	// поврежденный снимок тоже не читается
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "test.snapshot"), []byte{1, 2, 3}, 0o640))
+
+	_, err = load(t, log)
+	assert.ErrorIs(t, err, ErrCorrupted)
+}